@@ -0,0 +1,396 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"flag"
+	"fmt"
+	"go/version"
+	"io"
+	"log"
+	"math"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/cristaloleg/go-gen-syncmap/internal/gen"
+)
+
+// workloadTest is the benchmark of a workload, written as a test extension
+// of the template, with the share of loads to fill in.
+const workloadTest = `package syncmap
+
+import (
+	"math/rand"
+	"sync/atomic"
+	"testing"
+)
+
+// readPercent is the share of the operations of BenchmarkWorkload that are
+// loads rather than stores.
+const readPercent = %d
+
+// workloadKeys is the number of keys BenchmarkWorkload operates on.
+const workloadKeys = %d
+
+func BenchmarkWorkload(b *testing.B) {
+	var m Map
+	keys := make([]KeyT, workloadKeys)
+	for i := range keys {
+		keys[i] = newKeyT(i)
+		m.Store(keys[i], newValueT(i))
+	}
+	value := newValueT(workloadKeys)
+
+	b.ResetTimer()
+
+	var seed int64
+	b.RunParallel(func(pb *testing.PB) {
+		r := rand.New(rand.NewSource(atomic.AddInt64(&seed, 1)))
+		for pb.Next() {
+			k := keys[r.Intn(workloadKeys)]
+			if r.Intn(100) < readPercent {
+				m.Load(k)
+			} else {
+				m.Store(k, value)
+			}
+		}
+	})
+}
+`
+
+// workloadKeys is the number of keys of the workload benchmark.
+const workloadKeys = 1 << 10
+
+// workloadPattern matches the workloads bench accepts.
+var workloadPattern = regexp.MustCompile(`^read([0-9]{1,3})$`)
+
+func benchUsage(fs *flag.FlagSet) func() {
+	return func() {
+		fmt.Fprintf(os.Stderr, "Usage of go-gen-syncmap bench:\n")
+		fmt.Fprintf(os.Stderr, "\tgo-gen-syncmap bench -key=KeyType -value=ValueType [-workload=read90] [flags]\n")
+		fmt.Fprintf(os.Stderr, "Flags:\n")
+		fs.PrintDefaults()
+	}
+}
+
+// benchOptions are the flags of the bench subcommand.
+type benchOptions struct {
+	key, value     string
+	keyFac, valFac string
+	workload       string
+	reads          int // percentage of loads in the workload
+	impls          []string
+	benchtime      string
+	count          int
+	template       string
+	keep, verbose  bool
+}
+
+// benchMain runs the bench subcommand with the arguments args.
+func benchMain(args []string) {
+	var o benchOptions
+	fs := flag.NewFlagSet("bench", flag.ExitOnError)
+	fs.StringVar(&o.key, "key", "", "key type `expression`, such as string or *Key")
+	fs.StringVar(&o.value, "value", "", "value type `expression`, such as int or *Value")
+	fs.StringVar(&o.keyFac, "key-factory", "", "Go `expression` of the i-th key, such as UserID(i)")
+	fs.StringVar(&o.valFac, "value-factory", "", "Go `expression` of the i-th value, such as &User{ID: UserID(i)}")
+	fs.StringVar(&o.workload, "workload", "read90", "`workload` to recommend an implementation for: readN, where N is the percentage of loads among loads and stores")
+	impls := fs.String("impl", strings.Join(gen.Impls, ","), "comma-separated `implementations` to compare")
+	fs.StringVar(&o.benchtime, "benchtime", "1s", "run each benchmark for `duration`, or Nx times, as go test does")
+	fs.IntVar(&o.count, "count", 5, "run each benchmark `n` times")
+	fs.StringVar(&o.template, "template", "", "`path` of a template package directory to use instead of the embedded one")
+	fs.BoolVar(&o.keep, "keep", false, "keep the generated module and print its path")
+	fs.BoolVar(&o.verbose, "v", false, "print the output of go test")
+	fs.Usage = benchUsage(fs)
+	fs.Parse(args)
+	if fs.NArg() > 0 || o.key == "" || o.value == "" {
+		fs.Usage()
+		os.Exit(2)
+	}
+	m := workloadPattern.FindStringSubmatch(o.workload)
+	if m != nil {
+		o.reads, _ = strconv.Atoi(m[1])
+	}
+	if m == nil || o.reads > 100 {
+		log.Printf("invalid workload %q: must be readN, with N at most 100", o.workload)
+		fs.Usage()
+		os.Exit(2)
+	}
+	for _, impl := range strings.Split(*impls, ",") {
+		if impl = strings.TrimSpace(impl); impl != "" {
+			o.impls = append(o.impls, impl)
+		}
+	}
+	if err := runBench(o); err != nil {
+		log.Fatal(err)
+	}
+}
+
+// runBench generates a map for each implementation of o into a temporary
+// module, runs their benchmarks, and prints how they compare and which
+// suits the workload.
+func runBench(o benchOptions) error {
+	goVersion, err := toolchainVersion()
+	if err != nil {
+		return err
+	}
+	dir, err := os.MkdirTemp("", "syncmapbench")
+	if err != nil {
+		return err
+	}
+	if o.keep {
+		log.Printf("generated module in %s", dir)
+	} else {
+		defer os.RemoveAll(dir)
+	}
+	ext := filepath.Join(dir, "workload_test.go")
+	mod := filepath.Join(dir, "mod")
+	if err := setupBenchModule(dir, mod, goVersion, fmt.Sprintf(workloadTest, o.reads, workloadKeys)); err != nil {
+		return err
+	}
+	for _, impl := range o.impls {
+		c := gen.Config{
+			Package:      impl,
+			Key:          o.key,
+			Value:        o.value,
+			KeyFactory:   o.keyFac,
+			ValueFactory: o.valFac,
+			Impl:         impl,
+			GoVersion:    goVersion,
+			Benchmarks:   true,
+			Extensions:   []string{ext},
+		}
+		// The types are resolved from the current directory, whose module
+		// the generated one uses.
+		files, err := generate([]gen.Config{c}, o.template, "")
+		if err != nil {
+			return fmt.Errorf("generating %s: %v", impl, err)
+		}
+		if err := os.Mkdir(filepath.Join(mod, impl), 0o755); err != nil {
+			return err
+		}
+		if err := writeFiles(filepath.Join(mod, impl, "map_syncmap.go"), files); err != nil {
+			return err
+		}
+	}
+
+	cmd := exec.Command("go", "test", "-run=^$", "-bench=.", "-benchtime="+o.benchtime, "-count="+strconv.Itoa(o.count), "./...")
+	cmd.Dir = mod
+	cmd.Env = benchEnv()
+	cmd.Stderr = os.Stderr
+	var out bytes.Buffer
+	cmd.Stdout = &out
+	if o.verbose {
+		cmd.Stdout = io.MultiWriter(&out, os.Stdout)
+	}
+	if err := cmd.Run(); err != nil {
+		if !o.verbose {
+			os.Stdout.Write(out.Bytes())
+		}
+		return fmt.Errorf("running the benchmarks: %v", err)
+	}
+
+	results := parseBenchmarks(&out)
+	fmt.Printf("workload %s: %d%% loads and %d%% stores of %d keys, map[%s]%s\n\n", o.workload, o.reads, 100-o.reads, workloadKeys, o.key, o.value)
+	printComparison(os.Stdout, results, o.impls)
+	fmt.Println()
+	fmt.Println(recommend(results["Workload"], o.impls, o.workload))
+	return nil
+}
+
+// toolchainVersion returns the version of the go command, such as "1.23.4",
+// for the generated maps to use what it supports, or an empty string for
+// development versions.
+func toolchainVersion() (string, error) {
+	out, err := exec.Command("go", "env", "GOVERSION").Output()
+	if err != nil {
+		return "", fmt.Errorf("go env GOVERSION: %v", err)
+	}
+	v := strings.TrimSpace(string(out))
+	if !version.IsValid(v) {
+		return "", nil
+	}
+	return strings.TrimPrefix(v, "go"), nil
+}
+
+// setupBenchModule writes to dir the workload test extension src, and the
+// module mod the maps are generated into, for go to run at goVersion. If the
+// current directory is in a module, mod is in a workspace with it, so that
+// the key and value types may come from its packages.
+func setupBenchModule(dir, mod, goVersion, src string) error {
+	if err := os.WriteFile(filepath.Join(dir, "workload_test.go"), []byte(src), 0o644); err != nil {
+		return err
+	}
+	if err := os.Mkdir(mod, 0o755); err != nil {
+		return err
+	}
+	lang := ""
+	if goVersion != "" {
+		lang = "go " + strings.TrimPrefix(version.Lang("go"+goVersion), "go") + "\n"
+	}
+	if err := os.WriteFile(filepath.Join(mod, "go.mod"), []byte("module syncmapbench\n\n"+lang), 0o644); err != nil {
+		return err
+	}
+	out, err := exec.Command("go", "env", "GOMOD").Output()
+	if err != nil {
+		return fmt.Errorf("go env GOMOD: %v", err)
+	}
+	gomod := strings.TrimSpace(string(out))
+	if gomod == "" || gomod == os.DevNull {
+		return nil
+	}
+	work := fmt.Sprintf("%s\nuse (\n\t.\n\t%s\n)\n", lang, strconv.Quote(filepath.Dir(gomod)))
+	return os.WriteFile(filepath.Join(mod, "go.work"), []byte(work), 0o644)
+}
+
+// benchEnv returns the environment to run the benchmarks in: that of the
+// process, without a -mod flag in GOFLAGS, which the workspace of the module
+// may not accept.
+func benchEnv() []string {
+	var flags []string
+	for _, f := range strings.Fields(os.Getenv("GOFLAGS")) {
+		if !strings.HasPrefix(f, "-mod=") {
+			flags = append(flags, f)
+		}
+	}
+	return append(os.Environ(), "GOFLAGS="+strings.Join(flags, " "))
+}
+
+// benchLine matches a benchmark result of go test, capturing the name of the
+// benchmark without its GOMAXPROCS suffix and its time per operation.
+var benchLine = regexp.MustCompile(`^Benchmark(\S+?)(?:-[0-9]+)?\s+[0-9]+\s+([0-9.]+) ns/op`)
+
+// parseBenchmarks returns the times per operation in ns reported by go test
+// in r, by benchmark and then by implementation, which is the last element
+// of the package path.
+func parseBenchmarks(r io.Reader) map[string]map[string][]float64 {
+	results := make(map[string]map[string][]float64)
+	impl := ""
+	s := bufio.NewScanner(r)
+	for s.Scan() {
+		line := s.Text()
+		if p, ok := strings.CutPrefix(line, "pkg: "); ok {
+			impl = path.Base(strings.TrimSpace(p))
+			continue
+		}
+		m := benchLine.FindStringSubmatch(line)
+		if m == nil {
+			continue
+		}
+		ns, err := strconv.ParseFloat(m[2], 64)
+		if err != nil {
+			continue
+		}
+		if results[m[1]] == nil {
+			results[m[1]] = make(map[string][]float64)
+		}
+		results[m[1]][impl] = append(results[m[1]][impl], ns)
+	}
+	return results
+}
+
+// stats returns the mean of samples, and their spread around it as a
+// fraction of it, like the ± of benchstat.
+func stats(samples []float64) (mean, spread float64) {
+	lo, hi := math.Inf(1), math.Inf(-1)
+	for _, s := range samples {
+		mean += s
+		lo = math.Min(lo, s)
+		hi = math.Max(hi, s)
+	}
+	mean /= float64(len(samples))
+	if mean == 0 {
+		return 0, 0
+	}
+	return mean, math.Max(hi-mean, mean-lo) / mean
+}
+
+// formatNs formats a time in ns with three significant digits.
+func formatNs(ns float64) string {
+	for _, unit := range [...]struct {
+		name string
+		ns   float64
+	}{{"s", 1e9}, {"ms", 1e6}, {"µs", 1e3}} {
+		if ns >= unit.ns {
+			return strconv.FormatFloat(ns/unit.ns, 'g', 3, 64) + unit.name
+		}
+	}
+	return strconv.FormatFloat(ns, 'g', 3, 64) + "ns"
+}
+
+// printComparison writes a table of results to w, with a row per benchmark,
+// the workload first, and a column per implementation of impls. Benchmarks
+// an implementation skipped are marked with a dash.
+func printComparison(w io.Writer, results map[string]map[string][]float64, impls []string) {
+	names := make([]string, 0, len(results))
+	for name := range results {
+		if name != "Workload" {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	if _, ok := results["Workload"]; ok {
+		names = append([]string{"Workload"}, names...)
+	}
+
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprint(tw, "time/op\t")
+	for _, impl := range impls {
+		fmt.Fprintf(tw, "%s\t", impl)
+	}
+	fmt.Fprintln(tw)
+	for _, name := range names {
+		fmt.Fprintf(tw, "%s\t", name)
+		for _, impl := range impls {
+			samples := results[name][impl]
+			if len(samples) == 0 {
+				fmt.Fprint(tw, "-\t")
+				continue
+			}
+			mean, spread := stats(samples)
+			fmt.Fprintf(tw, "%s ±%.0f%%\t", formatNs(mean), spread*100)
+		}
+		fmt.Fprintln(tw)
+	}
+	tw.Flush()
+}
+
+// recommend returns the recommendation for workload given the results of
+// its benchmark by implementation: the fastest of impls, unless the default
+// implementation, which has the full API, is within noise of it.
+func recommend(results map[string][]float64, impls []string, workload string) string {
+	type result struct {
+		impl         string
+		mean, spread float64
+	}
+	var ranked []result
+	for _, impl := range impls {
+		if samples := results[impl]; len(samples) > 0 {
+			mean, spread := stats(samples)
+			ranked = append(ranked, result{impl, mean, spread})
+		}
+	}
+	if len(ranked) == 0 {
+		return "no implementation ran the workload"
+	}
+	sort.SliceStable(ranked, func(i, j int) bool { return ranked[i].mean < ranked[j].mean })
+	best := ranked[0]
+	if len(ranked) == 1 {
+		return fmt.Sprintf("recommendation: %s, the only implementation benchmarked", best.impl)
+	}
+	for _, r := range ranked[1:] {
+		// Overlapping intervals are as fast as the benchmarks can tell.
+		if r.impl == gen.Impls[0] && r.mean*(1-r.spread) <= best.mean*(1+best.spread) {
+			return fmt.Sprintf("recommendation: %s, within noise of %s on %s, for its full API", r.impl, best.impl, workload)
+		}
+	}
+	next := ranked[1]
+	return fmt.Sprintf("recommendation: %s, %.2fx as fast as %s, the runner-up, on %s", best.impl, next.mean/best.mean, next.impl, workload)
+}
@@ -0,0 +1,905 @@
+// Command go-gen-syncmap generates a sync.Map specialized for concrete key
+// and value types.
+//
+// Usage:
+//
+//	go-gen-syncmap -key=KeyType -value=ValueType [-name=Map] [-package=name] [-output=file]
+//	go-gen-syncmap -type=Name:KeyType:ValueType [-type=...] [-package=name] [-output=file]
+//	go-gen-syncmap -config=syncmaps.yaml
+//	go-gen-syncmap [flags] packages
+//	go-gen-syncmap bench -key=KeyType -value=ValueType [-workload=read90]
+//
+// It is typically invoked by a go:generate directive:
+//
+//	//go:generate go-gen-syncmap -key=string -value=*User
+//
+// in which case the package name defaults to the package of the directive.
+//
+// Given package directories, or trees such as ./..., it generates the maps
+// requested by //syncmap:generate comments in their Go files, next to the
+// comments:
+//
+//	//syncmap:generate name=UserCache key=UserID value=*User
+//
+// See gen.ParseDirectives for the fields a directive accepts.
+//
+// With -build, the generated file carries a build constraint. With -go, it
+// is only built by Go versions since the given one, and uses the features
+// they provide, such as iterators for Go 1.23 or later.
+//
+// With -extension, the declarations of a Go file written like the files of
+// the template package, such as methods of Map in terms of KeyT and ValueT,
+// are added to the generated maps, so that teams can give all their maps
+// methods of their own without forking the template.
+//
+// With -tests, the portable tests of the template are generated along with
+// the map, into a file named after the output with a _test suffix. They
+// build keys and values with -key-factory and -value-factory, Go expressions
+// in terms of i int, which default to conversions for numeric types and to
+// strconv.Itoa(i) for strings. With -benchmarks, so are the benchmarks of
+// the template, which are named alike for every -impl, so that benchstat
+// can compare the implementations for the map's own types. With
+// -property-tests, so are property tests checking invariants of the map
+// under randomized concurrent workloads, best run with -race. With
+// -examples, so are runnable examples of the map's methods, which the
+// documentation of its package then shows. With -linearizability, so is a
+// test checking that histories of concurrent operations on the map are
+// linearizable.
+//
+// With -split, each output is split into a file per concern, that is, per
+// template file: the maps are declared in the output itself, and their JSON
+// methods, say, in the file named after it with a _json suffix.
+//
+// With -dry-run, the generated code is printed instead of written. With
+// -diff, nothing is written either, but the differences between the files on
+// disk and the generated code are printed, and the exit status is 1 if there
+// are any, which suits checking in CI that generated maps are up to date.
+//
+// With -watch, the tool keeps running after generating, and generates again
+// whenever the manifest, the template, or a Go file of a generated package
+// changes, such as the one annotated with the go:generate directive.
+//
+// The bench subcommand helps choose an implementation: it generates a map of
+// the given types with each of them into a temporary module, runs their
+// benchmarks, and prints how they compare, and which suits the workload
+// given by -workload=readN, where N is the percentage of loads among loads
+// and stores:
+//
+//	go-gen-syncmap bench -key=string -value=int64 -workload=read90
+//
+// Types of the module of the current directory may be used.
+//
+// With -template=file, the map is generated from a custom text/template
+// instead of the template package; see gen.TemplateData for the variables
+// it's executed with.
+//
+// The map uses sync.Map's algorithm by default. With -impl, it can instead be
+// guarded by a single sync.RWMutex (rwmutex), split into independently locked
+// shards (sharded), held in one table whose buckets are guarded by a few
+// locks (striped), copied by batches of writes (cow), held in a copy-on-write
+// persistent HAMT whose root every write swaps, serializing writes (ctrie),
+// or split into shards of open-addressing tables (robinhood) or of Swiss
+// tables (swiss); these only have the core API of sync.Map, plus Len. With
+// -padded, the shards of a map, and the fields its readers and writers
+// contend on, are padded to separate cache lines, which costs memory but
+// stops cores writing one from slowing down those reading another. With
+// -ttl, a map of the default implementation has
+// StoreWithTTL, storing values that expire after a duration, and then act as
+// deleted. With -loader, it has WithLoader, setting a function that loads the
+// values of the keys loads miss, such as from a database, and GetE, which
+// returns its errors; concurrent misses of a key share one call of the
+// function. With -backend, it has WithBackend too, making it a cache of a
+// store that it reads through by the loader and writes through to, or
+// behind, by a goroutine, with WithWriteBehind, and StoreE and DeleteE, which
+// return the errors of the store. With -metrics, it has Metrics, returning
+// the numbers of hits, misses, stores, deletions, evictions, and loader
+// errors, which it counts atomically, and with -prometheus too, Collector, a
+// prometheus.Collector exporting them, or with -otel, WithMeter and
+// WithTracer, reporting them and the calls of its loader to OpenTelemetry.
+// With -redis, the map comes with a Redis type, New<Name>Redis returning a
+// map of the same keys and values held by a Redis server, with the Load,
+// Store, LoadOrStore, Delete, and Range methods of the map. With
+// -maxentries=n, a map of the default implementation holds at most n entries,
+// and storing a new key into a full map evicts the entries used least
+// recently, which loads record without locking, or with -eviction=tinylfu,
+// those used least often. With -cost and -maxcost, it evicts entries until
+// its values cost at most the budget given by -maxcost, as computed by the
+// function given by -cost, such as the length of byte buffers:
+//
+//	go-gen-syncmap -key=string -value=[]byte -cost=github.com/acme/blob.Size -maxcost=1073741824
+//
+// With -hash and -equal, functions of types func(maphash.Seed, Key) uint64
+// and func(a, b Key) bool, the keys of a striped, ctrie, robinhood, or swiss
+// map are hashed and compared by them rather than by ==, so that they needn't
+// be comparable, or may be normalized, as case-insensitive strings are:
+//
+//	go-gen-syncmap -key=[]byte -value=int -nojson -impl=swiss \
+//		-hash=github.com/acme/model.HashBytes -equal=bytes.Equal
+//
+// With -kind=pool, a typed sync.Pool of pointers to the -value type is
+// generated instead of a map, with Get and Put methods needing no type
+// assertions, and the options WithNew, setting the function allocating its
+// values, and WithReset, setting one resetting those it's given back:
+//
+//	go-gen-syncmap -kind=pool -name=Buffers -value=bytes.Buffer
+//
+// With -kind=set, a concurrent set of the -key type is generated, with the
+// algorithm of the map but no values, and the methods Add, Remove, Contains,
+// Len, Range, Union, and Intersect:
+//
+//	go-gen-syncmap -kind=set -name=Hosts -key=string
+//
+// With -kind=countermap, a map of int64 counters of the -key type is
+// generated, whose Add, Inc, and Load methods are atomic operations on the
+// counter of a key once it exists, and whose Snapshot method copies them:
+//
+//	go-gen-syncmap -kind=countermap -name=Requests -key=string
+//
+// With -kind=multimap, a map of the -key type to slices of values of the
+// -value type is generated, whose Append and RemoveValue methods replace the
+// values of a key with a copy under a lock of the key, so that LoadAll and
+// Range read them without locking:
+//
+//	go-gen-syncmap -kind=multimap -name=Subscribers -key=string -value=int64
+//
+// With -kind=bimap, a one-to-one map between the -key and -value types is
+// generated, indexing its pairs both ways under one lock, with the methods
+// StorePair, LoadByKey, LoadByValue, DeleteByEither, Len, and Range:
+//
+//	go-gen-syncmap -kind=bimap -name=Names -key=UserID -value=string
+//
+// With -mode=generic, the map isn't specialized from the template, but is
+// a thin wrapper over the generic package of go-gen-syncmap, an alias of its
+// Map type instantiated for the key and value types, and constructors, which
+// needn't be regenerated when the template changes; the module must require
+// go-gen-syncmap, and Go 1.24. Programs may also import the generic package
+// without generating anything:
+//
+//	go-gen-syncmap -name=UserCache -key=UserID -value=*User -mode=generic
+//
+// Types of other packages are qualified by their import path, and the
+// generated file imports them:
+//
+//	go-gen-syncmap -key=github.com/acme/ids.UserID -value=*github.com/acme/model.User
+//
+// Without -key and -value, the map is inferred from the type declaration
+// following the directive, either an instantiation of syncmap.Map, kept in
+// a file built only with the "generate" tag:
+//
+//	//go:build generate
+//
+//	//go:generate go-gen-syncmap
+//	type UserCache = syncmap.Map[UserID, *User]
+//
+// or a pair of type aliases named after the map:
+//
+//	//go:generate go-gen-syncmap
+//	type (
+//		UserCacheKey   = UserID
+//		UserCacheValue = *User
+//	)
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/cristaloleg/go-gen-syncmap/internal/gen"
+)
+
+var (
+	key     = flag.String("key", "", "key type `expression`, such as string or *Key")
+	value   = flag.String("value", "", "value type `expression`, such as int or *Value")
+	pkg     = flag.String("package", os.Getenv("GOPACKAGE"), "package `name` of the generated file; defaults to $GOPACKAGE")
+	name    = flag.String("name", "", "`name` of the generated map type; defaults to Map")
+	unexp   = flag.Bool("unexported", false, "make the generated map type and its helpers unexported, lowering the first letter of -name")
+	output  = flag.String("output", "", "output `file` name; defaults to <name>_syncmap.go in lower case")
+	noJSON  = flag.Bool("nojson", false, "don't generate MarshalJSON and UnmarshalJSON")
+	noCmp   = flag.Bool("nocompare", false, "don't generate the methods comparing values, for values that aren't comparable")
+	padded  = flag.Bool("padded", false, "pad shards and contended fields to separate cache lines, at the cost of memory")
+	ttl     = flag.Bool("ttl", false, "generate StoreWithTTL, DeleteExpired, and a janitor deleting expired values, for values that expire")
+	loader  = flag.Bool("loader", false, "generate WithLoader and GetE, loading the values of missing keys with one call per key")
+	backend = flag.Bool("backend", false, "generate WithBackend, StoreE, and DeleteE, caching a store the map reads and writes through")
+	metrics = flag.Bool("metrics", false, "generate Metrics, counting hits, misses, stores, deletes, evictions, and loader errors")
+	prom    = flag.Bool("prometheus", false, "with -metrics, generate Collector, a prometheus.Collector exporting the metrics")
+	otel    = flag.Bool("otel", false, "with -metrics, generate WithMeter and WithTracer, reporting the metrics and loader calls to OpenTelemetry")
+	redis   = flag.Bool("redis", false, "generate a Redis type too, with the methods of the map, holding its keys and values in Redis")
+	maxEnt  = flag.Int("maxentries", 0, "bound the map to `n` entries, evicting the least recently used ones to store new keys")
+	evict   = flag.String("eviction", "", "eviction `policy` of a map bounded by -maxentries: lru, or tinylfu for scan resistance")
+	cost    = flag.String("cost", "", "`function` of type func(Value) int64 giving the cost of a value, such as its size, for -maxcost")
+	maxCost = flag.Int64("maxcost", 0, "evict entries until the values of the map cost at most `n` in total, by -cost")
+	tests   = flag.Bool("tests", false, "generate the portable tests of the template along with the map, into a _test.go file")
+	benches = flag.Bool("benchmarks", false, "generate the benchmarks of the template along with the map, into a _test.go file")
+	props   = flag.Bool("property-tests", false, "generate property tests of the map under randomized concurrent workloads, into a _test.go file")
+	exmpls  = flag.Bool("examples", false, "generate runnable examples of the map, shown by its documentation, into a _test.go file")
+	linear  = flag.Bool("linearizability", false, "generate a test checking that concurrent histories of the map are linearizable, into a _test.go file")
+	hash    = flag.String("hash", "", "hash `function` of keys, such as github.com/acme/model.HashKey, of type func(maphash.Seed, Key) uint64")
+	equal   = flag.String("equal", "", "equality `function` of keys agreeing with -hash, such as github.com/acme/model.EqualKey")
+	keyFac  = flag.String("key-factory", "", "Go `expression` of the i-th key of the tests, such as UserID(i)")
+	valFac  = flag.String("value-factory", "", "Go `expression` of the i-th value of the tests, such as &User{ID: UserID(i)}")
+	tags    = flag.String("build", "", "build constraint `expression` of the generated file, such as !tinygo")
+	goVer   = flag.String("go", "", "minimum Go `version` of the generated file, selecting the features it may use")
+	kind    = flag.String("kind", "map", "`kind` of type to generate: "+strings.Join(gen.Kinds, ", ")+", of which pool has no -key, and set and countermap no -value")
+	impl    = flag.String("impl", "syncmap", "backing `implementation`: "+strings.Join(gen.Impls, ", ")+", of which ctrie is a copy-on-write persistent HAMT serializing writes")
+	mode    = flag.String("mode", "specialized", "generation `mode`: specialized from the template, or generic, as a wrapper over "+gen.GenericPackage)
+	dryRun  = flag.Bool("dry-run", false, "print the generated code to standard output instead of writing files")
+	watch   = flag.Bool("watch", false, "keep running, and regenerate whenever the manifest, template, or package sources change")
+	diff    = flag.Bool("diff", false, "don't write files; print a diff and exit with status 1 if they're out of date")
+	split   = flag.Bool("split", false, "split each output by concern into files named after it, such as map_syncmap_json.go")
+	noFmt   = flag.Bool("noformat", false, "write the generated code without formatting it or pruning its imports")
+	tmplDir = flag.String("template", "", "`path` of a template package directory to use instead of the embedded one, or of a custom text/template file")
+	config  = flag.String("config", "", "generate the maps listed in the YAML or TOML manifest `file`")
+	types   typeList
+	exts    stringList
+)
+
+func init() {
+	flag.Var(&types, "type", "generate a map `Name:Key:Value` into the output file; may be repeated")
+	flag.Var(&exts, "extension", "add the declarations of the Go `file` to the generated maps; may be repeated")
+}
+
+// runFlags are the flags setting how maps are generated rather than
+// describing them. Every other flag describes maps, which package patterns
+// and -config do themselves, so they can't be combined with it.
+var runFlags = map[string]bool{
+	"package":  true,
+	"template": true,
+	"config":   true,
+	"dry-run":  true,
+	"diff":     true,
+	"watch":    true,
+	"split":    true,
+	"noformat": true,
+}
+
+// mapFlag returns the name of a flag describing maps set on the command
+// line, or "" if there is none.
+func mapFlag() string {
+	var name string
+	flag.Visit(func(f *flag.Flag) {
+		if name == "" && !runFlags[f.Name] {
+			name = f.Name
+		}
+	})
+	return name
+}
+
+// typeList is a flag.Value collecting the maps given by -type.
+type typeList []gen.Config
+
+func (l *typeList) String() string {
+	parts := make([]string, 0, len(*l))
+	for _, c := range *l {
+		parts = append(parts, c.Name+":"+c.Key+":"+c.Value)
+	}
+	return strings.Join(parts, ",")
+}
+
+func (l *typeList) Set(s string) error {
+	parts := strings.SplitN(s, ":", 3)
+	if len(parts) != 3 {
+		return fmt.Errorf("%q is not of the form Name:Key:Value", s)
+	}
+	*l = append(*l, gen.Config{Name: parts[0], Key: parts[1], Value: parts[2]})
+	return nil
+}
+
+// stringList is a flag.Value collecting the values of a repeated flag.
+type stringList []string
+
+func (l *stringList) String() string {
+	return strings.Join(*l, ",")
+}
+
+func (l *stringList) Set(s string) error {
+	*l = append(*l, s)
+	return nil
+}
+
+func usage() {
+	fmt.Fprintf(os.Stderr, "Usage of go-gen-syncmap:\n")
+	fmt.Fprintf(os.Stderr, "\tgo-gen-syncmap -key=KeyType -value=ValueType [flags]\n")
+	fmt.Fprintf(os.Stderr, "\tgo-gen-syncmap -type=Name:Key:Value [-type=...] [flags]\n")
+	fmt.Fprintf(os.Stderr, "\tgo-gen-syncmap -config=syncmaps.yaml [flags]\n")
+	fmt.Fprintf(os.Stderr, "\tgo-gen-syncmap [flags] ./...\n")
+	fmt.Fprintf(os.Stderr, "\tgo-gen-syncmap bench -key=KeyType -value=ValueType [-workload=read90] [flags]\n")
+	fmt.Fprintf(os.Stderr, "Flags:\n")
+	flag.PrintDefaults()
+}
+
+func main() {
+	log.SetFlags(0)
+	log.SetPrefix("go-gen-syncmap: ")
+	if len(os.Args) > 1 && os.Args[1] == "bench" {
+		benchMain(os.Args[2:])
+		return
+	}
+	flag.Usage = usage
+	flag.Parse()
+	if *dryRun && *diff {
+		log.Print("-dry-run can't be combined with -diff")
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	if *watch && (*dryRun || *diff) {
+		log.Print("-watch can't be combined with -dry-run or -diff")
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	if flag.NArg() > 0 {
+		if f := mapFlag(); *config != "" || f != "" {
+			log.Print("package patterns can't be combined with -config or flags describing maps")
+			flag.Usage()
+			os.Exit(2)
+		}
+		dir := templateDir()
+		run(func() error {
+			return generateDirectives(flag.Args(), dir)
+		}, func() []string {
+			return directiveSources(flag.Args(), dir)
+		})
+	}
+	if *config != "" {
+		if f := mapFlag(); f != "" {
+			log.Printf("-config can't be combined with -%s, which describes maps", f)
+			flag.Usage()
+			os.Exit(2)
+		}
+		dir := templateDir()
+		run(func() error {
+			return generateManifest(*config, dir)
+		}, func() []string {
+			return manifestSources(*config, dir)
+		})
+	}
+	if len(types) > 0 {
+		if *key != "" || *value != "" || *name != "" {
+			log.Print("-type can't be combined with -key, -value, or -name")
+			flag.Usage()
+			os.Exit(2)
+		}
+		for i := range types {
+			types[i].Package = *pkg
+			types[i].Unexported = *unexp
+			types[i].NoJSON = *noJSON
+			types[i].NoCompare = *noCmp
+			types[i].Padded = *padded
+			types[i].TTL = *ttl
+			types[i].Loader = *loader
+			types[i].Backend = *backend
+			types[i].Metrics = *metrics
+			types[i].Prometheus = *prom
+			types[i].OTel = *otel
+			types[i].Redis = *redis
+			types[i].MaxEntries = *maxEnt
+			types[i].Eviction = *evict
+			types[i].Cost = *cost
+			types[i].MaxCost = *maxCost
+			types[i].Build = *tags
+			types[i].GoVersion = *goVer
+			types[i].Kind = *kind
+			types[i].Impl = *impl
+			types[i].Mode = *mode
+			types[i].Tests = *tests
+			types[i].Benchmarks = *benches
+			types[i].PropertyTests = *props
+			types[i].Examples = *exmpls
+			types[i].Linearizability = *linear
+			types[i].Hash = *hash
+			types[i].Equal = *equal
+			types[i].KeyFactory = *keyFac
+			types[i].ValueFactory = *valFac
+			types[i].Extensions = exts
+		}
+		out := *output
+		if out == "" {
+			out = strings.ToLower(types[0].Name) + "_syncmap.go"
+		}
+		dir := templateDir()
+		run(func() error {
+			files, err := generate(types, dir, out)
+			if err != nil {
+				return err
+			}
+			return writeFiles(out, files)
+		}, func() []string {
+			return append(sources(dir, []string{out}), exts...)
+		})
+	}
+
+	cfg, err := singleConfig()
+	if err != nil {
+		log.Fatal(err)
+	}
+	if err := cfg.Validate(); err != nil {
+		log.Print(err)
+		flag.Usage()
+		os.Exit(2)
+	}
+	out := *output
+	if out == "" {
+		name := cfg.Name
+		if name == "" {
+			name = "Map"
+			if cfg.Kind != gen.Kinds[0] {
+				name = cfg.Kind
+			}
+		}
+		out = strings.ToLower(name) + "_syncmap.go"
+	}
+	dir := templateDir()
+	run(func() error {
+		// The annotated declaration may have changed since the last run.
+		cfg, err := singleConfig()
+		if err != nil {
+			return err
+		}
+		files, err := generate([]gen.Config{cfg}, dir, out)
+		if err != nil {
+			return err
+		}
+		return writeFiles(out, files)
+	}, func() []string {
+		return append(sources(dir, []string{out}), exts...)
+	})
+}
+
+// singleConfig returns the map described by the flags, completed by the
+// declaration following the go:generate directive if -key and -value are
+// unset.
+func singleConfig() (gen.Config, error) {
+	cfg := gen.Config{
+		Package:         *pkg,
+		Name:            *name,
+		Unexported:      *unexp,
+		Key:             *key,
+		Value:           *value,
+		NoJSON:          *noJSON,
+		NoCompare:       *noCmp,
+		Padded:          *padded,
+		TTL:             *ttl,
+		Loader:          *loader,
+		Backend:         *backend,
+		Metrics:         *metrics,
+		Prometheus:      *prom,
+		OTel:            *otel,
+		Redis:           *redis,
+		MaxEntries:      *maxEnt,
+		Eviction:        *evict,
+		Cost:            *cost,
+		MaxCost:         *maxCost,
+		Build:           *tags,
+		GoVersion:       *goVer,
+		Kind:            *kind,
+		Impl:            *impl,
+		Mode:            *mode,
+		Tests:           *tests,
+		Benchmarks:      *benches,
+		PropertyTests:   *props,
+		Examples:        *exmpls,
+		Linearizability: *linear,
+		Hash:            *hash,
+		Equal:           *equal,
+		KeyFactory:      *keyFac,
+		ValueFactory:    *valFac,
+		Extensions:      exts,
+	}
+	if cfg.Key == "" && cfg.Value == "" && os.Getenv("GOFILE") != "" {
+		inferred, err := infer(os.Getenv("GOFILE"), os.Getenv("GOLINE"))
+		if err != nil {
+			return cfg, err
+		}
+		cfg.Key, cfg.Value = inferred.Key, inferred.Value
+		if cfg.Name == "" {
+			cfg.Name = inferred.Name
+		}
+	}
+	return cfg, nil
+}
+
+// run runs job and exits, or with -watch, runs it again whenever a file
+// listed by watched changes, forever.
+func run(job func() error, watched func() []string) {
+	if !*watch {
+		if err := job(); err != nil {
+			log.Fatal(err)
+		}
+		exit()
+	}
+
+	var last map[string]stamp
+	for {
+		if cur := stamps(watched()); !reflect.DeepEqual(cur, last) {
+			if err := job(); err != nil {
+				log.Print(err)
+			} else if last != nil {
+				log.Print("regenerated")
+			}
+			last = cur
+		}
+		time.Sleep(watchInterval)
+	}
+}
+
+// watchInterval is how often -watch polls the watched files.
+const watchInterval = 500 * time.Millisecond
+
+// stamp identifies a version of a file.
+type stamp struct {
+	mod  time.Time
+	size int64
+}
+
+// stamps returns the stamps of the files that exist among names.
+func stamps(names []string) map[string]stamp {
+	m := make(map[string]stamp, len(names))
+	for _, name := range names {
+		if fi, err := os.Stat(name); err == nil {
+			m[name] = stamp{fi.ModTime(), fi.Size()}
+		}
+	}
+	return m
+}
+
+// sources returns the files generating outputs depends on: the template at
+// dir, unless it's embedded, and the Go files of the packages outputs belong
+// to, other than outputs themselves.
+func sources(dir string, outputs []string) []string {
+	var names []string
+	if fi, err := os.Stat(dir); err == nil && !fi.IsDir() {
+		names = append(names, dir)
+	} else if dir != "" {
+		for _, impl := range gen.Impls {
+			sub := dir
+			if impl != gen.Impls[0] {
+				sub = filepath.Join(dir, impl)
+			}
+			m, _ := filepath.Glob(filepath.Join(sub, "*.go"))
+			names = append(names, m...)
+		}
+		for _, kind := range gen.Kinds[1:] {
+			m, _ := filepath.Glob(filepath.Join(dir, kind, "*.go"))
+			names = append(names, m...)
+		}
+		m, _ := filepath.Glob(filepath.Join(dir, gen.SharedDir, "*.go"))
+		names = append(names, m...)
+	}
+
+	// Outputs, including the files split from them, aren't sources.
+	skip := make(map[string]bool)
+	var prefixes []string
+	for _, out := range outputs {
+		out = filepath.Clean(out)
+		skip[out] = true
+		if *split {
+			prefixes = append(prefixes, strings.TrimSuffix(out, ".go")+"_")
+		}
+	}
+	seen := make(map[string]bool)
+	for _, out := range outputs {
+		pkgDir := filepath.Dir(out)
+		if seen[pkgDir] {
+			continue
+		}
+		seen[pkgDir] = true
+		m, _ := filepath.Glob(filepath.Join(pkgDir, "*.go"))
+	files:
+		for _, name := range m {
+			name = filepath.Clean(name)
+			if skip[name] {
+				continue
+			}
+			for _, p := range prefixes {
+				if strings.HasPrefix(name, p) {
+					continue files
+				}
+			}
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// manifestSources returns the manifest file and the sources of the outputs
+// it lists.
+func manifestSources(file, dir string) []string {
+	targets, _ := manifestTargets(file)
+	return append([]string{file}, targetSources(targets, dir)...)
+}
+
+// directiveFiles returns the Go files of the packages matched by patterns,
+// which are directories, or directory trees when ending in "/...".
+func directiveFiles(patterns []string) ([]string, error) {
+	var files []string
+	for _, pattern := range patterns {
+		root, tree := strings.TrimSuffix(pattern, "/..."), strings.HasSuffix(pattern, "/...")
+		if pattern == "..." {
+			root, tree = ".", true
+		}
+		if !tree {
+			m, err := filepath.Glob(filepath.Join(root, "*.go"))
+			if err != nil {
+				return nil, err
+			}
+			files = append(files, m...)
+			continue
+		}
+		err := filepath.Walk(root, func(path string, fi os.FileInfo, err error) error {
+			if err != nil {
+				return err
+			}
+			if fi.IsDir() {
+				// Skip the directories the go command ignores.
+				base := fi.Name()
+				if path != root && (base == "testdata" || base == "vendor" || strings.HasPrefix(base, ".") || strings.HasPrefix(base, "_")) {
+					return filepath.SkipDir
+				}
+				return nil
+			}
+			if strings.HasSuffix(path, ".go") {
+				files = append(files, path)
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	return files, nil
+}
+
+// generateDirectives generates the maps requested by the //syncmap:generate
+// directives in the packages matched by patterns, next to the directives.
+func generateDirectives(patterns []string, dir string) error {
+	files, err := directiveFiles(patterns)
+	if err != nil {
+		return err
+	}
+	var targets []gen.Target
+	for _, file := range files {
+		src, err := os.ReadFile(file)
+		if err != nil {
+			return err
+		}
+		t, err := gen.ParseDirectives(file, src)
+		if err != nil {
+			return err
+		}
+		targets = append(targets, t...)
+	}
+	if len(targets) == 0 {
+		return fmt.Errorf("no //syncmap:generate directives in %s", strings.Join(patterns, " "))
+	}
+	return generateTargets(targets, dir)
+}
+
+// directiveSources returns the files that the maps requested by directives
+// in the packages matched by patterns are generated from.
+func directiveSources(patterns []string, dir string) []string {
+	files, _ := directiveFiles(patterns)
+	var targets []gen.Target
+	for _, file := range files {
+		if src, err := os.ReadFile(file); err == nil {
+			t, _ := gen.ParseDirectives(file, src)
+			targets = append(targets, t...)
+		}
+	}
+	// The package files of each output include the directives.
+	return targetSources(targets, dir)
+}
+
+// targetSources returns the files that targets are generated from.
+func targetSources(targets []gen.Target, dir string) []string {
+	var outputs, extensions []string
+	for _, t := range targets {
+		outputs = append(outputs, t.Output)
+		extensions = append(extensions, t.Extensions...)
+	}
+	return append(sources(dir, outputs), extensions...)
+}
+
+// manifestPath returns the path of a file named in a manifest file, such as
+// an output, which is relative to the manifest's directory.
+func manifestPath(file, name string) string {
+	if filepath.IsAbs(name) {
+		return name
+	}
+	return filepath.Join(filepath.Dir(file), name)
+}
+
+// stale is set by writeFile in -diff mode when a file is out of date.
+var stale bool
+
+// writeFile writes the generated file name unless it's up to date, or with
+// -dry-run or -diff, prints it or its differences from the file on disk.
+func writeFile(name string, src []byte) error {
+	switch {
+	case *dryRun:
+		_, err := os.Stdout.Write(src)
+		return err
+	case *diff:
+		old, err := os.ReadFile(name)
+		if err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		if d := gen.Diff(name, old, name+" (generated)", src); d != nil {
+			stale = true
+			_, err = os.Stdout.Write(d)
+			return err
+		}
+		return nil
+	}
+	if old, err := os.ReadFile(name); err == nil && bytes.Equal(old, src) {
+		// Leave up-to-date files untouched, modification time included.
+		return nil
+	}
+	return os.WriteFile(name, src, 0644)
+}
+
+// exit exits with status 1 if -diff found a file out of date.
+func exit() {
+	if stale {
+		os.Exit(1)
+	}
+	os.Exit(0)
+}
+
+// templateDir returns the directory of the template package, or an empty
+// string for the template embedded in the binary.
+func templateDir() string {
+	return *tmplDir
+}
+
+// generate returns the files of the maps cs to write to output, built from
+// the template package or custom template at path, split by concern if
+// -split is set, and formatted unless -noformat is set. The types of the
+// maps are resolved in the directory of output.
+func generate(cs []gen.Config, path, output string) ([]gen.File, error) {
+	var (
+		files []gen.File
+		err   error
+	)
+	cs = append([]gen.Config(nil), cs...)
+	for i := range cs {
+		// The maps may use the types of the package they're generated into.
+		cs[i].Dir = filepath.Dir(output)
+	}
+	for _, c := range cs {
+		warnings, err := c.Check()
+		if err != nil {
+			return nil, err
+		}
+		for _, w := range warnings {
+			log.Printf("warning: %s", w)
+		}
+	}
+	if fi, statErr := os.Stat(path); statErr == nil && !fi.IsDir() {
+		if len(cs) != 1 {
+			return nil, fmt.Errorf("custom template %s generates a single map", path)
+		}
+		if cs[0].Impl != "" && cs[0].Impl != gen.Impls[0] {
+			return nil, fmt.Errorf("custom template %s can't be combined with -impl", path)
+		}
+		if cs[0].Kind != "" && cs[0].Kind != gen.Kinds[0] {
+			return nil, fmt.Errorf("custom template %s can't be combined with -kind", path)
+		}
+		if cs[0].Mode != "" && cs[0].Mode != gen.Modes[0] {
+			return nil, fmt.Errorf("custom template %s can't be combined with -mode", path)
+		}
+		if *split || cs[0].Tests || cs[0].Benchmarks || cs[0].PropertyTests || cs[0].Examples || cs[0].Linearizability {
+			return nil, fmt.Errorf("custom template %s can't be split or generate tests", path)
+		}
+		var src []byte
+		src, err = gen.GenerateTemplate(cs[0], path)
+		files = []gen.File{{Src: src}}
+	} else {
+		files, err = gen.GenerateFiles(cs, path, *split)
+	}
+	if err != nil || *noFmt {
+		return files, err
+	}
+	for i := range files {
+		if files[i].Src, err = gen.Format(files[i].Src); err != nil {
+			return nil, err
+		}
+	}
+	return files, nil
+}
+
+// writeFiles writes the files generated for output: the file declaring the
+// maps to output itself, and the others next to it, named after their
+// concern.
+func writeFiles(output string, files []gen.File) error {
+	for _, f := range files {
+		if err := writeFile(splitName(output, f.Concern), f.Src); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// splitName returns the name of the file holding concern of output, such as
+// usercache_syncmap_json.go for the concern json of usercache_syncmap.go.
+func splitName(output, concern string) string {
+	if concern == "" {
+		return output
+	}
+	return strings.TrimSuffix(output, ".go") + "_" + concern + ".go"
+}
+
+// generateManifest generates every map listed in the manifest file, with
+// output paths relative to the manifest's directory.
+func generateManifest(file, dir string) error {
+	targets, err := manifestTargets(file)
+	if err != nil {
+		return err
+	}
+	return generateTargets(targets, dir)
+}
+
+// manifestTargets returns the maps listed in the manifest file, with the
+// paths it names made relative to the current directory.
+func manifestTargets(file string) ([]gen.Target, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	targets, err := gen.ParseManifest(file, data)
+	if err != nil {
+		return nil, err
+	}
+	for i, t := range targets {
+		targets[i].Output = manifestPath(file, t.Output)
+		for j, name := range t.Extensions {
+			t.Extensions[j] = manifestPath(file, name)
+		}
+	}
+	return targets, nil
+}
+
+// generateTargets generates targets, grouping those sharing an output into
+// one file.
+func generateTargets(targets []gen.Target, dir string) error {
+	var outputs []string
+	byOutput := make(map[string][]gen.Config)
+	for _, t := range targets {
+		if _, ok := byOutput[t.Output]; !ok {
+			outputs = append(outputs, t.Output)
+		}
+		byOutput[t.Output] = append(byOutput[t.Output], t.Config)
+	}
+	for _, output := range outputs {
+		files, err := generate(byOutput[output], dir, output)
+		if err != nil {
+			return fmt.Errorf("generating %s: %v", output, err)
+		}
+		if err := writeFiles(output, files); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// infer returns the map described by the declaration following the
+// go:generate directive at line of file.
+func infer(file, line string) (gen.Config, error) {
+	n, err := strconv.Atoi(line)
+	if err != nil {
+		return gen.Config{}, fmt.Errorf("invalid $GOLINE %q", line)
+	}
+	src, err := os.ReadFile(file)
+	if err != nil {
+		return gen.Config{}, err
+	}
+	return gen.Infer(file, src, n)
+}
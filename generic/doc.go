@@ -0,0 +1,15 @@
+// Package generic is the template package of go-gen-syncmap as a generic
+// package: Map[K comparable, V any] has the algorithm and the API of the
+// maps the generator specializes by default, for programs that would rather
+// import a package than run a code generation step.
+//
+// A specialized map avoids the conversions to any of the methods comparing
+// values, which panic here if V isn't comparable, as those of sync.Map do,
+// and may be generated with other implementations, or without the methods
+// its types don't support. The generator emits thin wrappers over this
+// package with -mode=generic instead.
+//
+// The package is generated from the template, and requires Go 1.24.
+package generic
+
+//go:generate go test ../internal/gen -run TestGoldenGeneric -update
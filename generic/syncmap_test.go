@@ -0,0 +1,61 @@
+package generic_test
+
+import (
+	"testing"
+
+	"github.com/cristaloleg/go-gen-syncmap/generic"
+)
+
+func TestMap(t *testing.T) {
+	m := generic.NewFromMap(map[string]int{"a": 1})
+	if v, loaded := m.LoadOrStore("a", 2); !loaded || v != 1 {
+		t.Errorf("LoadOrStore(a, 2) = %v, %v; want 1, true", v, loaded)
+	}
+	if !m.CompareAndSwap("a", 1, 3) || m.CompareAndSwap("a", 1, 4) {
+		t.Error("CompareAndSwap doesn't compare the current value")
+	}
+	m.Store("b", 5)
+	if !m.CompareAndDelete("b", 5) {
+		t.Error("CompareAndDelete(b, 5) = false")
+	}
+	if v, ok := m.Load("a"); !ok || v != 3 || m.Len() != 1 {
+		t.Errorf("Load(a) = %v, %v with Len %d; want 3, true with Len 1", v, ok, m.Len())
+	}
+}
+
+// TestZeroSizeValues checks that storing a zero-sized value doesn't mark its
+// entry as expunged, as a pointer to another zero-sized variable would: the
+// entry would then be left out of the next dirty map, and lost.
+func TestZeroSizeValues(t *testing.T) {
+	var m generic.Map[int, struct{}]
+	for i := 0; i < 10; i++ {
+		m.Store(i, struct{}{})
+	}
+	for round := 0; round < 2; round++ {
+		// Miss until the dirty map is promoted, then store a new key,
+		// copying the read map into a new dirty map.
+		for i := 0; i < 20; i++ {
+			m.Load(-1)
+		}
+		m.Store(100+round, struct{}{})
+	}
+	for i := 0; i < 20; i++ {
+		m.Load(-1)
+	}
+	for i := 0; i < 10; i++ {
+		if _, ok := m.Load(i); !ok {
+			t.Errorf("Load(%d) missed", i)
+		}
+	}
+}
+
+func TestCompareIncomparable(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Error("CompareAndSwap of slices didn't panic")
+		}
+	}()
+	var m generic.Map[string, []byte]
+	m.Store("a", nil)
+	m.CompareAndSwap("a", nil, []byte("b"))
+}
@@ -1 +1,3 @@
 module github.com/cristaloleg/go-gen-syncmap
+
+go 1.24
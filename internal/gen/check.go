@@ -0,0 +1,362 @@
+package gen
+
+import (
+	"bytes"
+	"fmt"
+	"go/ast"
+	"go/build"
+	"go/parser"
+	"go/token"
+	"go/types"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// Check type-checks the key and value types of c, and its hash and equality
+// functions, if any. It returns an error if the key isn't comparable and
+// there are no such functions, and warnings about keys that are comparable but
+// behave surprisingly, and about values that aren't comparable, for which
+// the methods comparing values are omitted, or panic for generic maps.
+//
+// Types declared in the package of the generated file are checked along with
+// the files of the package in Dir, except those generated by go-gen-syncmap,
+// which may be out of date. Names it doesn't declare, such as those of a
+// package that doesn't exist yet, are assumed to be valid and comparable
+// types: set NoCompare for values of such types that aren't comparable.
+func (c Config) Check() (warnings []string, err error) {
+	_, warnings, err = c.check()
+	return warnings, err
+}
+
+// typeFacts are what check learns about the key and value types of a map,
+// which select the template code generated for it.
+type typeFacts struct {
+	// incomparable is set if the value type is known not to be comparable.
+	incomparable bool
+
+	// keyTag is the build tag of keyTags selecting the template files
+	// specialized for the keys, if any.
+	keyTag string
+
+	// valueTag is the build tag of valueTags selecting the template files
+	// specialized for the values, if any.
+	valueTag string
+
+	// binary is set if MarshalBinary can encode both the keys and the
+	// values: if each is fixed-size, or encodes itself.
+	binary bool
+}
+
+// check is like Check, but also returns the facts it learned about the
+// types.
+func (c Config) check() (facts typeFacts, warnings []string, err error) {
+	if err := c.Validate(); err != nil {
+		return facts, nil, err
+	}
+	q := newQualifier(nil)
+	if c.Dir != "" {
+		if q.dir, err = filepath.Abs(c.Dir); err != nil {
+			return facts, nil, err
+		}
+	}
+	keyExpr := c.Key
+	if !c.hasKeys() {
+		// Checked as a key type that is valid, comparable, and selects
+		// no template files.
+		keyExpr = "struct{}"
+	}
+	key, err := q.qualify(keyExpr)
+	if err != nil {
+		return facts, nil, fmt.Errorf("key type of %s: %v", c.name(), err)
+	}
+	valueExpr := c.Value
+	if !c.hasValues() {
+		valueExpr = "struct{}"
+	}
+	value, err := q.qualify(valueExpr)
+	if err != nil {
+		return facts, nil, fmt.Errorf("value type of %s: %v", c.name(), err)
+	}
+	var seed, hash, equal string
+	if c.Hash != "" {
+		seed, _ = q.qualify("hash/maphash.Seed")
+		if hash, err = q.qualifyExpr(c.Hash, false); err != nil {
+			return facts, nil, fmt.Errorf("hash function of %s: %v", c.name(), err)
+		}
+		if equal, err = q.qualifyExpr(c.Equal, false); err != nil {
+			return facts, nil, fmt.Errorf("equality function of %s: %v", c.name(), err)
+		}
+	}
+
+	// Declare a variable of each type in a file importing their packages.
+	var src strings.Builder
+	fmt.Fprintf(&src, "package %s\n\n", c.Package)
+	paths := make([]string, 0, len(q.imports))
+	for path := range q.imports {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+	for _, path := range paths {
+		fmt.Fprintf(&src, "import %s\n", q.importSpec(path))
+	}
+	fmt.Fprintf(&src, "\nvar _ %s\n\nvar _ %s\n", key, value)
+	if c.Hash != "" {
+		fmt.Fprintf(&src, "\nvar _ func(%s, %s) uint64 = %s\n", seed, key, hash)
+		fmt.Fprintf(&src, "\nvar _ func(a, b %s) bool = %s\n", key, equal)
+	}
+
+	// The file is checked as part of the package, in its directory, so that
+	// the types it declares resolve, and relative imports are those of its
+	// module.
+	fset := token.NewFileSet()
+	filename := filepath.Join(q.dir, "syncmap_check.go")
+	f, err := parser.ParseFile(fset, filename, src.String(), 0)
+	if err != nil {
+		return facts, nil, err
+	}
+	files := append(packageFiles(fset, q.dir, c.Package), f)
+	spec := func(i int) *ast.ValueSpec {
+		return f.Decls[len(paths)+i].(*ast.GenDecl).Specs[0].(*ast.ValueSpec)
+	}
+	type exprSpec struct {
+		name, expr string
+		x          ast.Expr
+	}
+	specs := []exprSpec{
+		{"key type", c.Key, spec(0).Type},
+		{"value type", c.Value, spec(1).Type},
+	}
+	if c.Hash != "" {
+		specs = append(specs,
+			exprSpec{"hash function", c.Hash, spec(2).Values[0]},
+			exprSpec{"equality function", c.Equal, spec(3).Values[0]})
+	}
+	var typeErrs []types.Error
+	conf := types.Config{
+		Importer: q.imp,
+		Error: func(err error) {
+			typeErrs = append(typeErrs, err.(types.Error))
+		},
+	}
+	info := &types.Info{Types: make(map[ast.Expr]types.TypeAndValue)}
+	conf.Check(c.Package, fset, files, info)
+
+	for _, e := range typeErrs {
+		if fset.Position(e.Pos).Filename != filename {
+			// The package is being edited, or refers to the maps generated.
+			continue
+		}
+		if strings.HasPrefix(e.Msg, "undefined: ") {
+			// Declared by a file of the package that isn't written yet, or
+			// by a generated one, presumably.
+			continue
+		}
+		for _, s := range specs {
+			if s.x.Pos() <= e.Pos && e.Pos < s.x.End() {
+				return facts, nil, fmt.Errorf("invalid %s %s of %s: %s", s.name, s.expr, c.name(), e.Msg)
+			}
+		}
+		return facts, nil, fmt.Errorf("invalid type of %s: %s", c.name(), e.Msg)
+	}
+
+	// types.Comparable treats invalid types, such as those of unresolved
+	// names, as comparable, so a false result is definite.
+	keyType, valueType := info.Types[specs[0].x].Type, info.Types[specs[1].x].Type
+	switch {
+	case keyType == nil || types.Comparable(keyType):
+	case c.Hash == "":
+		return facts, nil, fmt.Errorf("key type %s of %s is not comparable, so it can't be a map key "+
+			"without hash and equality functions", c.Key, c.name())
+	case c.hasTests():
+		return facts, nil, fmt.Errorf("key type %s of %s is not comparable: "+
+			"the tests of the template keep keys in Go maps", c.Key, c.name())
+	}
+	// Only maps have JSON methods, whose keys must be JSON object keys.
+	if c.kind() == Kinds[0] && !c.NoJSON && !c.generic() && !jsonKey(keyType) {
+		return facts, nil, fmt.Errorf("key type %s of %s can't be used as a JSON object key: use a string or integer type, "+
+			"implement encoding.TextMarshaler and encoding.TextUnmarshaler, or disable JSON", c.Key, c.name())
+	}
+	// Only maps, multimaps, and bimaps compare values, which the latter can't
+	// do without.
+	if valueType != nil && !types.Comparable(valueType) {
+		switch c.kind() {
+		case "multimap":
+			return facts, nil, fmt.Errorf("value type %s of %s is not comparable: "+
+				"RemoveValue compares values", c.Value, c.name())
+		case "bimap":
+			return facts, nil, fmt.Errorf("value type %s of %s is not comparable: "+
+				"bimaps index pairs by their values", c.Value, c.name())
+		}
+	}
+	if c.kind() == Kinds[0] && valueType != nil && !types.Comparable(valueType) {
+		facts.incomparable = true
+		switch {
+		case c.generic():
+			warnings = append(warnings, fmt.Sprintf("value type %s of %s is not comparable: "+
+				"CompareAndSwap, CompareAndDelete, and Equal panic", c.Value, c.name()))
+		case !c.NoCompare:
+			warnings = append(warnings, fmt.Sprintf("value type %s of %s is not comparable: "+
+				"CompareAndSwap, CompareAndDelete, and Equal are omitted", c.Value, c.name()))
+		}
+	}
+
+	// A pointer to a type the package doesn't declare yet is still a
+	// pointer, although its type is invalid here.
+	_, pointer := specs[1].x.(*ast.StarExpr)
+	if valueType != nil {
+		if _, ok := valueType.Underlying().(*types.Pointer); ok {
+			pointer = true
+		}
+	}
+	if pointer {
+		facts.valueTag = "syncmap_ptrvalue"
+	}
+	facts.binary = c.hasKeys() && c.hasValues() && encodesBinary(keyType) && encodesBinary(valueType)
+	if c.Hash != "" {
+		// The functions define the equality of keys, whatever their type.
+		facts.keyTag = "syncmap_customkey"
+		return facts, warnings, nil
+	}
+	if keyType != nil {
+		if basic, ok := keyType.Underlying().(*types.Basic); ok {
+			switch {
+			case basic.Info()&types.IsInteger != 0:
+				facts.keyTag = "syncmap_intkey"
+			case basic.Info()&types.IsString != 0:
+				facts.keyTag = "syncmap_stringkey"
+			}
+		}
+	}
+
+	switch {
+	case hasFloat(keyType, make(map[types.Type]bool)):
+		warnings = append(warnings, fmt.Sprintf("key type %s of %s holds floating-point numbers: "+
+			"NaN is not equal to itself, so entries stored with a NaN key can never be loaded or deleted", c.Key, c.name()))
+	case types.IsInterface(keyType):
+		warnings = append(warnings, fmt.Sprintf("key type %s of %s is an interface: "+
+			"using a key whose dynamic type is not comparable panics", c.Key, c.name()))
+	}
+	return facts, warnings, nil
+}
+
+// packageFiles parses the files of the package in dir if it is named name,
+// except those generated by go-gen-syncmap. It returns nil if there is no
+// such package.
+func packageFiles(fset *token.FileSet, dir, name string) []*ast.File {
+	pkg, err := build.Default.ImportDir(dir, 0)
+	if err != nil || pkg.Name != name {
+		return nil
+	}
+	var files []*ast.File
+	for _, base := range pkg.GoFiles {
+		filename := filepath.Join(dir, base)
+		src, err := os.ReadFile(filename)
+		if err != nil || bytes.HasPrefix(src, []byte(generatedPrefix)) {
+			continue
+		}
+		if f, err := parser.ParseFile(fset, filename, src, 0); err == nil {
+			files = append(files, f)
+		}
+	}
+	return files
+}
+
+// codecMethods returns the methods of the interfaces of package encoding
+// marshaling and unmarshaling format, such as MarshalText and UnmarshalText
+// for "Text".
+func codecMethods(format string) (marshal, unmarshal *types.Func) {
+	data := types.NewVar(token.NoPos, nil, "data", types.NewSlice(types.Typ[types.Byte]))
+	err := types.NewVar(token.NoPos, nil, "err", types.Universe.Lookup("error").Type())
+	m := types.NewSignatureType(nil, nil, nil, nil, types.NewTuple(data, err), false)
+	u := types.NewSignatureType(nil, nil, nil, types.NewTuple(data), types.NewTuple(err), false)
+	return types.NewFunc(token.NoPos, nil, "Marshal"+format, m), types.NewFunc(token.NoPos, nil, "Unmarshal"+format, u)
+}
+
+// binaryCodec is the interface of the types implementing both
+// encoding.BinaryMarshaler and encoding.BinaryUnmarshaler.
+var binaryCodec = func() *types.Interface {
+	marshal, unmarshal := codecMethods("Binary")
+	return types.NewInterfaceType([]*types.Func{marshal, unmarshal}, nil).Complete()
+}()
+
+// textMarshaler and textUnmarshaler are encoding.TextMarshaler and
+// encoding.TextUnmarshaler.
+var textMarshaler, textUnmarshaler = func() (*types.Interface, *types.Interface) {
+	marshal, unmarshal := codecMethods("Text")
+	return types.NewInterfaceType([]*types.Func{marshal}, nil).Complete(),
+		types.NewInterfaceType([]*types.Func{unmarshal}, nil).Complete()
+}()
+
+// jsonKey reports whether encoding/json encodes and decodes values of t as
+// object keys: if t is a string or integer type, or if t implements
+// encoding.TextMarshaler and *t encoding.TextUnmarshaler. Invalid types,
+// such as those of names the package doesn't declare yet, are assumed to be.
+func jsonKey(t types.Type) bool {
+	if t == nil || t.Underlying() == types.Typ[types.Invalid] {
+		return true
+	}
+	if b, ok := t.Underlying().(*types.Basic); ok && b.Info()&(types.IsString|types.IsInteger) != 0 {
+		return true
+	}
+	return types.Implements(t, textMarshaler) && types.Implements(types.NewPointer(t), textUnmarshaler)
+}
+
+// encodesBinary reports whether MarshalBinary encodes values of t: if t is
+// fixed-size, or if *t implements binaryCodec.
+func encodesBinary(t types.Type) bool {
+	if t == nil || t.Underlying() == types.Typ[types.Invalid] {
+		return false
+	}
+	return fixedSize(t) || types.Implements(types.NewPointer(t), binaryCodec)
+}
+
+// fixedSize reports whether t is a fixed-size type that encoding/binary
+// both writes and reads: a boolean or sized numeric type, or an array or a
+// struct of such types, whose fields are exported or blank.
+func fixedSize(t types.Type) bool {
+	switch u := t.Underlying().(type) {
+	case *types.Basic:
+		switch u.Kind() {
+		case types.Bool,
+			types.Int8, types.Int16, types.Int32, types.Int64,
+			types.Uint8, types.Uint16, types.Uint32, types.Uint64,
+			types.Float32, types.Float64, types.Complex64, types.Complex128:
+			return true
+		}
+	case *types.Array:
+		return fixedSize(u.Elem())
+	case *types.Struct:
+		for i := 0; i < u.NumFields(); i++ {
+			f := u.Field(i)
+			if !f.Exported() && f.Name() != "_" || !fixedSize(f.Type()) {
+				return false
+			}
+		}
+		return true
+	}
+	return false
+}
+
+// hasFloat reports whether values of t hold floating-point or complex
+// numbers, which are compared by value.
+func hasFloat(t types.Type, seen map[types.Type]bool) bool {
+	if t == nil || seen[t] {
+		return false
+	}
+	seen[t] = true
+	switch u := t.Underlying().(type) {
+	case *types.Basic:
+		return u.Info()&(types.IsFloat|types.IsComplex) != 0
+	case *types.Array:
+		return hasFloat(u.Elem(), seen)
+	case *types.Struct:
+		for i := 0; i < u.NumFields(); i++ {
+			if hasFloat(u.Field(i).Type(), seen) {
+				return true
+			}
+		}
+	}
+	return false
+}
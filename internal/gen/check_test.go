@@ -0,0 +1,104 @@
+package gen
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestCheck(t *testing.T) {
+	for _, tt := range []struct {
+		c       Config
+		warning string
+	}{
+		{Config{Package: "cache", Key: "string", Value: "*User"}, ""},
+		{Config{Package: "cache", Key: "UserID", Value: "struct{ a [2]UserID }"}, ""},
+		{Config{Package: "cache", Key: "time.Time", Value: "*encoding/json.Decoder"}, ""},
+		{Config{Package: "cache", Key: "net/netip.Addr", Value: "int"}, ""},
+		{Config{Package: "cache", Key: "float64", Value: "int", NoJSON: true}, "NaN"},
+		{Config{Package: "cache", Key: "struct{ x, y float32 }", Value: "int", NoJSON: true}, "NaN"},
+		{Config{Package: "cache", Key: "interface{ String() string }", Value: "int", NoJSON: true}, "interface"},
+		{Config{Package: "cache", Key: "string", Value: "[]int"}, "not comparable"},
+		{Config{Package: "cache", Key: "string", Value: "[]int", NoCompare: true}, ""},
+	} {
+		warnings, err := tt.c.Check()
+		if err != nil {
+			t.Errorf("Check(%+v): %v", tt.c, err)
+			continue
+		}
+		got := strings.Join(warnings, "\n")
+		if (tt.warning == "") != (got == "") || !strings.Contains(got, tt.warning) {
+			t.Errorf("Check(%+v) warnings = %q; want one mentioning %q", tt.c, got, tt.warning)
+		}
+	}
+}
+
+func TestCheckErrors(t *testing.T) {
+	for _, tt := range []struct {
+		c    Config
+		want string
+	}{
+		{Config{Package: "cache", Key: "[]byte", Value: "int", NoJSON: true}, "key type []byte of Map is not comparable"},
+		{Config{Package: "cache", Key: "struct{ m map[string]int }", Value: "int", NoJSON: true}, "not comparable"},
+		{Config{Package: "cache", Name: "Blobs", Key: "[]byte", Kind: "set"}, "key type []byte of Blobs is not comparable"},
+		{Config{Package: "cache", Key: "string", Value: "[]byte", Kind: "multimap"}, "value type []byte of Multimap is not comparable"},
+		{Config{Package: "cache", Key: "int", Value: "map[string]int", Kind: "bimap"}, "value type map[string]int of Bimap is not comparable"},
+		{Config{Package: "cache", Key: "string", Value: "[-1]int"}, "invalid value type [-1]int of Map"},
+		{Config{Package: "cache", Name: "Pairs", Key: "struct{ a, b int }", Value: "int"}, "key type struct{ a, b int } of Pairs can't be used as a JSON object key"},
+		{Config{Package: "cache", Key: "float64", Value: "int"}, "key type float64 of Map can't be used as a JSON object key"},
+		{Config{Package: "cache", Key: "any", Value: "int"}, "key type any of Map can't be used as a JSON object key"},
+		{Config{Package: "cache", Key: "[2]int", Value: "int"}, "key type [2]int of Map can't be used as a JSON object key"},
+		{Config{Package: "cache", Name: "Cache", Key: "string", Value: "time.Nope"}, "value type of Cache"},
+		{Config{Package: "cache", Key: "[]byte", Value: "int", NoJSON: true, Impl: "swiss",
+			Hash: "hash/maphash.String", Equal: "bytes.Equal"}, "invalid hash function hash/maphash.String of Map"},
+		{Config{Package: "cache", Key: "[]byte", Value: "int", NoJSON: true, Impl: "swiss",
+			Hash: "hash/maphash.Bytes", Equal: "bytes.Nope"}, "equality function of Map"},
+		{Config{Package: "cache", Key: "[]byte", Value: "int", NoJSON: true, Impl: "swiss", Tests: true, KeyFactory: "[]byte{byte(i)}",
+			Hash: "hash/maphash.Bytes", Equal: "bytes.Equal"}, "the tests of the template keep keys in Go maps"},
+	} {
+		_, err := tt.c.Check()
+		if err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("Check(%+v) = %v; want an error mentioning %q", tt.c, err, tt.want)
+		}
+	}
+}
+
+func TestCheckPackage(t *testing.T) {
+	dir := t.TempDir()
+	for name, src := range map[string]string{
+		"types.go": "package cache\n\ntype UserID int64\n\ntype Tags struct{ names []string }\n",
+		"cache.go": "package cache\n\nvar users = new(Map)\n",
+		// Out of date, and excluded from the package checked.
+		"map_syncmap.go": generatedPrefix + ". DO NOT EDIT.\n\npackage cache\n\ntype Tags int\n",
+	} {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(src), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	c := Config{Package: "cache", Dir: dir, Key: "UserID", Value: "int64"}
+	facts, warnings, err := c.check()
+	if err != nil || len(warnings) != 0 {
+		t.Fatalf("check(%+v) = %v, %v", c, warnings, err)
+	}
+	if facts.keyTag != "syncmap_intkey" || !facts.binary {
+		t.Errorf("check(%+v) facts = %+v; want syncmap_intkey keys encoded in binary", c, facts)
+	}
+
+	c = Config{Package: "cache", Dir: dir, Key: "UserID", Value: "Tags"}
+	if warnings, err := c.Check(); err != nil || len(warnings) != 1 || !strings.Contains(warnings[0], "not comparable") {
+		t.Errorf("Check(%+v) = %q, %v; want a warning that the value is not comparable", c, warnings, err)
+	}
+
+	c = Config{Package: "cache", Dir: dir, Key: "Tags", Value: "int"}
+	if _, err := c.Check(); err == nil || !strings.Contains(err.Error(), "key type Tags of Map is not comparable") {
+		t.Errorf("Check(%+v) = %v; want an error that the key is not comparable", c, err)
+	}
+
+	// The types of another package are unknown.
+	c = Config{Package: "other", Dir: dir, Key: "Tags", Value: "int"}
+	if _, err := c.Check(); err != nil {
+		t.Errorf("Check(%+v): %v", c, err)
+	}
+}
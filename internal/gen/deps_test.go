@@ -0,0 +1,64 @@
+//go:build syncmap_deps
+
+package gen
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+)
+
+// depsMod is the go.mod file of the module TestGenerateDeps builds the
+// generated code in, requiring the clients it uses.
+const depsMod = `module syncmapdeps
+
+go 1.24
+
+require (
+	github.com/prometheus/client_golang v1.24.1
+	github.com/redis/go-redis/v9 v9.22.0
+	go.opentelemetry.io/otel v1.46.0
+	go.opentelemetry.io/otel/metric v1.46.0
+	go.opentelemetry.io/otel/trace v1.46.0
+)
+`
+
+// TestGenerateDeps builds and vets the code generated for Prometheus,
+// OpenTelemetry, and Redis, which TestGeneratePrometheus, TestGenerateOTel,
+// and TestGenerateRedis can't type-check, in a module requiring their
+// packages. go mod tidy fetches them, so the test needs network access or a
+// module cache holding them, and only runs with the syncmap_deps tag:
+//
+//	go test -tags=syncmap_deps -run=TestGenerateDeps ./internal/gen
+func TestGenerateDeps(t *testing.T) {
+	mod := t.TempDir()
+	if err := os.WriteFile(filepath.Join(mod, "go.mod"), []byte(depsMod), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	for _, c := range []Config{
+		{Package: "prometheus", Name: "Users", Key: "string", Value: "int64", Metrics: true, Prometheus: true},
+		{Package: "otel", Name: "Users", Key: "string", Value: "int64", Metrics: true, Loader: true, OTel: true},
+		{Package: "redis", Name: "Users", Key: "string", Value: "*encoding/json.RawMessage", Redis: true},
+	} {
+		files, err := GenerateFiles([]Config{c}, templateDir, false)
+		if err != nil {
+			t.Fatalf("GenerateFiles(%+v): %v", c, err)
+		}
+		dir := filepath.Join(mod, c.Package)
+		if err := os.Mkdir(dir, 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(dir, "users_syncmap.go"), files[0].Src, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for _, args := range [][]string{{"mod", "tidy"}, {"vet", "./..."}} {
+		cmd := exec.Command("go", args...)
+		cmd.Dir = mod
+		if out, err := cmd.CombinedOutput(); err != nil {
+			t.Fatalf("go %v: %v\n%s", args, err, out)
+		}
+	}
+}
@@ -0,0 +1,37 @@
+package gen
+
+import "testing"
+
+func TestDiff(t *testing.T) {
+	for _, tt := range []struct{ old, new, want string }{
+		{"a\nb\n", "a\nb\n", ""},
+		{
+			"a\nb\nc\n", "a\nB\nc\n",
+			"--- old\n+++ new\n@@ -1,3 +1,3 @@\n a\n-b\n+B\n c\n",
+		},
+		{
+			"", "a\n",
+			"--- old\n+++ new\n@@ -0,0 +1 @@\n+a\n",
+		},
+		{
+			"a\n", "a",
+			"--- old\n+++ new\n@@ -1 +1 @@\n-a\n+a\n\\ No newline at end of file\n",
+		},
+		{
+			"1\n2\n3\n4\n5\n6\n7\n8\n9\n10\n11\n12\n",
+			"0\n1\n2\n3\n4\n5\n6\n7\n8\n9\n10\n12\n",
+			"--- old\n+++ new\n" +
+				"@@ -1,3 +1,4 @@\n+0\n 1\n 2\n 3\n" +
+				"@@ -8,5 +9,4 @@\n 8\n 9\n 10\n-11\n 12\n",
+		},
+		{
+			"1\n2\n3\n4\n5\n6\n7\n",
+			"1\n2\nx\n4\n5\n6\ny\n",
+			"--- old\n+++ new\n@@ -1,7 +1,7 @@\n 1\n 2\n-3\n+x\n 4\n 5\n 6\n-7\n+y\n",
+		},
+	} {
+		if got := string(Diff("old", []byte(tt.old), "new", []byte(tt.new))); got != tt.want {
+			t.Errorf("Diff(%q, %q) =\n%s\nwant\n%s", tt.old, tt.new, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,112 @@
+package gen
+
+import (
+	"bytes"
+	"fmt"
+	"go/parser"
+	"go/token"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// directivePrefix starts the comments read by ParseDirectives.
+const directivePrefix = "//syncmap:generate"
+
+// ParseDirectives returns the maps requested by the directives in the Go
+// source file src, which are line comments of the form
+//
+//	//syncmap:generate name=UserCache key=UserID value=*User
+//
+// The fields are those of a manifest entry except package, which is the
+// package of src; values containing spaces may be double-quoted, and the
+// boolean fields, such as nojson and tests, may be given without a value.
+// Outputs and extensions are relative to the directory of filename.
+func ParseDirectives(filename string, src []byte) ([]Target, error) {
+	if !bytes.Contains(src, []byte(directivePrefix)) {
+		return nil, nil
+	}
+	fset := token.NewFileSet()
+	f, err := parser.ParseFile(fset, filename, src, parser.ParseComments)
+	if err != nil {
+		return nil, err
+	}
+
+	var targets []Target
+	for _, cg := range f.Comments {
+		for _, c := range cg.List {
+			args, ok := strings.CutPrefix(c.Text, directivePrefix)
+			if !ok || (args != "" && !unicode.IsSpace(rune(args[0]))) {
+				continue
+			}
+			pos := fset.Position(c.Pos())
+			fields, err := splitDirective(args)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %v", pos, err)
+			}
+			e := manifestEntry{line: pos.Line}
+			for _, field := range fields {
+				k, v := field, "true"
+				if i := strings.Index(field, "="); i >= 0 {
+					k, v = field[:i], field[i+1:]
+				} else if k != "nojson" && k != "nocompare" && k != "unexported" && k != "tests" && k != "benchmarks" && k != "property_tests" && k != "examples" && k != "linearizability" {
+					return nil, fmt.Errorf("%s: expected key=value, got %q", pos, field)
+				}
+				if k == "package" {
+					return nil, fmt.Errorf("%s: the package of a directive is the package of its file", pos)
+				}
+				e.fields = append(e.fields, manifestField{pos.Line, k, v})
+			}
+			e.fields = append(e.fields, manifestField{pos.Line, "package", f.Name.Name})
+			t, err := e.target()
+			if err != nil {
+				return nil, fmt.Errorf("%s:%v", filename, err)
+			}
+			if !filepath.IsAbs(t.Output) {
+				t.Output = filepath.Join(filepath.Dir(filename), t.Output)
+			}
+			for i, name := range t.Extensions {
+				if !filepath.IsAbs(name) {
+					t.Extensions[i] = filepath.Join(filepath.Dir(filename), name)
+				}
+			}
+			targets = append(targets, t)
+		}
+	}
+	return targets, nil
+}
+
+// splitDirective splits the arguments of a directive into fields separated
+// by spaces. The value of a key=value field may be double-quoted.
+func splitDirective(s string) ([]string, error) {
+	var fields []string
+	for {
+		s = strings.TrimLeftFunc(s, unicode.IsSpace)
+		if s == "" {
+			return fields, nil
+		}
+		i := strings.IndexFunc(s, func(r rune) bool { return unicode.IsSpace(r) || r == '"' })
+		if i < 0 {
+			return append(fields, s), nil
+		}
+		if s[i] != '"' {
+			fields = append(fields, s[:i])
+			s = s[i:]
+			continue
+		}
+		if i == 0 || s[i-1] != '=' {
+			return nil, fmt.Errorf("unexpected quote in %q", s)
+		}
+		quoted, err := strconv.QuotedPrefix(s[i:])
+		if err != nil {
+			return nil, fmt.Errorf("invalid quoted value in %q", s)
+		}
+		value, _ := strconv.Unquote(quoted)
+		fields = append(fields, s[:i]+value)
+		s = s[i+len(quoted):]
+		if s != "" && !unicode.IsSpace(rune(s[0])) {
+			return nil, fmt.Errorf("expected a space after %s", quoted)
+		}
+	}
+}
@@ -0,0 +1,61 @@
+package gen
+
+import (
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestParseDirectives(t *testing.T) {
+	src := `package cache
+
+//syncmap:generate name=UserCache key=UserID value=*User unexported benchmarks key_factory=UserID(strconv.Itoa(i)) value_factory=&User{}
+type UserID string
+
+// Not a directive: //syncmap:generate key=int value=int
+//syncmap:generated
+func f() {
+	//syncmap:generate key=float64 value="*struct{ n int }" nojson impl=sharded output=../maps.go extensions=dump.go
+}
+`
+	got, err := ParseDirectives(filepath.Join("src", "cache", "cache.go"), []byte(src))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []Target{
+		{
+			Config: Config{Package: "cache", Name: "UserCache", Unexported: true, Key: "UserID", Value: "*User",
+				Benchmarks: true, KeyFactory: "UserID(strconv.Itoa(i))", ValueFactory: "&User{}"},
+			Output: filepath.Join("src", "cache", "usercache_syncmap.go"),
+		},
+		{
+			Config: Config{Package: "cache", Key: "float64", Value: "*struct{ n int }", NoJSON: true, Impl: "sharded",
+				Extensions: []string{filepath.Join("src", "cache", "dump.go")}},
+			Output: filepath.Join("src", "maps.go"),
+		},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("ParseDirectives = %+v; want %+v", got, want)
+	}
+
+	if got, err := ParseDirectives("cache.go", []byte("package cache\n")); err != nil || got != nil {
+		t.Errorf("ParseDirectives without directives = %+v, %v", got, err)
+	}
+}
+
+func TestParseDirectivesErrors(t *testing.T) {
+	for _, directive := range []string{
+		"//syncmap:generate key=int",
+		"//syncmap:generate key=int value=int color=red",
+		"//syncmap:generate key=int value=int package=other",
+		"//syncmap:generate key=int value=int sharded",
+		`//syncmap:generate key=int value="int`,
+		`//syncmap:generate key=int value="int"x`,
+		`//syncmap:generate key=int "value"=int`,
+	} {
+		src := "package cache\n\n" + directive + "\n"
+		if got, err := ParseDirectives("cache.go", []byte(src)); err == nil {
+			t.Errorf("ParseDirectives(%q) = %+v; want error", directive, got)
+		}
+	}
+}
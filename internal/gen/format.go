@@ -0,0 +1,114 @@
+package gen
+
+import (
+	"bytes"
+	"fmt"
+	"go/ast"
+	"go/format"
+	"go/parser"
+	"go/token"
+	"path"
+	"strconv"
+	"strings"
+)
+
+// Format formats the Go source src like gofmt, after removing the imports
+// it doesn't use or repeats and grouping the rest like goimports: standard
+// library packages first, then the others.
+//
+// An import is only known to be unused if its package name can be told from
+// its path, that is, if it's named or its last path element, or the one
+// before a major version suffix such as v2, is an identifier.
+func Format(src []byte) ([]byte, error) {
+	fset := token.NewFileSet()
+	f, err := parser.ParseFile(fset, "", src, parser.ParseComments)
+	if err != nil {
+		return nil, fmt.Errorf("formatting generated code: %v", err)
+	}
+
+	used := make(map[string]bool)
+	ast.Inspect(f, func(n ast.Node) bool {
+		if sel, ok := n.(*ast.SelectorExpr); ok {
+			if id, ok := sel.X.(*ast.Ident); ok && id.Obj == nil {
+				used[id.Name] = true
+			}
+		}
+		return true
+	})
+
+	var std, other []string
+	seen := make(map[string]bool)
+	for _, spec := range f.Imports {
+		p, err := strconv.Unquote(spec.Path.Value)
+		if err != nil {
+			return nil, err
+		}
+		name := path.Base(p)
+		if dir := path.Dir(p); dir != "." && isMajorVersion(name) {
+			name = path.Base(dir)
+		}
+		if spec.Name != nil {
+			name = spec.Name.Name
+		}
+		if token.IsIdentifier(name) && !used[name] {
+			continue
+		}
+		s := spec.Path.Value
+		if spec.Name != nil {
+			s = spec.Name.Name + " " + s
+		}
+		if seen[s] {
+			continue
+		}
+		seen[s] = true
+		if strings.Contains(strings.SplitN(p, "/", 2)[0], ".") {
+			other = append(other, s)
+		} else {
+			std = append(std, s)
+		}
+	}
+
+	// Replace the import declarations with a single grouped one.
+	var buf bytes.Buffer
+	start, end := fset.Position(f.Name.End()).Offset, fset.Position(f.Name.End()).Offset
+	for _, d := range f.Decls {
+		if g, ok := d.(*ast.GenDecl); ok && g.Tok == token.IMPORT {
+			end = fset.Position(g.End()).Offset
+		}
+	}
+	buf.Write(src[:start])
+	buf.WriteString("\n\n")
+	if len(std)+len(other) > 0 {
+		buf.WriteString("import (\n")
+		for i, group := range [][]string{std, other} {
+			if i > 0 && len(std) > 0 && len(other) > 0 {
+				buf.WriteString("\n")
+			}
+			for _, s := range group {
+				fmt.Fprintf(&buf, "\t%s\n", s)
+			}
+		}
+		buf.WriteString(")\n")
+	}
+	buf.Write(src[end:])
+
+	out, err := format.Source(buf.Bytes())
+	if err != nil {
+		return nil, fmt.Errorf("formatting generated code: %v", err)
+	}
+	return out, nil
+}
+
+// isMajorVersion reports whether the path element elem is a major version
+// suffix, such as v2.
+func isMajorVersion(elem string) bool {
+	if len(elem) < 2 || elem[0] != 'v' || elem[1] == '0' {
+		return false
+	}
+	for _, r := range elem[1:] {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,64 @@
+package gen
+
+import "testing"
+
+func TestFormat(t *testing.T) {
+	for _, tt := range []struct{ src, want string }{
+		{
+			src: `// Code generated by go-gen-syncmap. DO NOT EDIT.
+
+package cache
+
+import (
+	"github.com/acme/model"
+	"github.com/acme/kit/v2"
+	"github.com/redis/go-redis/v9"
+	"gopkg.in/yaml.v3"
+	"strings"
+	"sync"
+	j "encoding/json"
+	"bytes"
+)
+
+func f(json int) ( *model.User, sync.Mutex, j.Number) {
+	var b bytes.Buffer
+	_ = json
+	return nil, sync.Mutex{}, ""
+}
+`,
+			want: `// Code generated by go-gen-syncmap. DO NOT EDIT.
+
+package cache
+
+import (
+	"bytes"
+	j "encoding/json"
+	"sync"
+
+	"github.com/acme/model"
+	"github.com/redis/go-redis/v9"
+	"gopkg.in/yaml.v3"
+)
+
+func f(json int) (*model.User, sync.Mutex, j.Number) {
+	var b bytes.Buffer
+	_ = json
+	return nil, sync.Mutex{}, ""
+}
+`,
+		},
+		{
+			src:  "package cache\nimport \"sync\"\nvar n int\n",
+			want: "package cache\n\nvar n int\n",
+		},
+	} {
+		got, err := Format([]byte(tt.src))
+		if err != nil {
+			t.Errorf("Format(%q): %v", tt.src, err)
+			continue
+		}
+		if string(got) != tt.want {
+			t.Errorf("Format(%q) = %s; want %s", tt.src, got, tt.want)
+		}
+	}
+}
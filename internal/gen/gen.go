@@ -0,0 +1,1633 @@
+// Package gen specializes the syncmap template package for concrete key and
+// value types.
+//
+// The template is an ordinary Go package that is compiled and tested with
+// placeholder types KeyT and ValueT. Generate parses its files and replaces
+// every reference to the placeholders with the configured type expressions,
+// so the template must only use KeyT and ValueT in type position (never as a
+// conversion such as KeyT(0)).
+package gen
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"go/ast"
+	"go/build/constraint"
+	"go/parser"
+	"go/token"
+	"go/types"
+	"go/version"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"runtime/debug"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	templates "github.com/cristaloleg/go-gen-syncmap"
+)
+
+// TemplatePackage is the import path of the template package.
+const TemplatePackage = "github.com/cristaloleg/go-gen-syncmap/syncmap"
+
+// Config describes a map to generate.
+type Config struct {
+	// Package is the package clause of the generated file.
+	Package string
+
+	// Dir is the directory of the package of the generated file, whose
+	// types the key and value may name, or the current directory if empty.
+	Dir string
+
+	// Name is the name of the generated map type, "Map" if empty. Otherwise,
+	// the other package-level identifiers of the template are renamed after
+	// it, so that several maps can be generated into one package. If Name is
+	// unexported, so are they.
+	Name string
+
+	// Unexported makes Name unexported by lowering its first letter. It
+	// requires Name to be set, since "map" is a keyword.
+	Unexported bool
+
+	// Key and Value are the key and value type expressions, such as "string"
+	// or "*User". Types of other packages are qualified by import path, as in
+	// "*github.com/acme/model.User", and are imported by the generated file.
+	Key   string
+	Value string
+
+	// Hash and Equal are the hash and equality functions of keys, such as
+	// "github.com/acme/model.HashKey", of types
+	// func(seed maphash.Seed, key K) uint64 and func(a, b K) bool for the
+	// key type K, which must agree: equal keys have equal hashes. Given
+	// both, the map compares keys with Equal rather than ==, so that keys
+	// needn't be comparable, and may be normalized, as are case-insensitive
+	// strings. Only implementations holding keys in hash tables of their own,
+	// CustomKeyImpls, support them.
+	Hash  string
+	Equal string
+
+	// NoJSON omits the MarshalJSON and UnmarshalJSON methods.
+	NoJSON bool
+
+	// NoCompare omits the methods comparing values with ==, such as
+	// CompareAndSwap, so that the value type needn't be comparable. It is
+	// implied for value types that are known not to be comparable.
+	NoCompare bool
+
+	// Build is a build constraint expression for the generated file, such
+	// as "!tinygo".
+	Build string
+
+	// GoVersion is the minimum Go version of the generated file, such as
+	// "1.21". It is added to the build constraint, and selects the template
+	// variants the version supports, such as the iterators of Go 1.23. By
+	// default, the generated file supports every version the template does.
+	GoVersion string
+
+	// Tests generates the portable tests of the template package along with
+	// the map, into a file of their own, with the i-th key and value they use
+	// given by the Go expressions KeyFactory and ValueFactory in terms of
+	// i int, such as "UserID(i)". Keys must be distinct for distinct i. The
+	// factories default to conversions for numeric types and to
+	// strconv.Itoa(i) for strings. Like types, they may be qualified by
+	// import path.
+	Tests        bool
+	KeyFactory   string
+	ValueFactory string
+
+	// Benchmarks generates the benchmarks of the template package along with
+	// the map, like Tests, with keys and values given by the same
+	// factories. The benchmarks of every implementation have the same
+	// names, so that their results can be compared.
+	Benchmarks bool
+
+	// PropertyTests generates the property tests of the template along with
+	// the map, like Tests: they check invariants such as that no LoadOrStore
+	// is lost under randomized concurrent workloads, and are best run with
+	// -race.
+	PropertyTests bool
+
+	// Examples generates the runnable examples of the template along with
+	// the map, like Tests, so that the documentation of its package shows
+	// how to use it, and go test checks that the examples still compile and
+	// run.
+	Examples bool
+
+	// Linearizability generates a test recording histories of concurrent
+	// operations on the map, and checking that a sequential map could
+	// have produced them, like Tests. It gives much stronger evidence of the
+	// correctness of an implementation than the race detector.
+	Linearizability bool
+
+	// Extensions are the paths of Go files adding declarations to the map,
+	// such as methods every map of a team should have. They are written
+	// like the files of the template package, in terms of Map, KeyT, and
+	// ValueT, and may use its unexported declarations; they are renamed and
+	// specialized along with it. Extensions named like _test.go files add
+	// tests, which are generated along with those of the template, if any.
+	Extensions []string
+
+	// Kind is what to generate, one of Kinds: by default a map, or a pool,
+	// which is a typed sync.Pool of pointers to Value, and has no Key. The
+	// kinds other than map have template packages of their own, and none of
+	// the options of maps but Tests and Extensions.
+	Kind string
+
+	// Impl is the backing implementation, one of Impls. The default,
+	// "syncmap", is sync.Map's algorithm and has the full API; the others
+	// only have the core API shared with sync.Map.
+	Impl string
+
+	// Padded pads the shards of the implementations splitting the map into
+	// them, and the fields that readers and writers of the map contend on,
+	// to separate cache lines, so that cores writing one don't slow down
+	// those reading another. It costs 128 bytes per shard or field, which
+	// only maps under heavy concurrent use are worth.
+	Padded bool
+
+	// TTL gives the map StoreWithTTL, storing values that expire, and
+	// DeleteExpired, which the option WithJanitor calls periodically until
+	// the map is closed. Every value is then boxed with its expiry, even a
+	// pointer, and loads check it. Only the default implementation has TTLs.
+	TTL bool
+
+	// Loader gives the map the option WithLoader, setting a function that
+	// loads the values of the keys loads miss, such as from a database, and
+	// GetE, which returns the errors of the loader. Concurrent misses of a
+	// key share a single call of the loader, the option WithRefreshAfter has
+	// loads refresh the values older than an age in the background, and
+	// WithNegativeTTL remembers the keys the loader didn't find for a while.
+	// Only the default implementation has loaders.
+	Loader bool
+
+	// Backend gives the map the option WithBackend, making it a cache of a
+	// store, such as a key-value store, that it reads through by its loader
+	// and writes through to, or behind with WithWriteBehind, and StoreE and
+	// DeleteE, which return the errors of the store. It implies Loader.
+	Backend bool
+
+	// Metrics gives the map Metrics, returning the numbers of hits, misses,
+	// stores, deletions, evictions, expirations, and loader errors, which the
+	// map counts atomically. Only the default implementation has metrics.
+	Metrics bool
+
+	// Prometheus gives a map with Metrics the method Collector, returning a
+	// prometheus.Collector that exports them along with the number of
+	// entries. The generated file then imports
+	// github.com/prometheus/client_golang/prometheus.
+	Prometheus bool
+
+	// OTel gives a map with Metrics the options WithMeter, reporting its hit
+	// ratio, its number of entries, and the duration of the calls of its
+	// loader to an OpenTelemetry meter, and WithTracer, tracing the calls of
+	// its loader. The generated file then imports OpenTelemetry.
+	OTel bool
+
+	// Redis generates, along with the map, the type <Name>Redis, a map of the
+	// same keys and values held by a Redis server, with the Load, Store,
+	// LoadOrStore, Delete, and Range methods of the map, which it encodes
+	// keys and values for as JSON. The generated file then imports
+	// github.com/redis/go-redis/v9.
+	Redis bool
+
+	// MaxEntries, if positive, bounds the map to that many entries: storing a
+	// new key into a full map evicts the entries used least recently, as
+	// approximated by sampling a few entries stamped with the time of their
+	// last use, which loads record without locking. The option
+	// WithMaxEntries overrides the bound of a map. Only the default
+	// implementation has bounds.
+	MaxEntries int
+
+	// Eviction is the policy choosing the entries evicted from a map with
+	// MaxEntries, one of Evictions. The default, "lru", evicts the entries
+	// used least recently. "tinylfu" evicts those used least often, as
+	// estimated by a sketch which every use of a key updates, and only admits
+	// a new key into a full map if it was used at least as often as the entry
+	// it would replace, which resists scans of keys used once at the cost of
+	// slower loads. It requires Go 1.24 and MaxEntries, which sizes the
+	// sketch.
+	Eviction string
+
+	// Cost is the function of type func(ValueT) int64 giving the cost of a
+	// value, such as its size in bytes, and MaxCost the budget of the map:
+	// writes raising the total cost of its values above the budget evict
+	// entries as MaxEntries does, until it's within the budget again, so that
+	// maps of values of varying sizes are bounded by the memory they take.
+	// Both are given together, along with MaxEntries or not, and the option
+	// WithMaxCost overrides the budget of a map. The function is written
+	// like Hash, and called whenever a value is stored or deleted, so it
+	// must be cheap, and give the same cost for a value as long as it's in
+	// the map. Only the default implementation has budgets.
+	Cost    string
+	MaxCost int64
+
+	// Mode is how the map is generated, one of Modes. By default,
+	// "specialized", the template is specialized for the key and value
+	// types. With "generic", the map is instead a thin wrapper over Map of
+	// GenericPackage: an alias of its instance for the types, and
+	// constructors, so that it needn't be regenerated when the template
+	// changes. A generic map has the API of the default implementation, whose
+	// methods comparing values panic if they aren't comparable, and can't be
+	// adapted by the options changing the generated code, such as Impl,
+	// Tests, or NoJSON. It requires Go 1.24.
+	Mode string
+
+	// keyTag and valueTag are set by GenerateFiles to the build tags
+	// selecting the template files specialized for the key and value types,
+	// if any.
+	keyTag   string
+	valueTag string
+
+	// binary is set by GenerateFiles if MarshalBinary can encode the keys
+	// and values.
+	binary bool
+}
+
+// Kinds lists the kinds of types that can be generated. Each kind but the
+// first, map, is a subpackage of TemplatePackage of the same name.
+var Kinds = []string{"map", "pool", "set", "countermap", "multimap", "bimap"}
+
+// kindTypes are the names of the types the template packages of Kinds
+// declare, other than templateName.
+var kindTypes = map[string]string{"pool": "Pool", "set": "Set", "countermap": "CounterMap", "multimap": "Multimap", "bimap": "Bimap"}
+
+// keyless lists the Kinds with no key type.
+var keyless = map[string]bool{"pool": true}
+
+// valueless lists the Kinds with no value type.
+var valueless = map[string]bool{"set": true, "countermap": true}
+
+// kind returns the kind of c, one of Kinds.
+func (c Config) kind() string {
+	if c.Kind == "" {
+		return Kinds[0]
+	}
+	return c.Kind
+}
+
+// typeName returns the name of the type the template package of c declares.
+func (c Config) typeName() string {
+	if name, ok := kindTypes[c.kind()]; ok {
+		return name
+	}
+	return templateName
+}
+
+// hasKeys reports whether c has a key type.
+func (c Config) hasKeys() bool {
+	return !keyless[c.kind()]
+}
+
+// hasValues reports whether c has a value type.
+func (c Config) hasValues() bool {
+	return !valueless[c.kind()]
+}
+
+// Impls lists the implementations a map can be generated with. Each is a
+// template package: "syncmap" is TemplatePackage itself, and the others
+// are its subpackages of the same name.
+var Impls = []string{"syncmap", "rwmutex", "sharded", "striped", "cow", "ctrie", "robinhood", "swiss"}
+
+// portableTests are the test files of TemplatePackage that only use the API
+// shared by every implementation. The other implementations have no copies
+// of them: they're generated along with the maps of each from this one.
+var portableTests = []string{
+	"bench_test.go", "compare_test.go", "conformance_test.go", "example_test.go",
+	"fuzz_test.go", "linearizability_test.go", "property_test.go",
+}
+
+// SharedDir is the directory, within that of TemplatePackage, of the package
+// holding what the template packages have in common. A template importing
+// it is generated with the files of it declaring the names it uses.
+const SharedDir = "internal/shared"
+
+// Evictions lists the eviction policies of maps with MaxEntries.
+var Evictions = []string{"lru", "tinylfu"}
+
+// Modes lists the ways a map can be generated: specialized from the
+// template, or as a wrapper over the generic package.
+var Modes = []string{"specialized", "generic"}
+
+// generic reports whether c is generated as a wrapper over the generic
+// package.
+func (c Config) generic() bool {
+	return c.Mode == Modes[1]
+}
+
+// CustomKeyImpls lists the implementations supporting Config.Hash and
+// Config.Equal. The others hold keys in Go maps.
+var CustomKeyImpls = []string{"striped", "ctrie", "robinhood", "swiss"}
+
+// templateDir returns the directory of the template package of c within
+// the directory dir of TemplatePackage.
+func (c Config) templateDir(dir string) string {
+	if c.kind() != Kinds[0] {
+		return path.Join(dir, c.kind())
+	}
+	if c.Impl == "" || c.Impl == Impls[0] {
+		return dir
+	}
+	return path.Join(dir, c.Impl)
+}
+
+// templateFS returns the file system holding TemplatePackage and its
+// directory in it: dir if it isn't empty, or else the template embedded in
+// the generator.
+func templateFS(dir string) (fs.FS, string) {
+	if dir == "" {
+		return templates.FS, "syncmap"
+	}
+	return os.DirFS(dir), "."
+}
+
+// Version is the version of go-gen-syncmap, as recorded in the build info of
+// a binary installed from a release, or empty for development builds.
+var Version = moduleVersion()
+
+func moduleVersion() string {
+	info, ok := debug.ReadBuildInfo()
+	if !ok || info.Main.Path != path.Dir(TemplatePackage) {
+		return ""
+	}
+	return releaseVersion(info.Main.Version)
+}
+
+// pseudoVersion matches the suffix of pseudo-versions, which the go command
+// stamps on binaries built from a checkout.
+var pseudoVersion = regexp.MustCompile(`[-.]?(0\.)?[0-9]{14}-[0-9a-f]{12}$`)
+
+// releaseVersion returns the module version v if it's a release, or an empty
+// string if it's a pseudo-version or has build metadata such as +dirty: those
+// change with every commit, and would change every generated file with them.
+func releaseVersion(v string) string {
+	if !strings.HasPrefix(v, "v") || strings.Contains(v, "+") || pseudoVersion.MatchString(v) {
+		return ""
+	}
+	return v
+}
+
+// generatedPrefix starts the header of generated files.
+const generatedPrefix = "// Code generated by go-gen-syncmap"
+
+// generatedHeader returns the header marking generated files, as recognized
+// by go generate and linters, for a file generated from the template whose
+// hash is sum.
+func generatedHeader(sum []byte) string {
+	v := ""
+	if Version != "" {
+		v = " " + Version
+	}
+	return fmt.Sprintf("%s%s (template sha %x). DO NOT EDIT.\n", generatedPrefix, v, sum[:6])
+}
+
+// mainFile is the template file declaring the Map type.
+const mainFile = "syncmap.go"
+
+// templateName is the name of the map type in the template.
+const templateName = "Map"
+
+// placeholders are the template's type parameters, declared in types.go.
+var placeholders = [...]string{"KeyT", "ValueT"}
+
+// keyFuncs are the placeholders of the hash and equality functions of keys,
+// declared by the template packages in CustomKeyImpls.
+var keyFuncs = [...]string{"hashKeyT", "equalKeyT"}
+
+// Validate reports whether c describes a map that can be generated.
+func (c Config) Validate() error {
+	if c.Package == "" {
+		return errors.New("package name is required")
+	}
+	if !token.IsIdentifier(c.Package) {
+		return fmt.Errorf("invalid package name %q", c.Package)
+	}
+	if c.Unexported && c.Name == "" {
+		return errors.New("an unexported map needs a name")
+	}
+	if name := c.name(); !token.IsIdentifier(name) || name == "_" {
+		return fmt.Errorf("invalid type name %q", name)
+	}
+	for _, f := range [...]struct{ name, expr string }{{"key", c.KeyFactory}, {"value", c.ValueFactory}} {
+		if f.expr == "" {
+			continue
+		}
+		if _, err := parser.ParseExpr(normalize(f.expr)); err != nil {
+			return fmt.Errorf("invalid %s factory %q: %v", f.name, f.expr, err)
+		}
+	}
+	if c.Kind != "" && !contains(Kinds, c.Kind) {
+		return fmt.Errorf("unknown kind %q: must be one of %s", c.Kind, strings.Join(Kinds, ", "))
+	}
+	if !c.hasKeys() && (c.Key != "" || c.KeyFactory != "") {
+		return fmt.Errorf("%s %s has no key type", c.kind(), c.name())
+	}
+	if !c.hasValues() && (c.Value != "" || c.ValueFactory != "") {
+		return fmt.Errorf("%s %s has no value type", c.kind(), c.name())
+	}
+	for _, t := range [...]struct{ name, expr string }{{"key", c.Key}, {"value", c.Value}} {
+		if t.name == "key" && !c.hasKeys() || t.name == "value" && !c.hasValues() {
+			continue
+		}
+		if t.expr == "" {
+			return fmt.Errorf("%s type is required", t.name)
+		}
+		if _, err := parser.ParseExpr(normalize(t.expr)); err != nil {
+			return fmt.Errorf("invalid %s type %q: %v", t.name, t.expr, err)
+		}
+	}
+	if c.hasTests() {
+		for _, f := range [...]struct{ name, typ, expr string }{{"key", c.Key, c.KeyFactory}, {"value", c.Value, c.ValueFactory}} {
+			if factory(f.typ, f.expr) == "" && (f.name == "key" && c.hasKeys() || f.name == "value" && c.hasValues()) {
+				return fmt.Errorf("tests of %s need a %s factory for type %s", c.name(), f.name, f.typ)
+			}
+		}
+	}
+	if c.Impl != "" && !contains(Impls, c.Impl) {
+		return fmt.Errorf("unknown implementation %q: must be one of %s", c.Impl, strings.Join(Impls, ", "))
+	}
+	if c.Mode != "" && !contains(Modes, c.Mode) {
+		return fmt.Errorf("unknown mode %q: must be one of %s", c.Mode, strings.Join(Modes, ", "))
+	}
+	if c.kind() != Kinds[0] {
+		for _, o := range [...]struct {
+			name string
+			set  bool
+		}{
+			{"another implementation", c.Impl != "" && c.Impl != Impls[0]},
+			{"the generic mode", c.generic()},
+			{"hash and equality functions", c.Hash != ""},
+			{"tests other than Tests", c.Benchmarks || c.PropertyTests || c.Examples || c.Linearizability},
+			{"padding", c.Padded},
+			{"TTLs", c.TTL},
+			{"a loader", c.Loader},
+			{"a backend", c.Backend},
+			{"metrics", c.Metrics},
+			{"a Redis type", c.Redis},
+			{"a bound", c.MaxEntries != 0},
+			{"a budget", c.MaxCost != 0},
+		} {
+			if o.set {
+				return fmt.Errorf("%s %s can't have %s: only maps have it", c.kind(), c.name(), o.name)
+			}
+		}
+	}
+	if c.generic() {
+		for _, o := range [...]struct {
+			name string
+			set  bool
+		}{
+			{"another implementation", c.Impl != "" && c.Impl != Impls[0]},
+			{"hash and equality functions", c.Hash != ""},
+			{"tests", c.hasTests()},
+			{"extensions", len(c.Extensions) > 0},
+			{"NoJSON", c.NoJSON},
+			{"NoCompare", c.NoCompare},
+			{"padding", c.Padded},
+			{"TTLs", c.TTL},
+			{"a loader", c.Loader},
+			{"a backend", c.Backend},
+			{"metrics", c.Metrics},
+			{"a Redis type", c.Redis},
+			{"a bound", c.MaxEntries != 0},
+			{"a budget", c.MaxCost != 0},
+		} {
+			if o.set {
+				return fmt.Errorf("generic map %s can't have %s: it is an instance of %s.Map", c.name(), o.name, GenericPackage)
+			}
+		}
+	}
+	if (c.Hash == "") != (c.Equal == "") {
+		return fmt.Errorf("the hash and equality functions of the keys of %s must be given together", c.name())
+	}
+	for _, f := range [...]struct{ name, expr string }{{"hash", c.Hash}, {"equality", c.Equal}} {
+		if f.expr == "" {
+			continue
+		}
+		if _, err := parser.ParseExpr(normalize(f.expr)); err != nil {
+			return fmt.Errorf("invalid %s function %q: %v", f.name, f.expr, err)
+		}
+	}
+	if c.Hash != "" && !contains(CustomKeyImpls, c.Impl) {
+		impl := c.Impl
+		if impl == "" {
+			impl = Impls[0]
+		}
+		return fmt.Errorf("implementation %s holds keys in Go maps, so it can't use custom hash and equality functions: "+
+			"use one of %s", impl, strings.Join(CustomKeyImpls, ", "))
+	}
+	if c.TTL && c.Impl != "" && c.Impl != Impls[0] {
+		return fmt.Errorf("implementation %s can't have TTLs: use %s", c.Impl, Impls[0])
+	}
+	if c.Loader && c.Impl != "" && c.Impl != Impls[0] {
+		return fmt.Errorf("implementation %s can't have a loader: use %s", c.Impl, Impls[0])
+	}
+	if c.Backend && c.Impl != "" && c.Impl != Impls[0] {
+		return fmt.Errorf("implementation %s can't have a backend: use %s", c.Impl, Impls[0])
+	}
+	if c.Metrics && c.Impl != "" && c.Impl != Impls[0] {
+		return fmt.Errorf("implementation %s can't have metrics: use %s", c.Impl, Impls[0])
+	}
+	if c.Prometheus && !c.Metrics {
+		return fmt.Errorf("the Prometheus collector of %s needs its metrics", c.name())
+	}
+	if c.OTel && !c.Metrics {
+		return fmt.Errorf("the OpenTelemetry instruments of %s need its metrics", c.name())
+	}
+	if c.Redis && c.Impl != "" && c.Impl != Impls[0] {
+		return fmt.Errorf("implementation %s can't have a Redis type: use %s", c.Impl, Impls[0])
+	}
+	if c.Redis && c.NoJSON {
+		return fmt.Errorf("the Redis type of %s encodes keys and values as JSON, so it can't have NoJSON", c.name())
+	}
+	if c.MaxEntries < 0 {
+		return fmt.Errorf("invalid number of entries %d", c.MaxEntries)
+	}
+	if c.MaxEntries > 0 && c.Impl != "" && c.Impl != Impls[0] {
+		return fmt.Errorf("implementation %s can't be bounded: use %s", c.Impl, Impls[0])
+	}
+	if (c.Cost == "") != (c.MaxCost == 0) {
+		return fmt.Errorf("the cost function and budget of %s must be given together", c.name())
+	}
+	if c.MaxCost < 0 {
+		return fmt.Errorf("invalid budget %d", c.MaxCost)
+	}
+	if c.Cost != "" {
+		if _, err := parser.ParseExpr(normalize(c.Cost)); err != nil {
+			return fmt.Errorf("invalid cost function %q: %v", c.Cost, err)
+		}
+		if c.Impl != "" && c.Impl != Impls[0] {
+			return fmt.Errorf("implementation %s can't have a budget: use %s", c.Impl, Impls[0])
+		}
+	}
+	if c.Eviction != "" {
+		if !contains(Evictions, c.Eviction) {
+			return fmt.Errorf("unknown eviction policy %q: must be one of %s", c.Eviction, strings.Join(Evictions, ", "))
+		}
+		if c.MaxEntries == 0 {
+			return fmt.Errorf("eviction policy %s needs a bound on the number of entries of %s", c.Eviction, c.name())
+		}
+	}
+	if c.Build != "" {
+		if _, err := constraint.Parse("//go:build " + c.Build); err != nil {
+			return fmt.Errorf("invalid build constraint %q: %v", c.Build, err)
+		}
+	}
+	if c.GoVersion != "" {
+		if !version.IsValid(c.goVersion()) {
+			return fmt.Errorf("invalid Go version %q", c.GoVersion)
+		}
+		if min := implGoVersion[c.Impl]; min != "" && version.Compare(c.goVersion(), min) < 0 {
+			return fmt.Errorf("implementation %s requires Go %s", c.Impl, strings.TrimPrefix(min, "go"))
+		}
+		if c.Eviction == Evictions[1] && version.Compare(c.goVersion(), "go1.24") < 0 {
+			return fmt.Errorf("eviction policy %s requires Go 1.24", c.Eviction) // maphash.Comparable
+		}
+		if c.generic() && version.Compare(c.goVersion(), genericGoVersion) < 0 {
+			return fmt.Errorf("generic map %s requires Go %s", c.name(), strings.TrimPrefix(genericGoVersion, "go"))
+		}
+	}
+	return nil
+}
+
+// implGoVersion lists the implementations that need a newer Go version than
+// the rest of the template.
+var implGoVersion = map[string]string{
+	"sharded":   "go1.24", // maphash.Comparable
+	"striped":   "go1.24", // maphash.Comparable
+	"ctrie":     "go1.24", // maphash.Comparable
+	"robinhood": "go1.24", // maphash.Comparable
+	"swiss":     "go1.24", // maphash.Comparable
+}
+
+// goVersion returns GoVersion in the form of a build tag, such as "go1.21".
+func (c Config) goVersion() string {
+	if c.GoVersion == "" {
+		return ""
+	}
+	return "go" + strings.TrimPrefix(c.GoVersion, "go")
+}
+
+// buildConstraint returns the build constraint of the generated file, or
+// nil if it has none.
+func (c Config) buildConstraint() constraint.Expr {
+	var x constraint.Expr
+	if c.GoVersion != "" {
+		x = &constraint.TagExpr{Tag: version.Lang(c.goVersion())}
+	}
+	if c.Build != "" {
+		b, _ := constraint.Parse("//go:build " + c.Build)
+		if x == nil {
+			return b
+		}
+		x = &constraint.AndExpr{X: x, Y: b}
+	}
+	return x
+}
+
+// keyTags are the build tags of the template files specialized for keys:
+// syncmap_intkey for integers, syncmap_stringkey for strings, and
+// syncmap_customkey for keys hashed and compared by Hash and Equal.
+var keyTags = []string{"syncmap_intkey", "syncmap_stringkey", "syncmap_customkey"}
+
+// valueTags are the build tags of the template files specialized for
+// values: syncmap_ptrvalue for pointers, which entries hold as they are
+// rather than boxed.
+var valueTags = []string{"syncmap_ptrvalue"}
+
+// paddedTag is the build tag of the template files padding the maps
+// generated with Padded.
+const paddedTag = "syncmap_padded"
+
+// ttlTag is the build tag of the template files of maps generated with TTL.
+const ttlTag = "syncmap_ttl"
+
+// loaderTag is the build tag of the template files of maps generated with
+// Loader.
+const loaderTag = "syncmap_loader"
+
+// metricsTag is the build tag of the template files of maps generated with
+// Metrics.
+const metricsTag = "syncmap_metrics"
+
+// backendTag is the build tag of the template files of maps generated with
+// Backend.
+const backendTag = "syncmap_backend"
+
+// prometheusTag is the build tag of the template files of maps generated
+// with Prometheus.
+const prometheusTag = "syncmap_prometheus"
+
+// otelTag is the build tag of the template files of maps generated with
+// OTel.
+const otelTag = "syncmap_otel"
+
+// redisTag is the build tag of the template files of maps generated with
+// Redis.
+const redisTag = "syncmap_redis"
+
+// lruTag is the build tag of the template files of maps generated with
+// MaxEntries or MaxCost, which evict entries.
+const lruTag = "syncmap_lru"
+
+// costTag is the build tag of the template files of maps generated with
+// MaxCost.
+const costTag = "syncmap_cost"
+
+// tinyLFUTag is the build tag of the template files of maps evicting entries
+// by the tinylfu policy of Evictions.
+const tinyLFUTag = "syncmap_tinylfu"
+
+// maxEntries is the placeholder of MaxEntries, declared by the template
+// files of lruTag.
+const maxEntries = "maxEntriesT"
+
+// costFuncs are the placeholders of Cost and MaxCost, declared by the
+// template files of costTag.
+var costFuncs = [...]string{"costValueT", "maxCostT"}
+
+// satisfies reports whether the generated file selects the template file
+// constrained by x: that is, whether x holds for GoVersion, the oldest Go
+// version the file may be built with. Of keyTags and valueTags, only those
+// selected for the key and value types are set. paddedTag, ttlTag,
+// metricsTag, prometheusTag, otelTag, redisTag, and backendTag are set if
+// Padded, TTL, Metrics, Prometheus, OTel, Redis, and Backend are; loaderTag
+// if Loader or Backend is; lruTag if MaxEntries or MaxCost is; costTag if
+// MaxCost is; and tinyLFUTag if Eviction is tinylfu. Other build tags are
+// considered unset.
+func (c Config) satisfies(x constraint.Expr) bool {
+	return x.Eval(func(tag string) bool {
+		switch {
+		case contains(keyTags, tag):
+			return tag == c.keyTag
+		case contains(valueTags, tag):
+			return tag == c.valueTag
+		case tag == paddedTag:
+			return c.Padded
+		case tag == ttlTag:
+			return c.TTL
+		case tag == loaderTag:
+			return c.Loader || c.Backend
+		case tag == metricsTag:
+			return c.Metrics
+		case tag == prometheusTag:
+			return c.Prometheus
+		case tag == otelTag:
+			return c.OTel
+		case tag == redisTag:
+			return c.Redis
+		case tag == backendTag:
+			return c.Backend
+		case tag == lruTag:
+			return c.MaxEntries > 0 || c.MaxCost > 0
+		case tag == costTag:
+			return c.MaxCost > 0
+		case tag == tinyLFUTag:
+			return c.Eviction == Evictions[1]
+		}
+		return c.GoVersion != "" && version.IsValid(tag) && version.Compare(c.goVersion(), tag) >= 0
+	})
+}
+
+func (c Config) name() string {
+	if c.Name == "" {
+		return c.typeName()
+	}
+	if c.Unexported {
+		return lowerFirst(c.Name)
+	}
+	return c.Name
+}
+
+// factory returns the expression in terms of i of the i-th test value of
+// type typ: given if it's set, or else a default for predeclared numeric and
+// string types, or an empty string if there is none.
+func factory(typ, given string) string {
+	if given != "" {
+		return given
+	}
+	if typ == "string" {
+		return "strconv.Itoa(i)"
+	}
+	if obj, ok := types.Universe.Lookup(typ).(*types.TypeName); ok {
+		if b, ok := obj.Type().(*types.Basic); ok && b.Info()&(types.IsInteger|types.IsFloat) != 0 {
+			return typ + "(i)"
+		}
+	}
+	return ""
+}
+
+// includeFile reports whether the template file f is part of the output for
+// c.
+func (c Config) includeFile(f templateFile) bool {
+	if f.constraint != nil && !c.satisfies(f.constraint) {
+		return false
+	}
+	if f.extension {
+		return !f.test || c.hasTests()
+	}
+	if f.test && !c.includeTest(f.name) {
+		return false
+	}
+	name := f.name
+	if f.test {
+		// Test files follow the file they test.
+		name = strings.TrimSuffix(name, "_test.go") + ".go"
+	}
+	if placeholderFile(name) {
+		return false
+	}
+	switch name {
+	case "binary.go":
+		return c.binary
+	case "persist.go", "snapshot.go":
+		// Persisted with the binary or the JSON methods.
+		return c.binary || !c.NoJSON
+	case "json.go", "debug.go", "expvar.go":
+		return !c.NoJSON
+	case "compare.go":
+		return !c.NoCompare
+	}
+	return true
+}
+
+// placeholderFile reports whether the template file name declares the
+// placeholders, or a variant of them.
+func placeholderFile(name string) bool {
+	return name == "types.go" || strings.HasPrefix(name, "types_")
+}
+
+// hasTests reports whether tests of some kind are generated along with c.
+func (c Config) hasTests() bool {
+	return c.Tests || c.Benchmarks || c.PropertyTests || c.Examples || c.Linearizability
+}
+
+// includeTest reports whether the template test file name is part of the
+// output for c: files ending in bench_test.go hold benchmarks, and those
+// ending in property_test.go, example_test.go, and linearizability_test.go
+// the tests of the option of the same name.
+func (c Config) includeTest(name string) bool {
+	switch {
+	case strings.HasSuffix(name, "bench_test.go"):
+		return c.Benchmarks
+	case strings.HasSuffix(name, "property_test.go"):
+		return c.PropertyTests
+	case strings.HasSuffix(name, "example_test.go"):
+		return c.Examples
+	case strings.HasSuffix(name, "linearizability_test.go"):
+		return c.Linearizability
+	case name == "lru_test.go":
+		// Lifts the bound of the maps of the other tests.
+		return c.hasTests()
+	}
+	return c.Tests
+}
+
+// Generate returns the formatted source of a map specialized for c, built
+// from the template package files in dir, the directory of TemplatePackage,
+// or from the template embedded in the generator if dir is empty.
+//
+// Template files carrying build constraints are included only if c's Go
+// version satisfies them, or for the tags of keyTags and valueTags, if
+// they're selected for c's keys and values.
+func Generate(c Config, dir string) ([]byte, error) {
+	return GenerateMany([]Config{c}, dir)
+}
+
+// GenerateMany is like Generate, but returns a single file holding a map for
+// each of cs, in order of name. The maps must share a package and have
+// distinct names.
+//
+// The output only depends on cs and the template, so generating the same
+// maps again produces the same bytes.
+func GenerateMany(cs []Config, dir string) ([]byte, error) {
+	src, err := GenerateSource(cs, dir)
+	if err != nil {
+		return nil, err
+	}
+	return Format(src)
+}
+
+// GenerateSource is like GenerateMany, but returns the source before it is
+// passed through Format.
+func GenerateSource(cs []Config, dir string) ([]byte, error) {
+	for _, c := range cs {
+		if c.hasTests() {
+			return nil, fmt.Errorf("the tests of %s need a file of their own: use GenerateFiles", c.name())
+		}
+	}
+	files, err := GenerateFiles(cs, dir, false)
+	if err != nil {
+		return nil, err
+	}
+	return files[0].Src, nil
+}
+
+// A File is a generated file.
+type File struct {
+	// Concern is the name of the template file the code comes from, without
+	// the .go extension, such as "json", or empty for the file declaring
+	// the map types, and for the whole output if it isn't split.
+	Concern string
+
+	// Src is the source of the file.
+	Src []byte
+}
+
+// GenerateFiles is like GenerateSource, but if split is set, it splits the
+// output by concern: the code generated from each template file is put in
+// a file of its own, which only imports what it uses. The file declaring the
+// map types comes first. Generated tests go to files of their own either
+// way, whose concern ends in "test".
+func GenerateFiles(cs []Config, dir string, split bool) ([]File, error) {
+	if len(cs) == 0 {
+		return nil, errors.New("no maps to generate")
+	}
+	// Order the maps by name, so that the output doesn't depend on the order
+	// they were listed in.
+	cs = append([]Config(nil), cs...)
+	sort.SliceStable(cs, func(i, j int) bool { return cs[i].name() < cs[j].name() })
+	seen := make(map[string]bool)
+	for i, c := range cs {
+		facts, _, err := c.check()
+		if err != nil {
+			return nil, err
+		}
+		if facts.incomparable {
+			cs[i].NoCompare = true
+		}
+		cs[i].keyTag, cs[i].valueTag = facts.keyTag, facts.valueTag
+		cs[i].binary = facts.binary
+		if c.Package != cs[0].Package {
+			return nil, fmt.Errorf("maps %s and %s are in different packages", cs[0].name(), c.name())
+		}
+		if c.Build != cs[0].Build || c.GoVersion != cs[0].GoVersion {
+			return nil, fmt.Errorf("maps %s and %s have different build constraints", cs[0].name(), c.name())
+		}
+		if seen[c.name()] {
+			return nil, fmt.Errorf("map %s is generated twice", c.name())
+		}
+		seen[c.name()] = true
+	}
+
+	fset := token.NewFileSet()
+	fsys, root := templateFS(dir)
+	parsed := make(map[string][]templateFile)
+	sum := sha256.New()
+	var paths []string
+	for _, c := range cs {
+		if c.generic() {
+			fmt.Fprintf(sum, "generic %s\n", GenericPackage)
+			continue
+		}
+		tdir := c.templateDir(root)
+		if _, ok := parsed[tdir]; ok {
+			continue
+		}
+		files, err := parseTemplate(fset, fsys, root, tdir)
+		if err != nil {
+			return nil, err
+		}
+		for _, f := range files {
+			fmt.Fprintf(sum, "%s %d\n", path.Join(c.templateDir(""), f.name), len(f.src))
+			sum.Write(f.src)
+			for _, spec := range f.ast.Imports {
+				path, err := strconv.Unquote(spec.Path.Value)
+				if err != nil {
+					return nil, err
+				}
+				paths = append(paths, path)
+			}
+		}
+		parsed[tdir] = files
+	}
+	extensions := make(map[string]templateFile)
+	for _, c := range cs {
+		for _, name := range c.Extensions {
+			if _, ok := extensions[name]; ok {
+				continue
+			}
+			src, err := os.ReadFile(name)
+			if err != nil {
+				return nil, err
+			}
+			f, err := parseFile(fset, name, src)
+			if err != nil {
+				return nil, err
+			}
+			f.extension = true
+			f.test = strings.HasSuffix(f.name, "_test.go")
+			fmt.Fprintf(sum, "extension %s %d\n", f.name, len(f.src))
+			sum.Write(f.src)
+			for _, spec := range f.ast.Imports {
+				path, err := strconv.Unquote(spec.Path.Value)
+				if err != nil {
+					return nil, err
+				}
+				paths = append(paths, path)
+			}
+			extensions[name] = f
+		}
+	}
+
+	var (
+		groups []*group
+		byName = make(map[string]*group)
+		q      = newQualifier(paths)
+	)
+	groupOf := func(concern string) *group {
+		g := byName[concern]
+		if g == nil {
+			g = &group{concern: concern, imports: make(map[string]string)}
+			byName[concern] = g
+			groups = append(groups, g)
+		}
+		return g
+	}
+	for _, c := range cs {
+		var key string
+		if c.hasKeys() {
+			k, err := q.qualify(c.Key)
+			if err != nil {
+				return nil, fmt.Errorf("key type of %s: %v", c.name(), err)
+			}
+			key = k
+		}
+		var value string
+		if c.hasValues() {
+			v, err := q.qualify(c.Value)
+			if err != nil {
+				return nil, fmt.Errorf("value type of %s: %v", c.name(), err)
+			}
+			value = v
+		}
+		if c.generic() {
+			b, err := genericWrapper(c, q, key, value)
+			if err != nil {
+				return nil, err
+			}
+			g := groupOf("")
+			for _, path := range append(importPaths(c.Key), append(importPaths(c.Value), GenericPackage)...) {
+				g.imports[path] = q.importSpec(path)
+			}
+			g.bodies = append(g.bodies, b)
+			continue
+		}
+		subst := make(map[string]string)
+		// The expressions each placeholder stands for, whose imports the
+		// files referring to it need.
+		exprs := make(map[string]string)
+		if c.hasKeys() {
+			subst[placeholders[0]] = key
+			exprs[placeholders[0]] = c.Key
+		}
+		if c.hasValues() {
+			subst[placeholders[1]] = value
+			exprs[placeholders[1]] = c.Value
+		}
+		if c.MaxEntries > 0 || c.MaxCost > 0 {
+			subst[maxEntries] = strconv.Itoa(c.MaxEntries)
+		}
+		if c.MaxCost > 0 {
+			x, err := q.qualifyExpr(c.Cost, false)
+			if err != nil {
+				return nil, fmt.Errorf("cost function of %s: %v", c.name(), err)
+			}
+			subst[costFuncs[0]] = x
+			exprs[costFuncs[0]] = c.Cost
+			subst[costFuncs[1]] = strconv.FormatInt(c.MaxCost, 10)
+		}
+		if c.Hash != "" {
+			for i, expr := range [...]string{c.Hash, c.Equal} {
+				x, err := q.qualifyExpr(expr, false)
+				if err != nil {
+					return nil, fmt.Errorf("key functions of %s: %v", c.name(), err)
+				}
+				subst[keyFuncs[i]] = x
+				exprs[keyFuncs[i]] = expr
+			}
+		}
+		files := parsed[c.templateDir(root)]
+		if len(c.Extensions) > 0 {
+			files = append([]templateFile(nil), files...)
+			for _, name := range c.Extensions {
+				files = append(files, extensions[name])
+			}
+		}
+		if name := c.name(); name != c.typeName() {
+			for _, f := range files {
+				for _, ident := range decls(f.ast) {
+					if _, ok := subst[ident]; !ok {
+						subst[ident] = rename(ident, c.typeName(), name)
+					}
+				}
+			}
+		}
+
+		var tests *group
+		for _, f := range files {
+			if !c.includeFile(f) {
+				continue
+			}
+			concern := ""
+			switch {
+			case split && f.name != mainFile:
+				concern = strings.TrimSuffix(f.name, ".go")
+			case f.test:
+				concern = "test"
+			}
+			g := groupOf(concern)
+			for _, cg := range f.ast.Comments {
+				// Text drops directives such as //go:build.
+				if cg.End() < f.ast.Package && cg != f.ast.Doc && cg.Text() != "" {
+					g.headers = appendUnique(g.headers, cg.Text())
+				}
+			}
+			for _, spec := range f.ast.Imports {
+				path, err := strconv.Unquote(spec.Path.Value)
+				if err != nil {
+					return nil, err
+				}
+				g.imports[path] = strconv.Quote(path)
+			}
+			for ident, expr := range exprs {
+				if len(refs(f.ast, map[string]string{ident: ""})) == 0 {
+					continue
+				}
+				for _, path := range importPaths(expr) {
+					g.imports[path] = q.importSpec(path)
+				}
+			}
+			g.bodies = append(g.bodies, body(fset, f.ast, f.src, subst))
+			if f.test && tests == nil {
+				tests = g
+			}
+		}
+
+		if c.hasTests() {
+			if tests == nil {
+				return nil, fmt.Errorf("template of %s has no tests", c.name())
+			}
+			b, err := factories(c, q, subst, tests.imports)
+			if err != nil {
+				return nil, err
+			}
+			tests.bodies = append(tests.bodies, b)
+		}
+	}
+
+	header := generatedHeader(sum.Sum(nil))
+	out := make([]File, len(groups))
+	for i, g := range groups {
+		var buf bytes.Buffer
+		buf.WriteString(header + "\n")
+		if x := cs[0].buildConstraint(); x != nil {
+			fmt.Fprintf(&buf, "//go:build %s\n\n", x)
+		}
+		for _, h := range g.headers {
+			for _, line := range strings.Split(strings.TrimSuffix(h, "\n"), "\n") {
+				fmt.Fprintf(&buf, "// %s\n", line)
+			}
+			buf.WriteString("\n")
+		}
+		fmt.Fprintf(&buf, "package %s\n\n", cs[0].Package)
+		if len(g.imports) > 0 {
+			paths := make([]string, 0, len(g.imports))
+			for path := range g.imports {
+				paths = append(paths, path)
+			}
+			sort.Strings(paths)
+			buf.WriteString("import (\n")
+			for _, path := range paths {
+				fmt.Fprintf(&buf, "\t%s\n", g.imports[path])
+			}
+			buf.WriteString(")\n")
+		}
+		for _, b := range g.bodies {
+			buf.WriteString("\n")
+			buf.Write(b)
+		}
+		out[i] = File{Concern: g.concern, Src: buf.Bytes()}
+	}
+	return out, nil
+}
+
+// testFactories are the functions returning the keys and values of the
+// template tests, declared by types_test.go.
+var testFactories = [...]string{"newKeyT", "newValueT"}
+
+// factories returns the declarations of the test factories of c, renamed by
+// subst, adding the imports they need to imports.
+func factories(c Config, q *qualifier, subst map[string]string, imports map[string]string) ([]byte, error) {
+	var buf bytes.Buffer
+	for i, f := range [...]struct{ typ, expr string }{{c.Key, c.KeyFactory}, {c.Value, c.ValueFactory}} {
+		if i == 0 && !c.hasKeys() || i == 1 && !c.hasValues() {
+			continue
+		}
+		expr := factory(f.typ, f.expr)
+		x, err := q.qualifyExpr(expr, false)
+		if err != nil {
+			return nil, fmt.Errorf("factory %s of %s: %v", expr, c.name(), err)
+		}
+		for _, path := range importPaths(expr) {
+			imports[path] = q.importSpec(path)
+		}
+		name := testFactories[i]
+		if r, ok := subst[name]; ok {
+			name = r
+		}
+		fmt.Fprintf(&buf, "func %s(i int) %s {\n\treturn %s\n}\n\n", name, subst[placeholders[i]], x)
+	}
+	return buf.Bytes(), nil
+}
+
+// group collects the code of a generated file.
+type group struct {
+	concern string
+	headers []string
+	imports map[string]string // import path -> spec
+	bodies  [][]byte
+}
+
+// importPaths returns the import paths of the qualified identifiers in the
+// type expression expr.
+func importPaths(expr string) []string {
+	var paths []string
+	for _, s := range qualifiedIdent.FindAllString(expr, -1) {
+		paths = append(paths, s[:strings.LastIndex(s, ".")])
+	}
+	return paths
+}
+
+// templateFile is a parsed file of a template package.
+type templateFile struct {
+	name       string // base name
+	ast        *ast.File
+	src        []byte
+	constraint constraint.Expr // nil if none
+	extension  bool            // listed in Config.Extensions
+	test       bool            // a test of the template package, or a test extension
+}
+
+// parseTemplate parses the files of the template package in the directory
+// dir of fsys, including the tests in the package itself, which are portable
+// to generated maps, but not those in the _test package. The template of an
+// implementation other than TemplatePackage, in root, also includes the
+// portableTests of root, and the package in SharedDir is inlined into those
+// importing it. The file declaring the map type comes first.
+func parseTemplate(fset *token.FileSet, fsys fs.FS, root, dir string) ([]templateFile, error) {
+	names, err := fs.Glob(fsys, path.Join(dir, "*.go"))
+	if err != nil {
+		return nil, err
+	}
+	if dir != root && contains(Impls, path.Base(dir)) {
+		for _, name := range portableTests {
+			names = append(names, path.Join(root, name))
+		}
+	}
+
+	var files []templateFile
+	used := make(map[string]bool)
+	for _, name := range names {
+		src, err := fs.ReadFile(fsys, name)
+		if err != nil {
+			return nil, err
+		}
+		f, err := parseFile(fset, name, src)
+		if err != nil {
+			return nil, err
+		}
+		if strings.HasSuffix(f.name, "_test.go") {
+			if strings.HasSuffix(f.ast.Name.Name, "_test") {
+				// Tests of the package API, which need its name.
+				continue
+			}
+			f.test = true
+		}
+		if src, ok := unqualifyShared(fset, f, used); ok {
+			test := f.test
+			if f, err = parseFile(fset, name, src); err != nil {
+				return nil, err
+			}
+			f.test = test
+		}
+		files = append(files, f)
+	}
+	if len(files) == 0 {
+		return nil, fmt.Errorf("no template files in %s", dir)
+	}
+	if len(used) > 0 {
+		shared, err := parseShared(fset, fsys, root, files[0].ast.Name.Name, used)
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, shared...)
+	}
+	sort.Slice(files, func(i, j int) bool {
+		// Emit the Map type itself first.
+		a, b := files[i].name, files[j].name
+		if (a == mainFile) != (b == mainFile) {
+			return a == mainFile
+		}
+		return a < b
+	})
+	return files, nil
+}
+
+// unqualifyShared returns the source of the template file f without its
+// import of the package in SharedDir, if it has one, and with the names of
+// that package it refers to unexported and unqualified, adding them to used.
+// The placeholders of files declaring them are left to the generator.
+func unqualifyShared(fset *token.FileSet, f templateFile, used map[string]bool) ([]byte, bool) {
+	if placeholderFile(f.name) {
+		return nil, false
+	}
+	var rs []replacement
+	pkg := ""
+	for _, d := range f.ast.Decls {
+		g, ok := d.(*ast.GenDecl)
+		if !ok || g.Tok != token.IMPORT {
+			continue
+		}
+		for _, spec := range g.Specs {
+			spec := spec.(*ast.ImportSpec)
+			if p, _ := strconv.Unquote(spec.Path.Value); p != path.Join(TemplatePackage, SharedDir) {
+				continue
+			}
+			pkg = path.Base(SharedDir)
+			if spec.Name != nil {
+				pkg = spec.Name.Name
+			}
+			var n ast.Node = spec
+			if !g.Lparen.IsValid() {
+				n = g
+			}
+			rs = append(rs, replacement{fset.Position(n.Pos()).Offset, fset.Position(n.End()).Offset, ""})
+		}
+	}
+	if pkg == "" {
+		return nil, false
+	}
+	ast.Inspect(f.ast, func(n ast.Node) bool {
+		if sel, ok := n.(*ast.SelectorExpr); ok {
+			if x, ok := sel.X.(*ast.Ident); ok && x.Name == pkg {
+				used[sel.Sel.Name] = true
+				rs = append(rs, replacement{fset.Position(sel.Pos()).Offset, fset.Position(sel.End()).Offset, lowerFirst(sel.Sel.Name)})
+			}
+		}
+		return true
+	})
+	return replace(f.src, rs), true
+}
+
+// parseShared parses the files of the package in SharedDir, within root,
+// declaring a name in used, and their tests, for a template package named
+// pkg: in package pkg, and with the names the shared package exports
+// unexported, in their code and their comments. The files declaring the
+// placeholders are left out, as the template package declares its own.
+func parseShared(fset *token.FileSet, fsys fs.FS, root, pkg string, used map[string]bool) ([]templateFile, error) {
+	names, err := fs.Glob(fsys, path.Join(root, SharedDir, "*.go"))
+	if err != nil {
+		return nil, err
+	}
+	var all []templateFile
+	exported := make(map[string]string)
+	declares := make(map[string]bool)
+	for _, name := range names {
+		src, err := fs.ReadFile(fsys, name)
+		if err != nil {
+			return nil, err
+		}
+		f, err := parseFile(fset, name, src)
+		if err != nil {
+			return nil, err
+		}
+		f.test = strings.HasSuffix(f.name, "_test.go")
+		if placeholderFile(f.name) || strings.HasSuffix(f.ast.Name.Name, "_test") {
+			continue
+		}
+		if !f.test {
+			for _, id := range decls(f.ast) {
+				if ast.IsExported(id) {
+					exported[id] = lowerFirst(id)
+				}
+				if used[id] {
+					declares[f.name] = true
+				}
+			}
+		}
+		all = append(all, f)
+	}
+	var words []string
+	for id := range exported {
+		words = append(words, regexp.QuoteMeta(id))
+	}
+	sort.Strings(words)
+	word := regexp.MustCompile(`\b(` + strings.Join(words, "|") + `)\b`)
+
+	var files []templateFile
+	for _, f := range all {
+		name := f.name
+		if f.test {
+			// Tests follow the file they test.
+			name = strings.TrimSuffix(name, "_test.go") + ".go"
+		}
+		if !declares[name] {
+			continue
+		}
+		rs := []replacement{{fset.Position(f.ast.Name.Pos()).Offset, fset.Position(f.ast.Name.End()).Offset, pkg}}
+		for _, id := range refs(f.ast, exported) {
+			rs = append(rs, replacement{fset.Position(id.Pos()).Offset, fset.Position(id.End()).Offset, exported[id.Name]})
+		}
+		for _, cg := range f.ast.Comments {
+			for _, c := range cg.List {
+				offset := fset.Position(c.Pos()).Offset
+				for _, m := range word.FindAllStringIndex(c.Text, -1) {
+					id := c.Text[m[0]:m[1]]
+					rs = append(rs, replacement{offset + m[0], offset + m[1], exported[id]})
+				}
+			}
+		}
+		test := f.test
+		if f, err = parseFile(fset, path.Join(root, SharedDir, f.name), replace(f.src, rs)); err != nil {
+			return nil, err
+		}
+		f.test = test
+		files = append(files, f)
+	}
+	return files, nil
+}
+
+// replacement replaces the bytes of a source file from pos to end with text.
+type replacement struct {
+	pos, end int
+	text     string
+}
+
+// replace returns src with the replacements rs, which don't overlap, made.
+func replace(src []byte, rs []replacement) []byte {
+	sort.Slice(rs, func(i, j int) bool { return rs[i].pos < rs[j].pos })
+	var out bytes.Buffer
+	offset := 0
+	for _, r := range rs {
+		out.Write(src[offset:r.pos])
+		out.WriteString(r.text)
+		offset = r.end
+	}
+	out.Write(src[offset:])
+	return out.Bytes()
+}
+
+// parseFile parses the template file name with contents src.
+func parseFile(fset *token.FileSet, name string, src []byte) (templateFile, error) {
+	// A checkout with CRLF line endings generates the same code.
+	src = bytes.ReplaceAll(src, []byte("\r\n"), []byte("\n"))
+	f, err := parser.ParseFile(fset, name, src, parser.ParseComments)
+	if err != nil {
+		return templateFile{}, err
+	}
+	x, err := buildConstraint(f)
+	if err != nil {
+		return templateFile{}, fmt.Errorf("%s: %v", name, err)
+	}
+	return templateFile{name: filepath.Base(name), ast: f, src: src, constraint: x}, nil
+}
+
+// decls returns the names of the package-level declarations in f, other than
+// methods and init functions, which can't be renamed.
+func decls(f *ast.File) []string {
+	var names []string
+	for _, d := range f.Decls {
+		switch d := d.(type) {
+		case *ast.FuncDecl:
+			if d.Recv == nil && d.Name.Name != "init" {
+				names = append(names, d.Name.Name)
+			}
+		case *ast.GenDecl:
+			for _, spec := range d.Specs {
+				switch spec := spec.(type) {
+				case *ast.TypeSpec:
+					names = append(names, spec.Name.Name)
+				case *ast.ValueSpec:
+					for _, name := range spec.Names {
+						names = append(names, name.Name)
+					}
+				}
+			}
+		}
+	}
+	return names
+}
+
+// rename returns the name of the template identifier ident in a map named
+// name, whose template declares the type typ, such as Map. For example, for
+// a map named UserCache:
+//
+//	Map             -> UserCache
+//	New             -> NewUserCache
+//	NewFromMap      -> NewUserCacheFromMap
+//	Entry           -> UserCacheEntry
+//	entry           -> userCacheEntry
+//	TestOps         -> TestUserCacheOps
+//	ExampleMap_Load -> ExampleUserCache_Load
+//
+// and for a map named userCache, whose identifiers are all unexported, and
+// whose unexported template identifiers are set apart by an underscore so
+// as not to collide with the exported ones:
+//
+//	Map             -> userCache
+//	New             -> newUserCache
+//	Entry           -> userCacheEntry
+//	entry           -> userCache_entry
+//	ExampleMap_Load -> Example_userCache_Load
+//
+// Examples are named after the identifier they document, or, if it's
+// unexported, as examples of the package, since go test ignores
+// ExampleuserCache and go vet rejects examples of unknown identifiers.
+func rename(ident, typ, name string) string {
+	exported := ast.IsExported(name)
+	switch {
+	case ident == typ:
+		return name
+	case !ast.IsExported(ident) && exported:
+		return lowerFirst(name) + upperFirst(ident)
+	case !ast.IsExported(ident):
+		return name + "_" + ident
+	case strings.HasPrefix(ident, "New") && exported:
+		return "New" + name + ident[len("New"):]
+	case strings.HasPrefix(ident, "New"):
+		return "new" + upperFirst(name) + ident[len("New"):]
+	}
+	if rest, ok := strings.CutPrefix(ident, "Example"); ok {
+		// Examples of the package become examples of the map.
+		id, suffix := typ, rest
+		if i := strings.Index(rest, "_"); i > 0 {
+			id, suffix = rest[:i], rest[i:]
+		} else if i < 0 && rest != "" {
+			id, suffix = rest, ""
+		}
+		if id = rename(id, typ, name); ast.IsExported(id) {
+			return "Example" + id + suffix
+		}
+		return "Example_" + id + suffix
+	}
+	for _, prefix := range [...]string{"Test", "Benchmark", "Fuzz"} {
+		if strings.HasPrefix(ident, prefix) {
+			// Keep the prefix go test looks for.
+			return prefix + upperFirst(name) + ident[len(prefix):]
+		}
+	}
+	return name + ident
+}
+
+// lowerFirst and upperFirst change the case of the first letter of s.
+func lowerFirst(s string) string {
+	r, n := utf8.DecodeRuneInString(s)
+	return string(unicode.ToLower(r)) + s[n:]
+}
+
+func upperFirst(s string) string {
+	r, n := utf8.DecodeRuneInString(s)
+	return string(unicode.ToUpper(r)) + s[n:]
+}
+
+// body returns the declarations of f following its imports, with every
+// reference to a name in subst replaced.
+func body(fset *token.FileSet, f *ast.File, src []byte, subst map[string]string) []byte {
+	start := f.Name.End()
+	for _, d := range f.Decls {
+		if g, ok := d.(*ast.GenDecl); ok && g.Tok == token.IMPORT {
+			start = g.End()
+		}
+	}
+
+	var out bytes.Buffer
+	offset := fset.Position(start).Offset
+	for _, id := range refs(f, subst) {
+		pos := fset.Position(id.Pos()).Offset
+		if pos < offset {
+			continue
+		}
+		out.Write(src[offset:pos])
+		out.WriteString(subst[id.Name])
+		offset = pos + len(id.Name)
+	}
+	out.Write(src[offset:])
+	return bytes.TrimLeft(out.Bytes(), "\n")
+}
+
+// refs returns the identifiers in f that refer to a package-level name in
+// names, in source order. Selectors, field names, and method names are not
+// references, even if they are spelled the same.
+func refs(f *ast.File, names map[string]string) []*ast.Ident {
+	var ids []*ast.Ident
+	skip := make(map[*ast.Ident]bool)
+	ast.Inspect(f, func(n ast.Node) bool {
+		switch n := n.(type) {
+		case *ast.SelectorExpr:
+			skip[n.Sel] = true
+		case *ast.FuncDecl:
+			if n.Recv != nil {
+				skip[n.Name] = true
+			}
+		case *ast.StructType:
+			for _, field := range n.Fields.List {
+				for _, name := range field.Names {
+					skip[name] = true
+				}
+			}
+		case *ast.InterfaceType:
+			for _, field := range n.Methods.List {
+				for _, name := range field.Names {
+					skip[name] = true
+				}
+			}
+		case *ast.Ident:
+			if _, ok := names[n.Name]; ok && !skip[n] {
+				ids = append(ids, n)
+			}
+		}
+		return true
+	})
+	return ids
+}
+
+// buildConstraint returns the //go:build constraint of f, or nil if it has
+// none.
+func buildConstraint(f *ast.File) (constraint.Expr, error) {
+	for _, cg := range f.Comments {
+		if cg.Pos() > f.Package {
+			break
+		}
+		for _, c := range cg.List {
+			if constraint.IsGoBuild(c.Text) {
+				return constraint.Parse(c.Text)
+			}
+		}
+	}
+	return nil, nil
+}
+
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+func appendUnique(list []string, s string) []string {
+	for _, v := range list {
+		if v == s {
+			return list
+		}
+	}
+	return append(list, s)
+}
@@ -0,0 +1,1232 @@
+package gen
+
+import (
+	"bytes"
+	"fmt"
+	"go/ast"
+	"go/importer"
+	"go/parser"
+	"go/token"
+	"go/types"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+const templateDir = "../../syncmap"
+
+// header matches the header of generated files.
+var header = regexp.MustCompile(`^// Code generated by go-gen-syncmap \(template sha ([0-9a-f]{12})\)\. DO NOT EDIT\.\n`)
+
+// typeCheck parses and type-checks src as a standalone package.
+func typeCheck(t *testing.T, src []byte) *types.Package {
+	t.Helper()
+	fset := token.NewFileSet()
+	f, err := parser.ParseFile(fset, "map_syncmap.go", src, parser.ParseComments)
+	if err != nil {
+		t.Fatalf("parsing generated code: %v\n%s", err, src)
+	}
+	conf := types.Config{Importer: importer.ForCompiler(fset, "source", nil)}
+	pkg, err := conf.Check(f.Name.Name, fset, []*ast.File{f}, nil)
+	if err != nil {
+		t.Fatalf("type-checking generated code: %v", err)
+	}
+	return pkg
+}
+
+// skipShort skips t under -short: t generates code and type-checks it, or
+// the maps it describes, against the source of the packages they import,
+// which takes seconds.
+func skipShort(t *testing.T) {
+	t.Helper()
+	if testing.Short() {
+		t.Skip("type-checks generated code; skipped under -short")
+	}
+}
+
+// binaryTypes lists the key and value types of TestGenerate that
+// MarshalBinary encodes: those that are fixed-size, or encode themselves.
+var binaryTypes = map[string]bool{
+	"int32": true, "uint64": true, "int64": true, "float64": true, "time.Duration": true,
+	"[2]int16": true, "net/netip.Addr": true, "time.Time": true,
+}
+
+// sameType reports whether the type strings a and b differ only in spacing.
+func sameType(a, b string) bool {
+	return strings.Join(strings.Fields(a), "") == strings.Join(strings.Fields(b), "")
+}
+
+func TestGenerate(t *testing.T) {
+	skipShort(t)
+	for _, c := range []Config{
+		{Package: "cache", Key: "int32", Value: "uint64"},
+		{Package: "cache", Key: "string", Value: "*struct{ n int }"},
+		{Package: "cache", Key: "float64", Value: "string", NoJSON: true},
+		{Package: "cache", Name: "UserCache", Key: "string", Value: "int64"},
+		{Package: "cache", Key: "time.Duration", Value: "*encoding/json.Decoder"},
+		{Package: "cache", Key: "string", Value: "*sync.Mutex", NoJSON: true},
+		{Package: "cache", Key: "*text/template.Template", Value: "*html/template.Template", NoJSON: true},
+		{Package: "cache", Key: "string", Value: "int64", Impl: "rwmutex"},
+		{Package: "cache", Name: "UserCache", Key: "int32", Value: "*sync.Mutex", Impl: "sharded"},
+		{Package: "cache", Key: "time.Duration", Value: "string", Impl: "cow"},
+		{Package: "cache", Key: "string", Value: "*sync.Mutex", Impl: "striped"},
+		{Package: "cache", Key: "[2]string", Value: "[]byte", NoJSON: true, Impl: "ctrie"},
+		{Package: "cache", Key: "[16]byte", Value: "uint64", NoJSON: true, Impl: "robinhood"},
+		{Package: "cache", Key: "string", Value: "struct{ tags map[string]bool }", Impl: "swiss"},
+		{Package: "cache", Key: "string", Value: "[]int"},
+		{Package: "cache", Key: "string", Value: "struct{ tags map[string]bool }", Impl: "sharded"},
+		{Package: "cache", Key: "string", Value: "*int", NoCompare: true},
+		{Package: "cache", Name: "userCache", Key: "string", Value: "int64"},
+		{Package: "cache", Key: "[2]int16", Value: "time.Duration", NoJSON: true},
+		{Package: "cache", Key: "net/netip.Addr", Value: "time.Time", NoJSON: true},
+	} {
+		src, err := Generate(c, templateDir)
+		if err != nil {
+			t.Fatalf("Generate(%+v): %v", c, err)
+		}
+		if !header.Match(src) {
+			t.Errorf("Generate(%+v) is missing the generated code header", c)
+		}
+		pkg := typeCheck(t, src)
+		if pkg.Name() != c.Package {
+			t.Errorf("Generate(%+v) has package %s", c, pkg.Name())
+		}
+
+		m := pkg.Scope().Lookup(c.name())
+		if m == nil {
+			t.Fatalf("Generate(%+v) doesn't declare %s", c, c.name())
+		}
+		ms := types.NewMethodSet(types.NewPointer(m.Type()))
+		load := ms.Lookup(pkg, "Load")
+		if load == nil {
+			t.Fatalf("Generate(%+v) doesn't declare Map.Load", c)
+		}
+		sig := load.Type().(*types.Signature)
+		if got := types.TypeString(sig.Params().At(0).Type(), nil); !sameType(got, c.Key) {
+			t.Errorf("Generate(%+v): Load takes key %s", c, got)
+		}
+		if got := types.TypeString(sig.Results().At(0).Type(), nil); !sameType(got, c.Value) {
+			t.Errorf("Generate(%+v): Load returns value %s", c, got)
+		}
+
+		// The incomparable values above all hold slices or maps.
+		incomparable := c.NoCompare || strings.ContainsAny(c.Value, "[]")
+		if hasCAS := ms.Lookup(pkg, "CompareAndSwap") != nil; hasCAS == incomparable {
+			t.Errorf("Generate(%+v): CompareAndSwap generated = %v", c, hasCAS)
+		}
+
+		full := c.Impl == ""
+		hasJSON := ms.Lookup(pkg, "MarshalJSON") != nil
+		if want := full && !c.NoJSON; hasJSON != want {
+			t.Errorf("Generate(%+v): MarshalJSON generated = %v; want %v", c, hasJSON, want)
+		}
+		if hasVar := ms.Lookup(pkg, "Var") != nil; hasVar != hasJSON {
+			t.Errorf("Generate(%+v): Var generated = %v; want %v", c, hasVar, hasJSON)
+		}
+		hasBinary := ms.Lookup(pkg, "MarshalBinary") != nil
+		if want := full && binaryTypes[c.Key] && binaryTypes[c.Value]; hasBinary != want {
+			t.Errorf("Generate(%+v): MarshalBinary generated = %v; want %v", c, hasBinary, want)
+		}
+	}
+}
+
+func TestValidate(t *testing.T) {
+	for _, c := range []Config{
+		{Key: "int", Value: "int"},
+		{Package: "a.b", Key: "int", Value: "int"},
+		{Package: "cache", Value: "int"},
+		{Package: "cache", Key: "int"},
+		{Package: "cache", Key: "int]", Value: "int"},
+		{Package: "cache", Name: "map", Key: "int", Value: "int"},
+		{Package: "cache", Key: "int", Value: "int", Unexported: true},
+		{Package: "cache", Key: "int", Value: "int", Impl: "btree"},
+		{Package: "cache", Key: "int", Value: "int", Build: "linux &&"},
+		{Package: "cache", Key: "int", Value: "int", GoVersion: "1.x"},
+		{Package: "cache", Key: "int", Value: "int", GoVersion: "1.21", Impl: "sharded"},
+		{Package: "cache", Key: "int", Value: "int", Impl: "swiss", Hash: "hashInt"},
+		{Package: "cache", Key: "int", Value: "int", Impl: "swiss", Hash: "hashInt", Equal: "equal("},
+		{Package: "cache", Key: "int", Value: "int", Impl: "sharded", Hash: "hashInt", Equal: "equalInt"},
+		{Package: "cache", Key: "int", Value: "int", Hash: "hashInt", Equal: "equalInt"},
+		{Package: "cache", Key: "int", Value: "int", Mode: "boxed"},
+		{Package: "cache", Key: "int", Value: "int", Mode: "generic", Impl: "swiss"},
+		{Package: "cache", Key: "int", Value: "int", Mode: "generic", Tests: true},
+		{Package: "cache", Key: "int", Value: "int", Mode: "generic", NoJSON: true},
+		{Package: "cache", Key: "int", Value: "int", Mode: "generic", Padded: true},
+		{Package: "cache", Key: "int", Value: "int", Mode: "generic", TTL: true},
+		{Package: "cache", Key: "int", Value: "int", Impl: "sharded", TTL: true},
+		{Package: "cache", Key: "int", Value: "int", Mode: "generic", Loader: true},
+		{Package: "cache", Key: "int", Value: "int", Impl: "cow", Loader: true},
+		{Package: "cache", Key: "int", Value: "int", Mode: "generic", Backend: true},
+		{Package: "cache", Key: "int", Value: "int", Impl: "rwmutex", Backend: true},
+		{Package: "cache", Key: "int", Value: "int", Mode: "generic", Metrics: true},
+		{Package: "cache", Key: "int", Value: "int", Impl: "striped", Metrics: true},
+		{Package: "cache", Key: "int", Value: "int", Prometheus: true},
+		{Package: "cache", Key: "int", Value: "int", OTel: true},
+		{Package: "cache", Key: "int", Value: "int", Mode: "generic", Redis: true},
+		{Package: "cache", Key: "int", Value: "int", Impl: "sharded", Redis: true},
+		{Package: "cache", Key: "int", Value: "int", NoJSON: true, Redis: true},
+		{Package: "cache", Key: "int", Value: "int", Kind: "queue"},
+		{Package: "cache", Key: "int", Value: "int", Kind: "pool"},
+		{Package: "cache", Value: "int", Kind: "pool", TTL: true},
+		{Package: "cache", Value: "int", Kind: "pool", Impl: "cow"},
+		{Package: "cache", Value: "int", Kind: "pool", Benchmarks: true},
+		{Package: "cache", Value: "bytes.Buffer", Kind: "pool", Tests: true},
+		{Package: "cache", Key: "int", Value: "int", Kind: "set"},
+		{Package: "cache", Key: "int", Kind: "set", ValueFactory: "i"},
+		{Package: "cache", Key: "int", Kind: "set", MaxEntries: 10},
+		{Package: "cache", Key: "string", Value: "int64", Kind: "countermap"},
+		{Package: "cache", Key: "string", Kind: "countermap", NoJSON: true, Loader: true},
+		{Package: "cache", Key: "string", Kind: "multimap"},
+		{Package: "cache", Key: "string", Value: "int", Kind: "multimap", TTL: true},
+		{Package: "cache", Key: "string", Kind: "bimap"},
+		{Package: "cache", Key: "string", Value: "int", Kind: "bimap", Impl: "sharded"},
+		{Package: "cache", Key: "int", Value: "int", MaxEntries: -1},
+		{Package: "cache", Key: "int", Value: "int", Impl: "swiss", MaxEntries: 100},
+		{Package: "cache", Key: "int", Value: "int", Mode: "generic", MaxEntries: 100},
+		{Package: "cache", Key: "int", Value: "int", Eviction: "tinylfu"},
+		{Package: "cache", Key: "int", Value: "int", MaxEntries: 100, Eviction: "arc"},
+		{Package: "cache", Key: "int", Value: "int", MaxEntries: 100, Eviction: "tinylfu", GoVersion: "1.23"},
+		{Package: "cache", Key: "int", Value: "int", MaxCost: 100},
+		{Package: "cache", Key: "int", Value: "int", Cost: "costInt"},
+		{Package: "cache", Key: "int", Value: "int", Cost: "cost(", MaxCost: 100},
+		{Package: "cache", Key: "int", Value: "int", Cost: "costInt", MaxCost: -1},
+		{Package: "cache", Key: "int", Value: "int", Cost: "costInt", MaxCost: 100, Impl: "rwmutex"},
+		{Package: "cache", Key: "int", Value: "int", Cost: "costInt", MaxCost: 100, Mode: "generic"},
+		{Package: "cache", Key: "int", Value: "int", Mode: "generic", GoVersion: "1.23"},
+	} {
+		if err := c.Validate(); err == nil {
+			t.Errorf("Validate(%+v) succeeded", c)
+		}
+	}
+}
+
+func TestGenerateQualifiedErrors(t *testing.T) {
+	for _, c := range []Config{
+		{Package: "cache", Key: "time.Nope", Value: "int"},
+		{Package: "cache", Key: "string", Value: "time.Now"},
+		{Package: "cache", Key: "string", Value: "example.com/nonexistent.T"},
+	} {
+		if _, err := Generate(c, templateDir); err == nil {
+			t.Errorf("Generate(%+v) succeeded", c)
+		}
+	}
+}
+
+func TestRename(t *testing.T) {
+	for _, tt := range []struct{ ident, want string }{
+		{"Map", "UserCache"},
+		{"NewFromMap", "NewUserCacheFromMap"},
+		{"New", "NewUserCache"},
+		{"Entry", "UserCacheEntry"},
+		{"WithCapacity", "UserCacheWithCapacity"},
+		{"entry", "userCacheEntry"},
+		{"readOnly", "userCacheReadOnly"},
+		{"TestOps", "TestUserCacheOps"},
+		{"BenchmarkLoad", "BenchmarkUserCacheLoad"},
+		{"ExampleMap_Load", "ExampleUserCache_Load"},
+		{"ExampleNew", "ExampleNewUserCache"},
+		{"Example_usage", "ExampleUserCache_usage"},
+	} {
+		if got := rename(tt.ident, "Map", "UserCache"); got != tt.want {
+			t.Errorf("rename(%q) = %q; want %q", tt.ident, got, tt.want)
+		}
+	}
+	for _, tt := range []struct{ ident, want string }{
+		{"Pool", "Buffers"},
+		{"New", "NewBuffers"},
+		{"WithReset", "BuffersWithReset"},
+		{"ExamplePool_Get", "ExampleBuffers_Get"},
+		{"Example_usage", "ExampleBuffers_usage"},
+	} {
+		if got := rename(tt.ident, "Pool", "Buffers"); got != tt.want {
+			t.Errorf("rename(%q, Pool, Buffers) = %q; want %q", tt.ident, got, tt.want)
+		}
+	}
+	for _, tt := range []struct{ ident, want string }{
+		{"Map", "userCache"},
+		{"NewFromMap", "newUserCacheFromMap"},
+		{"New", "newUserCache"},
+		{"Entry", "userCacheEntry"},
+		{"entry", "userCache_entry"},
+		{"newEntry", "userCache_newEntry"},
+		{"ExampleMap_Load", "Example_userCache_Load"},
+		{"ExampleNew", "Example_newUserCache"},
+		{"Example_usage", "Example_userCache_usage"},
+	} {
+		if got := rename(tt.ident, "Map", "userCache"); got != tt.want {
+			t.Errorf("rename(%q, userCache) = %q; want %q", tt.ident, got, tt.want)
+		}
+	}
+}
+
+func TestGenerateUnexported(t *testing.T) {
+	skipShort(t)
+	for _, c := range []Config{
+		{Package: "cache", Name: "userCache", Key: "string", Value: "int64"},
+		{Package: "cache", Name: "UserCache", Unexported: true, Key: "string", Value: "int64", Impl: "sharded"},
+	} {
+		src, err := Generate(c, templateDir)
+		if err != nil {
+			t.Fatalf("Generate(%+v): %v", c, err)
+		}
+		pkg := typeCheck(t, src)
+		if pkg.Scope().Lookup("userCache") == nil {
+			t.Errorf("Generate(%+v) doesn't declare userCache", c)
+		}
+		for _, name := range pkg.Scope().Names() {
+			if ast.IsExported(name) {
+				t.Errorf("Generate(%+v) declares exported %s", c, name)
+			}
+		}
+	}
+}
+
+func TestGenerateMany(t *testing.T) {
+	skipShort(t)
+	src, err := GenerateMany([]Config{
+		{Package: "cache", Key: "string", Value: "int64"},
+		{Package: "cache", Name: "UserCache", Key: "int32", Value: "*struct{}"},
+		{Package: "cache", Name: "Sessions", Key: "string", Value: "int", Impl: "sharded"},
+		{Package: "cache", Name: "Config", Key: "string", Value: "string", Impl: "cow"},
+	}, templateDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pkg := typeCheck(t, src)
+	for _, name := range []string{"Map", "UserCache", "Sessions", "Config", "NewSessions", "SessionsWithShards"} {
+		if pkg.Scope().Lookup(name) == nil {
+			t.Errorf("GenerateMany doesn't declare %s", name)
+		}
+	}
+
+	for _, cs := range [][]Config{
+		nil,
+		{{Package: "cache", Key: "int", Value: "int"}, {Package: "cache", Key: "string", Value: "int"}},
+		{{Package: "a", Name: "A", Key: "int", Value: "int"}, {Package: "b", Name: "B", Key: "int", Value: "int"}},
+		{{Package: "cache", Name: "A", Key: "int", Value: "int"}, {Package: "cache", Name: "B", Key: "int", Value: "int", GoVersion: "1.23"}},
+	} {
+		if _, err := GenerateMany(cs, templateDir); err == nil {
+			t.Errorf("GenerateMany(%+v) succeeded", cs)
+		}
+	}
+}
+
+func TestGenerateConstraints(t *testing.T) {
+	skipShort(t)
+	for _, tt := range []struct {
+		c         Config
+		build     string
+		iterators bool
+	}{
+		{Config{Package: "cache", Key: "string", Value: "int64"}, "", false},
+		{Config{Package: "cache", Key: "string", Value: "int64", Build: "!tinygo"}, "!tinygo", false},
+		{Config{Package: "cache", Key: "string", Value: "int64", GoVersion: "1.18"}, "go1.18", false},
+		{Config{Package: "cache", Key: "string", Value: "int64", GoVersion: "go1.23"}, "go1.23", true},
+		{Config{Package: "cache", Key: "string", Value: "int64", GoVersion: "1.23.4"}, "go1.23", true},
+		{Config{Package: "cache", Key: "string", Value: "int64", GoVersion: "1.21", Build: "!tinygo"}, "go1.21 && !tinygo", false},
+		{Config{Package: "cache", Key: "string", Value: "int64", GoVersion: "1.24", Impl: "sharded"}, "go1.24", false},
+	} {
+		src, err := Generate(tt.c, templateDir)
+		if err != nil {
+			t.Fatalf("Generate(%+v): %v", tt.c, err)
+		}
+		var build string
+		for _, line := range strings.Split(string(src), "\n") {
+			if b, ok := strings.CutPrefix(line, "//go:build "); ok {
+				build = b
+			}
+		}
+		if build != tt.build {
+			t.Errorf("Generate(%+v) has build constraint %q; want %q", tt.c, build, tt.build)
+		}
+
+		// Older versions use the atomic.Value variant of the read map.
+		if got, want := strings.Contains(string(src), "= atomic.Pointer["), tt.c.GoVersion != "" && tt.c.GoVersion != "1.18"; tt.c.Impl == "" && got != want {
+			t.Errorf("Generate(%+v) uses atomic.Pointer = %v; want %v", tt.c, got, want)
+		}
+
+		pkg := typeCheck(t, src)
+		ms := types.NewMethodSet(types.NewPointer(pkg.Scope().Lookup(tt.c.name()).Type()))
+		if got := ms.Lookup(pkg, "All") != nil; got != tt.iterators {
+			t.Errorf("Generate(%+v): All generated = %v; want %v", tt.c, got, tt.iterators)
+		}
+	}
+}
+
+func TestGenerateKeyHash(t *testing.T) {
+	skipShort(t)
+	for _, impl := range []string{"sharded", "striped", "ctrie", "robinhood", "swiss"} {
+		for _, tt := range []struct {
+			key  string
+			hash string // a part of the hash function of keys
+		}{
+			{"int64", "0xff51afd7ed558ccd"},
+			{"uint8", "0xff51afd7ed558ccd"},
+			{"time.Duration", "0xff51afd7ed558ccd"},
+			{"string", "wyhash(string(key)"},
+			{"encoding/json.Number", "wyhash(string(key)"},
+			{"[2]int", "maphash.Comparable("},
+			{"bool", "maphash.Comparable("},
+		} {
+			c := Config{Package: "cache", Key: tt.key, Value: "string", NoJSON: true, GoVersion: "1.24", Impl: impl}
+			src, err := Generate(c, templateDir)
+			if err != nil {
+				t.Fatalf("Generate(%+v): %v", c, err)
+			}
+			typeCheck(t, src)
+			if !strings.Contains(string(src), tt.hash) {
+				t.Errorf("Generate(%+v) doesn't hash keys with %s", c, tt.hash)
+			}
+		}
+	}
+}
+
+func TestGeneratePadded(t *testing.T) {
+	skipShort(t)
+	for _, impl := range []string{"syncmap", "sharded", "striped", "cow", "robinhood", "swiss"} {
+		for _, padded := range []bool{false, true} {
+			c := Config{Package: "cache", Key: "string", Value: "int", GoVersion: "1.24", Impl: impl, Padded: padded}
+			src, err := Generate(c, templateDir)
+			if err != nil {
+				t.Fatalf("Generate(%+v): %v", c, err)
+			}
+			pkg := typeCheck(t, src)
+			size := types.SizesFor("gc", "amd64").Sizeof(pkg.Scope().Lookup("cacheLinePad").Type())
+			if want := map[bool]int64{false: 0, true: 128}[padded]; size != want {
+				t.Errorf("Generate(%+v) pads by %d bytes; want %d", c, size, want)
+			}
+		}
+	}
+}
+
+func TestGeneratePointerValues(t *testing.T) {
+	skipShort(t)
+	for _, tt := range []struct {
+		value string
+		unbox string // the conversion of the pointers held by entries
+	}{
+		{"*int", "(*int)(p)"},
+		{"*encoding/json.Decoder", "(*json.Decoder)(p)"},
+		{"int64", "*(*int64)(p)"},
+		{"[]*int", "*(*[]*int)(p)"},
+	} {
+		c := Config{Package: "cache", Key: "string", Value: tt.value, NoJSON: true}
+		src, err := Generate(c, templateDir)
+		if err != nil {
+			t.Fatalf("Generate(%+v): %v", c, err)
+		}
+		typeCheck(t, src)
+		if !strings.Contains(string(src), "return "+tt.unbox) {
+			t.Errorf("Generate(%+v) doesn't load values with %s", c, tt.unbox)
+		}
+	}
+}
+
+func TestGenerateTTL(t *testing.T) {
+	skipShort(t)
+	for _, c := range []Config{
+		{Package: "cache", Name: "Sessions", Key: "string", Value: "int64", TTL: true, Tests: true},
+		{Package: "cache", Name: "Sessions", Key: "string", Value: "*encoding/json.Decoder", TTL: true},
+	} {
+		files, err := GenerateFiles([]Config{c}, templateDir, false)
+		if err != nil {
+			t.Fatalf("GenerateFiles(%+v): %v", c, err)
+		}
+		src := string(files[0].Src)
+		typeCheck(t, files[0].Src)
+		// Pointers are boxed too, along with their expiry.
+		if !strings.Contains(src, "func (m *Sessions) StoreWithTTL(") || !strings.Contains(src, "return (*sessionsTtlValue)(p).v") {
+			t.Errorf("GenerateFiles(%+v) has no StoreWithTTL, or doesn't box values with their expiry", c)
+		}
+	}
+}
+
+func TestGenerateLoader(t *testing.T) {
+	skipShort(t)
+	for _, c := range []Config{
+		{Package: "cache", Name: "Users", Key: "string", Value: "int64", Loader: true, Tests: true},
+		{Package: "cache", Name: "Users", Key: "string", Value: "*encoding/json.Decoder", Loader: true, TTL: true},
+	} {
+		files, err := GenerateFiles([]Config{c}, templateDir, false)
+		if err != nil {
+			t.Fatalf("GenerateFiles(%+v): %v", c, err)
+		}
+		src := string(files[0].Src)
+		typeCheck(t, files[0].Src)
+		if !strings.Contains(src, "func (m *Users) GetE(ctx context.Context, key string) (") || !strings.Contains(src, "func UsersWithLoader(f UsersLoader) UsersOption") ||
+			!strings.Contains(src, "func UsersWithRefreshAfter(d time.Duration) UsersOption") || !strings.Contains(src, "func UsersWithNegativeTTL(d time.Duration) UsersOption") {
+			t.Errorf("GenerateFiles(%+v) has no GetE, or the options of loaders", c)
+		}
+	}
+}
+
+func TestGenerateBackend(t *testing.T) {
+	skipShort(t)
+	for _, c := range []Config{
+		{Package: "cache", Name: "Users", Key: "string", Value: "int64", Backend: true, Tests: true},
+		{Package: "cache", Name: "Users", Key: "string", Value: "*encoding/json.Decoder", Backend: true, Metrics: true, TTL: true},
+	} {
+		files, err := GenerateFiles([]Config{c}, templateDir, false)
+		if err != nil {
+			t.Fatalf("GenerateFiles(%+v): %v", c, err)
+		}
+		src := string(files[0].Src)
+		typeCheck(t, files[0].Src)
+		if !strings.Contains(src, "func UsersWithBackend(b UsersBackend) UsersOption") || !strings.Contains(src, "func (m *Users) GetE(ctx context.Context, key string) (") ||
+			!strings.Contains(src, "func (m *Users) StoreE(ctx context.Context, key string, value ") || !strings.Contains(src, "func (m *Users) DeleteE(ctx context.Context, key string) error") {
+			t.Errorf("GenerateFiles(%+v) has no WithBackend, or the methods of backends", c)
+		}
+	}
+}
+
+func TestGenerateMetrics(t *testing.T) {
+	skipShort(t)
+	for _, c := range []Config{
+		{Package: "cache", Name: "Users", Key: "string", Value: "int64", Metrics: true, Tests: true},
+		{Package: "cache", Name: "Users", Key: "string", Value: "*encoding/json.Decoder", Metrics: true, Loader: true, TTL: true, MaxEntries: 100},
+	} {
+		files, err := GenerateFiles([]Config{c}, templateDir, false)
+		if err != nil {
+			t.Fatalf("GenerateFiles(%+v): %v", c, err)
+		}
+		src := string(files[0].Src)
+		typeCheck(t, files[0].Src)
+		if !strings.Contains(src, "func (m *Users) Metrics() UsersMetrics {") {
+			t.Errorf("GenerateFiles(%+v) has no Metrics", c)
+		}
+	}
+}
+
+func TestGeneratePrometheus(t *testing.T) {
+	c := Config{Package: "cache", Name: "Users", Key: "string", Value: "int64", Metrics: true, Prometheus: true}
+	files, err := GenerateFiles([]Config{c}, templateDir, false)
+	if err != nil {
+		t.Fatalf("GenerateFiles(%+v): %v", c, err)
+	}
+	// The Prometheus client isn't a dependency of this module, so the
+	// generated code can't be type-checked here, but TestGenerateDeps builds
+	// it with -tags=syncmap_deps.
+	src := string(files[0].Src)
+	if !strings.Contains(src, `"github.com/prometheus/client_golang/prometheus"`) ||
+		!strings.Contains(src, "func (m *Users) Collector(name string, labels prometheus.Labels) *UsersCollector {") {
+		t.Errorf("GenerateFiles(%+v) has no Collector", c)
+	}
+}
+
+func TestGenerateOTel(t *testing.T) {
+	c := Config{Package: "cache", Name: "Users", Key: "string", Value: "int64", Metrics: true, Loader: true, OTel: true}
+	files, err := GenerateFiles([]Config{c}, templateDir, false)
+	if err != nil {
+		t.Fatalf("GenerateFiles(%+v): %v", c, err)
+	}
+	// OpenTelemetry isn't a dependency of this module either.
+	src := string(files[0].Src)
+	if !strings.Contains(src, `"go.opentelemetry.io/otel/metric"`) ||
+		!strings.Contains(src, "func UsersWithMeter(meter metric.Meter, attrs ...attribute.KeyValue) UsersOption {") ||
+		!strings.Contains(src, "func UsersWithTracer(tracer trace.Tracer) UsersOption {") {
+		t.Errorf("GenerateFiles(%+v) has no WithMeter or WithTracer", c)
+	}
+}
+
+func TestGenerateRedis(t *testing.T) {
+	c := Config{Package: "cache", Name: "Users", Key: "string", Value: "*encoding/json.RawMessage", Redis: true}
+	files, err := GenerateFiles([]Config{c}, templateDir, false)
+	if err != nil {
+		t.Fatalf("GenerateFiles(%+v): %v", c, err)
+	}
+	// Nor is the Redis client.
+	src := string(files[0].Src)
+	if !strings.Contains(src, `"github.com/redis/go-redis/v9"`) ||
+		!strings.Contains(src, "func NewUsersRedis(client *redis.Client, namespace string, onError func(err error)) *UsersRedis {") ||
+		!strings.Contains(src, "func (r *UsersRedis) LoadOrStore(key string, value *json.RawMessage) (actual *json.RawMessage, loaded bool) {") {
+		t.Errorf("GenerateFiles(%+v) has no Redis type", c)
+	}
+}
+
+func TestGeneratePool(t *testing.T) {
+	skipShort(t)
+	for _, c := range []Config{
+		{Package: "cache", Kind: "pool", Value: "bytes.Buffer"},
+		{Package: "cache", Kind: "pool", Name: "Buffers", Value: "bytes.Buffer", Tests: true, ValueFactory: "bytes.Buffer{}"},
+	} {
+		files, err := GenerateFiles([]Config{c}, templateDir, false)
+		if err != nil {
+			t.Fatalf("GenerateFiles(%+v): %v", c, err)
+		}
+		pkg := typeCheck(t, files[0].Src)
+		name := c.name()
+		obj := pkg.Scope().Lookup(name)
+		if obj == nil {
+			t.Fatalf("GenerateFiles(%+v) has no type %s", c, name)
+		}
+		get, _, _ := types.LookupFieldOrMethod(types.NewPointer(obj.Type()), true, pkg, "Get")
+		if get == nil || !sameType(types.TypeString(get.Type(), nil), "func() *bytes.Buffer") {
+			t.Errorf("GenerateFiles(%+v) has no method Get of type func() *bytes.Buffer", c)
+		}
+		if c.Tests && (len(files) != 2 || !strings.Contains(string(files[1].Src), "func buffersNewValueT(i int) bytes.Buffer {")) {
+			t.Errorf("GenerateFiles(%+v) has no tests", c)
+		}
+	}
+}
+
+func TestGenerateSet(t *testing.T) {
+	skipShort(t)
+	for _, c := range []Config{
+		{Package: "cache", Kind: "set", Key: "struct{ a int; b int }"},
+		{Package: "cache", Kind: "set", Name: "Hosts", Key: "net/netip.Addr", Tests: true, KeyFactory: "net/netip.AddrFrom4([4]byte{10, 0, byte(i >> 8), byte(i)})"},
+	} {
+		files, err := GenerateFiles([]Config{c}, templateDir, false)
+		if err != nil {
+			t.Fatalf("GenerateFiles(%+v): %v", c, err)
+		}
+		pkg := typeCheck(t, files[0].Src)
+		name := c.name()
+		obj := pkg.Scope().Lookup(name)
+		if obj == nil {
+			t.Fatalf("GenerateFiles(%+v) has no type %s", c, name)
+		}
+		for _, m := range [...]struct{ name, typ string }{
+			{"Add", "func(key " + c.Key + ") (added bool)"},
+			{"Union", "func(t *cache." + name + ") *cache." + name},
+		} {
+			f, _, _ := types.LookupFieldOrMethod(types.NewPointer(obj.Type()), true, pkg, m.name)
+			if f == nil || !sameType(types.TypeString(f.Type(), nil), m.typ) {
+				t.Errorf("GenerateFiles(%+v) has no method %s of type %s", c, m.name, m.typ)
+			}
+		}
+		if c.Tests && (len(files) != 2 || !strings.Contains(string(files[1].Src), "func hostsNewKeyT(i int) netip.Addr {")) {
+			t.Errorf("GenerateFiles(%+v) has no tests", c)
+		}
+	}
+}
+
+func TestGenerateCounterMap(t *testing.T) {
+	skipShort(t)
+	for _, c := range []Config{
+		{Package: "cache", Kind: "countermap", Key: "int"},
+		{Package: "cache", Kind: "countermap", Name: "Requests", Key: "time.Weekday", Tests: true, KeyFactory: "time.Weekday(i)"},
+	} {
+		files, err := GenerateFiles([]Config{c}, templateDir, false)
+		if err != nil {
+			t.Fatalf("GenerateFiles(%+v): %v", c, err)
+		}
+		pkg := typeCheck(t, files[0].Src)
+		name := c.name()
+		obj := pkg.Scope().Lookup(name)
+		if obj == nil {
+			t.Fatalf("GenerateFiles(%+v) has no type %s", c, name)
+		}
+		for _, m := range [...]struct{ name, typ string }{
+			{"Add", "func(key " + c.Key + ", delta int64) int64"},
+			{"Snapshot", "func() map[" + c.Key + "]int64"},
+		} {
+			f, _, _ := types.LookupFieldOrMethod(types.NewPointer(obj.Type()), true, pkg, m.name)
+			if f == nil || !sameType(types.TypeString(f.Type(), nil), m.typ) {
+				t.Errorf("GenerateFiles(%+v) has no method %s of type %s", c, m.name, m.typ)
+			}
+		}
+		if c.Tests && (len(files) != 2 || !strings.Contains(string(files[1].Src), "func requestsNewKeyT(i int) time.Weekday {")) {
+			t.Errorf("GenerateFiles(%+v) has no tests", c)
+		}
+	}
+}
+
+func TestGenerateMultimap(t *testing.T) {
+	skipShort(t)
+	for _, c := range []Config{
+		{Package: "cache", Kind: "multimap", Key: "string", Value: "*encoding/json.Decoder"},
+		{Package: "cache", Kind: "multimap", Name: "Subscribers", Key: "string", Value: "int64", Tests: true},
+	} {
+		files, err := GenerateFiles([]Config{c}, templateDir, false)
+		if err != nil {
+			t.Fatalf("GenerateFiles(%+v): %v", c, err)
+		}
+		pkg := typeCheck(t, files[0].Src)
+		name := c.name()
+		obj := pkg.Scope().Lookup(name)
+		if obj == nil {
+			t.Fatalf("GenerateFiles(%+v) has no type %s", c, name)
+		}
+		for _, m := range [...]struct{ name, typ string }{
+			{"LoadAll", "func(key " + c.Key + ") []" + c.Value},
+			{"Range", "func(f func(key " + c.Key + ", values []" + c.Value + ") bool)"},
+		} {
+			f, _, _ := types.LookupFieldOrMethod(types.NewPointer(obj.Type()), true, pkg, m.name)
+			if f == nil || !sameType(types.TypeString(f.Type(), nil), m.typ) {
+				t.Errorf("GenerateFiles(%+v) has no method %s of type %s", c, m.name, m.typ)
+			}
+		}
+		if c.Tests && (len(files) != 2 || !strings.Contains(string(files[1].Src), "func subscribersNewValueT(i int) int64 {")) {
+			t.Errorf("GenerateFiles(%+v) has no tests", c)
+		}
+	}
+}
+
+func TestGenerateBimap(t *testing.T) {
+	skipShort(t)
+	for _, c := range []Config{
+		{Package: "cache", Kind: "bimap", Key: "int64", Value: "*encoding/json.Decoder"},
+		{Package: "cache", Kind: "bimap", Name: "Names", Key: "uint32", Value: "string", Tests: true},
+	} {
+		files, err := GenerateFiles([]Config{c}, templateDir, false)
+		if err != nil {
+			t.Fatalf("GenerateFiles(%+v): %v", c, err)
+		}
+		pkg := typeCheck(t, files[0].Src)
+		name := c.name()
+		obj := pkg.Scope().Lookup(name)
+		if obj == nil {
+			t.Fatalf("GenerateFiles(%+v) has no type %s", c, name)
+		}
+		for _, m := range [...]struct{ name, typ string }{
+			{"LoadByValue", "func(value " + c.Value + ") (key " + c.Key + ", ok bool)"},
+			{"DeleteByEither", "func(key " + c.Key + ", value " + c.Value + ") (deleted int)"},
+		} {
+			f, _, _ := types.LookupFieldOrMethod(types.NewPointer(obj.Type()), true, pkg, m.name)
+			if f == nil || !sameType(types.TypeString(f.Type(), nil), m.typ) {
+				t.Errorf("GenerateFiles(%+v) has no method %s of type %s", c, m.name, m.typ)
+			}
+		}
+		if c.Tests && (len(files) != 2 || !strings.Contains(string(files[1].Src), "func namesNewValueT(i int) string {")) {
+			t.Errorf("GenerateFiles(%+v) has no tests", c)
+		}
+	}
+}
+
+func TestGenerateMaxEntries(t *testing.T) {
+	skipShort(t)
+	for _, c := range []Config{
+		{Package: "cache", Name: "Recent", Key: "string", Value: "int64", MaxEntries: 1000, Tests: true},
+		{Package: "cache", Name: "Recent", Key: "string", Value: "*encoding/json.Decoder", MaxEntries: 1000, TTL: true},
+		{Package: "cache", Name: "Recent", Key: "string", Value: "int64", MaxEntries: 1000, Eviction: "tinylfu", Tests: true},
+	} {
+		files, err := GenerateFiles([]Config{c}, templateDir, false)
+		if err != nil {
+			t.Fatalf("GenerateFiles(%+v): %v", c, err)
+		}
+		src := string(files[0].Src)
+		typeCheck(t, files[0].Src)
+		if !strings.Contains(src, "var recentMaxEntries = 1000\n") || !strings.Contains(src, "func RecentWithMaxEntries(") {
+			t.Errorf("GenerateFiles(%+v) isn't bounded to 1000 entries", c)
+		}
+		// The tests lift the bound from an init function, which keeps its name.
+		if c.Tests && (len(files) != 2 || !strings.Contains(string(files[1].Src), "\nfunc init() {\n")) {
+			t.Errorf("GenerateFiles(%+v) has no init function lifting the bound of the tests", c)
+		}
+	}
+}
+
+func TestGenerateCost(t *testing.T) {
+	skipShort(t)
+	for _, c := range []Config{
+		{Package: "cache", Name: "Blobs", Key: "string", Value: "*int64", Cost: "sync/atomic.LoadInt64", MaxCost: 1 << 30},
+		{Package: "cache", Name: "Blobs", Key: "string", Value: "int64", Cost: "costOf", MaxCost: 1 << 30, MaxEntries: 1000, Tests: true},
+	} {
+		files, err := GenerateFiles([]Config{c}, templateDir, false)
+		if err != nil {
+			t.Fatalf("GenerateFiles(%+v): %v", c, err)
+		}
+		src := string(files[0].Src)
+		if !strings.Contains(src, "var blobsMaxCost int64 = 1073741824\n") || !strings.Contains(src, "func (m *Blobs) Cost() int64") {
+			t.Errorf("GenerateFiles(%+v) has no budget of 1073741824", c)
+		}
+		want := "c = costOf(blobsUnboxValue(p))"
+		if c.Value == "*int64" {
+			typeCheck(t, files[0].Src)
+			want = "c = atomic.LoadInt64(blobsUnboxValue(p))"
+		}
+		if !strings.Contains(src, want) {
+			t.Errorf("GenerateFiles(%+v) doesn't charge values by the cost function: no %s", c, want)
+		}
+	}
+}
+
+func TestGenerateCustomKey(t *testing.T) {
+	skipShort(t)
+	for _, impl := range CustomKeyImpls {
+		for _, c := range []Config{
+			{Package: "cache", Key: "[]byte", Value: "string", NoJSON: true,
+				Hash: "hash/maphash.Bytes", Equal: "bytes.Equal"},
+			{Package: "cache", Name: "Hosts", Key: "string", Value: "int", Tests: true,
+				Hash: "hash/maphash.String", Equal: "strings.EqualFold"},
+		} {
+			c.GoVersion, c.Impl = "1.24", impl
+			files, err := GenerateFiles([]Config{c}, templateDir, false)
+			if err != nil {
+				t.Fatalf("GenerateFiles(%+v): %v", c, err)
+			}
+			src := string(files[0].Src)
+			typeCheck(t, files[0].Src)
+			// The functions replace the generic hash and ==.
+			hash, equal := c.Hash[strings.LastIndex(c.Hash, "/")+1:], c.Equal
+			if !strings.Contains(src, hash+"(") || !strings.Contains(src, equal+"(") || strings.Contains(src, "maphash.Comparable(") {
+				t.Errorf("GenerateFiles(%+v) doesn't hash and compare keys with %s and %s", c, hash, equal)
+			}
+		}
+	}
+}
+
+func TestGenerateGeneric(t *testing.T) {
+	skipShort(t)
+	cs := []Config{
+		{Package: "cache", Key: "int", Value: "string", Mode: "generic"},
+		{Package: "cache", Name: "UserCache", Key: "[2]int", Value: "*encoding/json.Decoder", Mode: "generic"},
+		{Package: "cache", Name: "Sessions", Key: "string", Value: "int64"},
+	}
+	src, err := GenerateMany(cs, templateDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pkg := typeCheck(t, src)
+	const generic = GenericPackage + "."
+	for name, want := range map[string]string{
+		"Map":             generic + "Map[int, string]",
+		"Option":          generic + "Option[int, string]",
+		"NewFromMap":      "func(src map[int]string, opts ...cache.Option) *cache.Map",
+		"UserCache":       generic + "Map[[2]int, *encoding/json.Decoder]",
+		"UserCacheOption": generic + "Option[[2]int, *encoding/json.Decoder]",
+		"NewUserCache":    "func(opts ...cache.UserCacheOption) *cache.UserCache",
+	} {
+		obj := pkg.Scope().Lookup(name)
+		if obj == nil {
+			t.Errorf("%s is not declared", name)
+			continue
+		}
+		if got := types.TypeString(types.Unalias(obj.Type()), nil); !sameType(got, want) {
+			t.Errorf("type of %s = %s, want %s", name, got, want)
+		}
+	}
+	// The other maps are still specialized.
+	if pkg.Scope().Lookup("SessionsEntry") == nil {
+		t.Errorf("specialized map Sessions is missing from the generated code:\n%s", src)
+	}
+}
+
+func TestGenerateEmbedded(t *testing.T) {
+	shas := make(map[string]string)
+	for _, impl := range Impls {
+		c := Config{Package: "cache", Key: "string", Value: "int64", Impl: impl}
+		src, err := Generate(c, "")
+		if err != nil {
+			t.Fatalf("Generate(%+v) from the embedded template: %v", c, err)
+		}
+		fromDir, err := Generate(c, templateDir)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(src) != string(fromDir) {
+			t.Errorf("Generate(%+v) differs between the embedded template and %s", c, templateDir)
+		}
+		m := header.FindSubmatch(src)
+		if m == nil {
+			t.Fatalf("Generate(%+v) is missing the generated code header", c)
+		}
+		if other, ok := shas[string(m[1])]; ok {
+			t.Errorf("templates %s and %s have the same sha %s", other, impl, m[1])
+		}
+		shas[string(m[1])] = impl
+	}
+}
+
+func TestGenerateDeterministic(t *testing.T) {
+	skipShort(t)
+	cs := []Config{
+		{Package: "cache", Name: "UserCache", Key: "string", Value: "*text/template.Template", NoJSON: true},
+		{Package: "cache", Name: "Sessions", Key: "time.Duration", Value: "*html/template.Template", Impl: "sharded", NoJSON: true},
+		{Package: "cache", Name: "Config", Key: "string", Value: "string", Impl: "cow"},
+	}
+	want, err := GenerateMany(cs, templateDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 3; i++ {
+		got, err := GenerateMany([]Config{cs[i%3], cs[(i+1)%3], cs[(i+2)%3]}, templateDir)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(got) != string(want) {
+			t.Errorf("GenerateMany rotated by %d differs:\n%s", i, Diff("want", want, "got", got))
+		}
+	}
+
+	// A checkout with CRLF line endings generates the same code.
+	dir := t.TempDir()
+	var sub []string
+	for _, impl := range Impls {
+		sub = append(sub, Config{Impl: impl}.templateDir(""))
+	}
+	for _, d := range append(sub, SharedDir) {
+		names, err := filepath.Glob(filepath.Join(templateDir, d, "*.go"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := os.MkdirAll(filepath.Join(dir, d), 0755); err != nil {
+			t.Fatal(err)
+		}
+		for _, name := range names {
+			src, err := os.ReadFile(name)
+			if err != nil {
+				t.Fatal(err)
+			}
+			crlf := bytes.ReplaceAll(src, []byte("\n"), []byte("\r\n"))
+			if err := os.WriteFile(filepath.Join(dir, d, filepath.Base(name)), crlf, 0644); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	got, err := GenerateMany(cs, dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != string(want) {
+		t.Errorf("GenerateMany from a CRLF template differs:\n%s", Diff("want", want, "got", got))
+	}
+}
+
+func TestReleaseVersion(t *testing.T) {
+	for _, tt := range []struct{ v, want string }{
+		{"v1.4.0", "v1.4.0"},
+		{"v2.0.0-rc.1", "v2.0.0-rc.1"},
+		{"(devel)", ""},
+		{"v1.4.0+dirty", ""},
+		{"v0.0.0-20261015082501-5b1456f84293", ""},
+		{"v1.4.1-0.20261015082501-5b1456f84293", ""},
+		{"v1.5.0-rc.1.0.20261015082501-5b1456f84293", ""},
+	} {
+		if got := releaseVersion(tt.v); got != tt.want {
+			t.Errorf("releaseVersion(%q) = %q; want %q", tt.v, got, tt.want)
+		}
+	}
+}
+
+func TestGenerateFiles(t *testing.T) {
+	skipShort(t)
+	cs := []Config{
+		{Package: "cache", Name: "UserCache", Key: "string", Value: "*text/template.Template"},
+		{Package: "cache", Name: "Sessions", Key: "time.Duration", Value: "int64", Impl: "sharded"},
+	}
+	files, err := GenerateFiles(cs, templateDir, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) < 2 || files[0].Concern != "" {
+		t.Fatalf("GenerateFiles split into %d files, the first for concern %q", len(files), files[0].Concern)
+	}
+
+	fset := token.NewFileSet()
+	var parsed []*ast.File
+	concerns := make(map[string]bool)
+	for _, file := range files {
+		if concerns[file.Concern] {
+			t.Errorf("GenerateFiles has two files for concern %q", file.Concern)
+		}
+		concerns[file.Concern] = true
+		if !header.Match(file.Src) {
+			t.Errorf("file for concern %q is missing the generated code header", file.Concern)
+		}
+		// Unformatted files must only import what they use.
+		f, err := parser.ParseFile(fset, file.Concern+".go", file.Src, parser.ParseComments)
+		if err != nil {
+			t.Fatalf("parsing file for concern %q: %v", file.Concern, err)
+		}
+		parsed = append(parsed, f)
+	}
+	for _, concern := range []string{"json", "compare", "handle"} {
+		if !concerns[concern] {
+			t.Errorf("GenerateFiles has no file for concern %q", concern)
+		}
+	}
+	conf := types.Config{Importer: importer.ForCompiler(fset, "source", nil)}
+	if _, err := conf.Check("cache", fset, parsed, nil); err != nil {
+		t.Fatalf("type-checking split files: %v", err)
+	}
+
+	whole, err := GenerateFiles(cs, templateDir, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(whole) != 1 || whole[0].Concern != "" {
+		t.Errorf("GenerateFiles without split returned %d files", len(whole))
+	}
+}
+
+func TestGenerateExtensions(t *testing.T) {
+	skipShort(t)
+	ext := []string{filepath.Join("testdata", "debugdump.go")}
+	src, err := GenerateMany([]Config{
+		{Package: "cache", Name: "UserCache", Key: "string", Value: "*text/template.Template", Extensions: ext},
+		{Package: "cache", Name: "Sessions", Key: "time.Duration", Value: "int64", Impl: "sharded", Extensions: ext},
+		{Package: "cache", Name: "Plain", Key: "string", Value: "int64"},
+	}, templateDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pkg := typeCheck(t, src)
+	for name, want := range map[string]bool{"UserCache": true, "Sessions": true, "Plain": false} {
+		ms := types.NewMethodSet(types.NewPointer(pkg.Scope().Lookup(name).Type()))
+		if got := ms.Lookup(pkg, "DebugDump") != nil; got != want {
+			t.Errorf("%s has DebugDump = %v; want %v", name, got, want)
+		}
+	}
+
+	// Test extensions come with the tests of the template, and only then.
+	ext = append(ext, filepath.Join("testdata", "debugdump_test.go"))
+	if _, err := GenerateMany([]Config{{Package: "cache", Key: "string", Value: "int64", Extensions: ext}}, templateDir); err != nil {
+		t.Errorf("GenerateMany without tests: %v", err)
+	}
+	files, err := GenerateFiles([]Config{{Package: "cache", Name: "UserCache", Key: "string", Value: "int64", Tests: true, Extensions: ext}}, templateDir, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fset := token.NewFileSet()
+	var parsed []*ast.File
+	for _, file := range files {
+		f, err := parser.ParseFile(fset, file.Concern+".go", file.Src, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		parsed = append(parsed, f)
+	}
+	conf := types.Config{Importer: importer.ForCompiler(fset, "source", nil)}
+	pkg, err = conf.Check("cache", fset, parsed, nil)
+	if err != nil {
+		t.Fatalf("type-checking a map with a test extension: %v", err)
+	}
+	if pkg.Scope().Lookup("TestUserCacheDebugDump") == nil {
+		t.Error("the test extension wasn't generated")
+	}
+
+	c := Config{Package: "cache", Key: "string", Value: "int64", Extensions: []string{"testdata/missing.go"}}
+	if _, err := Generate(c, templateDir); err == nil {
+		t.Errorf("Generate(%+v) succeeded", c)
+	}
+}
+
+func TestGenerateTests(t *testing.T) {
+	skipShort(t)
+	cs := []Config{
+		{Package: "cache", Name: "UserCache", Key: "string", Value: "*text/template.Template", NoJSON: true,
+			Tests: true, ValueFactory: "text/template.New(strconv.Itoa(i))"},
+		{Package: "cache", Name: "Sessions", Key: "time.Duration", Value: "[]byte", Impl: "sharded",
+			Tests: true, KeyFactory: "time.Duration(i)", ValueFactory: "[]byte{byte(i)}"},
+		{Package: "cache", Name: "Plain", Key: "int", Value: "float64", NoJSON: true},
+		{Package: "cache", Name: "Limits", Key: "string", Value: "int64", Impl: "striped", Tests: true},
+		{Package: "cache", Name: "Routes", Key: "string", Value: "[]string", Impl: "ctrie", Tests: true,
+			ValueFactory: "[]string{strconv.Itoa(i)}"},
+		{Package: "cache", Name: "Offsets", Key: "int64", Value: "int64", Impl: "robinhood", Tests: true},
+		{Package: "cache", Name: "Tables", Key: "string", Value: "*int", Impl: "swiss", Tests: true,
+			ValueFactory: "new(int)"},
+		{Package: "cache", Name: "Settings", Key: "string", Value: "string", Impl: "cow", Tests: true},
+	}
+	for _, split := range []bool{false, true} {
+		files, err := GenerateFiles(cs, templateDir, split)
+		if err != nil {
+			t.Fatal(err)
+		}
+		fset := token.NewFileSet()
+		var parsed []*ast.File
+		for _, file := range files {
+			if !split && file.Concern != "" && file.Concern != "test" {
+				t.Errorf("GenerateFiles without split has a file for concern %q", file.Concern)
+			}
+			f, err := parser.ParseFile(fset, file.Concern+".go", file.Src, 0)
+			if err != nil {
+				t.Fatalf("parsing file for concern %q: %v", file.Concern, err)
+			}
+			parsed = append(parsed, f)
+		}
+		conf := types.Config{Importer: importer.ForCompiler(fset, "source", nil)}
+		pkg, err := conf.Check("cache", fset, parsed, nil)
+		if err != nil {
+			t.Fatalf("type-checking the maps and their tests (split=%v): %v", split, err)
+		}
+		for name, want := range map[string]bool{
+			"TestUserCacheOps":        true,
+			"TestUserCacheCompareOps": true,
+			"TestSessionsConcurrent":  true,
+			"FuzzUserCacheOps":        true,
+			"TestSessionsWithShards":  true,
+			"TestLimitsWithStripes":   true,
+			"TestRoutesCollisions":    true,
+			"TestOffsetsRobinHood":    true,
+			"TestTablesSwissTable":    true,
+			"TestSettingsWithBatch":   true,
+			// Values of Sessions aren't comparable.
+			"TestSessionsCompareOps": false,
+			"TestPlainOps":           false,
+		} {
+			if got := pkg.Scope().Lookup(name) != nil; got != want {
+				t.Errorf("generated %s = %v; want %v", name, got, want)
+			}
+		}
+	}
+
+	for _, c := range []Config{
+		{Package: "cache", Key: "UserID", Value: "int", Tests: true},
+		{Package: "cache", Key: "int", Value: "*User", Tests: true},
+		{Package: "cache", Key: "int", Value: "int", Tests: true, KeyFactory: "int(i"},
+	} {
+		if err := c.Validate(); err == nil {
+			t.Errorf("Validate(%+v) succeeded", c)
+		}
+	}
+	if _, err := Generate(Config{Package: "cache", Key: "int", Value: "int", Tests: true}, templateDir); err == nil {
+		t.Error("Generate of a map with tests succeeded")
+	}
+}
+
+func TestGenerateBenchmarks(t *testing.T) {
+	skipShort(t)
+	cs := []Config{
+		{Package: "cache", Name: "UserCache", Key: "string", Value: "*text/template.Template", NoJSON: true,
+			Benchmarks: true, PropertyTests: true, ValueFactory: "text/template.New(strconv.Itoa(i))"},
+		{Package: "cache", Name: "Sessions", Key: "time.Duration", Value: "int", Impl: "cow",
+			Tests: true, Benchmarks: true, KeyFactory: "time.Duration(i)"},
+	}
+	for _, split := range []bool{false, true} {
+		files, err := GenerateFiles(cs, templateDir, split)
+		if err != nil {
+			t.Fatal(err)
+		}
+		fset := token.NewFileSet()
+		var parsed []*ast.File
+		for _, file := range files {
+			f, err := parser.ParseFile(fset, file.Concern+".go", file.Src, 0)
+			if err != nil {
+				t.Fatalf("parsing file for concern %q: %v", file.Concern, err)
+			}
+			parsed = append(parsed, f)
+		}
+		conf := types.Config{Importer: importer.ForCompiler(fset, "source", nil)}
+		pkg, err := conf.Check("cache", fset, parsed, nil)
+		if err != nil {
+			t.Fatalf("type-checking the maps, their benchmarks, and property tests (split=%v): %v", split, err)
+		}
+		for name, want := range map[string]bool{
+			"BenchmarkUserCacheLoadMostlyHits": true,
+			"BenchmarkSessionsRange":           true,
+			"TestSessionsOps":                  true,
+			"TestUserCacheProperties":          true,
+			// Benchmarks and property tests don't bring the tests along.
+			"TestUserCacheOps":       false,
+			"TestSessionsProperties": false,
+		} {
+			if got := pkg.Scope().Lookup(name) != nil; got != want {
+				t.Errorf("generated %s = %v; want %v", name, got, want)
+			}
+		}
+	}
+
+	c := Config{Package: "cache", Key: "UserID", Value: "int", Benchmarks: true}
+	if err := c.Validate(); err == nil {
+		t.Errorf("Validate(%+v) succeeded", c)
+	}
+}
+
+func TestGenerateExamples(t *testing.T) {
+	skipShort(t)
+	cs := []Config{
+		{Package: "cache", Name: "UserCache", Key: "string", Value: "int64", Examples: true},
+		{Package: "cache", Name: "sessions", Unexported: true, Key: "int", Value: "[]byte", Impl: "cow",
+			Examples: true, ValueFactory: "[]byte{byte(i)}"},
+	}
+	files, err := GenerateFiles(cs, templateDir, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fset := token.NewFileSet()
+	var parsed []*ast.File
+	for _, file := range files {
+		f, err := parser.ParseFile(fset, file.Concern+".go", file.Src, parser.ParseComments)
+		if err != nil {
+			t.Fatalf("parsing file for concern %q: %v", file.Concern, err)
+		}
+		parsed = append(parsed, f)
+	}
+	conf := types.Config{Importer: importer.ForCompiler(fset, "source", nil)}
+	pkg, err := conf.Check("cache", fset, parsed, nil)
+	if err != nil {
+		t.Fatalf("type-checking the maps and their examples: %v", err)
+	}
+	for name, want := range map[string]bool{
+		"ExampleUserCache_Load":    true,
+		"Example_sessions_Range":   true,
+		"ExampleUserCacheMap_Load": false,
+		"TestUserCacheOps":         false,
+	} {
+		if got := pkg.Scope().Lookup(name) != nil; got != want {
+			t.Errorf("generated %s = %v; want %v", name, got, want)
+		}
+	}
+	// The expected output of examples is in their comments.
+	if !bytes.Contains(files[len(files)-1].Src, []byte("// Output: 3 entries")) {
+		t.Error("generated examples lost their output comments")
+	}
+}
+
+func TestGenerateLinearizability(t *testing.T) {
+	skipShort(t)
+	// Both maps share the helpers of the checker, which must not collide.
+	cs := []Config{
+		{Package: "cache", Name: "UserCache", Key: "string", Value: "int64", Linearizability: true},
+		{Package: "cache", Name: "sessions", Unexported: true, Key: "int", Value: "[]byte", Impl: "rwmutex",
+			Linearizability: true, ValueFactory: "[]byte{byte(i)}"},
+	}
+	files, err := GenerateFiles(cs, templateDir, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fset := token.NewFileSet()
+	var parsed []*ast.File
+	for _, file := range files {
+		f, err := parser.ParseFile(fset, file.Concern+".go", file.Src, 0)
+		if err != nil {
+			t.Fatalf("parsing file for concern %q: %v", file.Concern, err)
+		}
+		parsed = append(parsed, f)
+	}
+	conf := types.Config{Importer: importer.ForCompiler(fset, "source", nil)}
+	pkg, err := conf.Check("cache", fset, parsed, nil)
+	if err != nil {
+		t.Fatalf("type-checking the maps and their checkers: %v", err)
+	}
+	for name, want := range map[string]bool{
+		"TestUserCacheLinearizable": true,
+		"TestSessionsLinearizable":  true,
+		"TestUserCacheOps":          false,
+		"ExampleUserCache_Load":     false,
+	} {
+		if got := pkg.Scope().Lookup(name) != nil; got != want {
+			t.Errorf("generated %s = %v; want %v", name, got, want)
+		}
+	}
+}
+
+func TestGenerateNames(t *testing.T) {
+	skipShort(t)
+	// Two maps with different names must be able to share a package.
+	var srcs [][]byte
+	for _, name := range []string{"UserCache", "SessionCache"} {
+		src, err := Generate(Config{Package: "cache", Name: name, Key: "string", Value: "int64"}, templateDir)
+		if err != nil {
+			t.Fatal(err)
+		}
+		srcs = append(srcs, src)
+	}
+
+	fset := token.NewFileSet()
+	var files []*ast.File
+	for i, src := range srcs {
+		f, err := parser.ParseFile(fset, fmt.Sprintf("map%d.go", i), src, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		files = append(files, f)
+	}
+	conf := types.Config{Importer: importer.ForCompiler(fset, "source", nil)}
+	if _, err := conf.Check("cache", fset, files, nil); err != nil {
+		t.Fatalf("type-checking two generated maps in one package: %v", err)
+	}
+}
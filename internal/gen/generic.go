@@ -0,0 +1,329 @@
+package gen
+
+import (
+	"bytes"
+	"fmt"
+	"go/ast"
+	"go/importer"
+	"go/token"
+	"go/types"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// GenericPackage is the import path of the generic package generated from the
+// template by GenerateGeneric.
+const GenericPackage = "github.com/cristaloleg/go-gen-syncmap/generic"
+
+// genericGoVersion is the Go version whose variant of the template the
+// generic package is generated from, and which it requires, for its generic
+// type alias.
+const genericGoVersion = "go1.24"
+
+// typeParams are the type parameters of the declarations of the generic
+// package, replacing the placeholders.
+var typeParams = [...]string{"K", "V"}
+
+// GenerateGeneric returns the source of the package pkg declaring
+// Map[K comparable, V any], with the algorithm and API of the template package
+// in dir, or of the embedded one if dir is empty, for programs that would
+// rather not generate code. Its types and functions have the type
+// parameters [K comparable, V any] in place of the placeholders, and its
+// methods comparing values, such as CompareAndSwap, panic if V is not
+// comparable, as those of sync.Map do. The binary encoding, which needs
+// fixed-size types, is left out.
+func GenerateGeneric(pkg, dir string) ([]byte, error) {
+	c := Config{Package: pkg, Key: typeParams[0], Value: typeParams[1], GoVersion: genericGoVersion}
+	fset := token.NewFileSet()
+	fsys, root := templateFS(dir)
+	parsed, err := parseTemplate(fset, fsys, root, root)
+	if err != nil {
+		return nil, err
+	}
+	var files, checked []templateFile
+	for _, f := range parsed {
+		if f.test || (f.constraint != nil && !c.satisfies(f.constraint)) {
+			continue
+		}
+		checked = append(checked, f)
+		if c.includeFile(f) {
+			files = append(files, f)
+		}
+	}
+
+	// Type-check the template, so that references are resolved exactly.
+	asts := make([]*ast.File, len(checked))
+	for i, f := range checked {
+		asts[i] = f.ast
+	}
+	conf := types.Config{Importer: importer.ForCompiler(fset, "source", nil)}
+	info := &types.Info{
+		Types: make(map[ast.Expr]types.TypeAndValue),
+		Defs:  make(map[*ast.Ident]types.Object),
+		Uses:  make(map[*ast.Ident]types.Object),
+	}
+	tpkg, err := conf.Check(asts[0].Name.Name, fset, asts, info)
+	if err != nil {
+		return nil, fmt.Errorf("type-checking the template: %v", err)
+	}
+	scope := tpkg.Scope()
+	var params [len(placeholders)]types.Object
+	for i, name := range placeholders {
+		params[i] = scope.Lookup(name)
+	}
+
+	// The types and functions referring to the placeholders, or to such
+	// types and functions, directly or not, get the type parameters, and so
+	// do the types whose methods do.
+	generic := make(map[types.Object]bool)
+	uses := make(map[types.Object][]types.Object) // type or function -> package-level objects it refers to
+	addUses := func(obj types.Object, n ast.Node) {
+		ast.Inspect(n, func(n ast.Node) bool {
+			if id, ok := n.(*ast.Ident); ok {
+				if u := info.Uses[id]; u != nil && u.Parent() == scope {
+					uses[obj] = append(uses[obj], u)
+				}
+			}
+			return true
+		})
+	}
+	for _, f := range files {
+		for _, d := range f.ast.Decls {
+			switch d := d.(type) {
+			case *ast.GenDecl:
+				for _, spec := range d.Specs {
+					switch spec := spec.(type) {
+					case *ast.TypeSpec:
+						addUses(info.Defs[spec.Name], spec)
+					case *ast.ValueSpec:
+						if obj := refersTo(info, spec, params[:]); obj != nil {
+							name := spec.Names[0].Name
+							return nil, fmt.Errorf("%s: %s refers to %s, so it can't be made generic", f.name, name, obj.Name())
+						}
+					}
+				}
+			case *ast.FuncDecl:
+				if d.Recv == nil {
+					addUses(info.Defs[d.Name], d)
+					break
+				}
+				// A type whose methods are generic is too.
+				recv := d.Recv.List[0].Type
+				if star, ok := recv.(*ast.StarExpr); ok {
+					recv = star.X
+				}
+				if id, ok := recv.(*ast.Ident); ok {
+					addUses(info.Uses[id], d)
+				}
+			}
+		}
+	}
+	for _, p := range params {
+		generic[p] = true
+	}
+	for changed := true; changed; {
+		changed = false
+		for fn, objs := range uses {
+			for _, obj := range objs {
+				if !generic[fn] && generic[obj] {
+					generic[fn], changed = true, true
+				}
+			}
+		}
+	}
+
+	// Rewrite the files, and join them.
+	imports := make(map[string]bool)
+	var (
+		headers []string
+		bodies  bytes.Buffer
+	)
+	for _, f := range files {
+		for _, cg := range f.ast.Comments {
+			// Text drops directives such as //go:build.
+			if cg.End() < f.ast.Package && cg != f.ast.Doc && cg.Text() != "" {
+				headers = appendUnique(headers, cg.Text())
+			}
+		}
+		for _, spec := range f.ast.Imports {
+			path, err := strconv.Unquote(spec.Path.Value)
+			if err != nil {
+				return nil, err
+			}
+			imports[path] = true
+		}
+		bodies.WriteString("\n")
+		bodies.Write(genericBody(fset, f, info, params, generic))
+	}
+
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "%s from its template package. DO NOT EDIT.\n\n", generatedPrefix)
+	for _, h := range headers {
+		for _, line := range strings.Split(strings.TrimSuffix(h, "\n"), "\n") {
+			fmt.Fprintf(&buf, "// %s\n", line)
+		}
+		buf.WriteString("\n")
+	}
+	fmt.Fprintf(&buf, "package %s\n\n", pkg)
+	paths := make([]string, 0, len(imports))
+	for path := range imports {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+	buf.WriteString("import (\n")
+	for _, path := range paths {
+		fmt.Fprintf(&buf, "\t%q\n", path)
+	}
+	buf.WriteString(")\n")
+	buf.Write(bodies.Bytes())
+	return Format(buf.Bytes())
+}
+
+// refersTo returns the first object of objs that n refers to, or nil.
+func refersTo(info *types.Info, n ast.Node, objs []types.Object) types.Object {
+	var found types.Object
+	ast.Inspect(n, func(n ast.Node) bool {
+		if id, ok := n.(*ast.Ident); ok && found == nil {
+			for _, obj := range objs {
+				if info.Uses[id] == obj {
+					found = obj
+				}
+			}
+		}
+		return found == nil
+	})
+	return found
+}
+
+// placeholderWord matches the placeholders in comments.
+var placeholderWord = regexp.MustCompile(`\b(KeyT|ValueT)\b`)
+
+// genericBody returns the declarations of the template file f made generic:
+// the placeholders are replaced with the type parameters, which the generic
+// declarations get, and with which the references to them are instantiated.
+// The operands of comparisons of values are converted to any, since V isn't
+// comparable.
+func genericBody(fset *token.FileSet, f templateFile, info *types.Info, params [len(placeholders)]types.Object, generic map[types.Object]bool) []byte {
+	type edit struct {
+		pos      int // offset in f.src
+		end      int // end of the replaced text
+		text     string
+		priority int // order of insertions at the same offset
+	}
+	var edits []edit
+	offset := func(p token.Pos) int { return fset.Position(p).Offset }
+	insert := func(p token.Pos, text string, priority int) {
+		edits = append(edits, edit{offset(p), offset(p), text, priority})
+	}
+	decl := "[" + typeParams[0] + " comparable, " + typeParams[1] + " any]"
+	inst := "[" + typeParams[0] + ", " + typeParams[1] + "]"
+
+	ast.Inspect(f.ast, func(n ast.Node) bool {
+		switch n := n.(type) {
+		case *ast.TypeSpec:
+			if generic[info.Defs[n.Name]] {
+				insert(n.Name.End(), decl, 0)
+			}
+		case *ast.FuncDecl:
+			if n.Recv == nil && generic[info.Defs[n.Name]] {
+				insert(n.Name.End(), decl, 0)
+			}
+		case *ast.BinaryExpr:
+			if n.Op != token.EQL && n.Op != token.NEQ {
+				break
+			}
+			if t := info.Types[n.X].Type; t == nil || t != params[1].Type() {
+				break
+			}
+			for _, x := range [...]ast.Expr{n.X, n.Y} {
+				insert(x.Pos(), "any(", 1)
+				insert(x.End(), ")", 0)
+			}
+		case *ast.Ident:
+			obj := info.Uses[n]
+			switch {
+			case obj == nil:
+			case obj == params[0], obj == params[1]:
+				name := typeParams[0]
+				if obj == params[1] {
+					name = typeParams[1]
+				}
+				edits = append(edits, edit{offset(n.Pos()), offset(n.End()), name, 0})
+			case generic[obj]:
+				insert(n.End(), inst, 0)
+			}
+		}
+		return true
+	})
+	for _, cg := range f.ast.Comments {
+		for _, c := range cg.List {
+			for _, m := range placeholderWord.FindAllStringIndex(c.Text, -1) {
+				name := typeParams[0]
+				if c.Text[m[0]:m[1]] == placeholders[1] {
+					name = typeParams[1]
+				}
+				start := offset(c.Pos())
+				edits = append(edits, edit{start + m[0], start + m[1], name, 0})
+			}
+		}
+	}
+	sort.SliceStable(edits, func(i, j int) bool {
+		if edits[i].pos != edits[j].pos {
+			return edits[i].pos < edits[j].pos
+		}
+		return edits[i].priority < edits[j].priority
+	})
+
+	start := f.ast.Name.End()
+	for _, d := range f.ast.Decls {
+		if g, ok := d.(*ast.GenDecl); ok && g.Tok == token.IMPORT {
+			start = g.End()
+		}
+	}
+	var out bytes.Buffer
+	at := offset(start)
+	for _, e := range edits {
+		if e.pos < at {
+			continue
+		}
+		out.Write(f.src[at:e.pos])
+		out.WriteString(e.text)
+		at = e.end
+	}
+	out.Write(f.src[at:])
+	return bytes.TrimLeft(out.Bytes(), "\n")
+}
+
+// genericWrapper returns the declarations of the generic map c, whose key
+// and value types are key and value as qualified by q: aliases of the
+// instances of the Map and Option types of GenericPackage, and constructors
+// calling its own, all named as they would be if c were specialized.
+func genericWrapper(c Config, q *qualifier, key, value string) ([]byte, error) {
+	pkg, err := q.qualifyExpr(GenericPackage+".New", false)
+	if err != nil {
+		return nil, fmt.Errorf("generic map %s: %v", c.name(), err)
+	}
+	pkg = strings.TrimSuffix(pkg, ".New")
+	names := make(map[string]string)
+	for _, ident := range [...]string{templateName, "Option", "New", "NewFromMap"} {
+		names[ident] = ident
+		if name := c.name(); name != templateName {
+			names[ident] = rename(ident, templateName, name)
+		}
+	}
+	inst := "[" + key + ", " + value + "]"
+
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "// %s is a concurrent map of %s to %s: see %s.Map.\n", names[templateName], key, value, pkg)
+	fmt.Fprintf(&buf, "type %s = %s.Map%s\n\n", names[templateName], pkg, inst)
+	fmt.Fprintf(&buf, "// %s configures a %s created by %s.\n", names["Option"], names[templateName], names["New"])
+	fmt.Fprintf(&buf, "type %s = %s.Option%s\n\n", names["Option"], pkg, inst)
+	fmt.Fprintf(&buf, "// %s returns an empty %s configured by opts.\n", names["New"], names[templateName])
+	fmt.Fprintf(&buf, "func %s(opts ...%s) *%s {\n\treturn %s.New(opts...)\n}\n\n", names["New"], names["Option"], names[templateName], pkg)
+	fmt.Fprintf(&buf, "// %s returns a %s holding the entries of src.\n", names["NewFromMap"], names[templateName])
+	fmt.Fprintf(&buf, "func %s(src map[%s]%s, opts ...%s) *%s {\n\treturn %s.NewFromMap(src, opts...)\n}\n",
+		names["NewFromMap"], key, value, names["Option"], names[templateName], pkg)
+	return buf.Bytes(), nil
+}
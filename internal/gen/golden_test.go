@@ -0,0 +1,106 @@
+package gen
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+var update = flag.Bool("update", false, "rewrite the golden files of TestGolden with the generated output")
+
+// TestGolden generates the maps listed by each manifest in testdata/golden,
+// split by concern if its name starts with split, and compares the
+// formatted files with those of the golden file of the same name, which
+// go test -run=TestGolden -update rewrites after an intended change.
+func TestGolden(t *testing.T) {
+	skipShort(t)
+	manifests, err := filepath.Glob(filepath.Join("testdata", "golden", "*.yaml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(manifests) == 0 {
+		t.Fatal("no golden manifests")
+	}
+	for _, manifest := range manifests {
+		name := strings.TrimSuffix(filepath.Base(manifest), ".yaml")
+		t.Run(name, func(t *testing.T) {
+			data, err := os.ReadFile(manifest)
+			if err != nil {
+				t.Fatal(err)
+			}
+			targets, err := ParseManifest(manifest, data)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var cs []Config
+			for _, target := range targets {
+				for i, ext := range target.Extensions {
+					target.Extensions[i] = filepath.Join(filepath.Dir(manifest), ext)
+				}
+				cs = append(cs, target.Config)
+			}
+			files, err := GenerateFiles(cs, templateDir, strings.HasPrefix(name, "split"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got bytes.Buffer
+			for _, f := range files {
+				src, err := Format(f.Src)
+				if err != nil {
+					t.Fatalf("formatting concern %q: %v", f.Concern, err)
+				}
+				file := "map.go"
+				if f.Concern != "" {
+					file = "map_" + f.Concern + ".go"
+				}
+				fmt.Fprintf(&got, "-- %s --\n", file)
+				got.Write(src)
+			}
+
+			golden := strings.TrimSuffix(manifest, ".yaml") + ".golden"
+			if *update {
+				if err := os.WriteFile(golden, got.Bytes(), 0o644); err != nil {
+					t.Fatal(err)
+				}
+				return
+			}
+			want, err := os.ReadFile(golden)
+			if err != nil {
+				t.Fatalf("%v; run go test -run=TestGolden -update to create it", err)
+			}
+			if d := Diff(golden, want, "generated", got.Bytes()); d != nil {
+				t.Errorf("generated output differs from %s; run go test -run=TestGolden -update if that's intended:\n%s", golden, d)
+			}
+		})
+	}
+}
+
+// genericFile is the file of the generic package generated by
+// GenerateGeneric.
+const genericFile = "../../generic/syncmap.go"
+
+// TestGoldenGeneric checks that the generic package is up to date with the
+// template, and go test -run=TestGolden -update regenerates it.
+func TestGoldenGeneric(t *testing.T) {
+	got, err := GenerateGeneric("generic", templateDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if *update {
+		if err := os.WriteFile(genericFile, got, 0o644); err != nil {
+			t.Fatal(err)
+		}
+		return
+	}
+	want, err := os.ReadFile(genericFile)
+	if err != nil {
+		t.Fatalf("%v; run go test -run=TestGolden -update to create it", err)
+	}
+	if d := Diff(genericFile, want, "generated", got); d != nil {
+		t.Errorf("generated output differs from %s; run go test -run=TestGolden -update if that's intended:\n%s", genericFile, d)
+	}
+}
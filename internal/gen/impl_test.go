@@ -0,0 +1,53 @@
+package gen
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+)
+
+// TestImplTests runs the portableTests against maps of integers and of
+// strings generated with each implementation but TemplatePackage, whose
+// template packages have no copies of them, in a module of their own.
+func TestImplTests(t *testing.T) {
+	skipShort(t)
+	mod := t.TempDir()
+	if err := os.WriteFile(filepath.Join(mod, "go.mod"), []byte("module impltests\n\ngo 1.24\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	for _, impl := range Impls[1:] {
+		var cs []Config
+		for _, m := range []struct{ name, key string }{{"Ints", "int64"}, {"Strings", "string"}} {
+			cs = append(cs, Config{
+				Package: impl, Name: m.name, Key: m.key, Value: "int64", Impl: impl,
+				Tests: true, Benchmarks: true, PropertyTests: true, Examples: true, Linearizability: true,
+			})
+		}
+		files, err := GenerateFiles(cs, templateDir, false)
+		if err != nil {
+			t.Fatalf("GenerateFiles(%+v): %v", cs, err)
+		}
+		dir := filepath.Join(mod, impl)
+		if err := os.Mkdir(dir, 0o755); err != nil {
+			t.Fatal(err)
+		}
+		for _, f := range files {
+			name := "maps_syncmap.go"
+			if f.Concern != "" {
+				name = "maps_syncmap_" + f.Concern + ".go"
+			}
+			if err := os.WriteFile(filepath.Join(dir, name), f.Src, 0o644); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	for _, args := range [][]string{{"vet", "./..."}, {"test", "./..."}} {
+		cmd := exec.Command("go", args...)
+		cmd.Dir = mod
+		if out, err := cmd.CombinedOutput(); err != nil {
+			t.Fatalf("go %v: %v\n%s", args, err, out)
+		}
+	}
+}
@@ -0,0 +1,139 @@
+package gen
+
+import (
+	"bytes"
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"path"
+	"strconv"
+	"strings"
+)
+
+// Infer returns the Config described by the first declaration after line in
+// the Go source file src, which is typically the line of a go:generate
+// directive. The declaration must take one of two forms:
+//
+//	type UserCache = syncmap.Map[UserID, *User]
+//
+//	type (
+//		UserCacheKey   = UserID
+//		UserCacheValue = *User
+//	)
+//
+// The first form can't be compiled alongside the generated type, so it
+// belongs in a file that is only seen by go generate, with a
+// "//go:build generate" constraint.
+//
+// Types of packages imported by src are qualified by import path in the
+// returned Config, so that the generated file imports them too.
+func Infer(filename string, src []byte, line int) (Config, error) {
+	fset := token.NewFileSet()
+	f, err := parser.ParseFile(fset, filename, src, 0)
+	if err != nil {
+		return Config{}, err
+	}
+
+	imports := make(map[string]string) // package name -> import path
+	for _, spec := range f.Imports {
+		p, err := strconv.Unquote(spec.Path.Value)
+		if err != nil {
+			return Config{}, err
+		}
+		name := path.Base(p)
+		if spec.Name != nil {
+			name = spec.Name.Name
+		}
+		imports[name] = p
+	}
+
+	for _, d := range f.Decls {
+		if fset.Position(d.Pos()).Line <= line {
+			continue
+		}
+		pos := fset.Position(d.Pos())
+		g, ok := d.(*ast.GenDecl)
+		if !ok || g.Tok != token.TYPE {
+			return Config{}, fmt.Errorf("%s: expected a type declaration", pos)
+		}
+		c, ok := inferDecl(g, func(x ast.Expr) string {
+			return qualifiedText(fset, src, x, imports)
+		})
+		if !ok {
+			return Config{}, fmt.Errorf("%s: expected type Name = syncmap.Map[Key, Value] "+
+				"or a pair of NameKey and NameValue type aliases", pos)
+		}
+		c.Package = f.Name.Name
+		return c, nil
+	}
+	return Config{}, fmt.Errorf("%s:%d: no declaration follows the directive", filename, line)
+}
+
+// inferDecl matches g against the forms accepted by Infer, using text to
+// get the source of type expressions.
+func inferDecl(g *ast.GenDecl, text func(ast.Expr) string) (Config, bool) {
+	var aliases []*ast.TypeSpec
+	for _, spec := range g.Specs {
+		ts := spec.(*ast.TypeSpec)
+		if !ts.Assign.IsValid() {
+			return Config{}, false
+		}
+		aliases = append(aliases, ts)
+	}
+
+	switch len(aliases) {
+	case 1:
+		ts := aliases[0]
+		x, ok := ts.Type.(*ast.IndexListExpr)
+		if !ok || len(x.Indices) != 2 || !isMap(x.X) {
+			return Config{}, false
+		}
+		return Config{Name: ts.Name.Name, Key: text(x.Indices[0]), Value: text(x.Indices[1])}, true
+
+	case 2:
+		key, value := aliases[0], aliases[1]
+		if strings.HasSuffix(key.Name.Name, "Value") {
+			key, value = value, key
+		}
+		name := strings.TrimSuffix(key.Name.Name, "Key")
+		if name == "" || key.Name.Name != name+"Key" || value.Name.Name != name+"Value" {
+			return Config{}, false
+		}
+		return Config{Name: name, Key: text(key.Type), Value: text(value.Type)}, true
+	}
+	return Config{}, false
+}
+
+// qualifiedText returns the source of x, with the package names of
+// qualified identifiers replaced by the import paths in imports.
+func qualifiedText(fset *token.FileSet, src []byte, x ast.Expr, imports map[string]string) string {
+	var out bytes.Buffer
+	offset := fset.Position(x.Pos()).Offset
+	ast.Inspect(x, func(n ast.Node) bool {
+		sel, ok := n.(*ast.SelectorExpr)
+		if !ok {
+			return true
+		}
+		if id, ok := sel.X.(*ast.Ident); ok && imports[id.Name] != "" {
+			pos := fset.Position(id.Pos()).Offset
+			out.Write(src[offset:pos])
+			out.WriteString(imports[id.Name])
+			offset = pos + len(id.Name)
+		}
+		return false
+	})
+	out.Write(src[offset:fset.Position(x.End()).Offset])
+	return out.String()
+}
+
+// isMap reports whether x names the template map type, qualified or not.
+func isMap(x ast.Expr) bool {
+	switch x := x.(type) {
+	case *ast.Ident:
+		return x.Name == templateName
+	case *ast.SelectorExpr:
+		return x.Sel.Name == templateName
+	}
+	return false
+}
@@ -0,0 +1,71 @@
+package gen
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestInfer(t *testing.T) {
+	for _, tt := range []struct {
+		src  string
+		want Config
+	}{
+		{
+			src: `package cache
+
+//go:generate go-gen-syncmap
+type UserCache = syncmap.Map[UserID, *User]
+`,
+			want: Config{Package: "cache", Name: "UserCache", Key: "UserID", Value: "*User"},
+		},
+		{
+			src: `package cache
+
+//go:generate go-gen-syncmap
+type (
+	UserCacheKey   = UserID
+	UserCacheValue = map[string]int
+)
+`,
+			want: Config{Package: "cache", Name: "UserCache", Key: "UserID", Value: "map[string]int"},
+		},
+		{
+			src: `package cache
+
+import (
+	"github.com/acme/ids"
+	m "github.com/acme/model"
+)
+
+//go:generate go-gen-syncmap
+type UserCache = syncmap.Map[ids.UserID, []*m.User]
+`,
+			want: Config{Package: "cache", Name: "UserCache", Key: "github.com/acme/ids.UserID", Value: "[]*github.com/acme/model.User"},
+		},
+	} {
+		line := strings.Count(tt.src[:strings.Index(tt.src, "//go:generate")], "\n") + 1
+		got, err := Infer("cache.go", []byte(tt.src), line)
+		if err != nil {
+			t.Errorf("Infer(%q): %v", tt.src, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("Infer(%q) = %+v; want %+v", tt.src, got, tt.want)
+		}
+	}
+}
+
+func TestInferErrors(t *testing.T) {
+	for _, src := range []string{
+		"package cache\n\n//go:generate go-gen-syncmap\n",
+		"package cache\n\n//go:generate go-gen-syncmap\nfunc f() {}\n",
+		"package cache\n\n//go:generate go-gen-syncmap\ntype UserCache struct{}\n",
+		"package cache\n\n//go:generate go-gen-syncmap\ntype UserCache = sync.Pool[UserID, *User]\n",
+		"package cache\n\n//go:generate go-gen-syncmap\ntype (\n\tAKey = int\n\tBValue = int\n)\n",
+	} {
+		if c, err := Infer("cache.go", []byte(src), 3); err == nil {
+			t.Errorf("Infer(%q) = %+v; want error", src, c)
+		}
+	}
+}
@@ -0,0 +1,350 @@
+package gen
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// Target is a map to generate and the file to write it to.
+type Target struct {
+	Config
+
+	// Output is the name of the generated file.
+	Output string
+}
+
+// ParseManifest parses a manifest listing maps to generate. The format is
+// chosen by the extension of filename: a YAML subset for .yaml and .yml,
+//
+//	maps:
+//	  - name: UserCache
+//	    key: UserID
+//	    value: "*User"
+//	    package: cache
+//	    output: cache/usercache_syncmap.go
+//
+// or a TOML subset for .toml,
+//
+//	[[maps]]
+//	name = "UserCache"
+//	key = "UserID"
+//	value = "*User"
+//	package = "cache"
+//	output = "cache/usercache_syncmap.go"
+//
+// Besides the fields above, an entry may set nojson, nocompare, unexported,
+// padded, ttl, loader, backend, metrics, prometheus, otel, redis, tests,
+// benchmarks, property_tests, examples, and linearizability to true,
+// maxentries to the bound of the map, eviction to one of Evictions, cost and
+// maxcost to its cost function and budget, key_factory and value_factory to
+// the factories of the tests, hash and equal to the hash and equality
+// functions of keys, kind to one of Kinds, impl to one of Impls, mode to one
+// of Modes, build to a build constraint, go to a minimum Go version, and
+// extensions to a comma-separated list of Config.Extensions. Fields given
+// before the list of maps apply to each of them, unless it sets them too:
+//
+//	extensions: debugdump.go
+//	maps:
+//	  - ...
+//
+// Only single-line scalar values and # comments are supported. Relative
+// output and extension paths are returned as written; entries sharing an
+// output are meant to be generated into one file with GenerateMany.
+func ParseManifest(filename string, data []byte) ([]Target, error) {
+	var (
+		entries []manifestEntry
+		err     error
+	)
+	switch ext := filepath.Ext(filename); ext {
+	case ".yaml", ".yml":
+		entries, err = parseYAML(data)
+	case ".toml":
+		entries, err = parseTOML(data)
+	default:
+		return nil, fmt.Errorf("%s: unsupported manifest format %q", filename, ext)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s:%v", filename, err)
+	}
+	if len(entries) == 0 {
+		return nil, fmt.Errorf("%s: no maps listed", filename)
+	}
+
+	targets := make([]Target, 0, len(entries))
+	for _, e := range entries {
+		t, err := e.target()
+		if err != nil {
+			return nil, fmt.Errorf("%s:%v", filename, err)
+		}
+		targets = append(targets, t)
+	}
+	return targets, nil
+}
+
+// manifestEntry is the list of fields of one map in a manifest.
+type manifestEntry struct {
+	line   int
+	fields []manifestField
+}
+
+type manifestField struct {
+	line       int
+	key, value string
+}
+
+func (e manifestEntry) target() (Target, error) {
+	var t Target
+	for _, f := range e.fields {
+		switch f.key {
+		case "name":
+			t.Name = f.value
+		case "key":
+			t.Key = f.value
+		case "value":
+			t.Value = f.value
+		case "package":
+			t.Package = f.value
+		case "output":
+			t.Output = f.value
+		case "kind":
+			t.Kind = f.value
+		case "impl":
+			t.Impl = f.value
+		case "mode":
+			t.Mode = f.value
+		case "eviction":
+			t.Eviction = f.value
+		case "cost":
+			t.Cost = f.value
+		case "build":
+			t.Build = f.value
+		case "go":
+			t.GoVersion = f.value
+		case "key_factory":
+			t.KeyFactory = f.value
+		case "value_factory":
+			t.ValueFactory = f.value
+		case "hash":
+			t.Hash = f.value
+		case "equal":
+			t.Equal = f.value
+		case "extensions":
+			t.Extensions = nil
+			for _, name := range strings.Split(f.value, ",") {
+				if name = strings.TrimSpace(name); name != "" {
+					t.Extensions = append(t.Extensions, name)
+				}
+			}
+		case "maxentries", "maxcost":
+			n, err := strconv.ParseInt(f.value, 10, 64)
+			if err != nil {
+				return t, fmt.Errorf("%d: invalid %s value %q", f.line, f.key, f.value)
+			}
+			if f.key == "maxcost" {
+				t.MaxCost = n
+			} else {
+				t.MaxEntries = int(n)
+			}
+		case "nojson", "nocompare", "unexported", "padded", "ttl", "loader", "backend", "metrics", "prometheus", "otel", "redis", "tests", "benchmarks", "property_tests", "examples", "linearizability":
+			b, err := strconv.ParseBool(f.value)
+			if err != nil {
+				return t, fmt.Errorf("%d: invalid %s value %q", f.line, f.key, f.value)
+			}
+			switch f.key {
+			case "nojson":
+				t.NoJSON = b
+			case "nocompare":
+				t.NoCompare = b
+			case "padded":
+				t.Padded = b
+			case "ttl":
+				t.TTL = b
+			case "loader":
+				t.Loader = b
+			case "backend":
+				t.Backend = b
+			case "metrics":
+				t.Metrics = b
+			case "prometheus":
+				t.Prometheus = b
+			case "otel":
+				t.OTel = b
+			case "redis":
+				t.Redis = b
+			case "tests":
+				t.Tests = b
+			case "benchmarks":
+				t.Benchmarks = b
+			case "property_tests":
+				t.PropertyTests = b
+			case "examples":
+				t.Examples = b
+			case "linearizability":
+				t.Linearizability = b
+			default:
+				t.Unexported = b
+			}
+		default:
+			return t, fmt.Errorf("%d: unknown field %q", f.line, f.key)
+		}
+	}
+	if err := t.Validate(); err != nil {
+		return t, fmt.Errorf("%d: %v", e.line, err)
+	}
+	if t.Output == "" {
+		t.Output = strings.ToLower(t.name()) + "_syncmap.go"
+	}
+	return t, nil
+}
+
+// withDefaults returns entries with the fields in defaults prepended to
+// each, so that fields of their own override them.
+func withDefaults(entries []manifestEntry, defaults []manifestField) []manifestEntry {
+	for i := range entries {
+		entries[i].fields = append(defaults[:len(defaults):len(defaults)], entries[i].fields...)
+	}
+	return entries
+}
+
+func parseYAML(data []byte) ([]manifestEntry, error) {
+	var (
+		entries  []manifestEntry
+		defaults []manifestField
+	)
+	inMaps := false
+	sc := bufio.NewScanner(bytes.NewReader(data))
+	for n := 1; sc.Scan(); n++ {
+		line := stripComment(sc.Text())
+		trimmed := strings.TrimSpace(line)
+		if trimmed == "" || trimmed == "---" {
+			continue
+		}
+		if line[0] != ' ' && line[0] != '-' {
+			inMaps = trimmed == "maps:"
+			if inMaps {
+				continue
+			}
+			i := strings.Index(trimmed, ":")
+			if i < 0 {
+				return nil, fmt.Errorf("%d: expected maps: or key: value", n)
+			}
+			value, err := unquote(strings.TrimSpace(trimmed[i+1:]))
+			if err != nil {
+				return nil, fmt.Errorf("%d: %v", n, err)
+			}
+			defaults = append(defaults, manifestField{n, strings.TrimSpace(trimmed[:i]), value})
+			continue
+		}
+		if !inMaps {
+			return nil, fmt.Errorf("%d: expected maps:", n)
+		}
+
+		if strings.HasPrefix(trimmed, "- ") || trimmed == "-" {
+			entries = append(entries, manifestEntry{line: n})
+			trimmed = strings.TrimSpace(strings.TrimPrefix(trimmed, "-"))
+			if trimmed == "" {
+				continue
+			}
+		}
+		if len(entries) == 0 {
+			return nil, fmt.Errorf("%d: expected a list item", n)
+		}
+		i := strings.Index(trimmed, ":")
+		if i < 0 {
+			return nil, fmt.Errorf("%d: expected key: value", n)
+		}
+		value, err := unquote(strings.TrimSpace(trimmed[i+1:]))
+		if err != nil {
+			return nil, fmt.Errorf("%d: %v", n, err)
+		}
+		e := &entries[len(entries)-1]
+		e.fields = append(e.fields, manifestField{n, strings.TrimSpace(trimmed[:i]), value})
+	}
+	return withDefaults(entries, defaults), sc.Err()
+}
+
+func parseTOML(data []byte) ([]manifestEntry, error) {
+	var (
+		entries  []manifestEntry
+		defaults []manifestField
+	)
+	sc := bufio.NewScanner(bytes.NewReader(data))
+	for n := 1; sc.Scan(); n++ {
+		line := strings.TrimSpace(stripComment(sc.Text()))
+		switch {
+		case line == "":
+			continue
+		case line == "[[maps]]":
+			entries = append(entries, manifestEntry{line: n})
+			continue
+		case strings.HasPrefix(line, "["):
+			return nil, fmt.Errorf("%d: unsupported table %s", n, line)
+		}
+
+		i := strings.Index(line, "=")
+		if i < 0 {
+			return nil, fmt.Errorf("%d: expected key = value", n)
+		}
+		value := strings.TrimSpace(line[i+1:])
+		if _, err := strconv.Atoi(value); err != nil && value != "true" && value != "false" {
+			if len(value) < 2 || (value[0] != '"' && value[0] != '\'') {
+				return nil, fmt.Errorf("%d: expected a string, boolean, or integer value", n)
+			}
+		}
+		value, err := unquote(value)
+		if err != nil {
+			return nil, fmt.Errorf("%d: %v", n, err)
+		}
+		field := manifestField{n, strings.TrimSpace(line[:i]), value}
+		if len(entries) == 0 {
+			// The root table, before the first map.
+			defaults = append(defaults, field)
+			continue
+		}
+		e := &entries[len(entries)-1]
+		e.fields = append(e.fields, field)
+	}
+	return withDefaults(entries, defaults), sc.Err()
+}
+
+// stripComment removes a # comment that is not inside a quoted string.
+func stripComment(line string) string {
+	var quote byte
+	for i := 0; i < len(line); i++ {
+		switch c := line[i]; {
+		case quote != 0:
+			if c == '\\' && quote == '"' {
+				i++
+			} else if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '\'':
+			quote = c
+		case c == '#':
+			return line[:i]
+		}
+	}
+	return line
+}
+
+var errUnterminated = errors.New("unterminated string")
+
+// unquote returns the value of a scalar that may be single- or
+// double-quoted.
+func unquote(s string) (string, error) {
+	if s == "" || (s[0] != '"' && s[0] != '\'') {
+		return s, nil
+	}
+	if len(s) < 2 || s[len(s)-1] != s[0] {
+		return "", errUnterminated
+	}
+	if s[0] == '\'' {
+		return strings.Replace(s[1:len(s)-1], "''", "'", -1), nil
+	}
+	return strconv.Unquote(s)
+}
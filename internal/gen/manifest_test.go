@@ -0,0 +1,182 @@
+package gen
+
+import (
+	"reflect"
+	"testing"
+)
+
+var manifestTargets = []Target{
+	{
+		Config: Config{Package: "cache", Name: "UserCache", Key: "UserID", Value: "*User", Build: "!tinygo", GoVersion: "1.23", TTL: true, Loader: true, Backend: true, Metrics: true, Prometheus: true, OTel: true, Redis: true, MaxEntries: 10000, Eviction: "lru", Cost: "userSize", MaxCost: 1 << 20,
+			Tests: true, Benchmarks: true, PropertyTests: true, Examples: true, Linearizability: true, KeyFactory: "UserID(strconv.Itoa(i))", ValueFactory: "&User{}",
+			Extensions: []string{"debugdump.go", "audit/audit.go"}},
+		Output: "cache/usercache_syncmap.go",
+	},
+	{
+		Config: Config{Package: "cache", Key: "float64", Value: "string", NoJSON: true, Impl: "sharded", Padded: true},
+		Output: "map_syncmap.go",
+	},
+	{
+		Config: Config{Package: "cache", Name: "Blobs", Key: "[]byte", Value: "int", NoJSON: true, Impl: "robinhood",
+			Hash: "hash/maphash.Bytes", Equal: "bytes.Equal"},
+		Output: "blobs_syncmap.go",
+	},
+	{
+		Config: Config{Package: "cache", Name: "Sessions", Key: "string", Value: "int64", Kind: "map", Mode: "generic"},
+		Output: "sessions_syncmap.go",
+	},
+}
+
+func TestParseManifest(t *testing.T) {
+	for _, tt := range []struct {
+		filename, src string
+	}{
+		{"syncmaps.yaml", `# Maps of the cache package.
+package: cache
+extensions: debugdump.go, audit/audit.go
+maps:
+  - name: UserCache
+    key: UserID
+    value: "*User" # quoted: * starts an alias in YAML
+    package: cache
+    output: 'cache/usercache_syncmap.go'
+    build: "!tinygo"
+    go: 1.23
+    ttl: true
+    loader: true
+    backend: true
+    metrics: true
+    prometheus: true
+    otel: true
+    redis: true
+    maxentries: 10000
+    eviction: lru
+    cost: userSize
+    maxcost: 1048576
+    tests: true
+    benchmarks: true
+    property_tests: true
+    examples: true
+    linearizability: true
+    key_factory: UserID(strconv.Itoa(i))
+    value_factory: "&User{}"
+  -
+    key: float64
+    value: string
+    nojson: true
+    extensions: ""
+    impl: sharded
+    padded: true
+  - name: Blobs
+    key: "[]byte"
+    value: int
+    nojson: true
+    extensions: ""
+    impl: robinhood
+    hash: hash/maphash.Bytes
+    equal: bytes.Equal
+  - name: Sessions
+    key: string
+    value: int64
+    extensions: ""
+    kind: map
+    mode: generic
+`},
+		{"syncmaps.toml", `# Maps of the cache package.
+extensions = "debugdump.go,audit/audit.go"
+
+[[maps]]
+name = "UserCache"
+key = "UserID"
+value = "*User"
+package = "cache"
+output = 'cache/usercache_syncmap.go'
+build = "!tinygo"
+go = "1.23"
+ttl = true
+loader = true
+backend = true
+metrics = true
+prometheus = true
+otel = true
+redis = true
+maxentries = 10000
+eviction = "lru"
+cost = "userSize"
+maxcost = 1048576
+tests = true
+benchmarks = true
+property_tests = true
+examples = true
+linearizability = true
+key_factory = "UserID(strconv.Itoa(i))"
+value_factory = "&User{}"
+
+[[maps]]
+key = "float64"
+value = "string"
+package = "cache" # same package
+nojson = true
+impl = "sharded"
+padded = true
+extensions = ''
+
+[[maps]]
+name = "Blobs"
+package = "cache"
+key = "[]byte"
+value = "int"
+nojson = true
+extensions = ""
+impl = "robinhood"
+hash = "hash/maphash.Bytes"
+equal = "bytes.Equal"
+
+[[maps]]
+name = "Sessions"
+package = "cache"
+key = "string"
+value = "int64"
+extensions = ""
+kind = "map"
+mode = "generic"
+
+`},
+	} {
+		got, err := ParseManifest(tt.filename, []byte(tt.src))
+		if err != nil {
+			t.Errorf("ParseManifest(%s): %v", tt.filename, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, manifestTargets) {
+			t.Errorf("ParseManifest(%s) = %+v; want %+v", tt.filename, got, manifestTargets)
+		}
+	}
+}
+
+func TestParseManifestErrors(t *testing.T) {
+	for _, tt := range []struct {
+		filename, src string
+	}{
+		{"syncmaps.json", `{}`},
+		{"syncmaps.yaml", ``},
+		{"syncmaps.yaml", "types:\n  - key: int\n"},
+		{"syncmaps.yaml", "package: cache\n"},
+		{"syncmaps.toml", "package = \"cache\"\n"},
+		{"syncmaps.yaml", "maps:\n  - key: int\n    value: int\n    package: cache\n    color: red\n"},
+		{"syncmaps.yaml", "maps:\n  - key: int\n    value: \"int\n    package: cache\n"},
+		{"syncmaps.yaml", "maps:\n  - key: int\n    value: int\n"},
+		{"syncmaps.yaml", "maps:\n  - key: int\n    value: int\n    package: cache\n    impl: btree\n"},
+		{"syncmaps.yaml", "maps:\n  - key: int\n    value: int\n    package: cache\n    mode: boxed\n"},
+		{"syncmaps.yaml", "maps:\n  - key: int\n    value: int\n    package: cache\n    go: one\n"},
+		{"syncmaps.yaml", "maps:\n  - key: int\n    value: int\n    package: cache\n    maxentries: many\n"},
+		{"syncmaps.yaml", "maps:\n  - key: int\n    value: int\n    package: cache\n    build: \"a &&\"\n"},
+		{"syncmaps.toml", "key = \"int\"\n"},
+		{"syncmaps.toml", "[[maps]]\nkey = int\n"},
+		{"syncmaps.toml", "[maps]\nkey = \"int\"\n"},
+	} {
+		if got, err := ParseManifest(tt.filename, []byte(tt.src)); err == nil {
+			t.Errorf("ParseManifest(%s, %q) = %+v; want error", tt.filename, tt.src, got)
+		}
+	}
+}
@@ -0,0 +1,108 @@
+package gen
+
+import (
+	"fmt"
+	"go/importer"
+	"go/token"
+	"go/types"
+	"os"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// qualifiedIdent matches an identifier qualified by an import path, such as
+// time.Time or github.com/acme/ids.UserID. The path is everything before the
+// last dot.
+var qualifiedIdent = regexp.MustCompile(`[A-Za-z0-9_.\-~/]+\.[A-Za-z_][A-Za-z0-9_]*`)
+
+// normalize replaces the import paths of qualified identifiers in expr with
+// their last element, so that expr can be parsed as a Go expression.
+func normalize(expr string) string {
+	return qualifiedIdent.ReplaceAllStringFunc(expr, func(s string) string {
+		i := strings.LastIndex(s, ".")
+		return path.Base(s[:i]) + s[i:]
+	})
+}
+
+// qualifier resolves qualified identifiers and tracks the imports they need.
+type qualifier struct {
+	imp     types.ImporterFrom
+	dir     string
+	names   map[string]string // package name -> import path
+	imports map[string]string // import path -> package name, for used imports
+}
+
+// newQualifier returns a qualifier for a file that already imports paths.
+func newQualifier(paths []string) *qualifier {
+	q := &qualifier{
+		imp:     importer.ForCompiler(token.NewFileSet(), "source", nil).(types.ImporterFrom),
+		names:   make(map[string]string),
+		imports: make(map[string]string),
+	}
+	q.dir, _ = os.Getwd()
+	for _, p := range paths {
+		q.names[path.Base(p)] = p
+	}
+	return q
+}
+
+// qualify rewrites the qualified identifiers in the type expression expr
+// into selector expressions, checking that each names a type.
+func (q *qualifier) qualify(expr string) (string, error) {
+	return q.qualifyExpr(expr, true)
+}
+
+// qualifyExpr is like qualify, but only checks that the identifiers name a
+// type if typeOnly is set, so that expr may be any expression.
+func (q *qualifier) qualifyExpr(expr string, typeOnly bool) (string, error) {
+	var err error
+	out := qualifiedIdent.ReplaceAllStringFunc(expr, func(s string) string {
+		i := strings.LastIndex(s, ".")
+		name, e := q.resolve(s[:i], s[i+1:], typeOnly)
+		if e != nil && err == nil {
+			err = e
+		}
+		return name + s[i:]
+	})
+	return out, err
+}
+
+// resolve returns the package name to use for importPath, checking that
+// ident is declared by it, and is a type if typeOnly is set.
+func (q *qualifier) resolve(importPath, ident string, typeOnly bool) (string, error) {
+	pkg, err := q.imp.ImportFrom(importPath, q.dir, 0)
+	if err != nil {
+		return "", fmt.Errorf("resolving %s.%s: %v", importPath, ident, err)
+	}
+	switch obj := pkg.Scope().Lookup(ident); obj.(type) {
+	case *types.TypeName:
+	case nil:
+		return "", fmt.Errorf("%s.%s is not declared", importPath, ident)
+	default:
+		if typeOnly {
+			return "", fmt.Errorf("%s.%s is not a type", importPath, ident)
+		}
+	}
+
+	if name, ok := q.imports[importPath]; ok {
+		return name, nil
+	}
+	name := pkg.Name()
+	for n := 2; q.names[name] != "" && q.names[name] != importPath; n++ {
+		name = pkg.Name() + strconv.Itoa(n)
+	}
+	q.names[name] = importPath
+	q.imports[importPath] = name
+	return name, nil
+}
+
+// importSpec returns the import spec for a used import, naming the
+// package if its name differs from the last element of the path.
+func (q *qualifier) importSpec(importPath string) string {
+	if name := q.imports[importPath]; name != path.Base(importPath) {
+		return fmt.Sprintf("%s %q", name, importPath)
+	}
+	return strconv.Quote(importPath)
+}
@@ -0,0 +1,112 @@
+package gen
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"fmt"
+	"go/parser"
+	"go/token"
+	"os"
+	"path/filepath"
+	"sort"
+	"text/template"
+)
+
+// TemplateData is the data a custom template is executed with.
+type TemplateData struct {
+	// Package is the package clause of the generated file.
+	Package string
+
+	// Name is the name of the map type, "Map" by default.
+	Name string
+
+	// KeyType and ValueType are the key and value type expressions, with
+	// types of other packages qualified by package name rather than import
+	// path, as in "*model.User".
+	KeyType   string
+	ValueType string
+
+	// NoJSON reports whether JSON methods should be omitted.
+	NoJSON bool
+}
+
+// GenerateTemplate is like GenerateSource for the single map c, but executes
+// the text/template in filename with a TemplateData instead of specializing
+// the template package. Unlike the template package, a custom template
+// spells out its package clause and imports, for example:
+//
+//	package {{.Package}}
+//
+//	import "sync"
+//
+//	// {{.Name}} is a map[{{.KeyType}}]{{.ValueType}} guarded by a mutex.
+//	type {{.Name}} struct {
+//		mu sync.Mutex
+//		m  map[{{.KeyType}}]{{.ValueType}}
+//	}
+//
+// The imports needed by qualified key and value types are added to the
+// output, which starts with the generated code header.
+func GenerateTemplate(c Config, filename string) ([]byte, error) {
+	if err := c.Validate(); err != nil {
+		return nil, err
+	}
+	text, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	text = bytes.ReplaceAll(text, []byte("\r\n"), []byte("\n"))
+	tmpl, err := template.New(filepath.Base(filename)).Parse(string(text))
+	if err != nil {
+		return nil, err
+	}
+
+	q := newQualifier(nil)
+	key, err := q.qualify(c.Key)
+	if err != nil {
+		return nil, fmt.Errorf("key type of %s: %v", c.name(), err)
+	}
+	value, err := q.qualify(c.Value)
+	if err != nil {
+		return nil, fmt.Errorf("value type of %s: %v", c.name(), err)
+	}
+	var buf bytes.Buffer
+	err = tmpl.Execute(&buf, TemplateData{
+		Package:   c.Package,
+		Name:      c.name(),
+		KeyType:   key,
+		ValueType: value,
+		NoJSON:    c.NoJSON,
+	})
+	if err != nil {
+		return nil, err
+	}
+	src := buf.Bytes()
+
+	fset := token.NewFileSet()
+	f, err := parser.ParseFile(fset, filename, src, parser.PackageClauseOnly)
+	if err != nil {
+		return nil, fmt.Errorf("executing %s: %v", filename, err)
+	}
+	var out bytes.Buffer
+	if !bytes.HasPrefix(src, []byte(generatedPrefix)) {
+		sum := sha256.Sum256(text)
+		out.WriteString(generatedHeader(sum[:]) + "\n")
+	}
+	end := fset.Position(f.Name.End()).Offset
+	out.Write(src[:end])
+	if len(q.imports) > 0 {
+		paths := make([]string, 0, len(q.imports))
+		for path := range q.imports {
+			paths = append(paths, path)
+		}
+		sort.Strings(paths)
+		out.WriteString("\n\nimport (\n")
+		for _, path := range paths {
+			fmt.Fprintf(&out, "\t%s\n", q.importSpec(path))
+		}
+		out.WriteString(")")
+	}
+	out.Write(src[end:])
+	return out.Bytes(), nil
+}
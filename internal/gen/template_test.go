@@ -0,0 +1,39 @@
+package gen
+
+import (
+	"go/types"
+	"testing"
+)
+
+func TestGenerateTemplate(t *testing.T) {
+	skipShort(t)
+	for _, c := range []Config{
+		{Package: "cache", Key: "string", Value: "int"},
+		{Package: "cache", Name: "Locks", Key: "time.Duration", Value: "*sync.Mutex", NoJSON: true},
+	} {
+		src, err := GenerateTemplate(c, "testdata/locked.tmpl")
+		if err != nil {
+			t.Fatalf("GenerateTemplate(%+v): %v", c, err)
+		}
+		if !header.Match(src) {
+			t.Errorf("GenerateTemplate(%+v) is missing the generated code header", c)
+		}
+		src, err = Format(src)
+		if err != nil {
+			t.Fatal(err)
+		}
+		pkg := typeCheck(t, src)
+		m := pkg.Scope().Lookup(c.name())
+		if m == nil {
+			t.Fatalf("GenerateTemplate(%+v) doesn't declare %s", c, c.name())
+		}
+		ms := types.NewMethodSet(types.NewPointer(m.Type()))
+		if hasLen := ms.Lookup(pkg, "Len") != nil; hasLen == c.NoJSON {
+			t.Errorf("GenerateTemplate(%+v): Len generated = %v", c, hasLen)
+		}
+	}
+
+	if _, err := GenerateTemplate(Config{Package: "cache", Key: "string", Value: "int"}, "testdata/missing.tmpl"); err == nil {
+		t.Error("GenerateTemplate of a missing file succeeded")
+	}
+}
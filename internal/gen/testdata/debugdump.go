@@ -0,0 +1,19 @@
+package syncmap
+
+import (
+	"fmt"
+	"io"
+)
+
+// dumpFormat formats an entry written by DebugDump.
+const dumpFormat = "%v: %v\n"
+
+// DebugDump writes the entries of m to w, one per line.
+func (m *Map) DebugDump(w io.Writer) error {
+	var err error
+	m.Range(func(key KeyT, value ValueT) bool {
+		_, err = fmt.Fprintf(w, dumpFormat, key, value)
+		return err == nil
+	})
+	return err
+}
@@ -0,0 +1,15 @@
+package syncmap
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestDebugDump(t *testing.T) {
+	var m Map
+	m.Store(newKeyT(1), newValueT(1))
+	var buf bytes.Buffer
+	if err := m.DebugDump(&buf); err != nil || buf.Len() == 0 {
+		t.Errorf("DebugDump wrote %q, %v", buf.String(), err)
+	}
+}
@@ -0,0 +1,157 @@
+//go:build syncmap_backend && syncmap_loader
+
+package syncmap
+
+import "context"
+
+// This file holds the backend of maps generated with -backend, which cache
+// the keys of a backing store, such as a key-value store, reading through
+// the loader and writing through to it.
+
+// Backend is a store the map caches, set by WithBackend.
+type Backend interface {
+	// Get returns the value of key, or an error wrapping ErrNotFound if the
+	// store doesn't hold it.
+	Get(ctx context.Context, key KeyT) (ValueT, error)
+
+	// Put stores value for key.
+	Put(ctx context.Context, key KeyT, value ValueT) error
+
+	// Delete deletes key, succeeding if the store doesn't hold it.
+	Delete(ctx context.Context, key KeyT) error
+}
+
+// backing is the backend of a map.
+type backing struct {
+	b       Backend
+	onError func(key KeyT, err error)
+
+	// queueLen and batchLen are set by WithWriteBehind, and behind is the
+	// queue New starts for them.
+	queueLen, batchLen int
+	behind             *writeBehind
+}
+
+// copy returns the backend of a clone of the map, which writes through to
+// the same store, by the same queue.
+func (b *backing) copy() backing {
+	return *b
+}
+
+// WithBackend makes the map a cache of b: its loader, replacing the one set
+// by WithLoader, if any, is b.Get, and the writes of keys are written through
+// to b, synchronously, by the goroutine writing them. Writes to the map
+// return no error, so they write to b once they stored into the map, and pass
+// the errors of b to the function set by WithOnWriteError, if any; StoreE and
+// DeleteE write to b first instead, and return its errors. WithWriteBehind
+// has the writes queued for a goroutine to apply instead.
+//
+// Every write the OnStore and OnDelete hooks of WithHooks see is written
+// through, except that Delete and DeleteMany delete their keys from b even
+// if the map doesn't hold them. LoadBulk, meant to warm the map up, such as
+// with the contents of b, and the values the loader loads and refreshes
+// aren't written to b, nor are the entries the map evicts, expires, or
+// clears.
+func WithBackend(b Backend) Option {
+	return func(m *Map) {
+		m.backend.b = b
+		m.loader.load = m.backend.get
+	}
+}
+
+// WithOnWriteError makes the map call f with the errors of the backend set
+// by WithBackend writing key through, for writes that don't return them.
+func WithOnWriteError(f func(key KeyT, err error)) Option {
+	return func(m *Map) {
+		m.backend.onError = f
+	}
+}
+
+// StoreE stores value for key into the backend set by WithBackend, if any,
+// and then into the map, unless the backend failed, in which case StoreE
+// returns its error and leaves the map unchanged.
+func (m *Map) StoreE(ctx context.Context, key KeyT, value ValueT) error {
+	value = m.copied(value)
+	if err := m.backend.writeAndWait(ctx, Write{Key: key, Value: value}); err != nil {
+		return err
+	}
+	m.swap(key, boxValue(value))
+	m.notifyStore(key, value)
+	return nil
+}
+
+// DeleteE deletes key from the backend set by WithBackend, if any, and then
+// from the map, unless the backend failed, in which case DeleteE returns its
+// error and leaves the map unchanged.
+func (m *Map) DeleteE(ctx context.Context, key KeyT) error {
+	if err := m.backend.writeAndWait(ctx, Write{Key: key, Deleted: true}); err != nil {
+		return err
+	}
+	if m.delete(key) {
+		m.notifyDelete(key)
+	}
+	return nil
+}
+
+// enabled reports whether the map has a backend.
+func (b *backing) enabled() bool {
+	return b.b != nil
+}
+
+// put writes value for key through to the backend, if any.
+func (b *backing) put(key KeyT, value ValueT) {
+	b.writeAsync(Write{Key: key, Value: value})
+}
+
+// delete deletes key from the backend, if any.
+func (b *backing) delete(key KeyT) {
+	b.writeAsync(Write{Key: key, Deleted: true})
+}
+
+// writeAsync queues w, if the map writes behind, or applies it to the
+// backend, if any, passing its error to failed.
+func (b *backing) writeAsync(w Write) {
+	if b.b == nil {
+		return
+	}
+	if wb := b.behind; wb != nil && wb.send(queuedWrite{w: w}) {
+		return
+	}
+	b.failed(w.Key, b.write(context.Background(), w))
+}
+
+// writeAndWait applies w to the backend, if any, through the queue if the
+// map writes behind, and returns its error, or that of ctx if it ends first.
+func (b *backing) writeAndWait(ctx context.Context, w Write) error {
+	if b.b == nil {
+		return nil
+	}
+	if wb := b.behind; wb != nil {
+		result := make(chan error, 1)
+		if wb.send(queuedWrite{w: w, result: result}) {
+			select {
+			case err := <-result:
+				return err
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		}
+	}
+	return b.write(ctx, w)
+}
+
+// write applies w to the backend.
+func (b *backing) write(ctx context.Context, w Write) error {
+	if w.Deleted {
+		return b.b.Delete(ctx, w.Key)
+	}
+	return b.b.Put(ctx, w.Key, w.Value)
+}
+
+// failed passes err, if any, of writing key to the backend to the function
+// set by WithOnWriteError, if any.
+func (b *backing) failed(key KeyT, err error) {
+	if err != nil && b.onError != nil {
+		b.onError(key, err)
+	}
+}
@@ -0,0 +1,24 @@
+//go:build !syncmap_backend || !syncmap_loader
+
+package syncmap
+
+// backing is the backend of maps generated with -backend.
+type backing struct{}
+
+// copy returns the backend of a clone of the map.
+func (b *backing) copy() backing {
+	return backing{}
+}
+
+// enabled reports whether the map has a backend, which only maps generated
+// with -backend may have.
+func (b *backing) enabled() bool {
+	return false
+}
+
+// The methods writing to the backend, and running its queue, do nothing.
+
+func (b *backing) put(key KeyT, value ValueT) {}
+func (b *backing) delete(key KeyT)            {}
+func (b *backing) start()                     {}
+func (b *backing) close()                     {}
@@ -0,0 +1,165 @@
+//go:build syncmap_backend && syncmap_loader
+
+package syncmap
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+)
+
+// memBackend is a Backend holding its keys in memory, failing the writes
+// with err if set.
+type memBackend struct {
+	mu   sync.Mutex
+	keys map[KeyT]ValueT
+	puts int
+	err  error
+}
+
+func (b *memBackend) Get(ctx context.Context, key KeyT) (ValueT, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	v, ok := b.keys[key]
+	if !ok {
+		return v, ErrNotFound
+	}
+	return v, nil
+}
+
+func (b *memBackend) Put(ctx context.Context, key KeyT, value ValueT) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.err != nil {
+		return b.err
+	}
+	b.keys[key] = value
+	b.puts++
+	return nil
+}
+
+func (b *memBackend) Delete(ctx context.Context, key KeyT) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.err != nil {
+		return b.err
+	}
+	delete(b.keys, key)
+	return nil
+}
+
+func (b *memBackend) holds(key KeyT) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	_, ok := b.keys[key]
+	return ok
+}
+
+func TestWithBackend(t *testing.T) {
+	b := &memBackend{keys: map[KeyT]ValueT{newKeyT(1): newValueT(1), newKeyT(3): newValueT(3)}}
+	var failed []KeyT
+	m := New(WithBackend(b), WithOnWriteError(func(key KeyT, err error) {
+		failed = append(failed, key)
+	}))
+
+	if _, ok := m.Load(newKeyT(1)); !ok {
+		t.Error("Load didn't read a key of the backend through")
+	}
+	if _, ok := m.Load(newKeyT(0)); ok {
+		t.Error("Load found a key missing from the backend")
+	}
+	m.Store(newKeyT(2), newValueT(2))
+	if !b.holds(newKeyT(2)) || b.puts != 1 {
+		t.Errorf("Store made %d puts, storing %v: %v; want only it stored", b.puts, newKeyT(2), b.holds(newKeyT(2)))
+	}
+	m.Delete(newKeyT(3))
+	m.DeleteMany([]KeyT{newKeyT(1), newKeyT(2)})
+	for i := 1; i <= 3; i++ {
+		if b.holds(newKeyT(i)) || m.Contains(newKeyT(i)) {
+			t.Errorf("the deletion of %v didn't reach both the map and the backend", newKeyT(i))
+		}
+	}
+
+	ctx := context.Background()
+	if err := m.StoreE(ctx, newKeyT(4), newValueT(4)); err != nil || !b.holds(newKeyT(4)) || !m.Contains(newKeyT(4)) {
+		t.Errorf("StoreE returned %v, or didn't store into both the map and the backend", err)
+	}
+	b.err = errors.New("unavailable")
+	if err := m.StoreE(ctx, newKeyT(5), newValueT(5)); err != b.err || m.Contains(newKeyT(5)) {
+		t.Errorf("StoreE returned %v for a failing backend, or stored into the map; want %v", err, b.err)
+	}
+	if err := m.DeleteE(ctx, newKeyT(4)); err != b.err || !m.Contains(newKeyT(4)) {
+		t.Errorf("DeleteE returned %v for a failing backend, or deleted from the map; want %v", err, b.err)
+	}
+	m.Store(newKeyT(6), newValueT(6))
+	if len(failed) != 1 || failed[0] != newKeyT(6) {
+		t.Errorf("WithOnWriteError called with %v; want [%v]", failed, newKeyT(6))
+	}
+	b.err = nil
+	if err := m.DeleteE(ctx, newKeyT(4)); err != nil || b.holds(newKeyT(4)) || m.Contains(newKeyT(4)) {
+		t.Errorf("DeleteE returned %v, or didn't delete from both the map and the backend", err)
+	}
+}
+
+// batchBackend is a memBackend applying batches of writes.
+type batchBackend struct {
+	memBackend
+	batches int
+}
+
+func (b *batchBackend) WriteBatch(ctx context.Context, writes []Write) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.err != nil {
+		return b.err
+	}
+	for _, w := range writes {
+		if w.Deleted {
+			delete(b.keys, w.Key)
+		} else {
+			b.keys[w.Key] = w.Value
+		}
+	}
+	b.batches++
+	return nil
+}
+
+func TestWithWriteBehind(t *testing.T) {
+	b := &batchBackend{memBackend: memBackend{keys: map[KeyT]ValueT{newKeyT(0): newValueT(0)}}}
+	m := New(WithBackend(b), WithWriteBehind(4, 2))
+	for i := 1; i < 10; i++ {
+		m.Store(newKeyT(i), newValueT(i))
+	}
+	m.Delete(newKeyT(0))
+	if _, ok := m.Load(newKeyT(0)); ok {
+		t.Error("Load loaded a key whose deletion was queued")
+	}
+	m.Flush()
+	for i := 1; i < 10; i++ {
+		if !b.holds(newKeyT(i)) {
+			t.Errorf("Flush returned before %v was written", newKeyT(i))
+		}
+	}
+	if b.batches == 0 || b.puts != 0 {
+		t.Errorf("the writes made %d batches and %d puts; want only batches", b.batches, b.puts)
+	}
+
+	ctx := context.Background()
+	b.mu.Lock()
+	b.err = errors.New("unavailable")
+	b.mu.Unlock()
+	if err := m.StoreE(ctx, newKeyT(10), newValueT(10)); err == nil || m.Contains(newKeyT(10)) {
+		t.Errorf("StoreE returned %v for a failing backend, or stored into the map", err)
+	}
+	b.mu.Lock()
+	b.err = nil
+	b.mu.Unlock()
+
+	m.Close()
+	m.Close()
+	m.Store(newKeyT(11), newValueT(11))
+	if !b.holds(newKeyT(11)) {
+		t.Error("Store after Close didn't write through synchronously")
+	}
+}
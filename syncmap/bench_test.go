@@ -1,55 +1,39 @@
-package syncmap_test
+package syncmap
 
 import (
-	"fmt"
-	"reflect"
 	"sync/atomic"
 	"testing"
-
-	"github.com/cristaloleg/go-gen-syncmap/syncmap"
 )
 
-func newKeyT(i int) KeyT {
-	// PLEASE FEEL WITH A MEANINGFUL CODE
-	var defaultKey KeyT
-	return defaultKey + KeyT(i)
-}
-
-func newValueT(i int) ValueT {
-	// PLEASE FEEL WITH A MEANINGFUL CODE
-	var defaultValue ValueT
-	return defaultValue
-}
+// The benchmarks of this file only use the API shared by every
+// implementation, so that they can be generated along with a map of any key
+// and value types, and compared across implementations.
 
 type bench struct {
-	setup func(*testing.B, mapInterface)
-	perG  func(b *testing.B, pb *testing.PB, i int, m mapInterface)
+	setup func(*testing.B, *Map)
+	perG  func(b *testing.B, pb *testing.PB, i int, m *Map)
 }
 
 func benchMap(b *testing.B, bench bench) {
-	for _, m := range [...]mapInterface{&DeepCopyMap{}, &RWMutexMap{}, &syncmap.Map{}} {
-		b.Run(fmt.Sprintf("%T", m), func(b *testing.B) {
-			m = reflect.New(reflect.TypeOf(m).Elem()).Interface().(mapInterface)
-			if bench.setup != nil {
-				bench.setup(b, m)
-			}
+	m := new(Map)
+	if bench.setup != nil {
+		bench.setup(b, m)
+	}
 
-			b.ResetTimer()
+	b.ResetTimer()
 
-			var i int64
-			b.RunParallel(func(pb *testing.PB) {
-				id := int(atomic.AddInt64(&i, 1) - 1)
-				bench.perG(b, pb, id*b.N, m)
-			})
-		})
-	}
+	var i int64
+	b.RunParallel(func(pb *testing.PB) {
+		id := int(atomic.AddInt64(&i, 1) - 1)
+		bench.perG(b, pb, id*b.N, m)
+	})
 }
 
 func BenchmarkLoadMostlyHits(b *testing.B) {
 	const hits, misses = 1023, 1
 
 	benchMap(b, bench{
-		setup: func(_ *testing.B, m mapInterface) {
+		setup: func(_ *testing.B, m *Map) {
 			for i := 0; i < hits; i++ {
 				m.LoadOrStore(newKeyT(i), newValueT(i))
 			}
@@ -59,7 +43,7 @@ func BenchmarkLoadMostlyHits(b *testing.B) {
 			}
 		},
 
-		perG: func(b *testing.B, pb *testing.PB, i int, m mapInterface) {
+		perG: func(b *testing.B, pb *testing.PB, i int, m *Map) {
 			for ; pb.Next(); i++ {
 				m.Load(newKeyT(i % (hits + misses)))
 			}
@@ -71,7 +55,7 @@ func BenchmarkLoadMostlyMisses(b *testing.B) {
 	const hits, misses = 1, 1023
 
 	benchMap(b, bench{
-		setup: func(_ *testing.B, m mapInterface) {
+		setup: func(_ *testing.B, m *Map) {
 			for i := 0; i < hits; i++ {
 				m.LoadOrStore(newKeyT(i), newValueT(i))
 			}
@@ -81,7 +65,7 @@ func BenchmarkLoadMostlyMisses(b *testing.B) {
 			}
 		},
 
-		perG: func(b *testing.B, pb *testing.PB, i int, m mapInterface) {
+		perG: func(b *testing.B, pb *testing.PB, i int, m *Map) {
 			for ; pb.Next(); i++ {
 				m.Load(newKeyT(i % (hits + misses)))
 			}
@@ -93,10 +77,7 @@ func BenchmarkLoadOrStoreBalanced(b *testing.B) {
 	const hits, misses = 128, 128
 
 	benchMap(b, bench{
-		setup: func(b *testing.B, m mapInterface) {
-			if _, ok := m.(*DeepCopyMap); ok {
-				b.Skip("DeepCopyMap has quadratic running time.")
-			}
+		setup: func(b *testing.B, m *Map) {
 			for i := 0; i < hits; i++ {
 				m.LoadOrStore(newKeyT(i), newValueT(i))
 			}
@@ -106,7 +87,7 @@ func BenchmarkLoadOrStoreBalanced(b *testing.B) {
 			}
 		},
 
-		perG: func(b *testing.B, pb *testing.PB, i int, m mapInterface) {
+		perG: func(b *testing.B, pb *testing.PB, i int, m *Map) {
 			for ; pb.Next(); i++ {
 				j := i % (hits + misses)
 				if j < hits {
@@ -125,13 +106,10 @@ func BenchmarkLoadOrStoreBalanced(b *testing.B) {
 
 func BenchmarkLoadOrStoreUnique(b *testing.B) {
 	benchMap(b, bench{
-		setup: func(b *testing.B, m mapInterface) {
-			if _, ok := m.(*DeepCopyMap); ok {
-				b.Skip("DeepCopyMap has quadratic running time.")
-			}
+		setup: func(b *testing.B, m *Map) {
 		},
 
-		perG: func(b *testing.B, pb *testing.PB, i int, m mapInterface) {
+		perG: func(b *testing.B, pb *testing.PB, i int, m *Map) {
 			for ; pb.Next(); i++ {
 				m.LoadOrStore(newKeyT(i), newValueT(i))
 			}
@@ -144,11 +122,11 @@ func BenchmarkLoadOrStoreCollision(b *testing.B) {
 	var defaultValue ValueT
 
 	benchMap(b, bench{
-		setup: func(_ *testing.B, m mapInterface) {
+		setup: func(_ *testing.B, m *Map) {
 			m.LoadOrStore(defaultKey, defaultValue)
 		},
 
-		perG: func(b *testing.B, pb *testing.PB, i int, m mapInterface) {
+		perG: func(b *testing.B, pb *testing.PB, i int, m *Map) {
 			for ; pb.Next(); i++ {
 				m.LoadOrStore(defaultKey, defaultValue)
 			}
@@ -160,13 +138,13 @@ func BenchmarkRange(b *testing.B) {
 	const mapSize = 1 << 10
 
 	benchMap(b, bench{
-		setup: func(_ *testing.B, m mapInterface) {
+		setup: func(_ *testing.B, m *Map) {
 			for i := 0; i < mapSize; i++ {
 				m.Store(newKeyT(i), newValueT(i))
 			}
 		},
 
-		perG: func(b *testing.B, pb *testing.PB, i int, m mapInterface) {
+		perG: func(b *testing.B, pb *testing.PB, i int, m *Map) {
 			for ; pb.Next(); i++ {
 				m.Range(func(_ KeyT, _ ValueT) bool { return true })
 			}
@@ -182,7 +160,7 @@ func BenchmarkRange(b *testing.B) {
 func BenchmarkAdversarialAlloc(b *testing.B) {
 	var defaultValue ValueT
 	benchMap(b, bench{
-		perG: func(b *testing.B, pb *testing.PB, i int, m mapInterface) {
+		perG: func(b *testing.B, pb *testing.PB, i int, m *Map) {
 			var stores, loadsSinceStore int64
 			for ; pb.Next(); i++ {
 				m.Load(newKeyT(i))
@@ -205,13 +183,13 @@ func BenchmarkAdversarialDelete(b *testing.B) {
 	const mapSize = 1 << 10
 
 	benchMap(b, bench{
-		setup: func(_ *testing.B, m mapInterface) {
+		setup: func(_ *testing.B, m *Map) {
 			for i := 0; i < mapSize; i++ {
 				m.Store(newKeyT(i), newValueT(i))
 			}
 		},
 
-		perG: func(b *testing.B, pb *testing.PB, i int, m mapInterface) {
+		perG: func(b *testing.B, pb *testing.PB, i int, m *Map) {
 			for ; pb.Next(); i++ {
 				m.Load(newKeyT(i))
 
@@ -0,0 +1,113 @@
+// Package bimap is the template of a concurrent bidirectional map, generated
+// with go-gen-syncmap -kind=bimap.
+//
+// It indexes pairs of keys and values both ways, under one lock, so that a
+// key and its value are always found from each other, which two maps updated
+// one after the other can't guarantee.
+package bimap
+
+import "sync"
+
+// Bimap is a one-to-one map between keys and values, like a Go
+// map[KeyT]ValueT and its inverse map[ValueT]KeyT guarded by a sync.RWMutex,
+// so it is safe for concurrent use by multiple goroutines. Each key has at
+// most one value, and each value at most one key.
+//
+// The zero Bimap is empty and ready for use. A Bimap must not be copied after
+// first use.
+type Bimap struct {
+	mu      sync.RWMutex
+	byKey   map[KeyT]ValueT
+	byValue map[ValueT]KeyT
+}
+
+// New returns an empty Bimap.
+func New() *Bimap {
+	return new(Bimap)
+}
+
+// LoadByKey returns the value paired with key, or the zero value if there is
+// none. The ok result indicates whether a value was found.
+func (m *Bimap) LoadByKey(key KeyT) (value ValueT, ok bool) {
+	m.mu.RLock()
+	value, ok = m.byKey[key]
+	m.mu.RUnlock()
+	return value, ok
+}
+
+// LoadByValue returns the key paired with value, or the zero value if there
+// is none. The ok result indicates whether a key was found.
+func (m *Bimap) LoadByValue(value ValueT) (key KeyT, ok bool) {
+	m.mu.RLock()
+	key, ok = m.byValue[value]
+	m.mu.RUnlock()
+	return key, ok
+}
+
+// StorePair pairs key with value, replacing the pairs either of them was in,
+// if any, so that key and value are paired with each other only.
+func (m *Bimap) StorePair(key KeyT, value ValueT) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.deleteLocked(key, value)
+	if m.byKey == nil {
+		m.byKey = make(map[KeyT]ValueT)
+		m.byValue = make(map[ValueT]KeyT)
+	}
+	m.byKey[key] = value
+	m.byValue[value] = key
+}
+
+// DeleteByEither deletes the pair holding key and the pair holding value,
+// and returns the number of pairs deleted: 0, 1 if there is only one, or if
+// key and value are paired with each other, or 2.
+func (m *Bimap) DeleteByEither(key KeyT, value ValueT) (deleted int) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.deleteLocked(key, value)
+}
+
+func (m *Bimap) deleteLocked(key KeyT, value ValueT) (deleted int) {
+	if v, ok := m.byKey[key]; ok {
+		delete(m.byKey, key)
+		delete(m.byValue, v)
+		deleted++
+	}
+	if k, ok := m.byValue[value]; ok {
+		delete(m.byValue, value)
+		delete(m.byKey, k)
+		deleted++
+	}
+	return deleted
+}
+
+// Len returns the number of pairs in the map.
+func (m *Bimap) Len() int {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return len(m.byKey)
+}
+
+// Range calls f sequentially for each pair in the map. If f returns false,
+// Range stops the iteration.
+//
+// Range visits the pairs present when it was called, copied under the read
+// lock, which isn't held while f runs, so f may call any method of m.
+func (m *Bimap) Range(f func(key KeyT, value ValueT) bool) {
+	type pair struct {
+		key   KeyT
+		value ValueT
+	}
+	m.mu.RLock()
+	pairs := make([]pair, 0, len(m.byKey))
+	for k, v := range m.byKey {
+		pairs = append(pairs, pair{k, v})
+	}
+	m.mu.RUnlock()
+
+	for _, p := range pairs {
+		if !f(p.key, p.value) {
+			break
+		}
+	}
+}
@@ -0,0 +1,135 @@
+package bimap
+
+import (
+	"sync"
+	"testing"
+)
+
+// testValues returns the first n values of the tests. The factories may
+// return distinct values for the same i, such as new pointers, so the tests
+// compare those they built once.
+func testValues(n int) []ValueT {
+	values := make([]ValueT, n)
+	for i := range values {
+		values[i] = newValueT(i)
+	}
+	return values
+}
+
+func TestStorePair(t *testing.T) {
+	var m Bimap
+	k0, k1 := newKeyT(0), newKeyT(1)
+	vs := testValues(2)
+	v0, v1 := vs[0], vs[1]
+	if _, ok := m.LoadByKey(k0); ok {
+		t.Error("LoadByKey of the zero Bimap found a value")
+	}
+	m.StorePair(k0, v0)
+	if v, ok := m.LoadByKey(k0); !ok || v != v0 {
+		t.Errorf("LoadByKey(k0) = %v, %v; want v0, true", v, ok)
+	}
+	if k, ok := m.LoadByValue(v0); !ok || k != k0 {
+		t.Errorf("LoadByValue(v0) = %v, %v; want k0, true", k, ok)
+	}
+
+	// Pairing k1 with v0 unpairs k0, and pairing k1 with v1 unpairs v0.
+	m.StorePair(k1, v0)
+	if _, ok := m.LoadByKey(k0); ok || m.Len() != 1 {
+		t.Errorf("k0 is still paired after pairing its value with k1, or Len()=%d; want 1", m.Len())
+	}
+	m.StorePair(k1, v1)
+	if _, ok := m.LoadByValue(v0); ok || m.Len() != 1 {
+		t.Errorf("v0 is still paired after pairing its key with v1, or Len()=%d; want 1", m.Len())
+	}
+	if k, ok := m.LoadByValue(v1); !ok || k != k1 {
+		t.Errorf("LoadByValue(v1) = %v, %v; want k1, true", k, ok)
+	}
+}
+
+func TestDeleteByEither(t *testing.T) {
+	m := New()
+	vs := testValues(4)
+	for i := 0; i < 4; i++ {
+		m.StorePair(newKeyT(i), vs[i])
+	}
+	for _, tt := range []struct {
+		key, value int
+		want       int
+	}{
+		{0, 0, 1},
+		{1, 2, 2},
+		{1, 2, 0},
+		{3, 0, 1},
+	} {
+		if got := m.DeleteByEither(newKeyT(tt.key), vs[tt.value]); got != tt.want {
+			t.Errorf("DeleteByEither(key %d, value %d) = %d; want %d", tt.key, tt.value, got, tt.want)
+		}
+	}
+	if m.Len() != 0 {
+		t.Errorf("Len() = %d after deleting every pair", m.Len())
+	}
+}
+
+func TestRange(t *testing.T) {
+	m := New()
+	vs := testValues(5)
+	for i := 0; i < 5; i++ {
+		m.StorePair(newKeyT(i), vs[i])
+	}
+	n := 0
+	m.Range(func(k KeyT, v ValueT) bool {
+		if got, ok := m.LoadByValue(v); !ok || got != k {
+			t.Errorf("Range passed a pair that LoadByValue doesn't agree with")
+		}
+		m.DeleteByEither(k, v)
+		n++
+		return true
+	})
+	if n != 5 || m.Len() != 0 {
+		t.Errorf("Range visited %d pairs, deleting them left %d; want 5, 0", n, m.Len())
+	}
+}
+
+func TestConcurrent(t *testing.T) {
+	const goroutines, pairs = 8, 20
+	var m Bimap
+	vs := testValues(pairs)
+	var wg sync.WaitGroup
+	for g := 0; g < goroutines; g++ {
+		wg.Add(1)
+		go func(g int) {
+			defer wg.Done()
+			for n := 0; n < 100; n++ {
+				// Pair keys with values at shifting offsets, so that pairs
+				// keep replacing each other.
+				i := (n + g) % pairs
+				m.StorePair(newKeyT(i), vs[(i+n)%pairs])
+				if n%7 == 0 {
+					m.DeleteByEither(newKeyT(i), vs[g])
+				}
+				m.Range(func(KeyT, ValueT) bool { return true })
+			}
+		}(g)
+	}
+	wg.Wait()
+
+	// Both directions agree.
+	n := 0
+	m.Range(func(k KeyT, v ValueT) bool {
+		if got, ok := m.LoadByValue(v); !ok || got != k {
+			t.Errorf("LoadByValue(%v) = %v, %v; want %v, true", v, got, ok, k)
+		}
+		n++
+		return true
+	})
+	for i := 0; i < pairs; i++ {
+		if k, ok := m.LoadByValue(vs[i]); ok {
+			if v, _ := m.LoadByKey(k); v != vs[i] {
+				t.Errorf("the key of value %d is paired with another value", i)
+			}
+		}
+	}
+	if n != m.Len() {
+		t.Errorf("Range visited %d pairs; Len() = %d", n, m.Len())
+	}
+}
@@ -0,0 +1,7 @@
+package bimap
+
+// KeyT is a type for bimap's keys.
+type KeyT int64
+
+// ValueT is a type for bimap's values, which it indexes as keys too.
+type ValueT string
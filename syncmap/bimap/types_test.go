@@ -0,0 +1,14 @@
+package bimap
+
+import "strconv"
+
+// newKeyT and newValueT return the i-th key and value used by the tests
+// generated along with a bimap, which replace them with factories for its
+// types. Keys and values must be distinct for distinct i.
+func newKeyT(i int) KeyT {
+	return KeyT(i)
+}
+
+func newValueT(i int) ValueT {
+	return ValueT(strconv.Itoa(i))
+}
@@ -0,0 +1,113 @@
+package syncmap
+
+import (
+	"bytes"
+	"encoding"
+	"encoding/binary"
+	"io"
+)
+
+// MarshalBinary implements encoding.BinaryMarshaler.
+//
+// The encoding is the number of entries as a uvarint followed by each key and
+// value. Keys and values whose pointers implement encoding.BinaryMarshaler
+// and encoding.BinaryUnmarshaler are written as the length of their own
+// encoding as a uvarint followed by it, and others in little-endian byte
+// order, so KeyT and ValueT must otherwise be fixed-size types as accepted by
+// encoding/binary.
+func (m *Map) MarshalBinary() ([]byte, error) {
+	snapshot := m.Snapshot()
+
+	var key KeyT
+	var value ValueT
+	var buf bytes.Buffer
+	var n [binary.MaxVarintLen64]byte
+	buf.Write(n[:binary.PutUvarint(n[:], uint64(len(snapshot)))])
+	if keySize, valueSize := binary.Size(key), binary.Size(value); keySize >= 0 && valueSize >= 0 {
+		buf.Grow(len(snapshot) * (keySize + valueSize))
+	}
+	for k, v := range snapshot {
+		if err := writeBinary(&buf, &k); err != nil {
+			return nil, err
+		}
+		if err := writeBinary(&buf, &v); err != nil {
+			return nil, err
+		}
+	}
+	return buf.Bytes(), nil
+}
+
+// UnmarshalBinary implements encoding.BinaryUnmarshaler. It replaces the
+// contents of the map with the entries decoded from data.
+func (m *Map) UnmarshalBinary(data []byte) error {
+	r := bytes.NewReader(data)
+	n, err := binary.ReadUvarint(r)
+	if err != nil {
+		return err
+	}
+	if n > uint64(r.Len()) {
+		// Every entry takes at least one byte: don't let a corrupt count make
+		// us preallocate a huge map.
+		n = uint64(r.Len())
+	}
+
+	src := make(map[KeyT]ValueT, n)
+	for i := n; i > 0; i-- {
+		var k KeyT
+		var v ValueT
+		if err := readBinary(r, &k); err != nil {
+			return err
+		}
+		if err := readBinary(r, &v); err != nil {
+			return err
+		}
+		src[k] = v
+	}
+	if r.Len() != 0 {
+		return errTrailingData
+	}
+	m.reset(src)
+	return nil
+}
+
+// binaryCodec is implemented by pointers to the keys and values that
+// MarshalBinary writes in their own encoding.
+type binaryCodec interface {
+	encoding.BinaryMarshaler
+	encoding.BinaryUnmarshaler
+}
+
+// writeBinary appends *p to buf in the encoding of MarshalBinary, where p is
+// a pointer to a key or value.
+func writeBinary(buf *bytes.Buffer, p interface{}) error {
+	c, ok := p.(binaryCodec)
+	if !ok {
+		return binary.Write(buf, binary.LittleEndian, p)
+	}
+	data, err := c.MarshalBinary()
+	if err != nil {
+		return err
+	}
+	var n [binary.MaxVarintLen64]byte
+	buf.Write(n[:binary.PutUvarint(n[:], uint64(len(data)))])
+	buf.Write(data)
+	return nil
+}
+
+// readBinary decodes the key or value writeBinary wrote from r into *p.
+func readBinary(r *bytes.Reader, p interface{}) error {
+	c, ok := p.(binaryCodec)
+	if !ok {
+		return binary.Read(r, binary.LittleEndian, p)
+	}
+	n, err := binary.ReadUvarint(r)
+	if err != nil {
+		return err
+	}
+	if n > uint64(r.Len()) {
+		return io.ErrUnexpectedEOF
+	}
+	data := make([]byte, n)
+	r.Read(data)
+	return c.UnmarshalBinary(data)
+}
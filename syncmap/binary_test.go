@@ -0,0 +1,40 @@
+package syncmap
+
+import (
+	"bytes"
+	"testing"
+	"time"
+)
+
+func TestBinaryMarshaler(t *testing.T) {
+	want := []time.Time{
+		time.Date(2009, time.November, 10, 23, 0, 0, 0, time.UTC),
+		time.Date(2022, time.March, 15, 12, 30, 0, 5, time.FixedZone("", 3600)),
+	}
+	var buf bytes.Buffer
+	for i := range want {
+		if err := writeBinary(&buf, &want[i]); err != nil {
+			t.Fatal(err)
+		}
+	}
+	data := buf.Bytes()
+
+	r := bytes.NewReader(data)
+	for _, w := range want {
+		var got time.Time
+		if err := readBinary(r, &got); err != nil {
+			t.Fatal(err)
+		}
+		if !got.Equal(w) {
+			t.Errorf("readBinary = %v; want %v", got, w)
+		}
+	}
+	if r.Len() != 0 {
+		t.Errorf("readBinary left %d bytes", r.Len())
+	}
+
+	var got time.Time
+	if err := readBinary(bytes.NewReader(data[:len(data)/4]), &got); err == nil {
+		t.Errorf("readBinary of truncated data succeeded")
+	}
+}
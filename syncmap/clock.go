@@ -0,0 +1,13 @@
+//go:build syncmap_ttl || syncmap_loader
+
+package syncmap
+
+import "time"
+
+// start is the origin of the times returned by now.
+var start = time.Now()
+
+// now returns the monotonic time elapsed since start.
+func now() int64 {
+	return int64(time.Since(start))
+}
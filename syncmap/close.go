@@ -0,0 +1,13 @@
+//go:build syncmap_ttl || (syncmap_backend && syncmap_loader)
+
+package syncmap
+
+// Close stops the goroutines of the map: the one started by WithJanitor, if
+// any, after which expired values are only deleted lazily, and the one
+// started by WithWriteBehind, if any, once it applied the writes queued,
+// after which writes reach the backend synchronously. The map remains usable,
+// and Close may be called more than once.
+func (m *Map) Close() {
+	m.stopJanitor()
+	m.backend.close()
+}
@@ -0,0 +1,161 @@
+// Copyright 2016 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package syncmap
+
+import "sync/atomic"
+
+// This file holds the methods comparing values with ==, which are only
+// generated if ValueT is comparable.
+
+// CompareAndSwap swaps the old and new values for key
+// if the value stored in the map is equal to old.
+// The ValueT type must be comparable.
+func (m *Map) CompareAndSwap(key KeyT, old, new ValueT) (swapped bool) {
+	new = m.copied(new)
+	read := m.loadReadOnly()
+	read.checkWritable()
+	if e, ok := read.m[key]; ok {
+		swapped = e.tryCompareAndSwap(old, new)
+		if swapped {
+			m.charge(e)
+			m.evictIfFull()
+			m.onStore(key, new)
+		}
+		return swapped
+	} else if !read.amended {
+		return false // No existing value for key.
+	}
+
+	m.mu.Lock()
+	read = m.loadReadOnly()
+	if e, ok := read.m[key]; ok {
+		if swapped = e.tryCompareAndSwap(old, new); swapped {
+			m.charge(e)
+		}
+	} else if e, ok := m.dirty[key]; ok {
+		if swapped = e.tryCompareAndSwap(old, new); swapped {
+			m.charge(e)
+		}
+		// We needed to lock mu in order to load the entry for key,
+		// and the operation didn't change the set of keys in the map
+		// (so it would be made more efficient by promoting the dirty
+		// map to read-only).
+		// Count it as a miss so that we will eventually switch to the
+		// more efficient steady state.
+		m.missLocked()
+	}
+	m.mu.Unlock()
+	if swapped {
+		m.evictIfFull()
+		m.onStore(key, new)
+	}
+	return swapped
+}
+
+// tryCompareAndSwap compare the entry with the given old value and swaps
+// it with a new value if the entry is equal to the old value.
+//
+// If the entry is expunged, tryCompareAndSwap returns false and leaves
+// the entry unchanged.
+func (e *entry) tryCompareAndSwap(old, new ValueT) bool {
+	p := atomic.LoadPointer(&e.p)
+	if p == nil || p == expunged || expired(p) || unboxValue(p) != old {
+		return false
+	}
+
+	// Box the value after the first load to make this method more amenable
+	// to escape analysis: if the comparison fails from the start, we shouldn't
+	// bother heap-allocating.
+	nc := boxValue(new)
+	for {
+		if atomic.CompareAndSwapPointer(&e.p, p, nc) {
+			return true
+		}
+		p = atomic.LoadPointer(&e.p)
+		if p == nil || p == expunged || expired(p) || unboxValue(p) != old {
+			return false
+		}
+	}
+}
+
+// CompareAndDelete deletes the entry for key if its value is equal to old.
+// The ValueT type must be comparable.
+//
+// If there is no current value for key in the map, CompareAndDelete
+// returns false (even if the old value is the zero ValueT).
+func (m *Map) CompareAndDelete(key KeyT, old ValueT) (deleted bool) {
+	read := m.loadReadOnly()
+	read.checkWritable()
+	e, ok := read.m[key]
+	if !ok && read.amended {
+		m.mu.Lock()
+		read = m.loadReadOnly()
+		e, ok = read.m[key]
+		if !ok && read.amended {
+			e, ok = m.dirty[key]
+			// Don't delete key from m.dirty: we still need to do the "compare" part
+			// of the operation. The entry will eventually be expunged when the
+			// dirty map is promoted to the read map.
+			//
+			// Regardless of whether the entry was present, record a miss: this key
+			// will take the slow path until the dirty map is promoted to the read
+			// map.
+			m.missLocked()
+		}
+		m.mu.Unlock()
+	}
+	for ok {
+		p := atomic.LoadPointer(&e.p)
+		if p == nil || p == expunged || expired(p) || unboxValue(p) != old {
+			return false
+		}
+		if atomic.CompareAndSwapPointer(&e.p, p, nil) {
+			atomic.AddInt64(m.counter(read), -1)
+			m.charge(e)
+			m.compactIfSparse()
+			m.onDelete(key)
+			return true
+		}
+	}
+	return false
+}
+
+// Equal reports whether m and other hold the same keys with equal values.
+// The ValueT type must be comparable; use EqualFunc otherwise.
+//
+// Equal compares a Snapshot of each map, so it has the same consistency
+// guarantees as Keys.
+func (m *Map) Equal(other *Map) bool {
+	return m.EqualFunc(other, func(a, b ValueT) bool {
+		return a == b
+	})
+}
+
+// CompareAndSwap swaps the old and new values for the handle's key if the
+// value stored in the map is equal to old.
+func (h *Entry) CompareAndSwap(old, new ValueT) (swapped bool) {
+	h.m.loadReadOnly().checkWritable()
+	if e, _, current := h.current(); current {
+		for {
+			p := atomic.LoadPointer(&e.p)
+			if p == expunged {
+				break
+			}
+			if p == nil || expired(p) || unboxValue(p) != old {
+				return false
+			}
+			v := h.m.copied(new)
+			if atomic.CompareAndSwapPointer(&e.p, p, boxValue(v)) {
+				h.m.charge(e)
+				h.m.evictIfFull()
+				h.m.onStore(h.key, v)
+				return true
+			}
+		}
+	}
+	swapped = h.m.CompareAndSwap(h.key, old, new)
+	h.resolve()
+	return swapped
+}
@@ -0,0 +1,52 @@
+package syncmap
+
+import (
+	"math/rand"
+	"testing"
+)
+
+// TestCompareOps applies random stores and comparing operations to a Map and
+// to a plain map, and checks that they agree.
+func TestCompareOps(t *testing.T) {
+	var m Map
+	want := make(map[KeyT]ValueT)
+	r := rand.New(rand.NewSource(1))
+	for i := 0; i < 10000; i++ {
+		k, v := newKeyT(r.Intn(64)), newValueT(r.Intn(4))
+		prev, loaded := want[k]
+		switch op := r.Intn(3); op {
+		case 0:
+			m.Store(k, v)
+			want[k] = v
+		case 1:
+			// Compare with the stored value or another one.
+			old := newValueT(r.Intn(4))
+			if loaded && r.Intn(2) == 0 {
+				old = prev
+			}
+			swapped := loaded && prev == old
+			if got := m.CompareAndSwap(k, old, v); got != swapped {
+				t.Fatalf("CompareAndSwap(%v, %v, %v) = %v; want %v", k, old, v, got, swapped)
+			}
+			if swapped {
+				want[k] = v
+			}
+		case 2:
+			old := v
+			if loaded && r.Intn(2) == 0 {
+				old = prev
+			}
+			deleted := loaded && prev == old
+			if got := m.CompareAndDelete(k, old); got != deleted {
+				t.Fatalf("CompareAndDelete(%v, %v) = %v; want %v", k, old, got, deleted)
+			}
+			if deleted {
+				delete(want, k)
+			}
+		}
+		w, wok := want[k]
+		if got, ok := m.Load(k); got != w || ok != wok {
+			t.Fatalf("Load(%v) = %v, %v; want %v, %v", k, got, ok, w, wok)
+		}
+	}
+}
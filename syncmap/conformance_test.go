@@ -0,0 +1,101 @@
+package syncmap
+
+import (
+	"math/rand"
+	"reflect"
+	"sync"
+	"testing"
+)
+
+// The tests of this file only use the API shared by every implementation,
+// and compare values with reflect.DeepEqual, so that they can be generated
+// along with a map of any key and value types.
+
+// TestOps applies random operations to a Map and to a plain map, and checks
+// that they agree.
+func TestOps(t *testing.T) {
+	var m Map
+	want := make(map[KeyT]ValueT)
+	r := rand.New(rand.NewSource(1))
+	for i := 0; i < 10000; i++ {
+		k, v := newKeyT(r.Intn(64)), newValueT(r.Intn(4))
+		prev, loaded := want[k]
+		switch op := r.Intn(6); op {
+		case 0:
+			m.Store(k, v)
+			want[k] = v
+		case 1:
+			if got, ok := m.Load(k); !reflect.DeepEqual(got, prev) || ok != loaded {
+				t.Fatalf("Load(%v) = %v, %v; want %v, %v", k, got, ok, prev, loaded)
+			}
+		case 2:
+			got, ok := m.LoadOrStore(k, v)
+			if !loaded {
+				prev = v
+				want[k] = v
+			}
+			if !reflect.DeepEqual(got, prev) || ok != loaded {
+				t.Fatalf("LoadOrStore(%v, %v) = %v, %v; want %v, %v", k, v, got, ok, prev, loaded)
+			}
+		case 3:
+			if got, ok := m.Swap(k, v); !reflect.DeepEqual(got, prev) || ok != loaded {
+				t.Fatalf("Swap(%v, %v) = %v, %v; want %v, %v", k, v, got, ok, prev, loaded)
+			}
+			want[k] = v
+		case 4:
+			m.Delete(k)
+			delete(want, k)
+		case 5:
+			if r.Intn(100) == 0 {
+				m.Clear()
+				want = make(map[KeyT]ValueT)
+			}
+		}
+	}
+
+	if got := m.Len(); got != len(want) {
+		t.Errorf("Len() = %d; want %d", got, len(want))
+	}
+	got := make(map[KeyT]ValueT)
+	m.Range(func(k KeyT, v ValueT) bool {
+		if _, dup := got[k]; dup {
+			t.Errorf("Range visited %v twice", k)
+		}
+		got[k] = v
+		return true
+	})
+	if len(got) != len(want) {
+		t.Errorf("Range visited %d keys; want %d", len(got), len(want))
+	}
+	for k, v := range want {
+		if !reflect.DeepEqual(got[k], v) {
+			t.Errorf("Range visited %v: %v; want %v", k, got[k], v)
+		}
+	}
+}
+
+func TestConcurrent(t *testing.T) {
+	const n = 100
+	var (
+		m  Map
+		wg sync.WaitGroup
+	)
+	for g := 0; g < 8; g++ {
+		wg.Add(1)
+		go func(g int) {
+			defer wg.Done()
+			for i := 0; i < n; i++ {
+				k := newKeyT(i)
+				m.LoadOrStore(k, newValueT(g))
+				m.Range(func(KeyT, ValueT) bool { return true })
+				if _, ok := m.Load(k); !ok {
+					t.Errorf("Load(%v) after LoadOrStore found nothing", k)
+				}
+			}
+		}(g)
+	}
+	wg.Wait()
+	if got := m.Len(); got != n {
+		t.Errorf("Len() = %d; want %d", got, n)
+	}
+}
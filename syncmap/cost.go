@@ -0,0 +1,93 @@
+//go:build syncmap_lru && syncmap_cost
+
+package syncmap
+
+import "sync/atomic"
+
+// This file holds the cost accounting of maps generated with -maxcost, which
+// evict entries until the total cost of their values, given by the function
+// of -cost, is within a budget, so that maps of values of varying sizes,
+// such as byte buffers, are bounded by the memory they take rather than by
+// their number of entries.
+//
+// Each entry records the cost it was charged, and every write or deletion
+// of its value charges it again: it swaps in the cost of the current value
+// and adds the difference to the total. A write racing with another may
+// charge the cost of the other's value, but the last charge of an entry
+// always follows its last write, so the total converges to the cost of the
+// values in the map.
+
+// maxCost is the budget of the maps not given WithMaxCost. It's a variable
+// so that the tests, which store more than the maps they're generated for
+// may hold, can lift it.
+var maxCost int64 = maxCostT
+
+// costs is the total cost of the values of a map.
+type costs struct {
+	cost int64 // accessed atomically
+	max  int64 // set by WithMaxCost, or 0 for maxCost
+}
+
+// copy returns the configuration of b, for a clone of its map.
+func (b *costs) copy() costs {
+	return costs{max: b.max}
+}
+
+// charged is the cost an entry was charged.
+type charged struct {
+	cost int64 // accessed atomically
+}
+
+// WithMaxCost makes the map evict entries until its values cost at most n in
+// total, rather than the budget it was generated with. An n that isn't
+// positive lifts the budget.
+func WithMaxCost(n int64) Option {
+	return func(m *Map) {
+		if n <= 0 {
+			n = -1
+		}
+		m.lru.budget.max = n
+	}
+}
+
+// Cost returns the total cost of the values in the map. It may lag behind
+// concurrent writers.
+func (m *Map) Cost() int64 {
+	return atomic.LoadInt64(&m.lru.budget.cost)
+}
+
+// charge updates the total cost of the map after the value of e changed.
+func (m *Map) charge(e *entry) {
+	var c int64
+	if p := atomic.LoadPointer(&e.p); p != nil && p != expunged {
+		c = costValueT(unboxValue(p))
+	}
+	if old := atomic.SwapInt64(&e.recency.charged.cost, c); old != c {
+		atomic.AddInt64(&m.lru.budget.cost, c-old)
+	}
+}
+
+// recharge resets the total cost of the map to that of entries, the entries
+// of a new read map replacing every entry. Writers still holding replaced
+// entries may skew the total by the cost of their values.
+func (m *Map) recharge(entries map[KeyT]*entry) {
+	var total int64
+	for _, e := range entries {
+		var c int64
+		if p := atomic.LoadPointer(&e.p); p != nil && p != expunged {
+			c = costValueT(unboxValue(p))
+		}
+		atomic.StoreInt64(&e.recency.charged.cost, c)
+		total += c
+	}
+	atomic.StoreInt64(&m.lru.budget.cost, total)
+}
+
+// overBudget reports whether the values of the map cost more than its budget.
+func (m *Map) overBudget() bool {
+	limit := m.lru.budget.max
+	if limit == 0 {
+		limit = maxCost
+	}
+	return limit > 0 && atomic.LoadInt64(&m.lru.budget.cost) > limit
+}
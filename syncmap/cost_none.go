@@ -0,0 +1,28 @@
+//go:build !syncmap_lru || !syncmap_cost
+
+package syncmap
+
+// costs is the total cost of the values of maps generated with -maxcost.
+type costs struct{}
+
+// copy returns the configuration of b, for a clone of its map.
+func (b *costs) copy() costs {
+	return costs{}
+}
+
+// charged is the cost an entry of a map generated with -maxcost was charged.
+type charged struct{}
+
+// charge updates the total cost of maps generated with -maxcost after the
+// value of e changed.
+func (m *Map) charge(e *entry) {}
+
+// recharge resets the total cost of maps generated with -maxcost to that of
+// entries.
+func (m *Map) recharge(entries map[KeyT]*entry) {}
+
+// overBudget reports whether the values of maps generated with -maxcost cost
+// more than their budget.
+func (m *Map) overBudget() bool {
+	return false
+}
@@ -0,0 +1,57 @@
+//go:build syncmap_lru && syncmap_cost
+
+package syncmap
+
+import "testing"
+
+func init() {
+	// The other tests store more than the maps they're generated for may
+	// hold, so the maps of the tests have no budget unless given WithMaxCost.
+	maxCost = 0
+}
+
+// totalCost returns the cost of the values in m.
+func totalCost(m *Map) int64 {
+	var total int64
+	m.Range(func(_ KeyT, v ValueT) bool {
+		total += costValueT(v)
+		return true
+	})
+	return total
+}
+
+func TestWithMaxCost(t *testing.T) {
+	var budget int64
+	for i := 0; i < 10; i++ {
+		budget += costValueT(newValueT(i))
+	}
+	m := New(WithMaxCost(budget))
+	for i := 0; i < 100; i++ {
+		m.Store(newKeyT(i), newValueT(i))
+		if c := m.Cost(); c > budget {
+			t.Fatalf("Cost() = %d after Store(%d); want at most %d", c, i, budget)
+		}
+	}
+	for i := 0; i < 100; i++ {
+		m.LoadOrStore(newKeyT(i), newValueT(i))
+		m.Swap(newKeyT(i/2), newValueT(i))
+		m.Replace(newKeyT(i/3), newValueT(i))
+		m.Delete(newKeyT(i / 5))
+		if c, want := m.Cost(), totalCost(m); c != want || c > budget {
+			t.Fatalf("Cost() = %d after %d writes; want %d, at most %d", c, i, want, budget)
+		}
+	}
+
+	c := m.Clone()
+	if got, want := c.Cost(), totalCost(c); got != want {
+		t.Errorf("Cost() of a clone = %d; want %d", got, want)
+	}
+	m.DeleteFunc(func(KeyT, ValueT) bool { return true })
+	if got := m.Cost(); got != 0 {
+		t.Errorf("Cost() after deleting every key = %d; want 0", got)
+	}
+	c.Clear()
+	if got := c.Cost(); got != 0 {
+		t.Errorf("Cost() after Clear = %d; want 0", got)
+	}
+}
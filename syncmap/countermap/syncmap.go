@@ -0,0 +1,184 @@
+// Package countermap is the template of a concurrent map of counters,
+// generated with go-gen-syncmap -kind=countermap.
+//
+// It has the algorithm of the map of the syncmap package, with entries
+// holding an int64 added to atomically, so that concurrent increments of a
+// counter, even of the same one, never lock once it exists.
+package countermap
+
+import (
+	"sync"
+	"sync/atomic"
+)
+
+// CounterMap is like a Go map[KeyT]int64 of counters but is safe for
+// concurrent use by multiple goroutines without additional locking or
+// coordination. Adding to a counter that exists is an atomic addition, and
+// only adding the first value of a key locks.
+//
+// Counters can't be deleted, so it suits sets of keys that only grow, such
+// as the labels of metrics.
+//
+// The zero CounterMap is empty and ready for use. A CounterMap must not be
+// copied after first use.
+type CounterMap struct {
+	mu sync.Mutex
+
+	// read holds a readOnly, the portion of the map's contents that are safe
+	// for concurrent access (with or without mu held). It is always safe to
+	// load, but must only be stored with mu held.
+	read atomic.Value
+
+	// dirty holds the portion of the map's contents that require mu to be
+	// held, including all of the counters of the read map, so that it can
+	// be promoted to the read map quickly.
+	dirty map[KeyT]*counter
+
+	// misses counts the lookups since the read map was last updated that
+	// needed to lock mu. Once they cover the cost of copying the dirty map,
+	// it is promoted to the read map.
+	misses int
+}
+
+// readOnly is an immutable struct stored atomically in the CounterMap.read
+// field.
+type readOnly struct {
+	m       map[KeyT]*counter
+	amended bool // true if the dirty map contains some key not in m.
+}
+
+// A counter is the value of a key, accessed atomically. It is allocated on
+// its own, so that it is 64-bit aligned on 32-bit platforms.
+type counter struct {
+	n int64
+}
+
+// New returns an empty CounterMap.
+func New() *CounterMap {
+	return new(CounterMap)
+}
+
+func (m *CounterMap) loadReadOnly() readOnly {
+	if r, ok := m.read.Load().(readOnly); ok {
+		return r
+	}
+	return readOnly{}
+}
+
+// lookup returns the counter of key, if any.
+func (m *CounterMap) lookup(key KeyT) (c *counter, ok bool) {
+	read := m.loadReadOnly()
+	c, ok = read.m[key]
+	if !ok && read.amended {
+		m.mu.Lock()
+		// Avoid reporting a spurious miss if m.dirty got promoted while we
+		// were blocked on m.mu.
+		read = m.loadReadOnly()
+		c, ok = read.m[key]
+		if !ok && read.amended {
+			c, ok = m.dirty[key]
+			// Regardless of whether the counter was present, record a miss:
+			// this key will take the slow path until the dirty map is
+			// promoted to the read map.
+			m.missLocked()
+		}
+		m.mu.Unlock()
+	}
+	return c, ok
+}
+
+// Load returns the value of the counter of key, which is zero if nothing
+// was added to it.
+func (m *CounterMap) Load(key KeyT) int64 {
+	c, ok := m.lookup(key)
+	if !ok {
+		return 0
+	}
+	return atomic.LoadInt64(&c.n)
+}
+
+// Add adds delta to the counter of key, creating it if needed, and returns
+// its new value.
+func (m *CounterMap) Add(key KeyT, delta int64) int64 {
+	read := m.loadReadOnly()
+	if c, ok := read.m[key]; ok {
+		return atomic.AddInt64(&c.n, delta)
+	}
+
+	m.mu.Lock()
+	read = m.loadReadOnly()
+	c, ok := read.m[key]
+	if !ok {
+		if c, ok = m.dirty[key]; ok {
+			// Record a miss, so that the counter is promoted to the read
+			// map, where adding to it doesn't lock, once the misses cover
+			// the cost of copying the dirty map.
+			m.missLocked()
+		}
+	}
+	if !ok {
+		if !read.amended {
+			// We're adding the first new key to the dirty map. Make sure it
+			// is allocated and mark the read-only map as incomplete.
+			m.dirtyLocked()
+			m.read.Store(readOnly{m: read.m, amended: true})
+		}
+		c = new(counter)
+		m.dirty[key] = c
+	}
+	m.mu.Unlock()
+	return atomic.AddInt64(&c.n, delta)
+}
+
+// Inc adds one to the counter of key, and returns its new value.
+func (m *CounterMap) Inc(key KeyT) int64 {
+	return m.Add(key, 1)
+}
+
+// Snapshot returns the counters of the map, such as to export them. Each
+// value is loaded atomically, but the snapshot as a whole isn't: counters
+// added to meanwhile may have their values from before or after.
+func (m *CounterMap) Snapshot() map[KeyT]int64 {
+	// Like Range of the syncmap package, promote the dirty map, which
+	// copying the counters amortizes, so that read.m holds them all.
+	read := m.loadReadOnly()
+	if read.amended {
+		m.mu.Lock()
+		read = m.loadReadOnly()
+		if read.amended {
+			read = readOnly{m: m.dirty}
+			m.read.Store(read)
+			m.dirty = nil
+			m.misses = 0
+		}
+		m.mu.Unlock()
+	}
+
+	s := make(map[KeyT]int64, len(read.m))
+	for k, c := range read.m {
+		s[k] = atomic.LoadInt64(&c.n)
+	}
+	return s
+}
+
+func (m *CounterMap) missLocked() {
+	m.misses++
+	if m.misses < len(m.dirty) {
+		return
+	}
+	m.read.Store(readOnly{m: m.dirty})
+	m.dirty = nil
+	m.misses = 0
+}
+
+func (m *CounterMap) dirtyLocked() {
+	if m.dirty != nil {
+		return
+	}
+
+	read := m.loadReadOnly()
+	m.dirty = make(map[KeyT]*counter, len(read.m)+1)
+	for k, c := range read.m {
+		m.dirty[k] = c
+	}
+}
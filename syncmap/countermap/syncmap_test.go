@@ -0,0 +1,109 @@
+package countermap
+
+import (
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestAdd(t *testing.T) {
+	var m CounterMap
+	k0, k1 := newKeyT(0), newKeyT(1)
+	if got := m.Load(k0); got != 0 {
+		t.Errorf("Load of the zero CounterMap = %d; want 0", got)
+	}
+	if got := m.Add(k0, 5); got != 5 {
+		t.Errorf("Add(k0, 5) = %d; want 5", got)
+	}
+	if got := m.Inc(k0); got != 6 {
+		t.Errorf("Inc(k0) = %d; want 6", got)
+	}
+	if got := m.Add(k1, -2); got != -2 {
+		t.Errorf("Add(k1, -2) = %d; want -2", got)
+	}
+	if got0, got1 := m.Load(k0), m.Load(k1); got0 != 6 || got1 != -2 {
+		t.Errorf("Load(k0), Load(k1) = %d, %d; want 6, -2", got0, got1)
+	}
+}
+
+func TestAddPromotes(t *testing.T) {
+	var m CounterMap
+	k := newKeyT(0)
+	m.Add(k, 1)
+	// Adds to a counter of the dirty map record misses, which promote it.
+	for i := 0; i < 10 && m.loadReadOnly().amended; i++ {
+		m.Inc(k)
+	}
+	if _, ok := m.loadReadOnly().m[k]; !ok {
+		t.Fatal("repeated Adds to a new key didn't promote it to the read map")
+	}
+
+	// Once it is promoted, adding to it doesn't lock.
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	done := make(chan struct{}, 1)
+	go func() {
+		m.Inc(k)
+		done <- struct{}{}
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Error("Inc of a promoted counter locked the map")
+	}
+}
+
+func TestSnapshot(t *testing.T) {
+	m := New()
+	for i := 0; i < 10; i++ {
+		m.Add(newKeyT(i), int64(i))
+		if i == 5 {
+			// Promote the counters to the read map.
+			m.Snapshot()
+		}
+	}
+	s := m.Snapshot()
+	if len(s) != 10 {
+		t.Errorf("Snapshot has %d counters; want 10", len(s))
+	}
+	for i := 0; i < 10; i++ {
+		if got := s[newKeyT(i)]; got != int64(i) {
+			t.Errorf("Snapshot()[key %d] = %d; want %d", i, got, i)
+		}
+	}
+
+	// The snapshot is a copy.
+	m.Inc(newKeyT(0))
+	if got := s[newKeyT(0)]; got != 0 {
+		t.Errorf("Inc changed the snapshot to %d", got)
+	}
+}
+
+func TestConcurrent(t *testing.T) {
+	const goroutines, keys, rounds = 8, 50, 100
+	var m CounterMap
+	var wg sync.WaitGroup
+	for g := 0; g < goroutines; g++ {
+		wg.Add(1)
+		go func(g int) {
+			defer wg.Done()
+			for n := 0; n < rounds; n++ {
+				for i := 0; i < keys; i++ {
+					m.Inc(newKeyT((i + g) % keys))
+					m.Load(newKeyT(i))
+				}
+				if n%10 == 0 {
+					m.Snapshot()
+				}
+			}
+		}(g)
+	}
+	wg.Wait()
+
+	s := m.Snapshot()
+	for i := 0; i < keys; i++ {
+		if got := s[newKeyT(i)]; got != goroutines*rounds {
+			t.Errorf("counter of key %d = %d; want %d", i, got, goroutines*rounds)
+		}
+	}
+}
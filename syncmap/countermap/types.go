@@ -0,0 +1,4 @@
+package countermap
+
+// KeyT is a type for the keys of counters.
+type KeyT int64
@@ -0,0 +1,8 @@
+package countermap
+
+// newKeyT returns the i-th key used by the tests generated along with a
+// counter map, which replace it with a factory for its type. Keys must be
+// distinct for distinct i.
+func newKeyT(i int) KeyT {
+	return KeyT(i)
+}
@@ -0,0 +1,31 @@
+package cow
+
+import "time"
+
+// Option configures a Map created by New.
+type Option func(*Map)
+
+// WithBatch publishes staged writes once there are n of them, or d after the
+// first of them, whichever comes first. Reads lock while writes are staged,
+// so a smaller d favors readers and a larger n favors bursts of writes.
+// WithBatch(1, 0) publishes every write at once, copying the map each time.
+//
+// n less than 1 selects the default, a batch as large as the map, and d less
+// than or equal to 0 a millisecond.
+func WithBatch(n int, d time.Duration) Option {
+	return func(m *Map) {
+		m.batch, m.delay = n, d
+	}
+}
+
+// New returns an empty Map configured by opts.
+//
+// The zero Map is also empty and ready for use; New is only needed to pass
+// options.
+func New(opts ...Option) *Map {
+	m := new(Map)
+	for _, opt := range opts {
+		opt(m)
+	}
+	return m
+}
@@ -0,0 +1,61 @@
+package cow
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestWithBatch(t *testing.T) {
+	m := New(WithBatch(3, time.Hour))
+	m.Store(newKeyT(0), newValueT(0))
+	m.Store(newKeyT(1), newValueT(1))
+	if _, current := m.loadClean(); current {
+		t.Fatal("a batch of 2 writes out of 3 was published")
+	}
+	if got, ok := m.Load(newKeyT(1)); !ok || !reflect.DeepEqual(got, newValueT(1)) {
+		t.Errorf("Load of a staged write = %v, %v; want %v, true", got, ok, newValueT(1))
+	}
+	if got := m.Len(); got != 2 {
+		t.Errorf("Len with 2 staged writes = %d", got)
+	}
+	m.Delete(newKeyT(0))
+	if clean, current := m.loadClean(); !current || len(clean) != 1 {
+		t.Errorf("a batch of 3 writes wasn't published: clean %v, current %v", clean, current)
+	}
+
+	m = New(WithBatch(100, time.Millisecond))
+	m.Store(newKeyT(0), newValueT(0))
+	for deadline := time.Now().Add(10 * time.Second); ; time.Sleep(time.Millisecond) {
+		if clean, current := m.loadClean(); current && len(clean) == 1 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("a write wasn't published after the delay of its batch")
+		}
+	}
+}
+
+// TestBatchAmortized checks that the default batches grow with the map, so
+// that the map is copied a logarithmic number of times as it fills.
+func TestBatchAmortized(t *testing.T) {
+	m := New(WithBatch(0, time.Hour))
+	const n = 1000
+	for i := 0; i < n; i++ {
+		m.Store(newKeyT(i), newValueT(i))
+	}
+	if batches := (m.gen + 1) / 2; batches > 20 {
+		t.Errorf("%d writes made %d batches; want fewer than 20", n, batches)
+	}
+	if got := m.Len(); got != n {
+		t.Errorf("Len() = %d; want %d", got, n)
+	}
+	count := 0
+	m.Range(func(KeyT, ValueT) bool {
+		count++
+		return true
+	})
+	if count != n {
+		t.Errorf("Range visited %d entries; want %d", count, n)
+	}
+}
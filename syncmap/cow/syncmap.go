@@ -0,0 +1,239 @@
+// Package cow is the template of a copy-on-write map, generated with
+// go-gen-syncmap -impl=cow.
+//
+// It has the core API of the syncmap template. Writes are staged in a copy
+// of the map, which replaces it once the batch of writes is large enough or
+// old enough, so that bursts of writes copy the map once rather than once
+// each. Reads don't lock unless a batch is staged, so it suits maps that are
+// read constantly and written rarely, such as configuration.
+package cow
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/cristaloleg/go-gen-syncmap/syncmap/internal/shared"
+)
+
+// defaultDelay is the longest a batch of writes is staged for before it's
+// published, unless WithBatch sets another.
+const defaultDelay = time.Millisecond
+
+// Map is like a Go map[KeyT]ValueT that is replaced by a modified copy after
+// each batch of writes, so it is safe for concurrent use by multiple
+// goroutines.
+//
+// The zero Map is empty and ready for use. A Map must not be copied after
+// first use.
+type Map struct {
+	mu    sync.Mutex   // serializes writers, and guards the fields below gen
+	clean atomic.Value // map[KeyT]ValueT, never modified once stored
+
+	// gen is odd while a batch of writes is staged, and incremented when a
+	// batch is started and when it's published, so that a reader seeing the
+	// same even gen before and after loading clean knows it's current.
+	gen uint32
+
+	// Readers only load the fields above, which writers seldom write.
+	_ shared.CacheLinePad
+
+	batch int           // set by WithBatch
+	delay time.Duration // set by WithBatch
+
+	dirty  map[KeyT]ValueT // copy of clean with the staged writes, or nil
+	writes int             // number of staged writes
+	timer  *time.Timer     // publishes the batch after delay
+}
+
+func (m *Map) load() map[KeyT]ValueT {
+	clean, _ := m.clean.Load().(map[KeyT]ValueT)
+	return clean
+}
+
+// loadClean returns clean if no batch of writes is staged, or false.
+func (m *Map) loadClean() (map[KeyT]ValueT, bool) {
+	gen := atomic.LoadUint32(&m.gen)
+	if gen%2 != 0 {
+		return nil, false
+	}
+	clean := m.load()
+	return clean, atomic.LoadUint32(&m.gen) == gen
+}
+
+// currentLocked returns the map with the staged writes.
+func (m *Map) currentLocked() map[KeyT]ValueT {
+	if m.dirty != nil {
+		return m.dirty
+	}
+	return m.load()
+}
+
+// Load returns the value stored in the map for a key, or the zero value if
+// no value is present.
+// The ok result indicates whether value was found in the map.
+func (m *Map) Load(key KeyT) (value ValueT, ok bool) {
+	if clean, current := m.loadClean(); current {
+		value, ok = clean[key]
+		return value, ok
+	}
+	m.mu.Lock()
+	value, ok = m.currentLocked()[key]
+	m.mu.Unlock()
+	return value, ok
+}
+
+// Store sets the value for a key.
+func (m *Map) Store(key KeyT, value ValueT) {
+	m.mu.Lock()
+	m.dirtyLocked()[key] = value
+	m.wroteLocked()
+	m.mu.Unlock()
+}
+
+// LoadOrStore returns the existing value for the key if present.
+// Otherwise, it stores and returns the given value.
+// The loaded result is true if the value was loaded, false if stored.
+func (m *Map) LoadOrStore(key KeyT, value ValueT) (actual ValueT, loaded bool) {
+	if actual, loaded = m.Load(key); loaded {
+		return actual, loaded
+	}
+
+	m.mu.Lock()
+	// Reload in case the map changed while we were waiting on m.mu.
+	actual, loaded = m.currentLocked()[key]
+	if !loaded {
+		m.dirtyLocked()[key] = value
+		m.wroteLocked()
+		actual = value
+	}
+	m.mu.Unlock()
+	return actual, loaded
+}
+
+// Swap swaps the value for a key and returns the previous value if any.
+// The loaded result reports whether the key was present.
+func (m *Map) Swap(key KeyT, value ValueT) (previous ValueT, loaded bool) {
+	m.mu.Lock()
+	dirty := m.dirtyLocked()
+	previous, loaded = dirty[key]
+	dirty[key] = value
+	m.wroteLocked()
+	m.mu.Unlock()
+	return previous, loaded
+}
+
+// Delete deletes the value for a key.
+func (m *Map) Delete(key KeyT) {
+	if _, ok := m.Load(key); !ok {
+		return
+	}
+
+	m.mu.Lock()
+	if _, ok := m.currentLocked()[key]; ok {
+		delete(m.dirtyLocked(), key)
+		m.wroteLocked()
+	}
+	m.mu.Unlock()
+}
+
+// Len returns the number of entries in the map.
+func (m *Map) Len() int {
+	if clean, current := m.loadClean(); current {
+		return len(clean)
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return len(m.currentLocked())
+}
+
+// Clear deletes all the entries, resulting in an empty Map.
+func (m *Map) Clear() {
+	m.mu.Lock()
+	m.dirty = nil
+	m.clean.Store(map[KeyT]ValueT(nil))
+	m.endBatchLocked()
+	m.mu.Unlock()
+}
+
+// Range calls f sequentially for each key and value present in the map.
+// If f returns false, range stops the iteration.
+//
+// Unlike sync.Map, Range visits a consistent snapshot of the map: writes made
+// while f runs, including those made by f itself, are never observed. A
+// staged batch of writes is published first.
+func (m *Map) Range(f func(key KeyT, value ValueT) bool) {
+	clean, current := m.loadClean()
+	if !current {
+		m.mu.Lock()
+		m.publishLocked()
+		clean = m.load()
+		m.mu.Unlock()
+	}
+	for k, v := range clean {
+		if !f(k, v) {
+			break
+		}
+	}
+}
+
+// dirtyLocked returns the map to stage a write in, starting a batch with a
+// copy of clean if there is none.
+func (m *Map) dirtyLocked() map[KeyT]ValueT {
+	if m.dirty != nil {
+		return m.dirty
+	}
+	clean := m.load()
+	m.dirty = make(map[KeyT]ValueT, len(clean)+1)
+	for k, v := range clean {
+		m.dirty[k] = v
+	}
+	atomic.AddUint32(&m.gen, 1)
+	delay := m.delay
+	if delay <= 0 {
+		delay = defaultDelay
+	}
+	m.timer = time.AfterFunc(delay, m.publish)
+	return m.dirty
+}
+
+// wroteLocked counts a write staged in dirty, and publishes the batch if it's
+// full. By default, a batch is full once it holds as many writes as the map
+// has entries, so that copying the map costs a constant time per write.
+func (m *Map) wroteLocked() {
+	m.writes++
+	batch := m.batch
+	if batch <= 0 {
+		batch = len(m.dirty)
+	}
+	if m.writes >= batch {
+		m.publishLocked()
+	}
+}
+
+func (m *Map) publish() {
+	m.mu.Lock()
+	m.publishLocked()
+	m.mu.Unlock()
+}
+
+// publishLocked replaces clean with dirty, if a batch is staged.
+func (m *Map) publishLocked() {
+	if m.dirty == nil {
+		return
+	}
+	m.clean.Store(m.dirty)
+	m.dirty = nil
+	m.endBatchLocked()
+}
+
+// endBatchLocked ends the batch being staged, if any, once clean is current.
+func (m *Map) endBatchLocked() {
+	if m.timer == nil {
+		return
+	}
+	m.timer.Stop()
+	m.timer = nil
+	m.writes = 0
+	atomic.AddUint32(&m.gen, 1)
+}
@@ -0,0 +1,36 @@
+package ctrie
+
+// This file holds the methods comparing values with ==, which are only
+// generated if ValueT is comparable.
+
+// CompareAndSwap swaps the old and new values for key
+// if the value stored in the map is equal to old.
+func (m *Map) CompareAndSwap(key KeyT, old, new ValueT) (swapped bool) {
+	h := m.hash(key)
+	for {
+		t := m.root.Load()
+		if value, ok := t.load(key, h); !ok || value != old {
+			return false
+		}
+		if m.root.CompareAndSwap(t, t.with(key, h, new)) {
+			return true
+		}
+	}
+}
+
+// CompareAndDelete deletes the entry for key if its value is equal to old.
+//
+// If there is no current value for key in the map, CompareAndDelete
+// returns false.
+func (m *Map) CompareAndDelete(key KeyT, old ValueT) (deleted bool) {
+	h := m.hash(key)
+	for {
+		t := m.root.Load()
+		if value, ok := t.load(key, h); !ok || value != old {
+			return false
+		}
+		if m.root.CompareAndSwap(t, t.without(key, h)) {
+			return true
+		}
+	}
+}
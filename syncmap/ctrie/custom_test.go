@@ -0,0 +1,34 @@
+//go:build syncmap_customkey
+
+package ctrie_test
+
+import (
+	"strconv"
+	"testing"
+
+	"github.com/cristaloleg/go-gen-syncmap/syncmap/ctrie"
+)
+
+func TestCustomKey(t *testing.T) {
+	var m ctrie.Map
+	for i := 0; i < 1000; i++ {
+		m.Store(ctrie.KeyT("key"+strconv.Itoa(i)), ctrie.ValueT(i))
+	}
+	m.Store("Gopher", 1)
+	if v, ok := m.Load("GOPHER"); !ok || v != 1 {
+		t.Errorf("Load(GOPHER) = %v, %v; want 1, true", v, ok)
+	}
+	if v, loaded := m.LoadOrStore("gopher", 2); !loaded || v != 1 {
+		t.Errorf("LoadOrStore(gopher, 2) = %v, %v; want 1, true", v, loaded)
+	}
+	if v, loaded := m.Swap("gOpHeR", 3); !loaded || v != 1 {
+		t.Errorf("Swap(gOpHeR, 3) = %v, %v; want 1, true", v, loaded)
+	}
+	m.Delete("GoPhEr")
+	if v, ok := m.Load("Gopher"); ok {
+		t.Errorf("Load(Gopher) after Delete(GoPhEr) = %v, true", v)
+	}
+	if n := m.Len(); n != 1000 {
+		t.Errorf("Len() = %d; want 1000", n)
+	}
+}
@@ -0,0 +1,103 @@
+package ctrie
+
+import (
+	"reflect"
+	"sync"
+	"testing"
+)
+
+func TestSnapshot(t *testing.T) {
+	var m Map
+	for i := 0; i < 100; i++ {
+		m.Store(newKeyT(i), newValueT(i))
+	}
+	s := m.Snapshot()
+	for i := 0; i < 100; i++ {
+		m.Delete(newKeyT(i))
+	}
+	s.Store(newKeyT(100), newValueT(100))
+	if got := m.Len(); got != 0 {
+		t.Errorf("map emptied after its snapshot has %d entries", got)
+	}
+	if got := s.Len(); got != 101 {
+		t.Errorf("snapshot has %d entries; want 101", got)
+	}
+	if _, ok := m.Load(newKeyT(100)); ok {
+		t.Error("a write to the snapshot changed the map")
+	}
+	for i := 0; i <= 100; i++ {
+		if got, ok := s.Load(newKeyT(i)); !ok || !reflect.DeepEqual(got, newValueT(i)) {
+			t.Errorf("snapshot Load(%v) = %v, %v; want %v, true", newKeyT(i), got, ok, newValueT(i))
+		}
+	}
+}
+
+// TestRangeSnapshot checks that Range sees the map as it was when it was
+// called, while another goroutine moves entries from even to odd keys.
+func TestRangeSnapshot(t *testing.T) {
+	const n = 64
+	var m Map
+	for i := 0; i < n; i += 2 {
+		m.Store(newKeyT(i), newValueT(i))
+	}
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < n; i += 2 {
+			m.Store(newKeyT(i+1), newValueT(i+1))
+			m.Delete(newKeyT(i))
+		}
+	}()
+	for i := 0; i < 100; i++ {
+		count := 0
+		m.Range(func(KeyT, ValueT) bool {
+			count++
+			return true
+		})
+		// An entry is moved by two writes, so a snapshot holds n/2 entries,
+		// or n/2+1 between them.
+		if count != n/2 && count != n/2+1 {
+			t.Fatalf("Range visited %d entries; want %d or %d", count, n/2, n/2+1)
+		}
+	}
+	wg.Wait()
+}
+
+// TestCollisions builds tries with chosen hashes, so that keys share
+// prefixes of their hashes or whole hashes.
+func TestCollisions(t *testing.T) {
+	hashes := []uint64{0, 1 << 60, 1<<60 | 1, 1 << 60, 0, 1<<63 | 1<<60, 42}
+	var tr *trie
+	for i, h := range hashes {
+		tr = tr.with(newKeyT(i), h, newValueT(i))
+	}
+	if tr.len != len(hashes) {
+		t.Fatalf("trie of %d keys has len %d", len(hashes), tr.len)
+	}
+	for i, h := range hashes {
+		if got, ok := tr.load(newKeyT(i), h); !ok || !reflect.DeepEqual(got, newValueT(i)) {
+			t.Errorf("load(%v, %#x) = %v, %v; want %v, true", newKeyT(i), h, got, ok, newValueT(i))
+		}
+		if _, ok := tr.load(newKeyT(len(hashes)), h); ok {
+			t.Errorf("load found absent key with hash %#x", h)
+		}
+	}
+	for i, h := range hashes {
+		if u := tr.without(newKeyT(len(hashes)), h); u != tr {
+			t.Errorf("without(absent key, %#x) copied the trie", h)
+		}
+		tr = tr.without(newKeyT(i), h)
+		if _, ok := tr.load(newKeyT(i), h); ok {
+			t.Errorf("key %v still present after without", newKeyT(i))
+		}
+		for j := i + 1; j < len(hashes); j++ {
+			if _, ok := tr.load(newKeyT(j), hashes[j]); !ok {
+				t.Errorf("without(%v) lost key %v", newKeyT(i), newKeyT(j))
+			}
+		}
+	}
+	if tr.len != 0 || tr.root != nil {
+		t.Errorf("trie emptied by without has len %d and root %v", tr.len, tr.root)
+	}
+}
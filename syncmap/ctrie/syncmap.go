@@ -0,0 +1,350 @@
+// Package ctrie is the template of a copy-on-write persistent hash array
+// mapped trie (HAMT), generated with go-gen-syncmap -impl=ctrie.
+//
+// It has the core API of the syncmap template, and Snapshot. A write copies
+// the nodes on the path to its key, and publishes the new root with a
+// compare-and-swap, retrying if another write got there first. Reads and
+// snapshots never lock or copy anything, and Range sees a consistent
+// snapshot of the map however heavily it's mutated meanwhile.
+//
+// Writes are serialized: every one of them swaps the root, so concurrent
+// writers contend and retry as they would on one lock, even on keys in
+// different parts of the trie. Despite its name, it isn't the Ctrie of
+// Prokopec et al., whose indirection nodes and GCAS let such writes proceed
+// in parallel; in exchange, a snapshot is a single load of the root.
+package ctrie
+
+import (
+	"math/bits"
+	"sync"
+	"sync/atomic"
+
+	"github.com/cristaloleg/go-gen-syncmap/syncmap/internal/shared"
+)
+
+const (
+	// bitsPerLevel is the number of bits of the hash of a key choosing the
+	// child of a branch on its path, one level of the trie deeper each.
+	bitsPerLevel = 6
+	levelMask    = 1<<bitsPerLevel - 1
+)
+
+// Map is like a Go map[KeyT]ValueT held in a copy-on-write persistent trie,
+// whose root is replaced with a compare-and-swap by every write, so it is
+// safe for concurrent use by multiple goroutines, but serializes writes.
+//
+// The zero Map is empty and ready for use. A Map must not be copied after
+// first use; use Snapshot instead.
+type Map struct {
+	once sync.Once
+	seed shared.HashSeed // picked on first use, and shared with snapshots
+	root atomic.Pointer[trie]
+}
+
+// trie is a version of the contents of a Map, never modified once published.
+// A nil *trie is empty.
+type trie struct {
+	root *node
+	len  int
+}
+
+// node is a node of a trie: either a branch, whose children are picked by
+// bitsPerLevel bits of the hash of a key, or a leaf, holding the entries of
+// the keys with the hash of the leaf. Leaves hold more than one entry only
+// when the hashes of distinct keys collide. Branches have at least one
+// child, so a node is a leaf if its bitmap is zero.
+type node struct {
+	bitmap   uint64  // bit i is set if the branch has a child for bits i
+	children []*node // ordered by bits
+
+	hash    uint64
+	entries []entry
+}
+
+// entry is an entry of a leaf.
+type entry struct {
+	key   KeyT
+	value ValueT
+}
+
+// Snapshot returns a copy of m, taken at once. It costs a single atomic load:
+// m and the copy share their trie until either is written.
+func (m *Map) Snapshot() *Map {
+	s := new(Map)
+	// The hashes in the trie are those of the keys with the seed of m.
+	s.once.Do(func() { s.seed = m.hashSeed() })
+	s.root.Store(m.root.Load())
+	return s
+}
+
+// hashSeed returns the seed of the hashes of the keys of m, picking it on
+// first use.
+func (m *Map) hashSeed() shared.HashSeed {
+	m.once.Do(func() { m.seed = shared.NewHashSeed() })
+	return m.seed
+}
+
+// hash returns the hash of key with the seed of m.
+func (m *Map) hash(key KeyT) uint64 {
+	return shared.HashKey(m.hashSeed(), key)
+}
+
+// Load returns the value stored in the map for a key, or the zero value if
+// no value is present.
+// The ok result indicates whether value was found in the map.
+func (m *Map) Load(key KeyT) (value ValueT, ok bool) {
+	return m.root.Load().load(key, m.hash(key))
+}
+
+// Store sets the value for a key.
+func (m *Map) Store(key KeyT, value ValueT) {
+	h := m.hash(key)
+	for {
+		t := m.root.Load()
+		if m.root.CompareAndSwap(t, t.with(key, h, value)) {
+			return
+		}
+	}
+}
+
+// LoadOrStore returns the existing value for the key if present.
+// Otherwise, it stores and returns the given value.
+// The loaded result is true if the value was loaded, false if stored.
+func (m *Map) LoadOrStore(key KeyT, value ValueT) (actual ValueT, loaded bool) {
+	h := m.hash(key)
+	for {
+		t := m.root.Load()
+		if actual, loaded = t.load(key, h); loaded {
+			return actual, loaded
+		}
+		if m.root.CompareAndSwap(t, t.with(key, h, value)) {
+			return value, false
+		}
+	}
+}
+
+// Swap swaps the value for a key and returns the previous value if any.
+// The loaded result reports whether the key was present.
+func (m *Map) Swap(key KeyT, value ValueT) (previous ValueT, loaded bool) {
+	h := m.hash(key)
+	for {
+		t := m.root.Load()
+		previous, loaded = t.load(key, h)
+		if m.root.CompareAndSwap(t, t.with(key, h, value)) {
+			return previous, loaded
+		}
+	}
+}
+
+// Delete deletes the value for a key.
+func (m *Map) Delete(key KeyT) {
+	h := m.hash(key)
+	for {
+		t := m.root.Load()
+		u := t.without(key, h)
+		if u == t || m.root.CompareAndSwap(t, u) {
+			return
+		}
+	}
+}
+
+// Len returns the number of entries in the map.
+func (m *Map) Len() int {
+	if t := m.root.Load(); t != nil {
+		return t.len
+	}
+	return 0
+}
+
+// Clear deletes all the entries, resulting in an empty Map.
+func (m *Map) Clear() {
+	m.root.Store(nil)
+}
+
+// Range calls f sequentially for each key and value present in the map.
+// If f returns false, range stops the iteration.
+//
+// Range visits a snapshot of the map, taken when it's called, so it is not
+// affected by concurrent writes, and f may call any method of m.
+func (m *Map) Range(f func(key KeyT, value ValueT) bool) {
+	if t := m.root.Load(); t != nil {
+		t.root.walk(f)
+	}
+}
+
+// load returns the value of key, whose hash is h, in t.
+func (t *trie) load(key KeyT, h uint64) (value ValueT, ok bool) {
+	if t == nil {
+		return value, false
+	}
+	n := t.root
+	for shift := uint(0); n != nil; shift += bitsPerLevel {
+		if n.bitmap == 0 {
+			if n.hash == h {
+				for _, e := range n.entries {
+					if shared.EqualKey(e.key, key) {
+						return e.value, true
+					}
+				}
+			}
+			break
+		}
+		bit := uint64(1) << (h >> shift & levelMask)
+		if n.bitmap&bit == 0 {
+			break
+		}
+		n = n.children[bits.OnesCount64(n.bitmap&(bit-1))]
+	}
+	return value, false
+}
+
+// with returns a copy of t in which key, whose hash is h, maps to value.
+func (t *trie) with(key KeyT, h uint64, value ValueT) *trie {
+	var u trie
+	if t != nil {
+		u = *t
+	}
+	var loaded bool
+	u.root, loaded = insert(u.root, 0, h, key, value)
+	if !loaded {
+		u.len++
+	}
+	return &u
+}
+
+// without returns a copy of t without key, whose hash is h, or t itself if
+// key isn't in it.
+func (t *trie) without(key KeyT, h uint64) *trie {
+	if t == nil {
+		return nil
+	}
+	root, removed := remove(t.root, 0, h, key)
+	if !removed {
+		return t
+	}
+	return &trie{root: root, len: t.len - 1}
+}
+
+// insert returns a copy of the subtrie n, whose branches pick their children
+// from shift on, in which key, whose hash is h, maps to value. It reports
+// whether key was already present.
+func insert(n *node, shift uint, h uint64, key KeyT, value ValueT) (*node, bool) {
+	switch {
+	case n == nil:
+		return &node{hash: h, entries: []entry{{key, value}}}, false
+	case n.bitmap == 0 && n.hash != h:
+		return merge(n, &node{hash: h, entries: []entry{{key, value}}}, shift), false
+	case n.bitmap == 0:
+		entries := make([]entry, len(n.entries), len(n.entries)+1)
+		copy(entries, n.entries)
+		for i := range entries {
+			if shared.EqualKey(entries[i].key, key) {
+				entries[i].value = value
+				return &node{hash: h, entries: entries}, true
+			}
+		}
+		return &node{hash: h, entries: append(entries, entry{key, value})}, false
+	}
+
+	bit := uint64(1) << (h >> shift & levelMask)
+	i := bits.OnesCount64(n.bitmap & (bit - 1))
+	if n.bitmap&bit == 0 {
+		children := make([]*node, len(n.children)+1)
+		copy(children, n.children[:i])
+		children[i] = &node{hash: h, entries: []entry{{key, value}}}
+		copy(children[i+1:], n.children[i:])
+		return &node{bitmap: n.bitmap | bit, children: children}, false
+	}
+	child, loaded := insert(n.children[i], shift+bitsPerLevel, h, key, value)
+	children := make([]*node, len(n.children))
+	copy(children, n.children)
+	children[i] = child
+	return &node{bitmap: n.bitmap, children: children}, loaded
+}
+
+// merge returns a subtrie holding the leaves a and b, whose hashes differ,
+// whose branches pick their children from shift on.
+func merge(a, b *node, shift uint) *node {
+	i, j := a.hash>>shift&levelMask, b.hash>>shift&levelMask
+	if i == j {
+		return &node{bitmap: 1 << i, children: []*node{merge(a, b, shift+bitsPerLevel)}}
+	}
+	if i > j {
+		i, j = j, i
+		a, b = b, a
+	}
+	return &node{bitmap: 1<<i | 1<<j, children: []*node{a, b}}
+}
+
+// remove returns a copy of the subtrie n, whose branches pick their children
+// from shift on, without key, whose hash is h, and reports whether key was
+// present; if not, it returns n itself. Branches left with a single leaf are
+// replaced by the leaf, which their parent can hold just as well.
+func remove(n *node, shift uint, h uint64, key KeyT) (*node, bool) {
+	if n == nil {
+		return nil, false
+	}
+	if n.bitmap == 0 {
+		if n.hash != h {
+			return n, false
+		}
+		for i, e := range n.entries {
+			if !shared.EqualKey(e.key, key) {
+				continue
+			}
+			if len(n.entries) == 1 {
+				return nil, true
+			}
+			entries := make([]entry, 0, len(n.entries)-1)
+			entries = append(entries, n.entries[:i]...)
+			entries = append(entries, n.entries[i+1:]...)
+			return &node{hash: h, entries: entries}, true
+		}
+		return n, false
+	}
+
+	bit := uint64(1) << (h >> shift & levelMask)
+	if n.bitmap&bit == 0 {
+		return n, false
+	}
+	i := bits.OnesCount64(n.bitmap & (bit - 1))
+	child, removed := remove(n.children[i], shift+bitsPerLevel, h, key)
+	switch {
+	case !removed:
+		return n, false
+	case child == nil && len(n.children) == 1:
+		return nil, true
+	case child == nil && len(n.children) == 2 && n.children[1-i].bitmap == 0:
+		return n.children[1-i], true
+	case child == nil:
+		children := make([]*node, 0, len(n.children)-1)
+		children = append(children, n.children[:i]...)
+		children = append(children, n.children[i+1:]...)
+		return &node{bitmap: n.bitmap &^ bit, children: children}, true
+	case len(n.children) == 1 && child.bitmap == 0:
+		return child, true
+	}
+	children := make([]*node, len(n.children))
+	copy(children, n.children)
+	children[i] = child
+	return &node{bitmap: n.bitmap, children: children}, true
+}
+
+// walk calls f for each entry of the subtrie n, until f returns false, and
+// reports whether it never did.
+func (n *node) walk(f func(key KeyT, value ValueT) bool) bool {
+	if n == nil {
+		return true
+	}
+	for _, e := range n.entries {
+		if !f(e.key, e.value) {
+			return false
+		}
+	}
+	for _, c := range n.children {
+		if !c.walk(f) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,112 @@
+package syncmap
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+)
+
+// debugLimit is the number of entries a page of DebugHandler holds by
+// default, and debugMaxLimit the most it holds.
+const (
+	debugLimit    = 100
+	debugMaxLimit = 10000
+)
+
+// DebugHandler returns a handler serving the map as JSON, to inspect it at
+// run time, such as under /debug/ next to net/http/pprof:
+//
+//	{"len": 2, "stats": {...}, "offset": 0, "limit": 100, "entries": [{"key": ..., "value": ...}, ...]}
+//
+// The entries are those of a Snapshot, ordered by the JSON encoding of their
+// keys, and paginated by the query parameters offset and limit, which
+// defaults to 100. If redact isn't nil, each value is served as
+// redact(key, value) instead, such as to hide secrets or to summarize large
+// values.
+func (m *Map) DebugHandler(redact func(key KeyT, value ValueT) interface{}) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet && r.Method != http.MethodHead {
+			w.Header().Set("Allow", "GET, HEAD")
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		offset, err := debugParam(r, "offset", 0)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		limit, err := debugParam(r, "limit", debugLimit)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if limit > debugMaxLimit {
+			limit = debugMaxLimit
+		}
+
+		type debugEntry struct {
+			Key   json.RawMessage `json:"key"`
+			Value interface{}     `json:"value"`
+			key   KeyT
+		}
+		snapshot := m.Snapshot()
+		entries := make([]debugEntry, 0, len(snapshot))
+		for k := range snapshot {
+			b, err := json.Marshal(k)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+			entries = append(entries, debugEntry{Key: b, key: k})
+		}
+		sort.Slice(entries, func(i, j int) bool {
+			return bytes.Compare(entries[i].Key, entries[j].Key) < 0
+		})
+		if offset > len(entries) {
+			offset = len(entries)
+		}
+		page := entries[offset:]
+		if len(page) > limit {
+			page = page[:limit]
+		}
+		for i := range page {
+			e := &page[i]
+			if redact != nil {
+				e.Value = redact(e.key, snapshot[e.key])
+			} else {
+				e.Value = snapshot[e.key]
+			}
+		}
+
+		b, err := json.Marshal(struct {
+			Len     int          `json:"len"`
+			Stats   Stats        `json:"stats"`
+			Offset  int          `json:"offset"`
+			Limit   int          `json:"limit"`
+			Entries []debugEntry `json:"entries"`
+		}{len(snapshot), m.Stats(), offset, limit, page})
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(b)
+	})
+}
+
+// debugParam returns the non-negative integer query parameter name of r, or
+// def if it's missing.
+func debugParam(r *http.Request, name string, def int) (int, error) {
+	s := r.URL.Query().Get(name)
+	if s == "" {
+		return def, nil
+	}
+	n, err := strconv.Atoi(s)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("invalid %s %q: want a non-negative integer", name, s)
+	}
+	return n, nil
+}
@@ -0,0 +1,64 @@
+package syncmap
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestDebugHandler(t *testing.T) {
+	var m Map
+	for i := 0; i < 5; i++ {
+		m.Store(newKeyT(i), newValueT(i))
+	}
+	h := m.DebugHandler(func(key KeyT, value ValueT) interface{} {
+		return "redacted"
+	})
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/debug/map?offset=1&limit=2", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("GET returned status %d: %s", rec.Code, rec.Body)
+	}
+	var page struct {
+		Len     int   `json:"len"`
+		Stats   Stats `json:"stats"`
+		Offset  int   `json:"offset"`
+		Limit   int   `json:"limit"`
+		Entries []struct {
+			Key   json.RawMessage `json:"key"`
+			Value string          `json:"value"`
+		} `json:"entries"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &page); err != nil {
+		t.Fatalf("decoding the page: %v", err)
+	}
+	if page.Len != 5 || page.Stats.Entries != 5 || page.Offset != 1 || page.Limit != 2 || len(page.Entries) != 2 {
+		t.Fatalf("GET returned %+v; want 2 of 5 entries from offset 1", page)
+	}
+	if bytes.Compare(page.Entries[0].Key, page.Entries[1].Key) >= 0 {
+		t.Errorf("GET returned keys %s and %s out of order", page.Entries[0].Key, page.Entries[1].Key)
+	}
+	for _, e := range page.Entries {
+		if e.Value != "redacted" {
+			t.Errorf("GET returned value %q for key %s; want it redacted", e.Value, e.Key)
+		}
+	}
+
+	for _, c := range []struct {
+		method, target string
+		code           int
+	}{
+		{http.MethodGet, "/debug/map?offset=10", http.StatusOK},
+		{http.MethodGet, "/debug/map?limit=-1", http.StatusBadRequest},
+		{http.MethodPost, "/debug/map", http.StatusMethodNotAllowed},
+	} {
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, httptest.NewRequest(c.method, c.target, nil))
+		if rec.Code != c.code {
+			t.Errorf("%s %s returned status %d; want %d", c.method, c.target, rec.Code, c.code)
+		}
+	}
+}
@@ -0,0 +1,80 @@
+package syncmap
+
+import (
+	"sync/atomic"
+	"unsafe"
+)
+
+// Reason is why the map removed an entry other than by a deletion of its
+// key, as reported to the function set by WithOnEvict.
+type Reason int
+
+const (
+	// ReasonExpired is the reason of the values stored with a TTL that
+	// passed, in maps generated with -ttl.
+	ReasonExpired Reason = iota + 1
+
+	// ReasonEvicted is the reason of the entries evicted to make room for
+	// others, in maps generated with -maxentries or -maxcost.
+	ReasonEvicted
+
+	// ReasonCleared is the reason of the entries removed by Clear, or by
+	// decoding into the map.
+	ReasonCleared
+)
+
+// String returns the name of r.
+func (r Reason) String() string {
+	switch r {
+	case ReasonExpired:
+		return "expired"
+	case ReasonEvicted:
+		return "evicted"
+	case ReasonCleared:
+		return "cleared"
+	}
+	return "unknown"
+}
+
+// WithOnEvict makes the map call f with the key and value of each entry it
+// removes when a value expires, when an entry is evicted, or when the map is
+// cleared, so that the resources held by values can be released. Deleting,
+// replacing, or swapping the value of a key doesn't call f.
+//
+// f is called once per removed value, by the goroutine removing it, and may
+// be called with the map's lock held, so it must not use the map.
+func WithOnEvict(f func(key KeyT, value ValueT, reason Reason)) Option {
+	return func(m *Map) {
+		m.onEvict = f
+	}
+}
+
+// evicted reports that the map removed the value of key, held by its entry
+// as p, to the function set by WithOnEvict, if any, and counts it.
+func (m *Map) evicted(key KeyT, p unsafe.Pointer, reason Reason) {
+	m.metrics.evict(reason)
+	if m.onEvict != nil {
+		m.onEvict(key, unboxValue(p), reason)
+	}
+}
+
+// cleared reports the values of entries, which the map no longer holds, to
+// the function set by WithOnEvict, if any. The entries are expunged, so that
+// writers still holding them look their keys up again instead of storing
+// values no one would see, and so that each value is reported once.
+func (m *Map) cleared(entries map[KeyT]*entry) {
+	if m.onEvict == nil {
+		return
+	}
+	for k, e := range entries {
+		p := atomic.SwapPointer(&e.p, expunged)
+		if p == nil || p == expunged {
+			continue
+		}
+		reason := ReasonCleared
+		if expired(p) {
+			reason = ReasonExpired
+		}
+		m.onEvict(k, unboxValue(p), reason)
+	}
+}
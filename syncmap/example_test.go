@@ -0,0 +1,71 @@
+package syncmap
+
+import "fmt"
+
+// The examples of this file are generated along with a map, for its
+// documentation to show how to use it. They only print what doesn't depend
+// on the key and value types.
+
+func ExampleMap_Load() {
+	var m Map
+	key, value := newKeyT(1), newValueT(1)
+	m.Store(key, value)
+	if _, ok := m.Load(key); ok {
+		fmt.Println("found")
+	}
+	if _, ok := m.Load(newKeyT(2)); !ok {
+		fmt.Println("not found")
+	}
+	// Output:
+	// found
+	// not found
+}
+
+func ExampleMap_LoadOrStore() {
+	var m Map
+	key := newKeyT(1)
+	_, loaded := m.LoadOrStore(key, newValueT(1))
+	fmt.Println("loaded:", loaded)
+	// The value stored first is kept.
+	_, loaded = m.LoadOrStore(key, newValueT(2))
+	fmt.Println("loaded:", loaded)
+	// Output:
+	// loaded: false
+	// loaded: true
+}
+
+func ExampleMap_Swap() {
+	var m Map
+	key := newKeyT(1)
+	_, loaded := m.Swap(key, newValueT(1))
+	fmt.Println("replaced:", loaded)
+	_, loaded = m.Swap(key, newValueT(2))
+	fmt.Println("replaced:", loaded)
+	// Output:
+	// replaced: false
+	// replaced: true
+}
+
+func ExampleMap_Delete() {
+	var m Map
+	key := newKeyT(1)
+	m.Store(key, newValueT(1))
+	m.Delete(key)
+	_, ok := m.Load(key)
+	fmt.Println(ok, m.Len())
+	// Output: false 0
+}
+
+func ExampleMap_Range() {
+	var m Map
+	for i := 0; i < 3; i++ {
+		m.Store(newKeyT(i), newValueT(i))
+	}
+	n := 0
+	m.Range(func(key KeyT, value ValueT) bool {
+		n++
+		return true // Return false to stop.
+	})
+	fmt.Println(n, "entries")
+	// Output: 3 entries
+}
@@ -0,0 +1,27 @@
+package syncmap
+
+import (
+	"encoding/json"
+	"expvar"
+)
+
+// Var returns an expvar.Var whose String method reports the map's contents
+// as a JSON object, encoded by MarshalJSON, or null if that fails.
+//
+// Map itself does not implement expvar.Var, because its String method prints
+// a bounded preview rather than JSON.
+func (m *Map) Var() expvar.Var {
+	return expvar.Func(func() interface{} {
+		data, err := m.MarshalJSON()
+		if err != nil {
+			return nil
+		}
+		return json.RawMessage(data)
+	})
+}
+
+// Publish exports the map's contents under name on /debug/vars.
+// Like expvar.Publish, it panics if name is already registered.
+func (m *Map) Publish(name string) {
+	expvar.Publish(name, m.Var())
+}
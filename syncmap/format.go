@@ -0,0 +1,50 @@
+package syncmap
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// previewLen is the maximum number of entries printed by String and GoString.
+const previewLen = 16
+
+// String implements fmt.Stringer. It prints the number of entries and up to
+// previewLen of them, sorted by their printed form.
+func (m *Map) String() string {
+	name := m.typeName()
+	name = name[strings.LastIndex(name, ".")+1:]
+	return m.preview(name+"[len=%d]{", "%v:%v", " ", "}")
+}
+
+// GoString implements fmt.GoStringer. Like String, it prints at most
+// previewLen entries.
+func (m *Map) GoString() string {
+	return m.preview("&"+m.typeName()+"{ /* len=%d */ ", "%#v: %#v", ", ", "}")
+}
+
+// typeName returns the package-qualified name of the map type, which
+// differs from syncmap.Map in generated code.
+func (m *Map) typeName() string {
+	return strings.TrimPrefix(fmt.Sprintf("%T", m), "*")
+}
+
+// preview prints the map's length and up to previewLen entries, sorted.
+func (m *Map) preview(header, entry, sep, footer string) string {
+	entries := make([]string, 0, previewLen)
+	m.Range(func(key KeyT, value ValueT) bool {
+		entries = append(entries, fmt.Sprintf(entry, key, value))
+		return len(entries) < previewLen
+	})
+	sort.Strings(entries)
+
+	var b strings.Builder
+	n := m.Len()
+	fmt.Fprintf(&b, header, n)
+	b.WriteString(strings.Join(entries, sep))
+	if n > len(entries) {
+		fmt.Fprintf(&b, "%s…", sep)
+	}
+	b.WriteString(footer)
+	return b.String()
+}
@@ -0,0 +1,133 @@
+package syncmap
+
+import (
+	"reflect"
+	"sync"
+	"testing"
+)
+
+// rwMutexMap is the reference FuzzOps checks a Map against: a plain map
+// guarded by a sync.RWMutex, whose behavior is obviously right.
+type rwMutexMap struct {
+	mu    sync.RWMutex
+	dirty map[KeyT]ValueT
+}
+
+func (m *rwMutexMap) Load(key KeyT) (value ValueT, ok bool) {
+	m.mu.RLock()
+	value, ok = m.dirty[key]
+	m.mu.RUnlock()
+	return
+}
+
+func (m *rwMutexMap) Store(key KeyT, value ValueT) {
+	m.mu.Lock()
+	if m.dirty == nil {
+		m.dirty = make(map[KeyT]ValueT)
+	}
+	m.dirty[key] = value
+	m.mu.Unlock()
+}
+
+func (m *rwMutexMap) LoadOrStore(key KeyT, value ValueT) (actual ValueT, loaded bool) {
+	m.mu.Lock()
+	actual, loaded = m.dirty[key]
+	if !loaded {
+		actual = value
+		if m.dirty == nil {
+			m.dirty = make(map[KeyT]ValueT)
+		}
+		m.dirty[key] = value
+	}
+	m.mu.Unlock()
+	return actual, loaded
+}
+
+func (m *rwMutexMap) Swap(key KeyT, value ValueT) (previous ValueT, loaded bool) {
+	m.mu.Lock()
+	if m.dirty == nil {
+		m.dirty = make(map[KeyT]ValueT)
+	}
+	previous, loaded = m.dirty[key]
+	m.dirty[key] = value
+	m.mu.Unlock()
+	return
+}
+
+func (m *rwMutexMap) Delete(key KeyT) {
+	m.mu.Lock()
+	delete(m.dirty, key)
+	m.mu.Unlock()
+}
+
+func (m *rwMutexMap) Clear() {
+	m.mu.Lock()
+	m.dirty = nil
+	m.mu.Unlock()
+}
+
+func (m *rwMutexMap) Len() int {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return len(m.dirty)
+}
+
+// FuzzOps decodes the fuzzed bytes as a sequence of operations, two bytes
+// each: the operation, and the index of its key among 16. It applies them to
+// a Map and to a rwMutexMap, and checks that every result, and the contents
+// the maps end up with, agree.
+func FuzzOps(f *testing.F) {
+	f.Add([]byte{0, 1, 1, 1, 2, 1, 4, 1, 1, 1})
+	f.Add([]byte{2, 3, 2, 3, 3, 3, 5, 0, 1, 3, 0, 4})
+	f.Fuzz(func(t *testing.T, ops []byte) {
+		var m Map
+		var ref rwMutexMap
+		for i := 0; i+1 < len(ops); i += 2 {
+			k, v := newKeyT(int(ops[i+1]%16)), newValueT(i)
+			switch ops[i] % 6 {
+			case 0:
+				m.Store(k, v)
+				ref.Store(k, v)
+			case 1:
+				got, ok := m.Load(k)
+				want, wantOK := ref.Load(k)
+				if !reflect.DeepEqual(got, want) || ok != wantOK {
+					t.Fatalf("op %d: Load(%v) = %v, %v; want %v, %v", i/2, k, got, ok, want, wantOK)
+				}
+			case 2:
+				got, ok := m.LoadOrStore(k, v)
+				want, wantOK := ref.LoadOrStore(k, v)
+				if !reflect.DeepEqual(got, want) || ok != wantOK {
+					t.Fatalf("op %d: LoadOrStore(%v, %v) = %v, %v; want %v, %v", i/2, k, v, got, ok, want, wantOK)
+				}
+			case 3:
+				got, ok := m.Swap(k, v)
+				want, wantOK := ref.Swap(k, v)
+				if !reflect.DeepEqual(got, want) || ok != wantOK {
+					t.Fatalf("op %d: Swap(%v, %v) = %v, %v; want %v, %v", i/2, k, v, got, ok, want, wantOK)
+				}
+			case 4:
+				m.Delete(k)
+				ref.Delete(k)
+			case 5:
+				m.Clear()
+				ref.Clear()
+			}
+		}
+
+		if got, want := m.Len(), ref.Len(); got != want {
+			t.Errorf("Len() = %d; want %d", got, want)
+		}
+		n := 0
+		m.Range(func(k KeyT, v ValueT) bool {
+			n++
+			if want, ok := ref.Load(k); !ok || !reflect.DeepEqual(v, want) {
+				t.Errorf("Range visited %v: %v; want %v, %v", k, v, want, ok)
+			}
+			return true
+		})
+		if want := ref.Len(); n != want {
+			t.Errorf("Range visited %d keys; want %d", n, want)
+		}
+	})
+}
@@ -0,0 +1,26 @@
+package syncmap
+
+import (
+	"bytes"
+	"encoding/gob"
+)
+
+// GobEncode implements gob.GobEncoder by encoding a Snapshot of the map.
+func (m *Map) GobEncode() ([]byte, error) {
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(m.Snapshot()); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// GobDecode implements gob.GobDecoder. It replaces the contents of the map,
+// building the read map directly from the decoded entries.
+func (m *Map) GobDecode(data []byte) error {
+	var src map[KeyT]ValueT
+	if err := gob.NewDecoder(bytes.NewReader(data)).Decode(&src); err != nil {
+		return err
+	}
+	m.reset(src)
+	return nil
+}
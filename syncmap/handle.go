@@ -0,0 +1,113 @@
+package syncmap
+
+import "sync/atomic"
+
+// Entry is a handle to the value for a single key of a Map, returned by
+// Acquire. Its methods behave like the Map methods of the same name applied
+// to the handle's key, but skip the map lookup while the underlying entry
+// stays in the map.
+//
+// An Entry is safe for concurrent use by multiple goroutines.
+type Entry struct {
+	m   *Map
+	key KeyT
+
+	// h is the resolved entry and the generation of the read map it belongs
+	// to, replaced as a whole whenever the key is looked up again.
+	h atomic.Value // handle
+}
+
+// handle is an immutable pair stored atomically in the Entry.h field.
+type handle struct {
+	e     *entry // nil if the key was missing when resolved.
+	count *int64 // readOnly.count of the generation e belongs to.
+}
+
+// Acquire returns a handle to the value for key. The key does not need to be
+// present in the map.
+func (m *Map) Acquire(key KeyT) *Entry {
+	h := &Entry{m: m, key: key}
+	h.resolve()
+	return h
+}
+
+// Key returns the key the handle is bound to.
+func (h *Entry) Key() KeyT {
+	return h.key
+}
+
+// Load returns the value stored in the map for the handle's key.
+func (h *Entry) Load() (value ValueT, ok bool) {
+	if e, _, current := h.current(); current {
+		p := atomic.LoadPointer(&e.p)
+		if p == nil || (p != expunged && expired(p)) {
+			h.m.onLoad(h.key, value, false)
+			return h.m.loadMissing(h.key)
+		}
+		if p != expunged {
+			h.m.touch(h.key, e)
+			h.m.refreshIfStale(h.key, e)
+			value = unboxValue(p)
+			h.m.onLoad(h.key, value, true)
+			return value, true
+		}
+	}
+	value, ok = h.m.Load(h.key)
+	h.resolve()
+	return value, ok
+}
+
+// Store sets the value for the handle's key.
+func (h *Entry) Store(value ValueT) {
+	h.m.loadReadOnly().checkWritable()
+	if e, count, current := h.current(); current {
+		value := h.m.copied(value)
+		if p, ok := e.trySwap(boxValue(value)); ok {
+			h.m.touch(h.key, e)
+			h.m.charge(e)
+			if p == nil {
+				atomic.AddInt64(count, 1)
+				h.m.admit(h.key)
+			} else {
+				h.m.evictIfFull()
+			}
+			h.m.onStore(h.key, value)
+			return
+		}
+	}
+	h.m.Store(h.key, value)
+	h.resolve()
+}
+
+// current returns the resolved entry and its counter, and reports whether
+// the entry still belongs to the map: that is, no Clear or reset started a
+// new generation since it was resolved. An expunged entry may still have
+// been dropped from the map and must be looked up again.
+func (h *Entry) current() (e *entry, count *int64, ok bool) {
+	hd, _ := h.h.Load().(handle)
+	if hd.e == nil {
+		return nil, nil, false
+	}
+	read := h.m.loadReadOnly()
+	if read.count != hd.count {
+		return nil, nil, false
+	}
+	return hd.e, h.m.counter(read), true
+}
+
+// resolve looks up the entry for the handle's key in the map.
+func (h *Entry) resolve() {
+	m := h.m
+	read := m.loadReadOnly()
+	e, ok := read.m[h.key]
+	if !ok && read.amended {
+		m.mu.Lock()
+		read = m.loadReadOnly()
+		e, ok = read.m[h.key]
+		if !ok && read.amended {
+			e = m.dirty[h.key]
+		}
+		m.mu.Unlock()
+	}
+	h.h.Store(handle{e: e, count: read.count})
+}
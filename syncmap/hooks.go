@@ -0,0 +1,110 @@
+package syncmap
+
+// Hooks are functions the map calls after operations on it, such as to log
+// writes or to broadcast invalidations of the keys written to other caches.
+// Any of them may be nil.
+//
+// The hooks are called by the goroutine performing the operation, once it
+// has released the map's lock, so they may use the map, although they delay
+// the operation's return. Concurrent operations call them concurrently, and
+// not necessarily in the order the operations took effect.
+type Hooks struct {
+	// OnStore is called with each key a write stored a value for, and the
+	// value stored: by Store, Swap, LoadOrStore storing its value, Replace,
+	// Update and Upsert keeping a value, CompareAndSwap swapping, the bulk
+	// writes for each of their keys, and the Entry methods of the same names.
+	OnStore func(key KeyT, value ValueT)
+
+	// OnDelete is called with each key whose value was deleted: by Delete,
+	// DeleteMany, CompareAndDelete, Pop, DeleteFunc, or Update. Deleting a
+	// missing key doesn't call it, nor do Clear and the removals reported
+	// to WithOnEvict.
+	OnDelete func(key KeyT)
+
+	// OnLoadHit is called with each key a load found, and its value: by
+	// Load, Contains, LoadOrDefault, LoadMany, LoadOrStore finding the key,
+	// and Entry.Load. Iterating over the map doesn't call it.
+	OnLoadHit func(key KeyT, value ValueT)
+
+	// OnLoadMiss is called with each key a load didn't find.
+	OnLoadMiss func(key KeyT)
+}
+
+// WithHooks makes the map call the functions of h after the operations on it.
+func WithHooks(h Hooks) Option {
+	return func(m *Map) {
+		m.hooks = h
+	}
+}
+
+// onStore writes a value stored through to the backend, if any, and
+// notifies it.
+func (m *Map) onStore(key KeyT, value ValueT) {
+	m.backend.put(key, value)
+	m.notifyStore(key, value)
+}
+
+// notifyStore counts a store, and calls the OnStore hook, if any, without
+// writing the value to the backend, such as when it came from there.
+func (m *Map) notifyStore(key KeyT, value ValueT) {
+	m.metrics.store(1)
+	if m.hooks.OnStore != nil {
+		m.hooks.OnStore(key, value)
+	}
+}
+
+// onDelete deletes a key deleted from the backend, if any, and notifies it.
+func (m *Map) onDelete(key KeyT) {
+	m.backend.delete(key)
+	m.notifyDelete(key)
+}
+
+// notifyDelete counts a deletion, and calls the OnDelete hook, if any,
+// without deleting the key from the backend.
+func (m *Map) notifyDelete(key KeyT) {
+	m.metrics.delete()
+	if m.hooks.OnDelete != nil {
+		m.hooks.OnDelete(key)
+	}
+}
+
+// collectsStores reports whether the bulk writes collect the values they
+// store, for onStoreMany to pass to the backend and the OnStore hook.
+func (m *Map) collectsStores() bool {
+	return m.hooks.OnStore != nil || m.backend.enabled()
+}
+
+// onStoreMany counts the n values a bulk write stored, and writes those it
+// collected, if any, through to the backend, and to the OnStore hook.
+func (m *Map) onStoreMany(n int, stored []Pair) {
+	m.metrics.store(n)
+	for _, p := range stored {
+		m.backend.put(p.Key, p.Value)
+		if m.hooks.OnStore != nil {
+			m.hooks.OnStore(p.Key, p.Value)
+		}
+	}
+}
+
+// onLoad counts a load, and calls the OnLoadHit hook, if any, if ok reports
+// that it found value for key, and the OnLoadMiss hook, if any, otherwise.
+func (m *Map) onLoad(key KeyT, value ValueT, ok bool) {
+	m.metrics.load(ok)
+	switch {
+	case ok && m.hooks.OnLoadHit != nil:
+		m.hooks.OnLoadHit(key, value)
+	case !ok && m.hooks.OnLoadMiss != nil:
+		m.hooks.OnLoadMiss(key)
+	}
+}
+
+// onLoadMany counts the loads of keys, loaded as values and ok by LoadMany,
+// and calls the load hooks, if any, for each of them.
+func (m *Map) onLoadMany(keys []KeyT, values []ValueT, ok []bool) {
+	if m.hooks.OnLoadHit == nil && m.hooks.OnLoadMiss == nil && !m.metrics.enabled() {
+		return
+	}
+	for i, k := range keys {
+		m.onLoad(k, values[i], ok[i])
+	}
+}
@@ -0,0 +1,8 @@
+// Package shared holds what the template packages have in common: the hash
+// and equality functions of keys, and the padding separating fields written
+// by different goroutines.
+//
+// A map generated from a template importing it has its own copy of the
+// files declaring the names the template uses, with those names unexported,
+// and the variant of each selected by the build tags of the map.
+package shared
@@ -0,0 +1,8 @@
+//go:build !syncmap_customkey
+
+package shared
+
+// EqualKey reports whether the keys a and b are equal.
+func EqualKey(a, b KeyT) bool {
+	return a == b
+}
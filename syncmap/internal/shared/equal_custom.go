@@ -0,0 +1,10 @@
+//go:build syncmap_customkey
+
+package shared
+
+// EqualKey reports whether the keys a and b are equal, according to the
+// equality function of keys given to the generator, which must agree with
+// the hash function: equal keys have equal hashes.
+func EqualKey(a, b KeyT) bool {
+	return equalKeyT(a, b)
+}
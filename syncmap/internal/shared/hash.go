@@ -0,0 +1,19 @@
+//go:build !syncmap_intkey && !syncmap_stringkey && !syncmap_customkey
+
+package shared
+
+import "hash/maphash"
+
+// HashSeed is the seed of the hashes of the keys of a map, which each map
+// picks when it's first used.
+type HashSeed = maphash.Seed
+
+// NewHashSeed returns a random seed.
+func NewHashSeed() HashSeed {
+	return maphash.MakeSeed()
+}
+
+// HashKey returns the hash of key with seed.
+func HashKey(seed HashSeed, key KeyT) uint64 {
+	return maphash.Comparable(seed, key)
+}
@@ -0,0 +1,20 @@
+//go:build syncmap_customkey
+
+package shared
+
+import "hash/maphash"
+
+// HashSeed is the seed of the hashes of the keys of a map, which each map
+// picks when it's first used.
+type HashSeed = maphash.Seed
+
+// NewHashSeed returns a random seed.
+func NewHashSeed() HashSeed {
+	return maphash.MakeSeed()
+}
+
+// HashKey returns the hash of key with seed, computed by the hash function
+// of keys given to the generator.
+func HashKey(seed HashSeed, key KeyT) uint64 {
+	return hashKeyT(seed, key)
+}
@@ -0,0 +1,29 @@
+//go:build syncmap_intkey
+
+package shared
+
+import "hash/maphash"
+
+// HashSeed is a random number mixed into the hash of each key of a map, so
+// that the hashes of keys chosen by an attacker can't be predicted. Each map
+// picks its own when it's first used.
+type HashSeed = uint64
+
+// NewHashSeed returns a random seed.
+func NewHashSeed() HashSeed {
+	return new(maphash.Hash).Sum64()
+}
+
+// HashKey returns the hash of key, an integer, mixed with seed by the
+// finalizer of MurmurHash3 rather than hashed by the generic path of
+// maphash.Comparable: a few multiplications, after which every bit of the
+// hash depends on every bit of key.
+func HashKey(seed HashSeed, key KeyT) uint64 {
+	x := uint64(key) ^ seed
+	x ^= x >> 33
+	x *= 0xff51afd7ed558ccd
+	x ^= x >> 33
+	x *= 0xc4ceb9fe1a85ec53
+	x ^= x >> 33
+	return x
+}
@@ -0,0 +1,88 @@
+//go:build syncmap_stringkey
+
+package shared
+
+import (
+	"hash/maphash"
+	"math/bits"
+)
+
+// HashSeed is a random number mixed into the hash of each key of a map, so
+// that the hashes of keys chosen by an attacker can't be predicted. Each map
+// picks its own when it's first used.
+type HashSeed = uint64
+
+// NewHashSeed returns a random seed.
+func NewHashSeed() HashSeed {
+	return new(maphash.Hash).Sum64()
+}
+
+// HashKey returns the hash of key, a string, with seed, computed by wyhash
+// rather than by the generic path of maphash.Comparable: it reads key 8 or
+// 16 bytes at a time, and mixes them with a 128-bit multiplication each.
+func HashKey(seed HashSeed, key KeyT) uint64 {
+	return wyhash(string(key), seed)
+}
+
+// The constants of wyhash, odd numbers with as many set bits as clear ones.
+const (
+	wyp0 = 0xa0761d6478bd642f
+	wyp1 = 0xe7037ed1a0b428db
+	wyp2 = 0x8ebc6af09c88c6e3
+	wyp3 = 0x589965cc75374cc3
+)
+
+// wyhash returns the hash of s with seed, as computed by the final version
+// of wyhash.
+func wyhash(s string, seed uint64) uint64 {
+	n := len(s)
+	seed ^= mix(seed^wyp0, wyp1)
+	var a, b uint64
+	switch {
+	case n >= 4 && n <= 16:
+		i := n >> 3 << 2
+		a = read32(s, 0)<<32 | read32(s, i)
+		b = read32(s, n-4)<<32 | read32(s, n-4-i)
+	case n > 0 && n < 4:
+		a = uint64(s[0])<<16 | uint64(s[n>>1])<<8 | uint64(s[n-1])
+	case n > 16:
+		p := s
+		if len(p) > 48 {
+			seed1, seed2 := seed, seed
+			for len(p) > 48 {
+				seed = mix(read64(p, 0)^wyp1, read64(p, 8)^seed)
+				seed1 = mix(read64(p, 16)^wyp2, read64(p, 24)^seed1)
+				seed2 = mix(read64(p, 32)^wyp3, read64(p, 40)^seed2)
+				p = p[48:]
+			}
+			seed ^= seed1 ^ seed2
+		}
+		for len(p) > 16 {
+			seed = mix(read64(p, 0)^wyp1, read64(p, 8)^seed)
+			p = p[16:]
+		}
+		// The last 16 bytes of s, which may overlap those read already.
+		a, b = read64(s, n-16), read64(s, n-8)
+	}
+	hi, lo := bits.Mul64(a^wyp1, b^seed)
+	return mix(lo^wyp0^uint64(n), hi^wyp1)
+}
+
+// mix returns the xor of the halves of the 128-bit product of a and b.
+func mix(a, b uint64) uint64 {
+	hi, lo := bits.Mul64(a, b)
+	return hi ^ lo
+}
+
+// read64 and read32 return the little-endian numbers at s[i:], which the
+// compiler loads at once.
+func read64(s string, i int) uint64 {
+	_ = s[i+7] // bounds check hint
+	return uint64(s[i]) | uint64(s[i+1])<<8 | uint64(s[i+2])<<16 | uint64(s[i+3])<<24 |
+		uint64(s[i+4])<<32 | uint64(s[i+5])<<40 | uint64(s[i+6])<<48 | uint64(s[i+7])<<56
+}
+
+func read32(s string, i int) uint64 {
+	_ = s[i+3] // bounds check hint
+	return uint64(s[i]) | uint64(s[i+1])<<8 | uint64(s[i+2])<<16 | uint64(s[i+3])<<24
+}
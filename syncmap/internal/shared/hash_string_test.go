@@ -0,0 +1,25 @@
+//go:build syncmap_stringkey
+
+package shared
+
+import "testing"
+
+func TestWyhash(t *testing.T) {
+	// The test vectors of the reference implementation.
+	for i, tt := range []struct {
+		s    string
+		want uint64
+	}{
+		{"", 0x0409638ee2bde459},
+		{"a", 0xa8412d091b5fe0a9},
+		{"abc", 0x32dd92e4b2915153},
+		{"message digest", 0x8619124089a3a16b},
+		{"abcdefghijklmnopqrstuvwxyz", 0x7a43afb61d7f5f40},
+		{"ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz0123456789", 0xff42329b90e50d58},
+		{"12345678901234567890123456789012345678901234567890123456789012345678901234567890", 0xc39cab13b115aad3},
+	} {
+		if got := wyhash(tt.s, uint64(i)); got != tt.want {
+			t.Errorf("wyhash(%q, %d) = %#x; want %#x", tt.s, i, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,8 @@
+//go:build !syncmap_padded
+
+package shared
+
+// CacheLinePad separates fields written by different goroutines, so that
+// they don't share a cache line. It takes no space unless the map is
+// generated with padding, which costs memory.
+type CacheLinePad struct{}
@@ -0,0 +1,10 @@
+//go:build syncmap_padded
+
+package shared
+
+// CacheLinePad separates fields written by different goroutines, so that
+// they don't share a cache line: writing one then doesn't invalidate the
+// other in the caches of the cores reading it. It is 128 bytes long, the
+// size of the cache lines of arm64 servers, and of the pairs of lines
+// prefetched together by amd64 processors.
+type CacheLinePad struct{ _ [128]byte }
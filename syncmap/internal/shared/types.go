@@ -0,0 +1,6 @@
+//go:build !syncmap_stringkey && !syncmap_customkey
+
+package shared
+
+// KeyT is a type for map's keys.
+type KeyT int64
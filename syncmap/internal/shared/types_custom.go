@@ -0,0 +1,22 @@
+//go:build syncmap_customkey
+
+package shared
+
+import (
+	"hash/maphash"
+	"strings"
+)
+
+// KeyT is a type for map's keys, a string compared regardless of case by
+// the variant of the template with custom hash and equality functions.
+type KeyT string
+
+// hashKeyT and equalKeyT are the hash and equality functions of keys, which
+// the generator replaces with those it's given.
+func hashKeyT(seed maphash.Seed, key KeyT) uint64 {
+	return maphash.String(seed, strings.ToLower(string(key)))
+}
+
+func equalKeyT(a, b KeyT) bool {
+	return strings.ToLower(string(a)) == strings.ToLower(string(b))
+}
@@ -0,0 +1,7 @@
+//go:build syncmap_stringkey
+
+package shared
+
+// KeyT is a type for map's keys, a string for the variant of the template
+// hashing strings with wyhash.
+type KeyT string
@@ -0,0 +1,29 @@
+//go:build go1.23
+
+package syncmap
+
+import "iter"
+
+// All returns an iterator over the keys and values present in the map.
+//
+// All has the same consistency guarantees as Range, and like Range it may
+// promote the dirty map when iteration starts.
+func (m *Map) All() iter.Seq2[KeyT, ValueT] {
+	return func(yield func(KeyT, ValueT) bool) {
+		m.Range(yield)
+	}
+}
+
+// KeysIter returns an iterator over the keys present in the map.
+func (m *Map) KeysIter() iter.Seq[KeyT] {
+	return func(yield func(KeyT) bool) {
+		m.RangeKeys(yield)
+	}
+}
+
+// ValuesIter returns an iterator over the values present in the map.
+func (m *Map) ValuesIter() iter.Seq[ValueT] {
+	return func(yield func(ValueT) bool) {
+		m.RangeValues(yield)
+	}
+}
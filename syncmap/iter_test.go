@@ -0,0 +1,45 @@
+//go:build go1.23 && !syncmap_ptrvalue
+
+package syncmap_test
+
+import (
+	"testing"
+
+	"github.com/cristaloleg/go-gen-syncmap/syncmap"
+)
+
+func TestAll(t *testing.T) {
+	const mapSize = 1 << 4
+
+	m := new(syncmap.Map)
+	for n := 0; n < mapSize; n++ {
+		m.Store(newKeyT(n), ValueT(n))
+	}
+
+	got := make(map[KeyT]ValueT)
+	for k, v := range m.All() {
+		got[k] = v
+	}
+	if len(got) != mapSize {
+		t.Fatalf("All visited %v entries; want %v", len(got), mapSize)
+	}
+
+	keys := 0
+	for k := range m.KeysIter() {
+		if _, ok := got[k]; !ok {
+			t.Fatalf("KeysIter yielded unexpected key %v", k)
+		}
+		keys++
+	}
+	values := 0
+	for range m.ValuesIter() {
+		values++
+	}
+	if keys != mapSize || values != mapSize {
+		t.Fatalf("KeysIter/ValuesIter yielded %v/%v elements; want %v", keys, values, mapSize)
+	}
+
+	for range m.All() {
+		break
+	}
+}
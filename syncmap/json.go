@@ -0,0 +1,78 @@
+package syncmap
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+)
+
+// MarshalJSON implements json.Marshaler by encoding a Snapshot of the map as
+// a JSON object.
+//
+// KeyT must be a string or integer type, or implement encoding.TextMarshaler,
+// to be usable as a JSON object key.
+func (m *Map) MarshalJSON() ([]byte, error) {
+	return json.Marshal(m.Snapshot())
+}
+
+// UnmarshalJSON implements json.Unmarshaler. It replaces the contents of the
+// map with the decoded JSON object.
+func (m *Map) UnmarshalJSON(data []byte) error {
+	var src map[KeyT]ValueT
+	if err := json.Unmarshal(data, &src); err != nil {
+		return err
+	}
+	m.reset(src)
+	return nil
+}
+
+// jsonLinesChunk is the number of records LoadJSONLines stores at once.
+const jsonLinesChunk = 1024
+
+// LoadJSONLines stores the records of r, a stream of JSON objects such as
+// {"key": k, "value": v}, one per line, as written by a JSON encoder, in
+// order, so the last value of a key passed more than once wins. It decodes
+// them in chunks, storing each chunk with StoreMany, so that warming a map up
+// from a file of gigabytes of records never holds more than a chunk of them
+// apart from the map.
+//
+// If progress isn't nil, LoadJSONLines calls it after storing each chunk,
+// and once at the end, with the number of records stored so far and of bytes
+// of r decoded. As with StoreMany, the values stored are counted, passed to
+// the OnStore hook of WithHooks, if any, and written to the backend of a map
+// generated with -backend. If a record can't be decoded, LoadJSONLines
+// returns its error, keeping the records stored before it.
+func (m *Map) LoadJSONLines(r io.Reader, progress func(records int, offset int64)) error {
+	m.loadReadOnly().checkWritable()
+	d := json.NewDecoder(r)
+	chunk := make(map[KeyT]ValueT, jsonLinesChunk)
+	n, records := 0, 0
+	flush := func() {
+		m.StoreMany(chunk)
+		chunk = make(map[KeyT]ValueT, jsonLinesChunk)
+		n += records
+		records = 0
+		if progress != nil {
+			progress(n, d.InputOffset())
+		}
+	}
+	for {
+		// Each record is decoded into a zeroed Pair, rather than over the
+		// previous one, whose pointers it would otherwise write through.
+		var p Pair
+		err := d.Decode(&p)
+		if err == io.EOF {
+			flush()
+			return nil
+		}
+		if err != nil {
+			m.StoreMany(chunk)
+			return fmt.Errorf("syncmap: record %d: %w", n+records+1, err)
+		}
+		chunk[p.Key] = p.Value
+		records++
+		if records == jsonLinesChunk {
+			flush()
+		}
+	}
+}
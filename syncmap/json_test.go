@@ -0,0 +1,57 @@
+package syncmap
+
+import (
+	"bytes"
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestLoadJSONLines(t *testing.T) {
+	var want Map
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	const n = jsonLinesChunk*2 + 10
+	for i := 0; i < n; i++ {
+		want.Store(newKeyT(i), newValueT(i))
+		if err := enc.Encode(Pair{newKeyT(i), newValueT(i)}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	size := int64(len(bytes.TrimRight(buf.Bytes(), "\n")))
+
+	stores := 0
+	m := New(WithHooks(Hooks{OnStore: func(KeyT, ValueT) { stores++ }}))
+	var calls []int
+	var offset int64
+	err := m.LoadJSONLines(&buf, func(records int, off int64) {
+		calls = append(calls, records)
+		offset = off
+	})
+	if err != nil {
+		t.Fatalf("LoadJSONLines: %v", err)
+	}
+	if got, want := m.Snapshot(), want.Snapshot(); !reflect.DeepEqual(got, want) {
+		t.Errorf("LoadJSONLines stored %v; want %v", got, want)
+	}
+	if want := []int{jsonLinesChunk, jsonLinesChunk * 2, n}; !reflect.DeepEqual(calls, want) {
+		t.Errorf("LoadJSONLines reported progress %v; want %v", calls, want)
+	}
+	if offset != size {
+		t.Errorf("LoadJSONLines reported offset %d at the end; want %d", offset, size)
+	}
+	if stores != n {
+		t.Errorf("LoadJSONLines called OnStore %d times; want %d", stores, n)
+	}
+
+	var partial Map
+	line, _ := json.Marshal(Pair{newKeyT(1), newValueT(1)})
+	err = partial.LoadJSONLines(strings.NewReader(string(line)+"\n{\"key\":"), nil)
+	if err == nil || !strings.Contains(err.Error(), "record 2") {
+		t.Errorf("LoadJSONLines of a truncated record returned %v; want an error of record 2", err)
+	}
+	if !partial.Contains(newKeyT(1)) {
+		t.Error("LoadJSONLines dropped the records before the one it failed to decode")
+	}
+}
@@ -0,0 +1,199 @@
+package syncmap
+
+import (
+	"fmt"
+	"math/rand"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+)
+
+// TestLinearizable records histories of concurrent operations on a Map and
+// checks that each is linearizable: that the operations could have taken
+// effect one at a time, each at some instant between its call and its
+// return, in an order a sequential map agrees with. Operations on distinct
+// keys don't interact, so the history of each key is checked on its own,
+// against a model of a single entry.
+func TestLinearizable(t *testing.T) {
+	const goroutines, keys = 4, 3
+	rounds, ops := 100, 40
+	if testing.Short() {
+		rounds = 10
+	}
+	values := make([]ValueT, goroutines*ops)
+	for i := range values {
+		values[i] = newValueT(i)
+	}
+	for round := 0; round < rounds; round++ {
+		var (
+			m       Map
+			clock   int64
+			wg      sync.WaitGroup
+			history = make([][]linearOp, goroutines)
+		)
+		for g := 0; g < goroutines; g++ {
+			wg.Add(1)
+			go func(g int, r *rand.Rand) {
+				defer wg.Done()
+				for i := 0; i < ops; i++ {
+					op := linearOp{kind: linearKind(r.Intn(5)), key: r.Intn(keys), in: g*ops + i}
+					k, v := newKeyT(op.key), values[op.in]
+					op.call = atomic.AddInt64(&clock, 1)
+					switch op.kind {
+					case linearLoad:
+						op.out, op.ok = m.Load(k)
+					case linearStore:
+						m.Store(k, v)
+					case linearLoadOrStore:
+						op.out, op.ok = m.LoadOrStore(k, v)
+					case linearSwap:
+						op.out, op.ok = m.Swap(k, v)
+					case linearDelete:
+						m.Delete(k)
+					}
+					op.ret = atomic.AddInt64(&clock, 1)
+					history[g] = append(history[g], op)
+				}
+			}(g, rand.New(rand.NewSource(int64(round*goroutines+g))))
+		}
+		wg.Wait()
+
+		byKey := make([][]linearOp, keys)
+		for _, h := range history {
+			for _, op := range h {
+				byKey[op.key] = append(byKey[op.key], op)
+			}
+		}
+		for key, h := range byKey {
+			if !linearizable(h, values) {
+				t.Fatalf("round %d: history of key %v isn't linearizable:\n%s", round, newKeyT(key), formatHistory(h, values))
+			}
+		}
+	}
+}
+
+type linearKind int
+
+const (
+	linearLoad linearKind = iota
+	linearStore
+	linearLoadOrStore
+	linearSwap
+	linearDelete
+)
+
+func (k linearKind) String() string {
+	return [...]string{"Load", "Store", "LoadOrStore", "Swap", "Delete"}[k]
+}
+
+// linearOp is an operation of a history: its kind, the index of its key and
+// of the value it stores, if any, what it returned, and the logical times
+// of its call and return.
+type linearOp struct {
+	kind      linearKind
+	key, in   int
+	out       ValueT
+	ok        bool
+	call, ret int64
+}
+
+// step applies op to the entry of a sequential map holding values[state],
+// or nothing if state is -1, and returns its next state, and whether op
+// returned what it would have.
+func (op *linearOp) step(state int, values []ValueT) (int, bool) {
+	holds := func(i int) bool {
+		return op.ok && reflect.DeepEqual(op.out, values[i])
+	}
+	switch op.kind {
+	case linearLoad:
+		if state < 0 {
+			return state, !op.ok
+		}
+		return state, holds(state)
+	case linearStore:
+		return op.in, true
+	case linearLoadOrStore:
+		if state < 0 {
+			return op.in, !op.ok && reflect.DeepEqual(op.out, values[op.in])
+		}
+		return state, holds(state)
+	case linearSwap:
+		if state < 0 {
+			return op.in, !op.ok
+		}
+		return op.in, holds(state)
+	}
+	return -1, true
+}
+
+// linearizable reports whether the history h of a single key is
+// linearizable, with the search of Wing and Gong: an operation can take
+// effect next if it was called before every remaining operation returned.
+// Pairs of operations done and states already explored are remembered.
+func linearizable(h []linearOp, values []ValueT) bool {
+	done := make([]bool, len(h))
+	seen := make(map[string]bool)
+	var search func(left, state int) bool
+	search = func(left, state int) bool {
+		if left == 0 {
+			return true
+		}
+		var b strings.Builder
+		for _, d := range done {
+			if d {
+				b.WriteByte('1')
+			} else {
+				b.WriteByte('0')
+			}
+		}
+		fmt.Fprintf(&b, ":%d", state)
+		if seen[b.String()] {
+			return false
+		}
+		seen[b.String()] = true
+
+		first := int64(1<<63 - 1)
+		for i := range h {
+			if !done[i] && h[i].ret < first {
+				first = h[i].ret
+			}
+		}
+		for i := range h {
+			if done[i] || h[i].call > first {
+				continue
+			}
+			next, ok := h[i].step(state, values)
+			if !ok {
+				continue
+			}
+			done[i] = true
+			if search(left-1, next) {
+				return true
+			}
+			done[i] = false
+		}
+		return false
+	}
+	return search(len(h), -1)
+}
+
+// formatHistory formats h in order of calls, for failures to show.
+func formatHistory(h []linearOp, values []ValueT) string {
+	h = append([]linearOp(nil), h...)
+	sort.Slice(h, func(i, j int) bool { return h[i].call < h[j].call })
+	var b strings.Builder
+	for _, op := range h {
+		fmt.Fprintf(&b, "\t[%d, %d] %v", op.call, op.ret, op.kind)
+		if op.kind != linearLoad && op.kind != linearDelete {
+			fmt.Fprintf(&b, "(%v)", values[op.in])
+		}
+		if op.kind != linearStore && op.kind != linearDelete {
+			fmt.Fprintf(&b, " = %v, %v", op.out, op.ok)
+		}
+		b.WriteString("\n")
+	}
+	return b.String()
+}
@@ -0,0 +1,305 @@
+//go:build syncmap_loader
+
+package syncmap
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"time"
+	"unsafe"
+)
+
+// This file holds the loading of maps generated with -loader, which fill the
+// keys loads miss by calling a loader, such as to cache the rows of a
+// database.
+
+// Loader returns the value of a key missing from the map, or an error, such
+// as ErrNotFound if the key doesn't exist.
+type Loader func(ctx context.Context, key KeyT) (ValueT, error)
+
+// ErrNotFound is returned by GetE for a missing key of a map without a
+// loader. Loaders return it too, wrapped or not, for keys that don't exist,
+// which WithNegativeTTL remembers.
+var ErrNotFound = errors.New("syncmap: key not found")
+
+// errLoaderPanicked is the error of the calls waiting for a loader that
+// panicked.
+var errLoaderPanicked = errors.New("syncmap: loader panicked")
+
+// loading is the state of the loader of a map.
+type loading struct {
+	load         Loader        // set by WithLoader, or nil
+	refreshAfter time.Duration // set by WithRefreshAfter, or 0
+	negativeTTL  time.Duration // set by WithNegativeTTL, or 0
+
+	mu sync.Mutex
+
+	// calls are the calls of load in flight, by key, and those that found
+	// their key missing, until their expiry.
+	calls map[KeyT]*call
+
+	// sweepAt is the number of calls from which the next one finding its
+	// key missing deletes those expired.
+	sweepAt int
+}
+
+// copy returns the configuration of l, for a clone of its map.
+func (l *loading) copy() loading {
+	return loading{load: l.load, refreshAfter: l.refreshAfter, negativeTTL: l.negativeTTL}
+}
+
+// loadTime is when the value of an entry was loaded, by now, or 0 if it
+// wasn't loaded by the loader, or is being refreshed.
+type loadTime struct {
+	at int64 // accessed atomically
+}
+
+// call is a call of the loader in flight, which the misses of its key
+// occurring meanwhile wait for rather than calling the loader again.
+type call struct {
+	done  chan struct{} // closed once value and err are set
+	value ValueT
+	err   error
+
+	// expires is when the result of a call finding its key missing, kept
+	// for WithNegativeTTL, expires, by now, or 0 if it isn't kept. It's
+	// guarded by the mutex of the calls.
+	expires int64
+}
+
+// expired reports whether c is the result of a call that found its key
+// missing, kept until an expiry that has passed.
+func (c *call) expired(now int64) bool {
+	return c.expires != 0 && now >= c.expires
+}
+
+// WithLoader makes the map call f to load the values of the keys that GetE
+// and Load miss, and store them. Concurrent misses of a key share a single
+// call of f.
+func WithLoader(f Loader) Option {
+	return func(m *Map) {
+		m.loader.load = f
+	}
+}
+
+// WithRefreshAfter makes the map refresh the values its loader loaded once
+// they're older than d: the first load of such a value calls the loader
+// again from a new goroutine, and stores the value it returns, while the
+// loads meanwhile return the old value. The keys in use are then refreshed
+// ahead of time, rather than all missing at once when their values expire.
+// If the loader fails, the old value is kept, and a later load tries again.
+// Values stored otherwise than by the loader aren't refreshed, and a d that
+// isn't positive refreshes none.
+func WithRefreshAfter(d time.Duration) Option {
+	return func(m *Map) {
+		m.loader.refreshAfter = d
+	}
+}
+
+// WithNegativeTTL makes the map remember for d that its loader found a key
+// missing, by returning ErrNotFound, so that GetE and Load calls for keys
+// that don't exist don't reach the loader again until then: GetE returns the
+// loader's error again, and Load reports the key missing. A key stored into
+// the map meanwhile is found, but once deleted, is reported missing until d
+// has passed. A d that isn't positive remembers nothing.
+func WithNegativeTTL(d time.Duration) Option {
+	return func(m *Map) {
+		m.loader.negativeTTL = d
+	}
+}
+
+// GetE returns the value for key, loading it with the loader set by
+// WithLoader if the map has none. If the loader fails, GetE returns its
+// error and stores nothing. A map without a loader returns ErrNotFound for a
+// missing key.
+//
+// While a value is being loaded, the misses of its key wait for it rather
+// than call the loader again. The loader is passed the ctx of the call that
+// started it; if it fails because ctx ended, the calls waiting for it whose
+// ctx is live start another. A call whose ctx ends while waiting returns
+// ctx.Err().
+func (m *Map) GetE(ctx context.Context, key KeyT) (value ValueT, err error) {
+	value, ok := m.lookup(key)
+	m.onLoad(key, value, ok)
+	if ok {
+		return value, nil
+	}
+	return m.fill(ctx, key)
+}
+
+// loadMissing loads the value of a key a Load missed, if the map has a
+// loader.
+func (m *Map) loadMissing(key KeyT) (value ValueT, ok bool) {
+	if m.loader.load == nil {
+		return value, false
+	}
+	value, err := m.fill(context.Background(), key)
+	return value, err == nil
+}
+
+// fill loads and stores the value of key, missing from the map, sharing the
+// call of the loader with the concurrent fills of key.
+func (m *Map) fill(ctx context.Context, key KeyT) (value ValueT, err error) {
+	l := &m.loader
+	if l.load == nil {
+		return value, ErrNotFound
+	}
+	for {
+		l.mu.Lock()
+		c, ok := l.calls[key]
+		if ok && c.expired(now()) {
+			delete(l.calls, key)
+			ok = false
+		}
+		if !ok {
+			c = &call{done: make(chan struct{})}
+			if l.calls == nil {
+				l.calls = make(map[KeyT]*call)
+			}
+			l.calls[key] = c
+			l.mu.Unlock()
+			m.runLoader(ctx, key, c)
+			return c.value, c.err
+		}
+		l.mu.Unlock()
+
+		select {
+		case <-c.done:
+		case <-ctx.Done():
+			return value, ctx.Err()
+		}
+		if ctx.Err() == nil && (errors.Is(c.err, context.Canceled) || errors.Is(c.err, context.DeadlineExceeded)) {
+			// The loader gave up on the ctx of another call.
+			continue
+		}
+		return c.value, c.err
+	}
+}
+
+// runLoader calls the loader for key, stores the value it returns unless the
+// key was stored meanwhile, and sets the result of c to the value left in
+// the map.
+func (m *Map) runLoader(ctx context.Context, key KeyT, c *call) {
+	defer func() {
+		if c.err != nil && !errors.Is(c.err, ErrNotFound) {
+			m.metrics.loaderError()
+		}
+		l := &m.loader
+		l.mu.Lock()
+		if l.negativeTTL > 0 && errors.Is(c.err, ErrNotFound) {
+			c.expires = now() + int64(l.negativeTTL)
+			l.sweepLocked()
+		} else {
+			delete(l.calls, key)
+		}
+		l.mu.Unlock()
+		close(c.done)
+	}()
+
+	c.err = errLoaderPanicked
+	value, err := m.callLoader(ctx, key)
+	if err != nil {
+		c.err = err
+		return
+	}
+	actual, loaded := m.loadOrStore(key, m.copied(value))
+	if !loaded {
+		m.stampLoaded(key)
+		m.notifyStore(key, actual)
+	}
+	c.value, c.err = actual, nil
+}
+
+// callLoader calls the loader for key, tracing and timing the call in maps
+// generated with -otel.
+func (m *Map) callLoader(ctx context.Context, key KeyT) (value ValueT, err error) {
+	ctx, span := m.telemetry.startLoad(ctx)
+	defer func() {
+		m.telemetry.endLoad(ctx, span, err)
+	}()
+	err = errLoaderPanicked
+	return m.loader.load(ctx, key)
+}
+
+// sweepLocked deletes the expired calls once their number doubled since the
+// last sweep, so that the keys found missing and never looked up again
+// don't pile up.
+func (l *loading) sweepLocked() {
+	if len(l.calls) < l.sweepAt {
+		return
+	}
+	t := now()
+	for k, c := range l.calls {
+		if c.expired(t) {
+			delete(l.calls, k)
+		}
+	}
+	l.sweepAt = 2 * len(l.calls)
+	if l.sweepAt < minSweep {
+		l.sweepAt = minSweep
+	}
+}
+
+// minSweep is the number of calls under which they're never swept.
+const minSweep = 64
+
+// stampLoaded records that the value of key was just loaded, if the map
+// refreshes its values.
+func (m *Map) stampLoaded(key KeyT) {
+	if m.loader.refreshAfter <= 0 {
+		return
+	}
+	read := m.loadReadOnly()
+	e, ok := read.m[key]
+	if !ok && read.amended {
+		m.mu.Lock()
+		read = m.loadReadOnly()
+		if e, ok = read.m[key]; !ok {
+			e, ok = m.dirty[key]
+		}
+		m.mu.Unlock()
+	}
+	if ok {
+		atomic.StoreInt64(&e.loaded.at, now())
+	}
+}
+
+// refreshIfStale starts refreshing the value of e, the entry of key, if the
+// loader loaded it longer ago than WithRefreshAfter allows.
+func (m *Map) refreshIfStale(key KeyT, e *entry) {
+	d := m.loader.refreshAfter
+	if d <= 0 {
+		return
+	}
+	at := atomic.LoadInt64(&e.loaded.at)
+	if at == 0 || now()-at < int64(d) || !atomic.CompareAndSwapInt64(&e.loaded.at, at, 0) {
+		return
+	}
+	if p := atomic.LoadPointer(&e.p); p != nil && p != expunged {
+		go m.refresh(key, e, p, at)
+	}
+}
+
+// refresh loads the value of key again, and replaces p, the value of its
+// entry e loaded at at, unless it has been replaced or deleted meanwhile.
+func (m *Map) refresh(key KeyT, e *entry, p unsafe.Pointer, at int64) {
+	value, err := m.callLoader(context.Background(), key)
+	if err != nil {
+		if !errors.Is(err, ErrNotFound) {
+			m.metrics.loaderError()
+		}
+		// Keep the old value, which the next load refreshes again.
+		atomic.StoreInt64(&e.loaded.at, at)
+		return
+	}
+	value = m.copied(value)
+	if !atomic.CompareAndSwapPointer(&e.p, p, boxValue(value)) {
+		return
+	}
+	atomic.StoreInt64(&e.loaded.at, now())
+	m.charge(e)
+	m.evictIfFull()
+	m.notifyStore(key, value)
+}
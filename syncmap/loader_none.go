@@ -0,0 +1,25 @@
+//go:build !syncmap_loader
+
+package syncmap
+
+// loading is the state of the loader of maps generated with -loader.
+type loading struct{}
+
+// copy returns the configuration of l, for a clone of its map.
+func (l *loading) copy() loading {
+	return loading{}
+}
+
+// loadTime is when the value of an entry was loaded, in maps generated with
+// -loader.
+type loadTime struct{}
+
+// refreshIfStale refreshes the value of the entry e for key, which only
+// maps generated with -loader do.
+func (m *Map) refreshIfStale(key KeyT, e *entry) {}
+
+// loadMissing loads the value of a key a Load missed, which only maps
+// generated with -loader do.
+func (m *Map) loadMissing(key KeyT) (value ValueT, ok bool) {
+	return value, false
+}
@@ -0,0 +1,199 @@
+//go:build syncmap_loader
+
+package syncmap
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"runtime"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestGetE(t *testing.T) {
+	errMissing := errors.New("missing")
+	var calls int32
+	m := New(WithLoader(func(ctx context.Context, k KeyT) (ValueT, error) {
+		atomic.AddInt32(&calls, 1)
+		if k == newKeyT(0) {
+			var zero ValueT
+			return zero, errMissing
+		}
+		return newValueT(1), nil
+	}))
+	ctx := context.Background()
+
+	if v, err := m.GetE(ctx, newKeyT(1)); err != nil || !reflect.DeepEqual(v, newValueT(1)) {
+		t.Errorf("GetE of a missing key = %v, %v; want %v, nil", v, err, newValueT(1))
+	}
+	if v, err := m.GetE(ctx, newKeyT(1)); err != nil || !reflect.DeepEqual(v, newValueT(1)) || calls != 1 {
+		t.Errorf("GetE of a loaded key = %v, %v after %d calls; want %v, nil after 1", v, err, calls, newValueT(1))
+	}
+	if _, err := m.GetE(ctx, newKeyT(0)); err != errMissing {
+		t.Errorf("GetE of a key failing to load returned error %v; want %v", err, errMissing)
+	}
+	if m.Contains(newKeyT(0)) {
+		t.Error("GetE stored the value of a key failing to load")
+	}
+	if v, ok := m.Load(newKeyT(2)); !ok || !reflect.DeepEqual(v, newValueT(1)) {
+		t.Errorf("Load of a missing key = %v, %v; want %v, true", v, ok, newValueT(1))
+	}
+	if _, ok := m.Load(newKeyT(0)); ok {
+		t.Error("Load of a key failing to load found it")
+	}
+	if m.Contains(newKeyT(3)) || calls != 4 {
+		t.Errorf("Contains called the loader")
+	}
+
+	var u Map
+	if _, err := u.GetE(ctx, newKeyT(0)); err != ErrNotFound {
+		t.Errorf("GetE of a map without loader returned error %v; want %v", err, ErrNotFound)
+	}
+}
+
+func TestGetESingleflight(t *testing.T) {
+	const goroutines = 16
+	var (
+		calls   int32
+		release = make(chan struct{})
+		wg      sync.WaitGroup
+	)
+	m := New(WithLoader(func(ctx context.Context, k KeyT) (ValueT, error) {
+		atomic.AddInt32(&calls, 1)
+		<-release
+		return newValueT(1), nil
+	}))
+	for i := 0; i < goroutines; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if v, err := m.GetE(context.Background(), newKeyT(1)); err != nil || !reflect.DeepEqual(v, newValueT(1)) {
+				t.Errorf("GetE = %v, %v; want %v, nil", v, err, newValueT(1))
+			}
+		}()
+	}
+	// Wait for the first call to start; the others may still be on their way.
+	for atomic.LoadInt32(&calls) == 0 {
+		runtime.Gosched()
+	}
+	close(release)
+	wg.Wait()
+	// The goroutines that missed the key after the load returned found it.
+	if calls != 1 {
+		t.Errorf("%d goroutines missing a key called the loader %d times; want 1", goroutines, calls)
+	}
+
+	// A waiting call whose ctx ends returns, while the load goes on.
+	block := make(chan struct{})
+	m = New(WithLoader(func(ctx context.Context, k KeyT) (ValueT, error) {
+		<-block
+		return newValueT(2), nil
+	}))
+	started := make(chan struct{})
+	go func() {
+		close(started)
+		m.GetE(context.Background(), newKeyT(2))
+	}()
+	<-started
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := m.GetE(ctx, newKeyT(2)); err != context.Canceled {
+		t.Errorf("GetE with a canceled ctx returned error %v; want %v", err, context.Canceled)
+	}
+	close(block)
+}
+
+func TestWithRefreshAfter(t *testing.T) {
+	const age = 20 * time.Millisecond
+	var calls, fail int32
+	m := New(WithRefreshAfter(age), WithLoader(func(ctx context.Context, k KeyT) (ValueT, error) {
+		atomic.AddInt32(&calls, 1)
+		if atomic.LoadInt32(&fail) != 0 {
+			var zero ValueT
+			return zero, errors.New("unavailable")
+		}
+		return newValueT(1), nil
+	}))
+	// loadUntil loads key 0, whose stale value is served meanwhile, until the
+	// loader has been called n times.
+	loadUntil := func(n int32) {
+		t.Helper()
+		for deadline := time.Now().Add(time.Second); atomic.LoadInt32(&calls) < n; time.Sleep(time.Millisecond) {
+			if _, ok := m.Load(newKeyT(0)); !ok {
+				t.Fatal("Load of a stale key found no value")
+			}
+			if time.Now().After(deadline) {
+				t.Fatalf("the loader was called %d times in a second; want %d", atomic.LoadInt32(&calls), n)
+			}
+		}
+	}
+	m.Load(newKeyT(0))
+	m.Store(newKeyT(1), newValueT(1))
+	time.Sleep(2 * age)
+
+	atomic.StoreInt32(&fail, 1)
+	loadUntil(2)
+	// The refresh failed, so a later load refreshes the value again.
+	atomic.StoreInt32(&fail, 0)
+	loadUntil(3)
+	// Once refreshed, the value isn't refreshed again until it's stale.
+	for i := 0; i < 10; i++ {
+		m.Load(newKeyT(0))
+	}
+	if n := atomic.LoadInt32(&calls); n != 3 {
+		t.Errorf("the loader was called %d times; want 3", n)
+	}
+
+	// Stored values aren't refreshed.
+	m.Load(newKeyT(1))
+	time.Sleep(age)
+	if n := atomic.LoadInt32(&calls); n != 3 {
+		t.Errorf("Load of a stored key called the loader")
+	}
+}
+
+func TestWithNegativeTTL(t *testing.T) {
+	const ttl = 20 * time.Millisecond
+	var calls int32
+	m := New(WithNegativeTTL(ttl), WithLoader(func(ctx context.Context, k KeyT) (ValueT, error) {
+		atomic.AddInt32(&calls, 1)
+		var zero ValueT
+		return zero, fmt.Errorf("loading %v: %w", k, ErrNotFound)
+	}))
+	ctx := context.Background()
+	for i := 0; i < 3; i++ {
+		if _, err := m.GetE(ctx, newKeyT(0)); !errors.Is(err, ErrNotFound) {
+			t.Errorf("GetE of a key not found returned error %v; want %v", err, ErrNotFound)
+		}
+		if _, ok := m.Load(newKeyT(0)); ok {
+			t.Errorf("Load of a key not found found it")
+		}
+	}
+	if calls != 1 {
+		t.Errorf("the loader was called %d times for a key not found; want 1", calls)
+	}
+	m.Store(newKeyT(0), newValueT(0))
+	if _, err := m.GetE(ctx, newKeyT(0)); err != nil {
+		t.Errorf("GetE of a key stored after it wasn't found returned error %v", err)
+	}
+	m.Delete(newKeyT(0))
+	time.Sleep(ttl)
+	if m.GetE(ctx, newKeyT(0)); calls != 2 {
+		t.Errorf("the loader was called %d times after the negative TTL; want 2", calls)
+	}
+
+	// The keys found missing don't pile up.
+	for i := 0; i < 1000; i++ {
+		m.GetE(ctx, newKeyT(i))
+		if i == 500 {
+			time.Sleep(ttl)
+		}
+	}
+	if n := len(m.loader.calls); n > 2*500 {
+		t.Errorf("%d keys found missing are remembered; want at most %d", n, 2*500)
+	}
+}
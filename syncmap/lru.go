@@ -0,0 +1,154 @@
+//go:build syncmap_lru
+
+package syncmap
+
+import "sync/atomic"
+
+// This file holds the eviction of maps generated with -maxentries, which
+// hold a bounded number of entries and evict some to make room for new keys.
+//
+// Rather than keeping a list of the entries in order of use, which every load
+// would have to lock to move its entry to the front, the map has a clock,
+// ticking at every write, and loads stamp the entries they
+// find with it, atomically and only if the stamp changed. Eviction scores a
+// few entries sampled from the map, under its lock, and evicts the one the
+// policy scores highest: by default the least recently used, which
+// approximates LRU as Redis does, while loads never lock.
+
+// maxEntries bounds the maps not given WithMaxEntries. It's a variable so
+// that the tests, which store more keys than the maps they're generated for
+// may hold, can lift the bound.
+var maxEntries = maxEntriesT
+
+// evictionSamples is the number of entries compared to evict one.
+const evictionSamples = 5
+
+// eviction is the state of the eviction of a map.
+type eviction struct {
+	budget costs  // first, to be 64-bit aligned on 32-bit platforms
+	clock  uint32 // ticks at every write; accessed atomically
+	max    int    // set by WithMaxEntries, or 0 for maxEntries
+	policy policy
+}
+
+// copy returns the configuration of l, for a clone of its map.
+func (l *eviction) copy() eviction {
+	return eviction{budget: l.budget.copy(), max: l.max}
+}
+
+// recency is when an entry was last used, by the clock of its map, and the
+// cost its value was charged.
+type recency struct {
+	charged charged // first, to be 64-bit aligned on 32-bit platforms
+	used    uint32  // accessed atomically
+}
+
+// WithMaxEntries makes the map hold at most n entries, rather than the
+// number it was generated with: inserting a key into a full map evicts
+// entries to make room for it. An n that isn't positive makes the map
+// unbounded.
+func WithMaxEntries(n int) Option {
+	return func(m *Map) {
+		if n <= 0 {
+			n = -1
+		}
+		m.lru.max = n
+	}
+}
+
+// limit returns the bound of the map, or a number not greater than 0 if it
+// has none.
+func (m *Map) limit() int {
+	if m.lru.max != 0 {
+		return m.lru.max
+	}
+	return maxEntries
+}
+
+// stamp records that e was used now.
+func (m *Map) stamp(e *entry) {
+	if now := atomic.LoadUint32(&m.lru.clock); atomic.LoadUint32(&e.recency.used) != now {
+		atomic.StoreUint32(&e.recency.used, now)
+	}
+}
+
+// age returns the number of ticks since e was used. The clock wraps around,
+// but ages don't as long as no entry goes unused for 2³¹ insertions. Entries
+// used since now was loaded have negative ages.
+func age(e *entry, now uint32) int32 {
+	return int32(now - atomic.LoadUint32(&e.recency.used))
+}
+
+// full reports whether the map holds more entries than limit, if it's
+// positive, or costs more than its budget.
+func (m *Map) full(count *int64, limit int) bool {
+	return (limit > 0 && atomic.LoadInt64(count) > int64(limit)) || m.overBudget()
+}
+
+// admit evicts entries, after key was inserted, until the map holds no more
+// than its bound. The policy may reject key, which is then evicted first.
+func (m *Map) admit(key KeyT) {
+	m.evict(&key)
+}
+
+// evictIfFull evicts entries, after several keys may have been inserted or
+// values replaced, until the map holds no more than its bound.
+func (m *Map) evictIfFull() {
+	m.evict(nil)
+}
+
+// evict ticks the clock after a write, and evicts entries until the map holds
+// no more than its bound, and costs no more than its budget: of
+// evictionSamples live entries, the one the policy scores highest is deleted,
+// unless the policy rejects the inserted key, if any, in its favour. Expired
+// values are deleted first. The samples are consecutive entries of an
+// iteration over the map, which starts at a random one.
+func (m *Map) evict(added *KeyT) {
+	atomic.AddUint32(&m.lru.clock, 1)
+	limit := m.limit()
+	read := m.loadReadOnly()
+	if !m.full(m.counter(read), limit) {
+		return
+	}
+
+	m.mu.Lock()
+	read = m.loadReadOnly()
+	count := m.counter(read)
+	src := m.entriesLocked(read)
+	for m.full(count, limit) {
+		var (
+			now       = atomic.LoadUint32(&m.lru.clock)
+			victim    *entry
+			victimKey KeyT
+			score     int64
+			n         int
+		)
+		for k, e := range src {
+			m.expire(k, e, read)
+			if p := atomic.LoadPointer(&e.p); p == nil || p == expunged {
+				continue
+			}
+			if s := m.score(k, e, now, limit); victim == nil || s > score {
+				victim, victimKey, score = e, k, s
+			}
+			if n++; n == evictionSamples {
+				break
+			}
+		}
+		if victim == nil {
+			break
+		}
+		if added != nil {
+			if e, ok := src[*added]; ok && e != victim && m.rejects(*added, victimKey) {
+				victim = e
+			}
+			added = nil
+		}
+		if p := victim.take(); p != nil {
+			atomic.AddInt64(count, -1)
+			m.charge(victim)
+			m.evicted(victimKey, p, ReasonEvicted)
+		}
+	}
+	m.mu.Unlock()
+}
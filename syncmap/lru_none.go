@@ -0,0 +1,26 @@
+//go:build !syncmap_lru
+
+package syncmap
+
+// eviction is the state of the eviction of maps generated with -maxentries.
+type eviction struct{}
+
+// copy returns the configuration of l, for a clone of its map.
+func (l *eviction) copy() eviction {
+	return eviction{}
+}
+
+// recency is when an entry of a map generated with -maxentries was last used.
+type recency struct{}
+
+// touch records that the entry e for key was used, which only maps
+// generated with -maxentries track.
+func (m *Map) touch(key KeyT, e *entry) {}
+
+// admit evicts entries after key was inserted into maps generated with
+// -maxentries.
+func (m *Map) admit(key KeyT) {}
+
+// evictIfFull evicts entries after several keys may have been inserted into
+// maps generated with -maxentries.
+func (m *Map) evictIfFull() {}
@@ -0,0 +1,26 @@
+//go:build syncmap_lru && !syncmap_tinylfu
+
+package syncmap
+
+// This file holds the default eviction policy of maps generated with
+// -maxentries, which evicts the entries used least recently.
+
+// policy is the state of the eviction policy, which LRU doesn't need.
+type policy struct{}
+
+// touch records that the entry e for key was used.
+func (m *Map) touch(key KeyT, e *entry) {
+	m.stamp(e)
+}
+
+// score returns the score of the entry e for key, of which the highest of
+// those sampled is evicted: its age.
+func (m *Map) score(key KeyT, e *entry, now uint32, limit int) int64 {
+	return int64(age(e, now))
+}
+
+// rejects reports whether the newly inserted key should be evicted rather
+// than the victim, which LRU never does.
+func (m *Map) rejects(key, victim KeyT) bool {
+	return false
+}
@@ -0,0 +1,115 @@
+//go:build syncmap_lru
+
+package syncmap
+
+import (
+	"math/rand"
+	"reflect"
+	"testing"
+)
+
+func init() {
+	// The other tests store up to 10000 keys, more than the maps they're
+	// generated for may hold, so the maps of the tests are unbounded unless
+	// given WithMaxEntries.
+	maxEntries = 0
+}
+
+func TestWithMaxEntries(t *testing.T) {
+	m := New(WithMaxEntries(4))
+	for i := 0; i < 4; i++ {
+		m.Store(newKeyT(i), newValueT(i))
+	}
+	for i := 0; i < 3; i++ {
+		m.Load(newKeyT(i))
+	}
+	// The map holds fewer entries than evictionSamples, so all of them are
+	// compared, and the one not loaded is evicted.
+	m.Store(newKeyT(4), newValueT(4))
+	if n := m.Len(); n != 4 {
+		t.Errorf("Len() = %d; want 4", n)
+	}
+	if _, ok := m.Load(newKeyT(3)); ok {
+		t.Errorf("Load(3) found the least recently used key")
+	}
+	for _, i := range []int{0, 1, 2, 4} {
+		if _, ok := m.Load(newKeyT(i)); !ok {
+			t.Errorf("Load(%v) didn't find a recently used key", newKeyT(i))
+		}
+	}
+
+	for i := 0; i < 1000; i++ {
+		if _, loaded := m.LoadOrStore(newKeyT(i), newValueT(i)); !loaded && m.Len() > 4 {
+			t.Fatalf("Len() = %d after LoadOrStore(%d); want at most 4", m.Len(), i)
+		}
+	}
+	c := m.Clone()
+	var pairs []Pair
+	for i := 5; i < 10; i++ {
+		pairs = append(pairs, Pair{newKeyT(i), newValueT(i)})
+	}
+	c.LoadBulk(pairs)
+	if n := c.Len(); n != 4 {
+		t.Errorf("Len() of a clone = %d after LoadBulk; want 4", n)
+	}
+}
+
+func TestWithOnEvictEvicted(t *testing.T) {
+	var evicted []KeyT
+	m := New(WithMaxEntries(2), WithOnEvict(func(k KeyT, v ValueT, reason Reason) {
+		if reason != ReasonEvicted {
+			t.Errorf("WithOnEvict called for %v with reason %v; want %v", k, reason, ReasonEvicted)
+		}
+		evicted = append(evicted, k)
+	}))
+	for i := 0; i < 3; i++ {
+		m.Store(newKeyT(i), newValueT(i))
+	}
+	if !reflect.DeepEqual(evicted, []KeyT{newKeyT(0)}) {
+		t.Errorf("evicted %v; want [%v]", evicted, newKeyT(0))
+	}
+}
+
+func TestMaxEntries(t *testing.T) {
+	defer func(n int) { maxEntries = n }(maxEntries)
+	maxEntries = 16
+
+	var m Map
+	for i := 0; i < 100; i++ {
+		m.Store(newKeyT(i), newValueT(i))
+	}
+	if n := m.Len(); n != 16 {
+		t.Errorf("Len() of the zero Map = %d; want 16", n)
+	}
+	u := New(WithMaxEntries(0))
+	for i := 0; i < 100; i++ {
+		u.Store(newKeyT(i), newValueT(i))
+	}
+	if n := u.Len(); n != 100 {
+		t.Errorf("Len() with WithMaxEntries(0) = %d; want 100", n)
+	}
+}
+
+// BenchmarkHitRatio reports the share of loads that hit a bounded map, for a
+// skewed workload interleaved with a scan of keys never used again, which
+// compares the eviction policies by how well they cache rather than how fast.
+func BenchmarkHitRatio(b *testing.B) {
+	const size = 1000
+	m := New(WithMaxEntries(size))
+	zipf := rand.NewZipf(rand.New(rand.NewSource(1)), 1.1, 1, 100*size)
+	hits, scanned := 0, 0
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		k := int(zipf.Uint64())
+		if i%4 == 3 {
+			scanned++
+			k = 100*size + scanned
+		}
+		if _, ok := m.Load(newKeyT(k)); ok {
+			hits++
+		} else {
+			m.Store(newKeyT(k), newValueT(k))
+		}
+	}
+	b.ReportMetric(100*float64(hits)/float64(b.N), "hit%")
+}
@@ -0,0 +1,156 @@
+//go:build syncmap_lru && syncmap_tinylfu
+
+package syncmap
+
+import (
+	"hash/maphash"
+	"math/bits"
+	"sync/atomic"
+)
+
+// This file holds the TinyLFU eviction policy of maps generated with
+// -maxentries and -eviction=tinylfu, which resists scans: a sketch estimates
+// how often each key was used recently, eviction deletes the entries used
+// least often, and a new key is only admitted into a full map if it was
+// used at least as often as the entry it would replace. Entries used within
+// the last hundredth of the map's bound of insertions form a window that
+// isn't evicted, so that new keys get a chance to be used again.
+//
+// Every use of a key increments its counters in the sketch, without locking,
+// but writing memory shared by all cores, which makes loads slower than with
+// LRU.
+
+// policy is the state of the eviction policy: the sketch, allocated on first
+// use for the bound of the map.
+type policy struct {
+	sketch atomic.Pointer[sketch]
+}
+
+// touch records that the entry e for key was used.
+func (m *Map) touch(key KeyT, e *entry) {
+	m.stamp(e)
+	if s := m.sketch(); s != nil {
+		s.add(key)
+	}
+}
+
+// sketch returns the sketch of the map, or nil if its number of entries is
+// unbounded, which leaves nothing to size the sketch for: the map then
+// evicts by LRU.
+func (m *Map) sketch() *sketch {
+	if s := m.lru.policy.sketch.Load(); s != nil {
+		return s
+	}
+	limit := m.limit()
+	if limit <= 0 {
+		return nil
+	}
+	m.lru.policy.sketch.CompareAndSwap(nil, newSketch(limit))
+	return m.lru.policy.sketch.Load()
+}
+
+// score returns the score of the entry e for key, of which the highest of
+// those sampled is evicted: entries in the window score lowest, and the
+// others by how rarely they were used, and then by their age.
+func (m *Map) score(key KeyT, e *entry, now uint32, limit int) int64 {
+	a := age(e, now)
+	s := m.sketch()
+	if s == nil {
+		return int64(a)
+	}
+	if window := limit/100 + 1; a < int32(window) {
+		return int64(a) - 1<<40
+	}
+	return int64(maxCount-s.estimate(key))<<32 | int64(a)
+}
+
+// rejects reports whether the newly inserted key should be evicted rather
+// than the victim: if it was used less often.
+func (m *Map) rejects(key, victim KeyT) bool {
+	s := m.sketch()
+	return s != nil && s.estimate(key) < s.estimate(victim)
+}
+
+// maxCount is the greatest count of a key in a sketch.
+const maxCount = 15
+
+// sketchDepth is the number of counters of a key in a sketch.
+const sketchDepth = 4
+
+// A sketch is a count-min sketch of the uses of keys: each increments
+// sketchDepth 4-bit counters of its hash, 16 of which fit in a word, and
+// the least of them estimates how often it was used. Once there have been
+// ten times as many uses as the map holds entries, every counter is halved,
+// so that the sketch forgets keys no longer used.
+type sketch struct {
+	seed    maphash.Seed
+	words   []uint64 // accessed atomically
+	mask    uint64   // len(words) - 1
+	adds    uint64   // accessed atomically
+	resetAt uint64
+}
+
+// newSketch returns a sketch for a map of limit entries, with a word of
+// counters per entry, as Caffeine's, so that the keys used once in between
+// halvings don't make those of the map look used often.
+func newSketch(limit int) *sketch {
+	n := 1 << bits.Len(uint(limit-1))
+	if n < 16 {
+		n = 16
+	}
+	return &sketch{
+		seed:    maphash.MakeSeed(),
+		words:   make([]uint64, n),
+		mask:    uint64(n - 1),
+		resetAt: 10 * uint64(limit),
+	}
+}
+
+// counter returns the word and shift of the i-th counter of the hash h.
+func (s *sketch) counter(h uint64, i int) (*uint64, uint) {
+	h = bits.RotateLeft64(h, 16*i) * 0x9e3779b97f4a7c15
+	return &s.words[(h>>4)&s.mask], uint(h&15) * 4
+}
+
+// add records a use of key.
+func (s *sketch) add(key KeyT) {
+	h := maphash.Comparable(s.seed, key)
+	for i := 0; i < sketchDepth; i++ {
+		w, shift := s.counter(h, i)
+		for {
+			old := atomic.LoadUint64(w)
+			if old>>shift&maxCount == maxCount || atomic.CompareAndSwapUint64(w, old, old+1<<shift) {
+				break
+			}
+		}
+	}
+	if atomic.AddUint64(&s.adds, 1)%s.resetAt == 0 {
+		s.halve()
+	}
+}
+
+// halve halves every counter.
+func (s *sketch) halve() {
+	for i := range s.words {
+		w := &s.words[i]
+		for {
+			old := atomic.LoadUint64(w)
+			if atomic.CompareAndSwapUint64(w, old, old>>1&0x7777777777777777) {
+				break
+			}
+		}
+	}
+}
+
+// estimate returns how often key was used, at most maxCount.
+func (s *sketch) estimate(key KeyT) int64 {
+	h := maphash.Comparable(s.seed, key)
+	least := uint64(maxCount)
+	for i := 0; i < sketchDepth; i++ {
+		w, shift := s.counter(h, i)
+		if c := atomic.LoadUint64(w) >> shift & maxCount; c < least {
+			least = c
+		}
+	}
+	return int64(least)
+}
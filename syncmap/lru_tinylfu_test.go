@@ -0,0 +1,55 @@
+//go:build syncmap_lru && syncmap_tinylfu
+
+package syncmap
+
+import "testing"
+
+func TestTinyLFUResistsScans(t *testing.T) {
+	const hot = 50
+	m := New(WithMaxEntries(2 * hot))
+	for i := 0; i < hot; i++ {
+		m.Store(newKeyT(i), newValueT(i))
+		for j := 0; j < 5; j++ {
+			m.Load(newKeyT(i))
+		}
+	}
+	// A scan of keys used once, during which each frequently used key is only
+	// used every 200 insertions, twice as many as the map holds, would flush
+	// an LRU map.
+	for i := hot; i < 100*hot; i++ {
+		m.Store(newKeyT(i), newValueT(i))
+		if i%4 == 0 {
+			m.Load(newKeyT(i / 4 % hot))
+		}
+	}
+	kept := 0
+	for i := 0; i < hot; i++ {
+		if _, ok := m.Load(newKeyT(i)); ok {
+			kept++
+		}
+	}
+	if kept < hot*9/10 {
+		t.Errorf("%d of %d frequently used keys survived a scan; want at least %d", kept, hot, hot*9/10)
+	}
+	if n := m.Len(); n > 2*hot {
+		t.Errorf("Len() = %d; want at most %d", n, 2*hot)
+	}
+}
+
+func TestSketch(t *testing.T) {
+	s := newSketch(100)
+	for i := 0; i < 10; i++ {
+		s.add(newKeyT(1))
+	}
+	s.add(newKeyT(2))
+	if c := s.estimate(newKeyT(1)); c < 10 {
+		t.Errorf("estimate of a key added 10 times = %d", c)
+	}
+	if a, b := s.estimate(newKeyT(2)), s.estimate(newKeyT(3)); a < 1 || a > b+1 {
+		t.Errorf("estimates of keys added once and never = %d, %d", a, b)
+	}
+	s.halve()
+	if c := s.estimate(newKeyT(1)); c < 5 || c > 7 {
+		t.Errorf("estimate of a key added 10 times after halving = %d; want about 5", c)
+	}
+}
@@ -0,0 +1,111 @@
+//go:build syncmap_metrics
+
+package syncmap
+
+import "sync/atomic"
+
+// This file holds the counters of maps generated with -metrics, which count
+// the operations on them without a wrapper, such as to export cache hit
+// rates.
+
+// Metrics are the numbers of operations on a Map since it was created, as
+// counted by maps generated with -metrics. Counting costs an atomic addition
+// per operation, on a counter shared by all the goroutines using the map.
+type Metrics struct {
+	// Hits is the number of keys loads found, as reported to the OnLoadHit
+	// hook of WithHooks.
+	Hits int64
+
+	// Misses is the number of keys loads didn't find, as reported to the
+	// OnLoadMiss hook.
+	Misses int64
+
+	// Stores is the number of values stored, as reported to the OnStore
+	// hook.
+	Stores int64
+
+	// Deletes is the number of values deleted, as reported to the OnDelete
+	// hook.
+	Deletes int64
+
+	// Evictions is the number of entries evicted to make room for others,
+	// in maps generated with -maxentries or -maxcost.
+	Evictions int64
+
+	// Expirations is the number of values removed once their TTL passed, in
+	// maps generated with -ttl. Clear doesn't count the expired values it
+	// removes.
+	Expirations int64
+
+	// LoaderErrors is the number of calls of the loader that failed, in maps
+	// generated with -loader, including refreshes but not the keys it
+	// reported missing with ErrNotFound.
+	LoaderErrors int64
+}
+
+// counters are the counters of a map, accessed atomically.
+type counters struct {
+	hits         int64
+	misses       int64
+	stores       int64
+	deletes      int64
+	evictions    int64
+	expirations  int64
+	loaderErrors int64
+}
+
+// Metrics returns the numbers of operations on the map. Each is read
+// atomically, but operations running meanwhile may be counted by some of
+// them and not yet by others. The counters of a clone start at 0.
+func (m *Map) Metrics() Metrics {
+	c := &m.metrics
+	return Metrics{
+		Hits:         atomic.LoadInt64(&c.hits),
+		Misses:       atomic.LoadInt64(&c.misses),
+		Stores:       atomic.LoadInt64(&c.stores),
+		Deletes:      atomic.LoadInt64(&c.deletes),
+		Evictions:    atomic.LoadInt64(&c.evictions),
+		Expirations:  atomic.LoadInt64(&c.expirations),
+		LoaderErrors: atomic.LoadInt64(&c.loaderErrors),
+	}
+}
+
+// enabled reports whether the map counts its operations.
+func (c *counters) enabled() bool {
+	return true
+}
+
+// load counts a load that found its key if ok, and one that missed it
+// otherwise.
+func (c *counters) load(ok bool) {
+	if ok {
+		atomic.AddInt64(&c.hits, 1)
+	} else {
+		atomic.AddInt64(&c.misses, 1)
+	}
+}
+
+// store counts n values stored.
+func (c *counters) store(n int) {
+	atomic.AddInt64(&c.stores, int64(n))
+}
+
+// delete counts a value deleted.
+func (c *counters) delete() {
+	atomic.AddInt64(&c.deletes, 1)
+}
+
+// evict counts an entry the map removed for reason.
+func (c *counters) evict(reason Reason) {
+	switch reason {
+	case ReasonEvicted:
+		atomic.AddInt64(&c.evictions, 1)
+	case ReasonExpired:
+		atomic.AddInt64(&c.expirations, 1)
+	}
+}
+
+// loaderError counts a failed call of the loader.
+func (c *counters) loaderError() {
+	atomic.AddInt64(&c.loaderErrors, 1)
+}
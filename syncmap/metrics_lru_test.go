@@ -0,0 +1,15 @@
+//go:build syncmap_metrics && syncmap_lru
+
+package syncmap
+
+import "testing"
+
+func TestMetricsEvictions(t *testing.T) {
+	m := New(WithMaxEntries(2))
+	for i := 0; i < 5; i++ {
+		m.Store(newKeyT(i), newValueT(i))
+	}
+	if got := m.Metrics(); got.Stores != 5 || got.Evictions != 3 {
+		t.Errorf("Metrics() = %+v; want 5 stores and 3 evictions", got)
+	}
+}
@@ -0,0 +1,20 @@
+//go:build !syncmap_metrics
+
+package syncmap
+
+// counters are the counters of maps generated with -metrics.
+type counters struct{}
+
+// enabled reports whether the map counts its operations, which only maps
+// generated with -metrics do.
+func (c *counters) enabled() bool {
+	return false
+}
+
+// The counting methods do nothing.
+
+func (c *counters) load(ok bool)        {}
+func (c *counters) store(n int)         {}
+func (c *counters) delete()             {}
+func (c *counters) evict(reason Reason) {}
+func (c *counters) loaderError()        {}
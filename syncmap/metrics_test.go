@@ -0,0 +1,28 @@
+//go:build syncmap_metrics
+
+package syncmap
+
+import "testing"
+
+func TestMetrics(t *testing.T) {
+	m := New()
+	m.Store(newKeyT(1), newValueT(1))
+	m.StoreMany(map[KeyT]ValueT{newKeyT(2): newValueT(2), newKeyT(3): newValueT(3)})
+	m.Load(newKeyT(1))
+	m.LoadMany([]KeyT{newKeyT(2), newKeyT(4)})
+	m.Contains(newKeyT(5))
+	m.Update(newKeyT(6), func(old ValueT, loaded bool) (ValueT, bool) {
+		return newValueT(6), true
+	})
+	m.Delete(newKeyT(1))
+	m.Delete(newKeyT(1))
+	m.DeleteMany([]KeyT{newKeyT(2), newKeyT(7)})
+
+	want := Metrics{Hits: 2, Misses: 2, Stores: 4, Deletes: 2}
+	if got := m.Metrics(); got != want {
+		t.Errorf("Metrics() = %+v; want %+v", got, want)
+	}
+	if got := m.Clone().Metrics(); got != (Metrics{}) {
+		t.Errorf("Metrics() of a clone = %+v; want zero", got)
+	}
+}
@@ -0,0 +1,271 @@
+// Package multimap is the template of a concurrent multimap, mapping keys to
+// slices of values, generated with go-gen-syncmap -kind=multimap.
+//
+// It has the algorithm of the map of the syncmap package, with entries
+// holding slices that writers replace rather than modify, so that appending
+// to the values of a key needs no locking by callers, and loading them none
+// at all.
+package multimap
+
+import (
+	"sync"
+	"sync/atomic"
+)
+
+// Multimap is like a Go map[KeyT][]ValueT but is safe for concurrent use by
+// multiple goroutines without additional locking or coordination. Loads run
+// without locking; writes to the values of a key lock that key only, and copy
+// its values, so they take time linear in their number.
+//
+// The zero Multimap is empty and ready for use. A Multimap must not be copied
+// after first use.
+type Multimap struct {
+	mu sync.Mutex
+
+	// read holds a readOnly, the portion of the multimap's contents that are
+	// safe for concurrent access (with or without mu held). It is always safe
+	// to load, but must only be stored with mu held.
+	read atomic.Value
+
+	// dirty holds the portion of the multimap's contents that require mu to
+	// be held, including all of the non-expunged entries in the read map, so
+	// that it can be promoted to the read map quickly.
+	dirty map[KeyT]*entry
+
+	// misses counts the lookups since the read map was last updated that
+	// needed to lock mu. Once they cover the cost of copying the dirty map,
+	// it is promoted to the read map.
+	misses int
+}
+
+// readOnly is an immutable struct stored atomically in the Multimap.read
+// field.
+type readOnly struct {
+	m       map[KeyT]*entry
+	amended bool // true if the dirty map contains some key not in m.
+}
+
+// An entry is a slot in the multimap corresponding to a particular key.
+type entry struct {
+	// mu is held by writers of values, and by the multimap to expunge the
+	// entry, after its own mu.
+	mu sync.Mutex
+
+	// values holds the []ValueT of the key, which is never modified once
+	// stored, so that readers may load it without locking.
+	values atomic.Value
+
+	// expunged is set, with mu held, when the entry has no values and the
+	// dirty map, which isn't nil, doesn't hold it.
+	expunged bool
+}
+
+// New returns an empty Multimap.
+func New() *Multimap {
+	return new(Multimap)
+}
+
+func (m *Multimap) loadReadOnly() readOnly {
+	if r, ok := m.read.Load().(readOnly); ok {
+		return r
+	}
+	return readOnly{}
+}
+
+func (e *entry) load() []ValueT {
+	values, _ := e.values.Load().([]ValueT)
+	return values
+}
+
+// lookup returns the entry of key, if any.
+func (m *Multimap) lookup(key KeyT) (e *entry, ok bool) {
+	read := m.loadReadOnly()
+	e, ok = read.m[key]
+	if !ok && read.amended {
+		m.mu.Lock()
+		// Avoid reporting a spurious miss if m.dirty got promoted while we
+		// were blocked on m.mu.
+		read = m.loadReadOnly()
+		e, ok = read.m[key]
+		if !ok && read.amended {
+			e, ok = m.dirty[key]
+			// Regardless of whether the entry was present, record a miss:
+			// this key will take the slow path until the dirty map is
+			// promoted to the read map.
+			m.missLocked()
+		}
+		m.mu.Unlock()
+	}
+	return e, ok
+}
+
+// LoadAll returns the values of key, in the order they were appended, or
+// nil if it has none. The slice is shared with other callers, and must not
+// be modified; appending to it copies it.
+func (m *Multimap) LoadAll(key KeyT) []ValueT {
+	e, ok := m.lookup(key)
+	if !ok {
+		return nil
+	}
+	values := e.load()
+	if len(values) == 0 {
+		return nil
+	}
+	return values
+}
+
+// Append appends value to the values of key.
+func (m *Multimap) Append(key KeyT, value ValueT) {
+	read := m.loadReadOnly()
+	if e, ok := read.m[key]; ok && e.tryAppend(value) {
+		return
+	}
+
+	m.mu.Lock()
+	read = m.loadReadOnly()
+	if e, ok := read.m[key]; ok {
+		e.mu.Lock()
+		if e.expunged {
+			// The entry was previously expunged, which implies that there is
+			// a non-nil dirty map and this entry is not in it.
+			e.expunged = false
+			m.dirty[key] = e
+		}
+		e.appendLocked(value)
+		e.mu.Unlock()
+	} else if e, ok := m.dirty[key]; ok {
+		e.mu.Lock()
+		e.appendLocked(value)
+		e.mu.Unlock()
+	} else {
+		if !read.amended {
+			// We're adding the first new key to the dirty map. Make sure it
+			// is allocated and mark the read-only map as incomplete.
+			m.dirtyLocked()
+			m.read.Store(readOnly{m: read.m, amended: true})
+		}
+		e := new(entry)
+		e.values.Store([]ValueT{value})
+		m.dirty[key] = e
+	}
+	m.mu.Unlock()
+}
+
+// tryAppend appends value to the values of the entry if it isn't expunged,
+// and reports whether it did.
+func (e *entry) tryAppend(value ValueT) bool {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.expunged {
+		return false
+	}
+	e.appendLocked(value)
+	return true
+}
+
+func (e *entry) appendLocked(value ValueT) {
+	old := e.load()
+	values := make([]ValueT, len(old)+1)
+	copy(values, old)
+	values[len(old)] = value
+	e.values.Store(values)
+}
+
+// RemoveValue removes the first of the values of key equal to value, and
+// reports whether there was one. Removing the last value of a key removes
+// the key.
+func (m *Multimap) RemoveValue(key KeyT, value ValueT) (removed bool) {
+	e, ok := m.lookup(key)
+	if !ok {
+		return false
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	old := e.load()
+	for i, v := range old {
+		if v == value {
+			values := make([]ValueT, 0, len(old)-1)
+			values = append(values, old[:i]...)
+			e.values.Store(append(values, old[i+1:]...))
+			return true
+		}
+	}
+	return false
+}
+
+// Range calls f sequentially for each key in the multimap and its values,
+// which f must not modify. If f returns false, Range stops the iteration.
+//
+// Range does not necessarily correspond to any consistent snapshot of the
+// multimap's contents: no key will be visited more than once, but if values
+// are appended to or removed from a key concurrently, Range may pass the
+// values it had before or after.
+//
+// Range may be O(N) with the number of keys in the multimap even if f
+// returns false after a constant number of calls.
+func (m *Multimap) Range(f func(key KeyT, values []ValueT) bool) {
+	// We need to be able to iterate over all of the keys that were already
+	// present at the start of the call to Range. If read.amended is false,
+	// then read.m satisfies that property without requiring us to hold m.mu
+	// for a long time.
+	read := m.loadReadOnly()
+	if read.amended {
+		// m.dirty contains keys not in read.m. Fortunately, Range is
+		// already O(N), so a call to Range amortizes an entire copy of the
+		// map: we can promote the dirty copy immediately!
+		m.mu.Lock()
+		read = m.loadReadOnly()
+		if read.amended {
+			read = readOnly{m: m.dirty}
+			m.read.Store(read)
+			m.dirty = nil
+			m.misses = 0
+		}
+		m.mu.Unlock()
+	}
+
+	for k, e := range read.m {
+		values := e.load()
+		if len(values) == 0 {
+			continue
+		}
+		if !f(k, values) {
+			break
+		}
+	}
+}
+
+func (m *Multimap) missLocked() {
+	m.misses++
+	if m.misses < len(m.dirty) {
+		return
+	}
+	m.read.Store(readOnly{m: m.dirty})
+	m.dirty = nil
+	m.misses = 0
+}
+
+func (m *Multimap) dirtyLocked() {
+	if m.dirty != nil {
+		return
+	}
+
+	read := m.loadReadOnly()
+	m.dirty = make(map[KeyT]*entry, len(read.m))
+	for k, e := range read.m {
+		if !e.tryExpungeLocked() {
+			m.dirty[k] = e
+		}
+	}
+}
+
+// tryExpungeLocked marks an entry with no values as expunged, and reports
+// whether the entry is expunged.
+func (e *entry) tryExpungeLocked() (isExpunged bool) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if len(e.load()) == 0 {
+		e.expunged = true
+	}
+	return e.expunged
+}
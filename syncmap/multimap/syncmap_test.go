@@ -0,0 +1,159 @@
+package multimap
+
+import (
+	"sync"
+	"testing"
+)
+
+// testValues returns the first n values of the tests. The factories may
+// return distinct values for the same i, such as new pointers, so the tests
+// compare those they built once.
+func testValues(n int) []ValueT {
+	values := make([]ValueT, n)
+	for i := range values {
+		values[i] = newValueT(i)
+	}
+	return values
+}
+
+// equalValues reports whether a and b hold the same values in order.
+func equalValues(a, b []ValueT) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func TestAppend(t *testing.T) {
+	var m Multimap
+	k0, k1 := newKeyT(0), newKeyT(1)
+	if got := m.LoadAll(k0); got != nil {
+		t.Errorf("LoadAll of the zero Multimap = %v; want nil", got)
+	}
+	vs := testValues(3)
+	v0, v1, v2 := vs[0], vs[1], vs[2]
+	m.Append(k0, v0)
+	m.Append(k0, v1)
+	m.Append(k1, v2)
+	before := m.LoadAll(k0)
+	m.Append(k0, v0)
+	if got, want := m.LoadAll(k0), []ValueT{v0, v1, v0}; !equalValues(got, want) {
+		t.Errorf("LoadAll(k0) = %v; want %v", got, want)
+	}
+	if got, want := m.LoadAll(k1), []ValueT{v2}; !equalValues(got, want) {
+		t.Errorf("LoadAll(k1) = %v; want %v", got, want)
+	}
+	if !equalValues(before, []ValueT{v0, v1}) {
+		t.Errorf("Append modified the values LoadAll returned before to %v", before)
+	}
+}
+
+func TestRemoveValue(t *testing.T) {
+	m := New()
+	k0 := newKeyT(0)
+	vs := testValues(2)
+	v0, v1 := vs[0], vs[1]
+	m.Append(k0, v0)
+	m.Append(k0, v1)
+	m.Append(k0, v0)
+	if m.RemoveValue(newKeyT(1), v0) {
+		t.Error("RemoveValue of a missing key reported removing a value")
+	}
+	if !m.RemoveValue(k0, v0) {
+		t.Error("RemoveValue(k0, v0) didn't report removing a value")
+	}
+	if got, want := m.LoadAll(k0), []ValueT{v1, v0}; !equalValues(got, want) {
+		t.Errorf("LoadAll(k0) after RemoveValue = %v; want %v", got, want)
+	}
+	m.RemoveValue(k0, v0)
+	if !m.RemoveValue(k0, v1) || m.RemoveValue(k0, v1) {
+		t.Error("RemoveValue(k0, v1) twice didn't report removing it once")
+	}
+	if got := m.LoadAll(k0); got != nil {
+		t.Errorf("LoadAll(k0) after removing its values = %v; want nil", got)
+	}
+
+	// Promote the key to the read map, expunge it by adding another, and
+	// append to it again.
+	m.Range(func(KeyT, []ValueT) bool { return true })
+	m.Append(newKeyT(1), v1)
+	m.Append(k0, v1)
+	n := 0
+	m.Range(func(KeyT, []ValueT) bool {
+		n++
+		return true
+	})
+	if got, want := m.LoadAll(k0), []ValueT{v1}; !equalValues(got, want) || n != 2 {
+		t.Errorf("after appending to an expunged key: LoadAll(k0) = %v, Range visited %d keys; want %v, 2", got, n, want)
+	}
+}
+
+func TestRange(t *testing.T) {
+	m := New()
+	vs := testValues(5)
+	for i := 0; i < 5; i++ {
+		for j := 0; j <= i; j++ {
+			m.Append(newKeyT(i), vs[j])
+		}
+	}
+	m.RemoveValue(newKeyT(0), vs[0])
+	seen := make(map[KeyT]int)
+	m.Range(func(key KeyT, values []ValueT) bool {
+		seen[key] = len(values)
+		return true
+	})
+	if len(seen) != 4 {
+		t.Errorf("Range visited %d keys; want the 4 with values", len(seen))
+	}
+	for i := 1; i < 5; i++ {
+		if seen[newKeyT(i)] != i+1 {
+			t.Errorf("Range passed %d values of key %d; want %d", seen[newKeyT(i)], i, i+1)
+		}
+	}
+}
+
+func TestConcurrent(t *testing.T) {
+	const goroutines, keys, rounds = 8, 20, 50
+	var m Multimap
+	vs := testValues(2 * goroutines)
+	var wg sync.WaitGroup
+	for g := 0; g < goroutines; g++ {
+		wg.Add(1)
+		go func(g int) {
+			defer wg.Done()
+			for n := 0; n < rounds; n++ {
+				for i := 0; i < keys; i++ {
+					key := newKeyT(i)
+					m.Append(key, vs[g])
+					m.Append(key, vs[goroutines+g])
+					m.LoadAll(key)
+					if !m.RemoveValue(key, vs[goroutines+g]) {
+						t.Errorf("RemoveValue of a value goroutine %d appended found none", g)
+					}
+				}
+				m.Range(func(KeyT, []ValueT) bool { return true })
+			}
+		}(g)
+	}
+	wg.Wait()
+
+	// No append was lost: each key holds each goroutine's value once per
+	// round.
+	for i := 0; i < keys; i++ {
+		count := make(map[ValueT]int)
+		for _, v := range m.LoadAll(newKeyT(i)) {
+			count[v]++
+		}
+		for g := 0; g < goroutines; g++ {
+			if count[vs[g]] != rounds || count[vs[goroutines+g]] != 0 {
+				t.Errorf("key %d holds %d and %d of the values of goroutine %d; want %d and 0",
+					i, count[vs[g]], count[vs[goroutines+g]], g, rounds)
+			}
+		}
+	}
+}
@@ -0,0 +1,9 @@
+package multimap
+
+// KeyT is a type for multimap's keys.
+type KeyT int64
+
+// ValueT is a type for multimap's values.
+//
+// ValueT must be comparable for RemoveValue.
+type ValueT int64
@@ -0,0 +1,12 @@
+package multimap
+
+// newKeyT and newValueT return the i-th key and value used by the tests
+// generated along with a multimap, which replace them with factories for its
+// types. Keys and values must be distinct for distinct i.
+func newKeyT(i int) KeyT {
+	return KeyT(i)
+}
+
+func newValueT(i int) ValueT {
+	return ValueT(i)
+}
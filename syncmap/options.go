@@ -0,0 +1,72 @@
+package syncmap
+
+// Option configures a Map created by New.
+type Option func(*Map)
+
+// WithCapacity presizes the map for n entries, so that bulk loads into a new
+// map don't grow the dirty map incrementally.
+func WithCapacity(n int) Option {
+	return func(m *Map) {
+		m.capacity = n
+	}
+}
+
+// WithCopy makes the map store a copy of each value passed to it, made by
+// f, so that callers may keep modifying the values they stored, such as
+// slices or structs holding pointers. Values are copied when they might be
+// stored, even if they end up not to be, as by LoadOrStore for a present key.
+//
+// Values returned by the map are not copied: they are shared with the map
+// and must not be modified.
+func WithCopy(f func(ValueT) ValueT) Option {
+	return func(m *Map) {
+		m.copier = f
+	}
+}
+
+// WithPromotionFactor makes the map promote its dirty map to the read map
+// once loads have missed the read map f times as often as the dirty map has
+// entries, rather than as often. A higher factor copies the dirty map less
+// often, for workloads storing new keys while loading missing ones, at the
+// cost of more loads locking the map in between; a lower one favours loads.
+// f not greater than 0 selects the default of 1.
+func WithPromotionFactor(f float64) Option {
+	return func(m *Map) {
+		m.promotionFactor = f
+	}
+}
+
+// WithAutoCompact makes deletions compact the map, as Compact does, once they
+// leave fewer live entries in it than f times the number of entries of its
+// read map, such as 0.25 for a map three quarters deleted. Maps of fewer than
+// 64 entries aren't compacted automatically, and the deletion compacting the
+// map takes as long as Compact does.
+func WithAutoCompact(f float64) Option {
+	return func(m *Map) {
+		m.compactFraction = f
+	}
+}
+
+// New returns an empty Map configured by opts.
+//
+// The zero Map is also empty and ready for use; New is only needed to pass
+// options.
+func New(opts ...Option) *Map {
+	m := new(Map)
+	for _, opt := range opts {
+		opt(m)
+	}
+	m.startJanitor()
+	m.backend.start()
+	return m
+}
+
+// NewFromMap returns a Map holding the entries of src.
+//
+// The read map is built directly from src, so no dirty map is created and
+// loads from the new map don't miss.
+func NewFromMap(src map[KeyT]ValueT, opts ...Option) *Map {
+	m := New(opts...)
+	m.reset(src)
+	return m
+}
@@ -0,0 +1,61 @@
+package syncmap
+
+import "testing"
+
+func TestWithPromotionFactor(t *testing.T) {
+	const mapSize = 8
+	for _, tt := range []struct {
+		factor float64
+		misses int
+	}{
+		{0, mapSize},
+		{1, mapSize},
+		{4, 4 * mapSize},
+		{0.5, mapSize / 2},
+	} {
+		m := New(WithPromotionFactor(tt.factor))
+		for i := 0; i < mapSize; i++ {
+			m.Store(newKeyT(i), newValueT(i))
+		}
+		missing := newKeyT(mapSize)
+		for i := 1; i < tt.misses; i++ {
+			m.Load(missing)
+		}
+		if m.dirty == nil {
+			t.Errorf("WithPromotionFactor(%v): promoted after %d misses; want %d", tt.factor, tt.misses-1, tt.misses)
+			continue
+		}
+		m.Load(missing)
+		if m.dirty != nil {
+			t.Errorf("WithPromotionFactor(%v): not promoted after %d misses", tt.factor, tt.misses)
+		}
+		if clone := m.Clone(); clone.promotionFactor != tt.factor {
+			t.Errorf("WithPromotionFactor(%v): clone has factor %v", tt.factor, clone.promotionFactor)
+		}
+	}
+}
+
+func TestWithAutoCompact(t *testing.T) {
+	const mapSize = 1 << 10
+	m := New(WithAutoCompact(0.25))
+	for i := 0; i < mapSize; i++ {
+		m.Store(newKeyT(i), newValueT(i))
+	}
+	m.Range(func(KeyT, ValueT) bool { return true })
+	for i := 0; i < mapSize/4*3; i++ {
+		m.Delete(newKeyT(i))
+	}
+	if n := len(m.loadReadOnly().m); n != mapSize {
+		t.Fatalf("compacted to %d entries with %d live; want no compaction yet", n, mapSize/4)
+	}
+	m.Delete(newKeyT(mapSize / 4 * 3))
+	if n := len(m.loadReadOnly().m); n != mapSize/4-1 {
+		t.Fatalf("read map has %d entries after compaction; want %d", n, mapSize/4-1)
+	}
+	for i := 0; i < mapSize; i++ {
+		_, ok := m.Load(newKeyT(i))
+		if want := i > mapSize/4*3; ok != want {
+			t.Fatalf("Load(%v) after compaction reported ok = %v; want %v", newKeyT(i), ok, want)
+		}
+	}
+}
@@ -0,0 +1,113 @@
+//go:build syncmap_metrics && syncmap_otel
+
+package syncmap
+
+import (
+	"context"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// This file holds the OpenTelemetry instrumentation of maps generated with
+// -metrics and -otel. It imports OpenTelemetry, which the generated file then
+// needs, so it's only generated for maps that ask for it.
+
+// instruments are the OpenTelemetry instruments of a map.
+type instruments struct {
+	tracer       trace.Tracer
+	loadDuration metric.Float64Histogram
+	attrs        metric.MeasurementOption
+}
+
+// copy returns the instruments of a clone of the map, which traces and times
+// the calls of its loader, but isn't observed by the meter.
+func (t *instruments) copy() instruments {
+	return *t
+}
+
+// WithMeter makes the map report the ratio of its loads that hit,
+// syncmap.hit_ratio, and its number of entries, syncmap.entries, when meter
+// collects them, and in maps generated with -loader, the duration of the
+// calls of its loader, syncmap.load.duration. Each has the attributes attrs,
+// which tell apart the maps sharing meter. Errors creating the instruments
+// are reported to otel.Handle.
+func WithMeter(meter metric.Meter, attrs ...attribute.KeyValue) Option {
+	return func(m *Map) {
+		t := &m.telemetry
+		t.attrs = metric.WithAttributeSet(attribute.NewSet(attrs...))
+		hitRatio, err := meter.Float64ObservableGauge("syncmap.hit_ratio",
+			metric.WithDescription("Ratio of the keys loads found to the keys they looked up."))
+		if err != nil {
+			otel.Handle(err)
+			return
+		}
+		entries, err := meter.Int64ObservableGauge("syncmap.entries",
+			metric.WithDescription("Number of entries."), metric.WithUnit("{entry}"))
+		if err != nil {
+			otel.Handle(err)
+			return
+		}
+		if t.loadDuration, err = meter.Float64Histogram("syncmap.load.duration",
+			metric.WithDescription("Duration of the calls of the loader."), metric.WithUnit("s")); err != nil {
+			otel.Handle(err)
+		}
+		_, err = meter.RegisterCallback(func(ctx context.Context, o metric.Observer) error {
+			s := m.Metrics()
+			if n := s.Hits + s.Misses; n > 0 {
+				o.ObserveFloat64(hitRatio, float64(s.Hits)/float64(n), t.attrs)
+			}
+			o.ObserveInt64(entries, int64(m.Len()), t.attrs)
+			return nil
+		}, hitRatio, entries)
+		if err != nil {
+			otel.Handle(err)
+		}
+	}
+}
+
+// WithTracer makes the map trace the calls of its loader with tracer, in
+// maps generated with -loader, as spans named syncmap.load, children of the
+// spans of the contexts of GetE.
+func WithTracer(tracer trace.Tracer) Option {
+	return func(m *Map) {
+		m.telemetry.tracer = tracer
+	}
+}
+
+// loadSpan is a call of the loader being traced and timed.
+type loadSpan struct {
+	span  trace.Span
+	began time.Time
+}
+
+// startLoad starts tracing and timing a call of the loader, made with the
+// returned context.
+func (t *instruments) startLoad(ctx context.Context) (context.Context, loadSpan) {
+	var s loadSpan
+	if t.tracer != nil {
+		ctx, s.span = t.tracer.Start(ctx, "syncmap.load")
+	}
+	if t.loadDuration != nil {
+		s.began = time.Now()
+	}
+	return ctx, s
+}
+
+// endLoad ends the span s of a call of the loader, which returned err.
+func (t *instruments) endLoad(ctx context.Context, s loadSpan, err error) {
+	if t.loadDuration != nil {
+		t.loadDuration.Record(ctx, time.Since(s.began).Seconds(), t.attrs)
+	}
+	if s.span != nil {
+		if err != nil {
+			s.span.RecordError(err)
+			s.span.SetStatus(codes.Error, err.Error())
+		}
+		s.span.End()
+	}
+}
@@ -0,0 +1,27 @@
+//go:build !syncmap_metrics || !syncmap_otel
+
+package syncmap
+
+import "context"
+
+// instruments are the OpenTelemetry instruments of maps generated with
+// -otel.
+type instruments struct{}
+
+// copy returns the instruments of a clone of the map.
+func (t *instruments) copy() instruments {
+	return instruments{}
+}
+
+// loadSpan is a call of the loader being traced, which only maps generated
+// with -otel trace.
+type loadSpan struct{}
+
+// startLoad starts tracing a call of the loader, which only maps generated
+// with -otel do.
+func (t *instruments) startLoad(ctx context.Context) (context.Context, loadSpan) {
+	return ctx, loadSpan{}
+}
+
+// endLoad ends tracing a call of the loader.
+func (t *instruments) endLoad(ctx context.Context, s loadSpan, err error) {}
@@ -0,0 +1,99 @@
+package syncmap
+
+import (
+	"encoding"
+	"encoding/json"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// errTrailingData is returned by UnmarshalBinary and LoadFrom when their
+// input holds more than the entries it encodes.
+var errTrailingData = errors.New("syncmap: trailing data after last entry")
+
+// SaveTo writes a Snapshot of the map to w, for LoadFrom to restore, such as
+// to keep a cache across restarts. Maps of keys and values that are
+// fixed-size or implement encoding.BinaryMarshaler are written in the
+// encoding of MarshalBinary, and others as the JSON object of MarshalJSON.
+func (m *Map) SaveTo(w io.Writer) error {
+	if b, ok := interface{}(m).(encoding.BinaryMarshaler); ok {
+		data, err := b.MarshalBinary()
+		if err != nil {
+			return err
+		}
+		_, err = w.Write(data)
+		return err
+	}
+	return json.NewEncoder(w).Encode(m.Snapshot())
+}
+
+// LoadFrom replaces the contents of the map with the entries SaveTo wrote to
+// r, reading r to its end.
+func (m *Map) LoadFrom(r io.Reader) error {
+	if b, ok := interface{}(m).(encoding.BinaryUnmarshaler); ok {
+		data, err := io.ReadAll(r)
+		if err != nil {
+			return err
+		}
+		return b.UnmarshalBinary(data)
+	}
+	var src map[KeyT]ValueT
+	d := json.NewDecoder(r)
+	if err := d.Decode(&src); err != nil {
+		return err
+	}
+	if _, err := d.Token(); err != io.EOF {
+		return errTrailingData
+	}
+	m.reset(src)
+	return nil
+}
+
+// SaveFile saves the map to the file name, as SaveTo does, atomically: it
+// writes a temporary file in the same directory, syncs it, and renames it to
+// name, so that a crash leaves either the old file or the new one, never a
+// truncated one. The file has mode perm, before umask.
+func (m *Map) SaveFile(name string, perm os.FileMode) error {
+	return writeFile(name, perm, m.SaveTo)
+}
+
+// writeFile replaces the file name, of mode perm, with the contents write
+// writes, atomically, as SaveFile does.
+func writeFile(name string, perm os.FileMode, write func(w io.Writer) error) (err error) {
+	f, err := os.CreateTemp(filepath.Dir(name), "."+filepath.Base(name)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			f.Close()
+			os.Remove(f.Name())
+		}
+	}()
+	if err := f.Chmod(perm); err != nil {
+		return err
+	}
+	if err := write(f); err != nil {
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), name)
+}
+
+// LoadFile restores the map from the file name, written by SaveFile or
+// SaveTo.
+func (m *Map) LoadFile(name string) error {
+	f, err := os.Open(name)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	return m.LoadFrom(f)
+}
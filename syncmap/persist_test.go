@@ -0,0 +1,64 @@
+//go:build !syncmap_ptrvalue
+
+package syncmap
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestSaveTo(t *testing.T) {
+	var m Map
+	for i := 0; i < 10; i++ {
+		m.Store(newKeyT(i), newValueT(i))
+	}
+	var buf bytes.Buffer
+	if err := m.SaveTo(&buf); err != nil {
+		t.Fatalf("SaveTo: %v", err)
+	}
+	data := buf.Bytes()
+
+	var restored Map
+	restored.Store(newKeyT(-1), newValueT(-1))
+	if err := restored.LoadFrom(bytes.NewReader(data)); err != nil {
+		t.Fatalf("LoadFrom: %v", err)
+	}
+	if got, want := restored.Snapshot(), m.Snapshot(); !reflect.DeepEqual(got, want) {
+		t.Errorf("LoadFrom restored %v; want %v", got, want)
+	}
+	if err := restored.LoadFrom(bytes.NewReader(append(data, 'x'))); err != errTrailingData {
+		t.Errorf("LoadFrom of trailing data returned %v; want %v", err, errTrailingData)
+	}
+}
+
+func TestSaveFile(t *testing.T) {
+	var m Map
+	for i := 0; i < 10; i++ {
+		m.Store(newKeyT(i), newValueT(i))
+	}
+	dir := t.TempDir()
+	name := filepath.Join(dir, "map")
+	for i := 0; i < 2; i++ {
+		// The second save replaces the file of the first.
+		if err := m.SaveFile(name, 0o600); err != nil {
+			t.Fatalf("SaveFile: %v", err)
+		}
+	}
+	if files, _ := os.ReadDir(dir); len(files) != 1 {
+		t.Errorf("SaveFile left %d files; want 1", len(files))
+	}
+
+	var restored Map
+	if err := restored.LoadFile(name); err != nil {
+		t.Fatalf("LoadFile: %v", err)
+	}
+	if got, want := restored.Snapshot(), m.Snapshot(); !reflect.DeepEqual(got, want) {
+		t.Errorf("LoadFile restored %v; want %v", got, want)
+	}
+	if err := m.SaveFile(filepath.Join(dir, "missing", "map"), 0o600); err == nil {
+		t.Error("SaveFile into a missing directory succeeded")
+	}
+}
@@ -0,0 +1,77 @@
+// Package pool is the template of a typed sync.Pool, generated with
+// go-gen-syncmap -kind=pool.
+//
+// It holds *ValueT rather than interface{}, so that getting a value needs no
+// type assertion, and putting one of another type doesn't compile.
+package pool
+
+import "sync"
+
+// Pool is a sync.Pool of *ValueT: a set of values that may be individually
+// saved and retrieved, to reuse them rather than allocate new ones, such as
+// buffers. Like sync.Pool, it may drop the values it holds at any time, and
+// it is safe for concurrent use by multiple goroutines.
+//
+// The zero Pool is empty and ready for use, and allocates the values Get
+// returns when it's empty with new(ValueT). A Pool must not be copied after
+// first use.
+type Pool struct {
+	p     sync.Pool
+	new   func() *ValueT // set by WithNew
+	reset func(*ValueT)  // set by WithReset
+}
+
+// Option configures a Pool created by New.
+type Option func(*Pool)
+
+// WithNew makes the pool call f for the values Get returns when it's empty,
+// rather than allocating zero values.
+func WithNew(f func() *ValueT) Option {
+	return func(p *Pool) {
+		p.new = f
+	}
+}
+
+// WithReset makes the pool call f with the values passed to Put before it
+// holds them, such as to truncate buffers, or to clear the references they
+// hold so that the pool doesn't keep what they refer to reachable.
+func WithReset(f func(*ValueT)) Option {
+	return func(p *Pool) {
+		p.reset = f
+	}
+}
+
+// New returns an empty Pool configured by opts.
+func New(opts ...Option) *Pool {
+	p := new(Pool)
+	for _, opt := range opts {
+		opt(p)
+	}
+	return p
+}
+
+// Get removes a value from the pool, and returns it. If the pool is empty,
+// it returns a new value, from the function set by WithNew, if any. Callers
+// shouldn't assume anything of the values Put passed to the pool, which may
+// be returned in any order.
+func (p *Pool) Get() *ValueT {
+	if v, ok := p.p.Get().(*ValueT); ok {
+		return v
+	}
+	if p.new != nil {
+		return p.new()
+	}
+	return new(ValueT)
+}
+
+// Put resets v with the function set by WithReset, if any, and adds it to
+// the pool. Putting nil does nothing. The caller must not use v afterwards.
+func (p *Pool) Put(v *ValueT) {
+	if v == nil {
+		return
+	}
+	if p.reset != nil {
+		p.reset(v)
+	}
+	p.p.Put(v)
+}
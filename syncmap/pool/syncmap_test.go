@@ -0,0 +1,71 @@
+package pool
+
+import (
+	"sync"
+	"testing"
+)
+
+func TestGet(t *testing.T) {
+	var p Pool
+	if v := p.Get(); v == nil {
+		t.Fatal("Get of the zero Pool returned nil")
+	}
+
+	var made []*ValueT
+	p2 := New(WithNew(func() *ValueT {
+		v := newValueT(len(made))
+		made = append(made, &v)
+		return &v
+	}))
+	if v := p2.Get(); len(made) != 1 || v != made[0] {
+		t.Errorf("Get of an empty pool returned %p, calling WithNew %d times; want the value it returned", v, len(made))
+	}
+}
+
+func TestPut(t *testing.T) {
+	var reset []*ValueT
+	p := New(WithReset(func(v *ValueT) {
+		reset = append(reset, v)
+	}))
+	v := p.Get()
+	p.Put(v)
+	p.Put(nil)
+	if len(reset) != 1 || reset[0] != v {
+		t.Errorf("Put called WithReset with %v; want [%p]", reset, v)
+	}
+
+	// The pool may drop any value, so Get only needs to return one of those
+	// put, or a new one.
+	if got := p.Get(); got == nil {
+		t.Error("Get after Put returned nil")
+	}
+}
+
+func TestConcurrent(t *testing.T) {
+	// reset records, for each value Get returned, whether it was reset since.
+	var mu sync.Mutex
+	reset := make(map[*ValueT]bool)
+	p := New(WithReset(func(v *ValueT) {
+		mu.Lock()
+		reset[v] = true
+		mu.Unlock()
+	}))
+	var wg sync.WaitGroup
+	for g := 0; g < 8; g++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < 1000; i++ {
+				v := p.Get()
+				mu.Lock()
+				if done, ok := reset[v]; ok && !done {
+					t.Errorf("Get returned %p, which is in use, or wasn't reset", v)
+				}
+				reset[v] = false
+				mu.Unlock()
+				p.Put(v)
+			}
+		}()
+	}
+	wg.Wait()
+}
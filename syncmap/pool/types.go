@@ -0,0 +1,7 @@
+package pool
+
+// ValueT is a type for the pool's values, which it holds pointers to.
+type ValueT struct {
+	n   int64
+	buf []byte
+}
@@ -0,0 +1,7 @@
+package pool
+
+// newValueT returns the i-th value used by the tests generated along with a
+// pool, which replace it with a factory for the pool's type.
+func newValueT(i int) ValueT {
+	return ValueT{n: int64(i)}
+}
@@ -0,0 +1,77 @@
+//go:build syncmap_metrics && syncmap_prometheus
+
+package syncmap
+
+import "github.com/prometheus/client_golang/prometheus"
+
+// This file holds the Prometheus collector of maps generated with -metrics
+// and -prometheus. It imports the Prometheus client, which the generated
+// file then needs, so it's only generated for maps that ask for it.
+
+// Collector is a prometheus.Collector exporting the Metrics of a Map, and its
+// number of entries, so that the map can be registered with a registry.
+type Collector struct {
+	m *Map
+
+	hits, misses, stores, deletes *prometheus.Desc
+	evictions, expirations        *prometheus.Desc
+	loaderErrors, entries         *prometheus.Desc
+}
+
+// Collector returns a collector exporting the metrics of the map, named
+// after name, such as "user_cache", with the constant labels, if any, which
+// tell apart the maps registered with the same registry:
+//
+//	prometheus.MustRegister(users.Collector("cache", prometheus.Labels{"map": "users"}))
+//
+// exports cache_hits_total, cache_misses_total, cache_stores_total,
+// cache_deletes_total, cache_evictions_total, cache_expirations_total,
+// cache_loader_errors_total, and cache_entries.
+func (m *Map) Collector(name string, labels prometheus.Labels) *Collector {
+	desc := func(metric, help string) *prometheus.Desc {
+		return prometheus.NewDesc(name+"_"+metric, help, nil, labels)
+	}
+	return &Collector{
+		m:            m,
+		hits:         desc("hits_total", "Number of keys loads found."),
+		misses:       desc("misses_total", "Number of keys loads didn't find."),
+		stores:       desc("stores_total", "Number of values stored."),
+		deletes:      desc("deletes_total", "Number of values deleted."),
+		evictions:    desc("evictions_total", "Number of entries evicted to make room for others."),
+		expirations:  desc("expirations_total", "Number of values removed once their TTL passed."),
+		loaderErrors: desc("loader_errors_total", "Number of failed calls of the loader."),
+		entries:      desc("entries", "Number of entries."),
+	}
+}
+
+// Describe sends the descriptions of the metrics of the map to ch.
+func (c *Collector) Describe(ch chan<- *prometheus.Desc) {
+	for _, d := range c.descs() {
+		ch <- d
+	}
+}
+
+// Collect sends the current metrics of the map to ch.
+func (c *Collector) Collect(ch chan<- prometheus.Metric) {
+	s := c.m.Metrics()
+	for _, v := range [...]struct {
+		desc  *prometheus.Desc
+		value int64
+	}{
+		{c.hits, s.Hits},
+		{c.misses, s.Misses},
+		{c.stores, s.Stores},
+		{c.deletes, s.Deletes},
+		{c.evictions, s.Evictions},
+		{c.expirations, s.Expirations},
+		{c.loaderErrors, s.LoaderErrors},
+	} {
+		ch <- prometheus.MustNewConstMetric(v.desc, prometheus.CounterValue, float64(v.value))
+	}
+	ch <- prometheus.MustNewConstMetric(c.entries, prometheus.GaugeValue, float64(c.m.Len()))
+}
+
+// descs returns the descriptions of the metrics of the map.
+func (c *Collector) descs() []*prometheus.Desc {
+	return []*prometheus.Desc{c.hits, c.misses, c.stores, c.deletes, c.evictions, c.expirations, c.loaderErrors, c.entries}
+}
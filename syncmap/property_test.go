@@ -0,0 +1,124 @@
+package syncmap
+
+import (
+	"math/rand"
+	"reflect"
+	"sync"
+	"testing"
+	"testing/quick"
+)
+
+// The properties of this file are checked under randomized concurrent
+// workloads, and are best run with -race. Like the other portable tests,
+// they only use the API shared by every implementation.
+
+// TestProperties checks with testing/quick that, for random numbers of
+// goroutines and keys and random orders of operations:
+//
+//   - exactly one of concurrent LoadOrStore calls for a key stores its
+//     value, and every call loads that value, so no update is lost;
+//   - concurrent and repeated Deletes of a key leave it absent;
+//   - Range only visits values stored for their key, while they are
+//     concurrently stored.
+func TestProperties(t *testing.T) {
+	f := func(seed int64, goroutines, keys uint8) bool {
+		return checkProperties(t, seed, int(goroutines%8)+2, int(keys%64)+1)
+	}
+	if err := quick.Check(f, &quick.Config{MaxCount: 20}); err != nil {
+		t.Error(err)
+	}
+}
+
+// checkProperties runs the workloads of TestProperties with g goroutines on
+// n keys, reporting whether their properties hold. The value goroutine j
+// stores for the i-th key is newValueT(j*n + i).
+func checkProperties(t *testing.T, seed int64, g, n int) bool {
+	var m Map
+	index := make(map[KeyT]int, n)
+	for i := 0; i < n; i++ {
+		index[newKeyT(i)] = i
+	}
+	ok := true
+	fail := func(format string, args ...interface{}) {
+		t.Helper()
+		t.Errorf("seed %d, %d goroutines, %d keys: "+format, append([]interface{}{seed, g, n}, args...)...)
+		ok = false
+	}
+	run := func(op func(j, i int)) {
+		var wg sync.WaitGroup
+		for j := 0; j < g; j++ {
+			wg.Add(1)
+			go func(j int, r *rand.Rand) {
+				defer wg.Done()
+				for _, i := range r.Perm(n) {
+					op(j, i)
+				}
+			}(j, rand.New(rand.NewSource(seed+int64(j))))
+		}
+		wg.Wait()
+	}
+
+	stores := make([]int, n)
+	actual := make([][]ValueT, n)
+	var mu sync.Mutex
+	run(func(j, i int) {
+		v, loaded := m.LoadOrStore(newKeyT(i), newValueT(j*n+i))
+		mu.Lock()
+		if !loaded {
+			stores[i]++
+		}
+		actual[i] = append(actual[i], v)
+		mu.Unlock()
+	})
+	for i := 0; i < n; i++ {
+		if stores[i] != 1 {
+			fail("%d LoadOrStore calls stored key %v; want 1", stores[i], newKeyT(i))
+		}
+		want, _ := m.Load(newKeyT(i))
+		for _, v := range actual[i] {
+			if !reflect.DeepEqual(v, want) {
+				fail("LoadOrStore(%v) loaded %v; the map holds %v", newKeyT(i), v, want)
+			}
+		}
+	}
+
+	run(func(j, i int) {
+		m.Delete(newKeyT(i))
+		m.Delete(newKeyT(i))
+	})
+	for i := 0; i < n; i++ {
+		if v, loaded := m.Load(newKeyT(i)); loaded {
+			fail("Load(%v) after Delete = %v, true", newKeyT(i), v)
+		}
+	}
+	if l := m.Len(); l != 0 {
+		fail("Len() after Delete = %d; want 0", l)
+	}
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for r := 0; r < 4; r++ {
+			m.Range(func(k KeyT, v ValueT) bool {
+				i, known := index[k]
+				if !known {
+					fail("Range visited key %v, which was never stored", k)
+					return true
+				}
+				for j := 0; j < g; j++ {
+					if reflect.DeepEqual(v, newValueT(j*n+i)) {
+						return true
+					}
+				}
+				fail("Range visited %v: %v, which was never stored for it", k, v)
+				return true
+			})
+		}
+	}()
+	run(func(j, i int) {
+		m.Store(newKeyT(i), newValueT(j*n+i))
+	})
+	wg.Wait()
+	return ok
+}
@@ -0,0 +1,8 @@
+//go:build go1.19
+
+package syncmap
+
+import "sync/atomic"
+
+// readOnlyPointer holds the read map of a Map.
+type readOnlyPointer = atomic.Pointer[readOnly]
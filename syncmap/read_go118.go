@@ -0,0 +1,20 @@
+//go:build !go1.19
+
+package syncmap
+
+import "sync/atomic"
+
+// readOnlyPointer holds the read map of a Map. It has the API of
+// atomic.Pointer[readOnly], which Go 1.18 lacks.
+type readOnlyPointer struct {
+	v atomic.Value // *readOnly
+}
+
+func (p *readOnlyPointer) Load() *readOnly {
+	r, _ := p.v.Load().(*readOnly)
+	return r
+}
+
+func (p *readOnlyPointer) Store(r *readOnly) {
+	p.v.Store(r)
+}
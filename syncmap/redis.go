@@ -0,0 +1,194 @@
+//go:build syncmap_redis
+
+package syncmap
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// This file holds the Redis type of maps generated with -redis. It imports
+// the Redis client, which the generated file then needs, so it's only
+// generated for maps that ask for it.
+
+// Redis is a map of the same keys and values as Map, held by a Redis server
+// rather than in memory, so that the instances of a program, or the tests of
+// it, can share it. Its Load, Store, LoadOrStore, Delete, and Range methods
+// have the signatures of those of Map, so that code using them through an
+// interface can use either.
+//
+// Each key is stored as the Redis key made of the namespace of the map, a
+// colon, and the JSON encoding of the key, holding the JSON encoding of its
+// value, so that maps of distinct namespaces can share a server.
+type Redis struct {
+	client  *redis.Client
+	prefix  string
+	onError func(err error)
+}
+
+// NewRedis returns the map of the keys of namespace held by the server, or
+// failover group, of client. The methods of the map, which return no error,
+// pass the errors of the server, and of decoding the values it holds, to
+// onError, if not nil, and then act as if the key were missing: Load and
+// LoadOrStore don't find it, and Range skips it.
+func NewRedis(client *redis.Client, namespace string, onError func(err error)) *Redis {
+	return &Redis{client: client, prefix: namespace + ":", onError: onError}
+}
+
+// Load returns the value stored for key, or the zero value if it's missing.
+// The ok result reports whether it was found.
+func (r *Redis) Load(key KeyT) (value ValueT, ok bool) {
+	ctx := context.Background()
+	k, err := r.key(key)
+	if err != nil {
+		r.failed(err)
+		return value, false
+	}
+	return r.get(ctx, k)
+}
+
+// Store sets the value for key.
+func (r *Redis) Store(key KeyT, value ValueT) {
+	ctx := context.Background()
+	k, data, err := r.encode(key, value)
+	if err != nil {
+		r.failed(err)
+		return
+	}
+	r.failed(r.client.Set(ctx, k, data, 0).Err())
+}
+
+// LoadOrStore returns the value stored for key, if any, and otherwise stores
+// and returns value. The loaded result is true if the value was loaded,
+// false if stored.
+func (r *Redis) LoadOrStore(key KeyT, value ValueT) (actual ValueT, loaded bool) {
+	ctx := context.Background()
+	k, data, err := r.encode(key, value)
+	if err != nil {
+		r.failed(err)
+		return value, false
+	}
+	for {
+		stored, err := r.client.SetNX(ctx, k, data, 0).Result()
+		if err != nil {
+			r.failed(err)
+			return value, false
+		}
+		if stored {
+			return value, false
+		}
+		data, err := r.client.Get(ctx, k).Bytes()
+		if err == redis.Nil {
+			// Deleted since SetNX found it: try storing value again.
+			continue
+		}
+		if err == nil {
+			err = json.Unmarshal(data, &actual)
+		}
+		if err != nil {
+			r.failed(err)
+			return value, false
+		}
+		return actual, true
+	}
+}
+
+// Delete deletes the value for key.
+func (r *Redis) Delete(key KeyT) {
+	ctx := context.Background()
+	k, err := r.key(key)
+	if err != nil {
+		r.failed(err)
+		return
+	}
+	r.failed(r.client.Del(ctx, k).Err())
+}
+
+// Range calls f sequentially for each key and value of the map, scanning its
+// namespace. If f returns false, Range stops the iteration.
+//
+// Like Map's, Range doesn't correspond to a consistent snapshot of the map:
+// the keys stored or deleted concurrently may or may not be visited, but no
+// key is visited more than once.
+func (r *Redis) Range(f func(key KeyT, value ValueT) bool) {
+	ctx := context.Background()
+	match := redisPattern.Replace(r.prefix) + "*"
+	seen := make(map[string]bool)
+	var cursor uint64
+	for {
+		keys, next, err := r.client.Scan(ctx, cursor, match, 100).Result()
+		if err != nil {
+			r.failed(err)
+			return
+		}
+		for _, k := range keys {
+			if seen[k] {
+				// SCAN returns the keys it finds more than once.
+				continue
+			}
+			seen[k] = true
+			var key KeyT
+			if err := json.Unmarshal([]byte(k[len(r.prefix):]), &key); err != nil {
+				r.failed(err)
+				continue
+			}
+			value, ok := r.get(ctx, k)
+			if ok && !f(key, value) {
+				return
+			}
+		}
+		if next == 0 {
+			return
+		}
+		cursor = next
+	}
+}
+
+// redisPattern escapes the special characters of the glob-style patterns of
+// SCAN.
+var redisPattern = strings.NewReplacer(`\`, `\\`, `*`, `\*`, `?`, `\?`, `[`, `\[`, `]`, `\]`)
+
+// key returns the Redis key of key.
+func (r *Redis) key(key KeyT) (string, error) {
+	data, err := json.Marshal(key)
+	if err != nil {
+		return "", err
+	}
+	return r.prefix + string(data), nil
+}
+
+// encode returns the Redis key of key, and the encoding of value.
+func (r *Redis) encode(key KeyT, value ValueT) (string, []byte, error) {
+	k, err := r.key(key)
+	if err != nil {
+		return "", nil, err
+	}
+	data, err := json.Marshal(value)
+	return k, data, err
+}
+
+// get returns the value of the Redis key k, if it holds one.
+func (r *Redis) get(ctx context.Context, k string) (value ValueT, ok bool) {
+	data, err := r.client.Get(ctx, k).Bytes()
+	if err == redis.Nil {
+		return value, false
+	}
+	if err == nil {
+		err = json.Unmarshal(data, &value)
+	}
+	if err != nil {
+		r.failed(err)
+		return value, false
+	}
+	return value, true
+}
+
+// failed passes err, if any, to the function set by NewRedis, if any.
+func (r *Redis) failed(err error) {
+	if err != nil && r.onError != nil {
+		r.onError(err)
+	}
+}
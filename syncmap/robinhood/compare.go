@@ -0,0 +1,34 @@
+package robinhood
+
+// This file holds the methods comparing values with ==, which are only
+// generated if ValueT is comparable.
+
+// CompareAndSwap swaps the old and new values for key
+// if the value stored in the map is equal to old.
+func (m *Map) CompareAndSwap(key KeyT, old, new ValueT) (swapped bool) {
+	h, s := m.lookup(key)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	i := s.find(key, h)
+	if i < 0 || s.slots[i].value != old {
+		return false
+	}
+	s.slots[i].value = new
+	return true
+}
+
+// CompareAndDelete deletes the entry for key if its value is equal to old.
+//
+// If there is no current value for key in the map, CompareAndDelete
+// returns false.
+func (m *Map) CompareAndDelete(key KeyT, old ValueT) (deleted bool) {
+	h, s := m.lookup(key)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	i := s.find(key, h)
+	if i < 0 || s.slots[i].value != old {
+		return false
+	}
+	s.remove(i)
+	return true
+}
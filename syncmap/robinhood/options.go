@@ -0,0 +1,34 @@
+package robinhood
+
+// Option configures a Map created by New.
+type Option func(*Map)
+
+// WithShards splits the map into n shards, rounded up to a power of two,
+// instead of a number scaled with GOMAXPROCS. More shards mean less
+// contention between writers, at the cost of memory and of slower Len, Clear,
+// and Range. n less than 1 selects the default.
+func WithShards(n int) Option {
+	return func(m *Map) {
+		m.n = n
+	}
+}
+
+// WithCapacity presizes the tables of the map for n entries, so that bulk
+// loads into a new map don't grow them, rehashing every entry, as they fill.
+func WithCapacity(n int) Option {
+	return func(m *Map) {
+		m.capacity = n
+	}
+}
+
+// New returns an empty Map configured by opts.
+//
+// The zero Map is also empty and ready for use; New is only needed to pass
+// options.
+func New(opts ...Option) *Map {
+	m := new(Map)
+	for _, opt := range opts {
+		opt(m)
+	}
+	return m
+}
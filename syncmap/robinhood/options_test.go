@@ -0,0 +1,72 @@
+package robinhood
+
+import (
+	"math/rand"
+	"testing"
+
+	"github.com/cristaloleg/go-gen-syncmap/syncmap/internal/shared"
+)
+
+// checkShards checks that every entry of m is where Robin Hood hashing puts
+// it, that is, that dist is 1 more than its distance from its home slot, and
+// that the entry before it is at least as far from its own home.
+func checkShards(t *testing.T, m *Map) {
+	t.Helper()
+	for si := range m.shards {
+		s := &m.shards[si]
+		n := 0
+		for i, sl := range s.slots {
+			if sl.dist == 0 {
+				continue
+			}
+			n++
+			h := shared.HashKey(m.seed, sl.key)
+			if h&m.mask != uint64(si) {
+				t.Fatalf("key %v is in shard %d; want %d", sl.key, si, h&m.mask)
+			}
+			if d := (i - s.home(h)) & (len(s.slots) - 1); int(sl.dist) != d+1 {
+				t.Fatalf("key %v at distance %d from its home has dist %d", sl.key, d, sl.dist)
+			}
+			if prev := s.slots[(i-1)&(len(s.slots)-1)]; sl.dist > 1 && prev.dist+1 < sl.dist {
+				t.Fatalf("key %v with dist %d follows dist %d", sl.key, sl.dist, prev.dist)
+			}
+		}
+		if n != s.n {
+			t.Fatalf("shard %d has %d entries; counted %d", si, n, s.n)
+		}
+	}
+}
+
+func TestRobinHood(t *testing.T) {
+	m := New(WithShards(2))
+	r := rand.New(rand.NewSource(1))
+	for i := 0; i < 20000; i++ {
+		k := newKeyT(r.Intn(1000))
+		if r.Intn(3) == 0 {
+			m.Delete(k)
+		} else {
+			m.Store(k, newValueT(i))
+		}
+		if i%1000 == 0 {
+			checkShards(t, m)
+		}
+	}
+	checkShards(t, m)
+}
+
+func TestWithCapacity(t *testing.T) {
+	m := New(WithShards(4), WithCapacity(1000))
+	size := len(m.getShards()[0].slots)
+	if size*maxLoad/8 < 1000/4 {
+		t.Fatalf("WithCapacity(1000) made shards of %d slots", size)
+	}
+	for i := 0; i < 800; i++ {
+		m.Store(newKeyT(i), newValueT(i))
+	}
+	for i := range m.shards {
+		if got := len(m.shards[i].slots); got != size {
+			t.Errorf("shard %d grew from %d to %d slots within its capacity", i, size, got)
+		}
+	}
+	checkShards(t, m)
+}
@@ -0,0 +1,25 @@
+package robinhood
+
+import "testing"
+
+func TestStats(t *testing.T) {
+	const mapSize = 1000
+	m := New(WithShards(4))
+	for i := 0; i < mapSize; i++ {
+		m.Store(newKeyT(i), newValueT(i))
+	}
+	st := m.Stats()
+	if st.Entries != mapSize || len(st.Shards) != 4 {
+		t.Fatalf("Stats() = %+v; want %d entries in 4 shards", st, mapSize)
+	}
+	sum := 0
+	for i, n := range st.Shards {
+		if n == 0 {
+			t.Errorf("shard %d is empty", i)
+		}
+		sum += n
+	}
+	if sum != mapSize {
+		t.Errorf("shards hold %d entries; want %d", sum, mapSize)
+	}
+}
@@ -0,0 +1,319 @@
+// Package robinhood is the template of a map split into shards, each an
+// open-addressing hash table guarded by its own sync.RWMutex, generated with
+// go-gen-syncmap -impl=robinhood.
+//
+// It has the core API of the syncmap template. Entries are stored inline in
+// a flat array of slots, ordered by Robin Hood hashing, so that a lookup
+// reads a few adjacent slots instead of chasing pointers. It suits large
+// maps of small keys and values, such as integer IDs, whose lookups are
+// dominated by cache misses.
+//
+// Readers take a read lock rather than validating a sequence number as a
+// seqlock would: reading slots while they're written is a data race under
+// the Go memory model, whatever the types of the keys and values.
+package robinhood
+
+import (
+	"math/bits"
+	"runtime"
+	"sync"
+
+	"github.com/cristaloleg/go-gen-syncmap/syncmap/internal/shared"
+)
+
+const (
+	// minSlots is the number of slots of a shard holding its first entry.
+	minSlots = 8
+
+	// maxLoad is the number of entries per 8 slots above which a shard
+	// grows. Robin Hood hashing keeps probes short at high loads.
+	maxLoad = 7
+)
+
+// Map is like a Go map[KeyT]ValueT split into shards by a hash of the key,
+// each an open-addressing table, so it is safe for concurrent use by
+// multiple goroutines.
+//
+// The zero Map is empty and ready for use, with defaultShards shards. A Map
+// must not be copied after first use.
+type Map struct {
+	// n and capacity are set by WithShards and WithCapacity.
+	n, capacity int
+
+	once   sync.Once
+	seed   shared.HashSeed // picked on first use
+	shards []shard         // allocated on first use, a power of two of them
+	mask   uint64          // len(shards) - 1
+}
+
+// shard is a part of a Map guarded by its own lock.
+type shard struct {
+	_     shared.CacheLinePad // from the previous shard
+	mu    sync.RWMutex
+	seed  shared.HashSeed // that of the Map, which rehashing the keys needs
+	slots []slot          // a power of two of them, or none
+	n     int             // number of entries
+}
+
+// slot is a slot of the table of a shard. Each entry is in the first free
+// slot from its home slot, picked by the hash of its key, at the time it was
+// inserted, unless it was displaced by an entry further from its own home.
+type slot struct {
+	key   KeyT
+	value ValueT
+	// dist is 1 more than the distance from the home slot of the entry, or
+	// 0 if the slot is free.
+	dist uint32
+}
+
+// defaultShards returns the number of shards of a Map created without
+// WithShards: a few per processor, so that writers rarely contend.
+func defaultShards() int {
+	return 4 * runtime.GOMAXPROCS(0)
+}
+
+// getShards returns the shards of m, allocating them on first use.
+func (m *Map) getShards() []shard {
+	m.once.Do(func() {
+		n := m.n
+		if n <= 0 {
+			n = defaultShards()
+		}
+		// Round up to a power of two, so that a mask picks the shard.
+		n = 1 << bits.Len(uint(n-1))
+		m.seed = shared.NewHashSeed()
+		m.shards = make([]shard, n)
+		m.mask = uint64(n - 1)
+		for i := range m.shards {
+			m.shards[i].seed = m.seed
+			if m.capacity > 0 {
+				m.shards[i].resize(m.capacity / n)
+			}
+		}
+	})
+	return m.shards
+}
+
+// lookup returns the hash of key and its shard. The low bits of the hash
+// pick the shard, and the high bits the home slot within it.
+func (m *Map) lookup(key KeyT) (uint64, *shard) {
+	shards := m.getShards()
+	h := shared.HashKey(m.seed, key)
+	return h, &shards[h&m.mask]
+}
+
+// Load returns the value stored in the map for a key, or the zero value if
+// no value is present.
+// The ok result indicates whether value was found in the map.
+func (m *Map) Load(key KeyT) (value ValueT, ok bool) {
+	h, s := m.lookup(key)
+	s.mu.RLock()
+	if i := s.find(key, h); i >= 0 {
+		value, ok = s.slots[i].value, true
+	}
+	s.mu.RUnlock()
+	return value, ok
+}
+
+// Store sets the value for a key.
+func (m *Map) Store(key KeyT, value ValueT) {
+	h, s := m.lookup(key)
+	s.mu.Lock()
+	if i := s.find(key, h); i >= 0 {
+		s.slots[i].value = value
+	} else {
+		s.insert(key, value, h)
+	}
+	s.mu.Unlock()
+}
+
+// LoadOrStore returns the existing value for the key if present.
+// Otherwise, it stores and returns the given value.
+// The loaded result is true if the value was loaded, false if stored.
+func (m *Map) LoadOrStore(key KeyT, value ValueT) (actual ValueT, loaded bool) {
+	h, s := m.lookup(key)
+	s.mu.Lock()
+	if i := s.find(key, h); i >= 0 {
+		actual, loaded = s.slots[i].value, true
+	} else {
+		actual = value
+		s.insert(key, value, h)
+	}
+	s.mu.Unlock()
+	return actual, loaded
+}
+
+// Swap swaps the value for a key and returns the previous value if any.
+// The loaded result reports whether the key was present.
+func (m *Map) Swap(key KeyT, value ValueT) (previous ValueT, loaded bool) {
+	h, s := m.lookup(key)
+	s.mu.Lock()
+	if i := s.find(key, h); i >= 0 {
+		previous, loaded = s.slots[i].value, true
+		s.slots[i].value = value
+	} else {
+		s.insert(key, value, h)
+	}
+	s.mu.Unlock()
+	return previous, loaded
+}
+
+// Delete deletes the value for a key.
+func (m *Map) Delete(key KeyT) {
+	h, s := m.lookup(key)
+	s.mu.Lock()
+	if i := s.find(key, h); i >= 0 {
+		s.remove(i)
+	}
+	s.mu.Unlock()
+}
+
+// Len returns the number of entries in the map.
+//
+// The shards are counted one at a time, so Len is only exact in the absence
+// of concurrent writes.
+func (m *Map) Len() int {
+	n := 0
+	shards := m.getShards()
+	for i := range shards {
+		s := &shards[i]
+		s.mu.RLock()
+		n += s.n
+		s.mu.RUnlock()
+	}
+	return n
+}
+
+// Clear deletes all the entries, resulting in an empty Map.
+//
+// The shards are cleared one at a time, so a concurrent Range may observe
+// some shards cleared and others not.
+func (m *Map) Clear() {
+	shards := m.getShards()
+	for i := range shards {
+		s := &shards[i]
+		s.mu.Lock()
+		s.slots, s.n = nil, 0
+		s.mu.Unlock()
+	}
+}
+
+// Range calls f sequentially for each key and value present in the map.
+// If f returns false, range stops the iteration.
+//
+// No lock is held while f runs, so f may call any method of m. As with
+// sync.Map, Range does not necessarily correspond to any consistent snapshot
+// of the Map's contents: it visits the keys present in each shard when the
+// shard is reached, skipping those deleted since.
+func (m *Map) Range(f func(key KeyT, value ValueT) bool) {
+	var keys []KeyT
+	shards := m.getShards()
+	for i := range shards {
+		s := &shards[i]
+		s.mu.RLock()
+		keys = keys[:0]
+		for j := range s.slots {
+			if s.slots[j].dist != 0 {
+				keys = append(keys, s.slots[j].key)
+			}
+		}
+		s.mu.RUnlock()
+
+		for _, k := range keys {
+			v, ok := m.Load(k)
+			if !ok {
+				continue
+			}
+			if !f(k, v) {
+				return
+			}
+		}
+	}
+}
+
+// home returns the home slot of the hash h.
+func (s *shard) home(h uint64) int {
+	return int(h>>32) & (len(s.slots) - 1)
+}
+
+// find returns the slot of key, whose hash is h, or -1 if it's absent.
+func (s *shard) find(key KeyT, h uint64) int {
+	if len(s.slots) == 0 {
+		return -1
+	}
+	mask := len(s.slots) - 1
+	for i, dist := s.home(h), uint32(1); ; i, dist = (i+1)&mask, dist+1 {
+		// Entries are ordered by distance, so key would be here by now.
+		sl := &s.slots[i]
+		if sl.dist < dist {
+			return -1
+		}
+		if shared.EqualKey(sl.key, key) {
+			return i
+		}
+	}
+}
+
+// insert adds an entry for key, which must be absent, growing the table if
+// needed.
+func (s *shard) insert(key KeyT, value ValueT, h uint64) {
+	if (s.n+1)*8 > maxLoad*len(s.slots) {
+		s.resize(s.n + 1)
+	}
+	s.n++
+	s.place(slot{key: key, value: value, dist: 1}, s.home(h))
+}
+
+// place puts e in the first free slot from i, the home slot of e, swapping
+// it with each entry closer to its own home on the way.
+func (s *shard) place(e slot, i int) {
+	mask := len(s.slots) - 1
+	for ; ; i, e.dist = (i+1)&mask, e.dist+1 {
+		sl := &s.slots[i]
+		if sl.dist == 0 {
+			*sl = e
+			return
+		}
+		if sl.dist < e.dist {
+			*sl, e = e, *sl
+		}
+	}
+}
+
+// remove deletes the entry of slot i, moving the entries after it one slot
+// back, until one at its home slot, so that no probe stops early.
+func (s *shard) remove(i int) {
+	mask := len(s.slots) - 1
+	for {
+		next := (i + 1) & mask
+		if s.slots[next].dist <= 1 {
+			break
+		}
+		s.slots[i] = s.slots[next]
+		s.slots[i].dist--
+		i = next
+	}
+	// Drop the references of the entry, if any.
+	s.slots[i] = slot{}
+	s.n--
+}
+
+// resize reallocates the table of s with enough slots for n entries, and
+// reinserts its entries.
+func (s *shard) resize(n int) {
+	size := minSlots
+	for n*8 > maxLoad*size {
+		size *= 2
+	}
+	if size <= len(s.slots) {
+		return
+	}
+	old := s.slots
+	s.slots = make([]slot, size)
+	for _, e := range old {
+		if e.dist != 0 {
+			e.dist = 1
+			s.place(e, s.home(shared.HashKey(s.seed, e.key)))
+		}
+	}
+}
@@ -0,0 +1,14 @@
+//go:build !syncmap_stringkey && !syncmap_customkey
+
+package robinhood
+
+// newKeyT and newValueT return the i-th key and value used by the tests
+// generated along with a map, which replace them with factories for the
+// map's types. Keys must be distinct for distinct i.
+func newKeyT(i int) KeyT {
+	return KeyT(i)
+}
+
+func newValueT(i int) ValueT {
+	return ValueT(i)
+}
@@ -0,0 +1,30 @@
+package rwmutex
+
+// This file holds the methods comparing values with ==, which are only
+// generated if ValueT is comparable.
+
+// CompareAndSwap swaps the old and new values for key
+// if the value stored in the map is equal to old.
+func (m *Map) CompareAndSwap(key KeyT, old, new ValueT) (swapped bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if value, ok := m.m[key]; !ok || value != old {
+		return false
+	}
+	m.m[key] = new
+	return true
+}
+
+// CompareAndDelete deletes the entry for key if its value is equal to old.
+//
+// If there is no current value for key in the map, CompareAndDelete
+// returns false.
+func (m *Map) CompareAndDelete(key KeyT, old ValueT) (deleted bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if value, ok := m.m[key]; !ok || value != old {
+		return false
+	}
+	delete(m.m, key)
+	return true
+}
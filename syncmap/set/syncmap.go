@@ -0,0 +1,307 @@
+// Package set is the template of a concurrent set, generated with
+// go-gen-syncmap -kind=set.
+//
+// It has the algorithm of the map of the syncmap package, with entries
+// holding whether their key is in the set rather than a value, so that a set
+// costs no memory for values, and reads as one.
+package set
+
+import (
+	"sync"
+	"sync/atomic"
+)
+
+// Set is like a Go map[KeyT]struct{} but is safe for concurrent use by
+// multiple goroutines without additional locking or coordination. Adds,
+// removals, and lookups run in amortized constant time.
+//
+// Like the map of the syncmap package, it is optimized for keys that are
+// only ever added once but looked up many times, or for goroutines adding
+// and removing disjoint sets of keys.
+//
+// The zero Set is empty and ready for use. A Set must not be copied after
+// first use.
+type Set struct {
+	// count is the number of keys in the set. It is accessed atomically and
+	// must stay first in the struct to be 64-bit aligned on 32-bit platforms.
+	count int64
+
+	mu sync.Mutex
+
+	// read holds a readOnly, the portion of the set's contents that are safe
+	// for concurrent access (with or without mu held). It is always safe to
+	// load, but must only be stored with mu held.
+	read atomic.Value
+
+	// dirty holds the portion of the set's contents that require mu to be
+	// held, including all of the non-expunged entries in the read map, so
+	// that it can be promoted to the read map quickly.
+	dirty map[KeyT]*entry
+
+	// misses counts the lookups since the read map was last updated that
+	// needed to lock mu. Once they cover the cost of copying the dirty map,
+	// it is promoted to the read map.
+	misses int
+}
+
+// readOnly is an immutable struct stored atomically in the Set.read field.
+type readOnly struct {
+	m       map[KeyT]*entry
+	amended bool // true if the dirty map contains some key not in m.
+}
+
+// The states of an entry.
+const (
+	// deleted is the state of entries whose key was removed, or is being
+	// added, and which the dirty map holds, if it isn't nil.
+	deleted int32 = iota
+
+	// present is the state of entries whose key is in the set.
+	present
+
+	// expunged is the state of deleted entries that the dirty map, which
+	// isn't nil, doesn't hold.
+	expunged
+)
+
+// An entry is a slot in the set corresponding to a particular key.
+type entry struct {
+	state int32 // one of deleted, present, and expunged, accessed atomically.
+}
+
+// New returns a set holding keys.
+func New(keys ...KeyT) *Set {
+	s := new(Set)
+	for _, key := range keys {
+		s.Add(key)
+	}
+	return s
+}
+
+func (s *Set) loadReadOnly() readOnly {
+	if r, ok := s.read.Load().(readOnly); ok {
+		return r
+	}
+	return readOnly{}
+}
+
+// Contains reports whether key is in the set.
+func (s *Set) Contains(key KeyT) bool {
+	read := s.loadReadOnly()
+	e, ok := read.m[key]
+	if !ok && read.amended {
+		s.mu.Lock()
+		// Avoid reporting a spurious miss if s.dirty got promoted while we
+		// were blocked on s.mu.
+		read = s.loadReadOnly()
+		e, ok = read.m[key]
+		if !ok && read.amended {
+			e, ok = s.dirty[key]
+			// Regardless of whether the entry was present, record a miss:
+			// this key will take the slow path until the dirty map is
+			// promoted to the read map.
+			s.missLocked()
+		}
+		s.mu.Unlock()
+	}
+	return ok && atomic.LoadInt32(&e.state) == present
+}
+
+// Add adds key to the set, and reports whether it wasn't in it.
+func (s *Set) Add(key KeyT) (added bool) {
+	read := s.loadReadOnly()
+	if e, ok := read.m[key]; ok {
+		if added, ok := e.tryAdd(); ok {
+			if added {
+				atomic.AddInt64(&s.count, 1)
+			}
+			return added
+		}
+	}
+
+	s.mu.Lock()
+	read = s.loadReadOnly()
+	if e, ok := read.m[key]; ok {
+		if e.unexpungeLocked() {
+			// The entry was previously expunged, which implies that there is
+			// a non-nil dirty map and this entry is not in it.
+			s.dirty[key] = e
+		}
+		added = atomic.SwapInt32(&e.state, present) != present
+	} else if e, ok := s.dirty[key]; ok {
+		added = atomic.SwapInt32(&e.state, present) != present
+	} else {
+		if !read.amended {
+			// We're adding the first new key to the dirty map. Make sure it
+			// is allocated and mark the read-only map as incomplete.
+			s.dirtyLocked()
+			s.read.Store(readOnly{m: read.m, amended: true})
+		}
+		s.dirty[key] = &entry{state: present}
+		added = true
+	}
+	s.mu.Unlock()
+	if added {
+		atomic.AddInt64(&s.count, 1)
+	}
+	return added
+}
+
+// tryAdd marks the entry present if it isn't expunged, and reports whether
+// it wasn't. If the entry is expunged, tryAdd leaves it unchanged and
+// returns with ok==false.
+func (e *entry) tryAdd() (added, ok bool) {
+	for {
+		state := atomic.LoadInt32(&e.state)
+		switch state {
+		case present:
+			return false, true
+		case expunged:
+			return false, false
+		}
+		if atomic.CompareAndSwapInt32(&e.state, state, present) {
+			return true, true
+		}
+	}
+}
+
+// unexpungeLocked ensures that the entry is not marked as expunged, and
+// reports whether it was, in which case it must be added to the dirty map
+// before s.mu is unlocked.
+func (e *entry) unexpungeLocked() (wasExpunged bool) {
+	return atomic.CompareAndSwapInt32(&e.state, expunged, deleted)
+}
+
+// Remove removes key from the set, and reports whether it was in it.
+func (s *Set) Remove(key KeyT) (removed bool) {
+	read := s.loadReadOnly()
+	e, ok := read.m[key]
+	if !ok && read.amended {
+		s.mu.Lock()
+		read = s.loadReadOnly()
+		e, ok = read.m[key]
+		if !ok && read.amended {
+			e, ok = s.dirty[key]
+			delete(s.dirty, key)
+			// Regardless of whether the entry was present, record a miss:
+			// this key will take the slow path until the dirty map is
+			// promoted to the read map.
+			s.missLocked()
+		}
+		s.mu.Unlock()
+	}
+	if ok && atomic.CompareAndSwapInt32(&e.state, present, deleted) {
+		atomic.AddInt64(&s.count, -1)
+		return true
+	}
+	return false
+}
+
+// Len returns the number of keys in the set. Under concurrent additions and
+// removals, it may not match any of the states Range visits.
+func (s *Set) Len() int {
+	return int(atomic.LoadInt64(&s.count))
+}
+
+// Range calls f sequentially for each key in the set. If f returns false,
+// Range stops the iteration.
+//
+// Range does not necessarily correspond to any consistent snapshot of the
+// set's contents: no key will be visited more than once, but if a key is
+// added or removed concurrently, Range may or may not visit it.
+//
+// Range may be O(N) with the number of elements in the set even if f
+// returns false after a constant number of calls.
+func (s *Set) Range(f func(key KeyT) bool) {
+	// We need to be able to iterate over all of the keys that were already
+	// present at the start of the call to Range. If read.amended is false,
+	// then read.m satisfies that property without requiring us to hold s.mu
+	// for a long time.
+	read := s.loadReadOnly()
+	if read.amended {
+		// s.dirty contains keys not in read.m. Fortunately, Range is
+		// already O(N), so a call to Range amortizes an entire copy of the
+		// set: we can promote the dirty copy immediately!
+		s.mu.Lock()
+		read = s.loadReadOnly()
+		if read.amended {
+			read = readOnly{m: s.dirty}
+			s.read.Store(read)
+			s.dirty = nil
+			s.misses = 0
+		}
+		s.mu.Unlock()
+	}
+
+	for k, e := range read.m {
+		if atomic.LoadInt32(&e.state) != present {
+			continue
+		}
+		if !f(k) {
+			break
+		}
+	}
+}
+
+// Union returns a new set holding the keys of s and t. Keys added to or
+// removed from either set meanwhile may or may not be in it.
+func (s *Set) Union(t *Set) *Set {
+	u := new(Set)
+	for _, from := range [...]*Set{s, t} {
+		from.Range(func(key KeyT) bool {
+			u.Add(key)
+			return true
+		})
+	}
+	return u
+}
+
+// Intersect returns a new set holding the keys of s that are in t. Keys
+// added to or removed from either set meanwhile may or may not be in it.
+func (s *Set) Intersect(t *Set) *Set {
+	u := new(Set)
+	s.Range(func(key KeyT) bool {
+		if t.Contains(key) {
+			u.Add(key)
+		}
+		return true
+	})
+	return u
+}
+
+func (s *Set) missLocked() {
+	s.misses++
+	if s.misses < len(s.dirty) {
+		return
+	}
+	s.read.Store(readOnly{m: s.dirty})
+	s.dirty = nil
+	s.misses = 0
+}
+
+func (s *Set) dirtyLocked() {
+	if s.dirty != nil {
+		return
+	}
+
+	read := s.loadReadOnly()
+	s.dirty = make(map[KeyT]*entry, len(read.m))
+	for k, e := range read.m {
+		if !e.tryExpungeLocked() {
+			s.dirty[k] = e
+		}
+	}
+}
+
+// tryExpungeLocked marks a deleted entry as expunged, and reports whether
+// the entry is expunged.
+func (e *entry) tryExpungeLocked() (isExpunged bool) {
+	state := atomic.LoadInt32(&e.state)
+	for state == deleted {
+		if atomic.CompareAndSwapInt32(&e.state, deleted, expunged) {
+			return true
+		}
+		state = atomic.LoadInt32(&e.state)
+	}
+	return state == expunged
+}
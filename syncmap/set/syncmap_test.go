@@ -0,0 +1,127 @@
+package set
+
+import (
+	"sync"
+	"testing"
+)
+
+func TestAddRemove(t *testing.T) {
+	var s Set
+	k0, k1 := newKeyT(0), newKeyT(1)
+	if s.Contains(k0) || s.Len() != 0 {
+		t.Fatal("the zero Set isn't empty")
+	}
+	if !s.Add(k0) || s.Add(k0) {
+		t.Error("Add(k0) twice didn't report adding it once")
+	}
+	if !s.Contains(k0) || s.Contains(k1) || s.Len() != 1 {
+		t.Errorf("after Add(k0): Contains(k0)=%v Contains(k1)=%v Len=%d; want true false 1", s.Contains(k0), s.Contains(k1), s.Len())
+	}
+	if s.Remove(k1) {
+		t.Error("Remove(k1) reported removing a missing key")
+	}
+	if !s.Remove(k0) || s.Remove(k0) {
+		t.Error("Remove(k0) twice didn't report removing it once")
+	}
+	if s.Contains(k0) || s.Len() != 0 {
+		t.Errorf("after Remove(k0): Contains(k0)=%v Len=%d; want false 0", s.Contains(k0), s.Len())
+	}
+
+	// Promote the keys to the read map, which expunges removed entries when
+	// the next key is added, and add them back.
+	for i := 0; i < 10; i++ {
+		s.Add(newKeyT(i))
+	}
+	s.Range(func(KeyT) bool { return true })
+	s.Remove(newKeyT(3))
+	s.Add(newKeyT(10))
+	if !s.Add(newKeyT(3)) || !s.Contains(newKeyT(3)) || s.Len() != 11 {
+		t.Errorf("adding back a removed key: Contains=%v Len=%d; want true 11", s.Contains(newKeyT(3)), s.Len())
+	}
+}
+
+func TestRange(t *testing.T) {
+	s := New(newKeyT(0), newKeyT(1), newKeyT(2))
+	s.Remove(newKeyT(1))
+	seen := make(map[KeyT]int)
+	s.Range(func(key KeyT) bool {
+		seen[key]++
+		return true
+	})
+	if len(seen) != 2 || seen[newKeyT(0)] != 1 || seen[newKeyT(2)] != 1 {
+		t.Errorf("Range visited %v; want keys 0 and 2 once", seen)
+	}
+
+	n := 0
+	s.Range(func(KeyT) bool {
+		n++
+		return false
+	})
+	if n != 1 {
+		t.Errorf("Range called f %d times after it returned false; want 1", n)
+	}
+}
+
+func TestUnionIntersect(t *testing.T) {
+	s := New(newKeyT(0), newKeyT(1), newKeyT(2))
+	u := New(newKeyT(1), newKeyT(2), newKeyT(3))
+	for _, tt := range []struct {
+		name string
+		got  *Set
+		want []int
+	}{
+		{"Union", s.Union(u), []int{0, 1, 2, 3}},
+		{"Intersect", s.Intersect(u), []int{1, 2}},
+		{"Intersect of an empty set", s.Intersect(new(Set)), nil},
+	} {
+		if tt.got.Len() != len(tt.want) {
+			t.Errorf("%s has %d keys; want %d", tt.name, tt.got.Len(), len(tt.want))
+		}
+		for _, i := range tt.want {
+			if !tt.got.Contains(newKeyT(i)) {
+				t.Errorf("%s doesn't contain key %d", tt.name, i)
+			}
+		}
+	}
+}
+
+func TestConcurrent(t *testing.T) {
+	const goroutines, keys = 8, 100
+	var s Set
+	// Each goroutine adds and removes every key, so that they race on each
+	// of them, and counts those it added and removed.
+	added := make([]int, goroutines)
+	var wg sync.WaitGroup
+	for g := 0; g < goroutines; g++ {
+		wg.Add(1)
+		go func(g int) {
+			defer wg.Done()
+			for n := 0; n < 10; n++ {
+				for i := 0; i < keys; i++ {
+					key := newKeyT((i + g) % keys)
+					if s.Add(key) {
+						added[g]++
+					}
+					s.Contains(key)
+					if i%3 == 0 && s.Remove(key) {
+						added[g]--
+					}
+				}
+				s.Range(func(KeyT) bool { return true })
+			}
+		}(g)
+	}
+	wg.Wait()
+
+	total, n := 0, 0
+	for _, a := range added {
+		total += a
+	}
+	s.Range(func(KeyT) bool {
+		n++
+		return true
+	})
+	if s.Len() != total || n != total {
+		t.Errorf("Len()=%d and Range visited %d keys; want the %d added and not removed", s.Len(), n, total)
+	}
+}
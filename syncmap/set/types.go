@@ -0,0 +1,4 @@
+package set
+
+// KeyT is a type for set's keys.
+type KeyT int64
@@ -0,0 +1,8 @@
+package set
+
+// newKeyT returns the i-th key used by the tests generated along with a set,
+// which replace it with a factory for the set's type. Keys must be distinct
+// for distinct i.
+func newKeyT(i int) KeyT {
+	return KeyT(i)
+}
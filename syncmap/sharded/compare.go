@@ -0,0 +1,32 @@
+package sharded
+
+// This file holds the methods comparing values with ==, which are only
+// generated if ValueT is comparable.
+
+// CompareAndSwap swaps the old and new values for key
+// if the value stored in the map is equal to old.
+func (m *Map) CompareAndSwap(key KeyT, old, new ValueT) (swapped bool) {
+	s := m.shardFor(key)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if value, ok := s.m[key]; !ok || value != old {
+		return false
+	}
+	s.m[key] = new
+	return true
+}
+
+// CompareAndDelete deletes the entry for key if its value is equal to old.
+//
+// If there is no current value for key in the map, CompareAndDelete
+// returns false.
+func (m *Map) CompareAndDelete(key KeyT, old ValueT) (deleted bool) {
+	s := m.shardFor(key)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if value, ok := s.m[key]; !ok || value != old {
+		return false
+	}
+	delete(s.m, key)
+	return true
+}
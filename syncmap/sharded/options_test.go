@@ -0,0 +1,36 @@
+package sharded
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestWithShards(t *testing.T) {
+	for _, tt := range []struct{ n, want int }{
+		{1, 1},
+		{3, 4},
+		{64, 64},
+		{100, 128},
+	} {
+		m := New(WithShards(tt.n))
+		for i := 0; i < 1000; i++ {
+			m.Store(newKeyT(i), newValueT(i))
+		}
+		if got := len(m.getShards()); got != tt.want {
+			t.Errorf("WithShards(%d) made %d shards; want %d", tt.n, got, tt.want)
+		}
+		if got := m.Len(); got != 1000 {
+			t.Errorf("WithShards(%d): Len() = %d; want 1000", tt.n, got)
+		}
+		for i := 0; i < 1000; i++ {
+			if got, ok := m.Load(newKeyT(i)); !ok || !reflect.DeepEqual(got, newValueT(i)) {
+				t.Fatalf("WithShards(%d): Load(%v) = %v, %v; want %v, true", tt.n, newKeyT(i), got, ok, newValueT(i))
+			}
+		}
+	}
+
+	var m Map
+	if got := len(m.getShards()); got < defaultShards() || got >= 2*defaultShards() {
+		t.Errorf("zero Map has %d shards; want the power of two at least %d", got, defaultShards())
+	}
+}
@@ -0,0 +1,184 @@
+// Package sharded is the template of a map split into shards, each guarded
+// by its own sync.RWMutex, generated with go-gen-syncmap -impl=sharded.
+//
+// It has the core API of the syncmap template. Writes to keys in different
+// shards don't contend, which suits write-heavy workloads.
+package sharded
+
+import (
+	"math/bits"
+	"runtime"
+	"sync"
+
+	"github.com/cristaloleg/go-gen-syncmap/syncmap/internal/shared"
+)
+
+// Map is like a Go map[KeyT]ValueT split into shards by a hash of the key,
+// so it is safe for concurrent use by multiple goroutines.
+//
+// The zero Map is empty and ready for use, with defaultShards shards. A Map
+// must not be copied after first use.
+type Map struct {
+	// n is the number of shards set by WithShards, or 0 for the default.
+	n int
+
+	once   sync.Once
+	seed   shared.HashSeed // picked on first use
+	shards []shard         // allocated on first use, a power of two of them
+	mask   uint64          // len(shards) - 1
+}
+
+// shard is a part of a Map guarded by its own lock.
+type shard struct {
+	_  shared.CacheLinePad // from the previous shard
+	mu sync.RWMutex
+	m  map[KeyT]ValueT
+}
+
+// defaultShards returns the number of shards of a Map created without
+// WithShards: a few per processor, so that writers rarely contend.
+func defaultShards() int {
+	return 4 * runtime.GOMAXPROCS(0)
+}
+
+// getShards returns the shards of m, allocating them on first use.
+func (m *Map) getShards() []shard {
+	m.once.Do(func() {
+		n := m.n
+		if n <= 0 {
+			n = defaultShards()
+		}
+		// Round up to a power of two, so that a mask picks the shard.
+		n = 1 << bits.Len(uint(n-1))
+		m.seed = shared.NewHashSeed()
+		m.shards = make([]shard, n)
+		m.mask = uint64(n - 1)
+	})
+	return m.shards
+}
+
+func (m *Map) shardFor(key KeyT) *shard {
+	shards := m.getShards()
+	return &shards[shared.HashKey(m.seed, key)&m.mask]
+}
+
+// Load returns the value stored in the map for a key, or the zero value if
+// no value is present.
+// The ok result indicates whether value was found in the map.
+func (m *Map) Load(key KeyT) (value ValueT, ok bool) {
+	s := m.shardFor(key)
+	s.mu.RLock()
+	value, ok = s.m[key]
+	s.mu.RUnlock()
+	return value, ok
+}
+
+// Store sets the value for a key.
+func (m *Map) Store(key KeyT, value ValueT) {
+	s := m.shardFor(key)
+	s.mu.Lock()
+	s.storeLocked(key, value)
+	s.mu.Unlock()
+}
+
+// LoadOrStore returns the existing value for the key if present.
+// Otherwise, it stores and returns the given value.
+// The loaded result is true if the value was loaded, false if stored.
+func (m *Map) LoadOrStore(key KeyT, value ValueT) (actual ValueT, loaded bool) {
+	s := m.shardFor(key)
+	s.mu.Lock()
+	actual, loaded = s.m[key]
+	if !loaded {
+		actual = value
+		s.storeLocked(key, value)
+	}
+	s.mu.Unlock()
+	return actual, loaded
+}
+
+// Swap swaps the value for a key and returns the previous value if any.
+// The loaded result reports whether the key was present.
+func (m *Map) Swap(key KeyT, value ValueT) (previous ValueT, loaded bool) {
+	s := m.shardFor(key)
+	s.mu.Lock()
+	previous, loaded = s.m[key]
+	s.storeLocked(key, value)
+	s.mu.Unlock()
+	return previous, loaded
+}
+
+// Delete deletes the value for a key.
+func (m *Map) Delete(key KeyT) {
+	s := m.shardFor(key)
+	s.mu.Lock()
+	delete(s.m, key)
+	s.mu.Unlock()
+}
+
+// Len returns the number of entries in the map.
+//
+// The shards are counted one at a time, so Len is only exact in the absence
+// of concurrent writes.
+func (m *Map) Len() int {
+	n := 0
+	shards := m.getShards()
+	for i := range shards {
+		s := &shards[i]
+		s.mu.RLock()
+		n += len(s.m)
+		s.mu.RUnlock()
+	}
+	return n
+}
+
+// Clear deletes all the entries, resulting in an empty Map.
+//
+// The shards are cleared one at a time, so a concurrent Range may observe
+// some shards cleared and others not.
+func (m *Map) Clear() {
+	shards := m.getShards()
+	for i := range shards {
+		s := &shards[i]
+		s.mu.Lock()
+		s.m = nil
+		s.mu.Unlock()
+	}
+}
+
+// Range calls f sequentially for each key and value present in the map.
+// If f returns false, range stops the iteration.
+//
+// No lock is held while f runs, so f may call any method of m. As with
+// sync.Map, Range does not necessarily correspond to any consistent snapshot
+// of the Map's contents: it visits the keys present in each shard when the
+// shard is reached, skipping those deleted since.
+func (m *Map) Range(f func(key KeyT, value ValueT) bool) {
+	var keys []KeyT
+	shards := m.getShards()
+	for i := range shards {
+		s := &shards[i]
+		s.mu.RLock()
+		keys = keys[:0]
+		for k := range s.m {
+			keys = append(keys, k)
+		}
+		s.mu.RUnlock()
+
+		for _, k := range keys {
+			v, ok := m.Load(k)
+			if !ok {
+				continue
+			}
+			if !f(k, v) {
+				return
+			}
+		}
+	}
+}
+
+func (s *shard) storeLocked(key KeyT, value ValueT) {
+	if s.m == nil {
+		s.m = make(map[KeyT]ValueT)
+	}
+	s.m[key] = value
+}
@@ -0,0 +1,12 @@
+package sharded
+
+import "github.com/cristaloleg/go-gen-syncmap/syncmap/internal/shared"
+
+// KeyT is a type for map's keys, that of the shared package, whose build
+// tags select the variant the map hashes.
+type KeyT = shared.KeyT
+
+// ValueT is a type for map's values.
+//
+// ValueT must be comparable for CompareAndSwap and CompareAndDelete.
+type ValueT int64
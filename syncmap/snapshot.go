@@ -0,0 +1,167 @@
+package syncmap
+
+import (
+	"context"
+	"io"
+	"os"
+	"sync"
+	"time"
+)
+
+// This file holds StartSnapshots, which saves a map periodically, such as
+// to keep a cache across restarts.
+
+// SnapshotSink stores the snapshots of a map taken by StartSnapshots.
+type SnapshotSink interface {
+	// WriteSnapshot stores the snapshot read from r, in the encoding of
+	// SaveTo, for LoadFrom to restore. It's called by one goroutine at a
+	// time, and must stop using r once it returns.
+	WriteSnapshot(ctx context.Context, r io.Reader) error
+}
+
+// SnapshotFile returns a SnapshotSink saving snapshots to the file name, of
+// mode perm, replaced atomically as SaveFile does, for LoadFile to restore.
+func SnapshotFile(name string, perm os.FileMode) SnapshotSink {
+	return snapshotFile{name: name, perm: perm}
+}
+
+// snapshotFile is the SnapshotSink returned by SnapshotFile.
+type snapshotFile struct {
+	name string
+	perm os.FileMode
+}
+
+func (f snapshotFile) WriteSnapshot(ctx context.Context, r io.Reader) error {
+	return writeFile(f.name, f.perm, func(w io.Writer) error {
+		_, err := io.Copy(w, r)
+		return err
+	})
+}
+
+// SnapshotOption configures the snapshots taken by StartSnapshots.
+type SnapshotOption func(*snapshots)
+
+// WithSnapshotRetries makes StartSnapshots retry a snapshot dest failed to
+// store up to n times, waiting backoff before the first retry, and twice as
+// long before each one after it.
+func WithSnapshotRetries(n int, backoff time.Duration) SnapshotOption {
+	return func(s *snapshots) {
+		s.retries = n
+		s.backoff = backoff
+	}
+}
+
+// WithSnapshotError makes StartSnapshots call f with the error of each
+// attempt at storing a snapshot that failed, numbered from 1, including
+// those it then retries.
+func WithSnapshotError(f func(attempt int, err error)) SnapshotOption {
+	return func(s *snapshots) {
+		s.onError = f
+	}
+}
+
+// snapshots is the state of the snapshots of a map.
+type snapshots struct {
+	m       *Map
+	dest    SnapshotSink
+	retries int
+	backoff time.Duration
+	onError func(attempt int, err error)
+}
+
+// StartSnapshots starts a goroutine saving a Snapshot of the map to dest
+// every interval, which must be positive, in the encoding of SaveTo,
+// streamed to dest rather than encoded into memory first. A snapshot taking
+// longer than interval delays the next one, rather than running alongside
+// it.
+//
+// The goroutine stops once ctx ends, canceling the snapshot in progress, if
+// any. The returned stop function stops it too, waits for it to return, and
+// then takes a last snapshot, with a context that never ends, so that the
+// map is saved as it is at shutdown; it returns the error of that snapshot,
+// and returns it again if called again, without taking another one.
+func (m *Map) StartSnapshots(ctx context.Context, interval time.Duration, dest SnapshotSink, opts ...SnapshotOption) (stop func() error) {
+	if interval <= 0 {
+		panic("syncmap: non-positive snapshot interval")
+	}
+	s := &snapshots{m: m, dest: dest}
+	for _, opt := range opts {
+		opt(s)
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		s.run(ctx, interval)
+	}()
+
+	var once sync.Once
+	var err error
+	return func() error {
+		once.Do(func() {
+			cancel()
+			<-done
+			err = s.take(context.Background())
+		})
+		return err
+	}
+}
+
+// run takes a snapshot every interval until ctx ends.
+func (s *snapshots) run(ctx context.Context, interval time.Duration) {
+	t := time.NewTicker(interval)
+	defer t.Stop()
+	for {
+		select {
+		case <-t.C:
+			s.take(ctx)
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// take takes a snapshot, retrying as set by WithSnapshotRetries until it's
+// stored or ctx ends, and returns the error of its last attempt.
+func (s *snapshots) take(ctx context.Context) error {
+	backoff := s.backoff
+	for attempt := 1; ; attempt++ {
+		err := s.write(ctx)
+		if err == nil {
+			return nil
+		}
+		if s.onError != nil {
+			s.onError(attempt, err)
+		}
+		if attempt > s.retries {
+			return err
+		}
+		t := time.NewTimer(backoff)
+		select {
+		case <-t.C:
+		case <-ctx.Done():
+			t.Stop()
+			return err
+		}
+		backoff *= 2
+	}
+}
+
+// write streams a snapshot of the map to the sink, encoding it as the sink
+// reads it.
+func (s *snapshots) write(ctx context.Context) error {
+	r, w := io.Pipe()
+	saved := make(chan error, 1)
+	go func() {
+		err := s.m.SaveTo(w)
+		w.CloseWithError(err)
+		saved <- err
+	}()
+	err := s.dest.WriteSnapshot(ctx, r)
+	// Unblock SaveTo if the sink returned before reading the whole snapshot.
+	r.Close()
+	if serr := <-saved; err == nil && serr != io.ErrClosedPipe {
+		err = serr
+	}
+	return err
+}
@@ -0,0 +1,116 @@
+//go:build !syncmap_ptrvalue
+
+package syncmap
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"path/filepath"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+)
+
+// memSink is a SnapshotSink keeping the snapshots it stores, failing the
+// first fails attempts.
+type memSink struct {
+	mu        sync.Mutex
+	fails     int
+	snapshots [][]byte
+}
+
+func (s *memSink) WriteSnapshot(ctx context.Context, r io.Reader) error {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.fails > 0 {
+		s.fails--
+		return errors.New("unavailable")
+	}
+	s.snapshots = append(s.snapshots, data)
+	return nil
+}
+
+func (s *memSink) last() []byte {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(s.snapshots) == 0 {
+		return nil
+	}
+	return s.snapshots[len(s.snapshots)-1]
+}
+
+func TestStartSnapshots(t *testing.T) {
+	var m Map
+	m.Store(newKeyT(0), newValueT(0))
+	sink := &memSink{fails: 2}
+	var mu sync.Mutex
+	var attempts []int
+	stop := m.StartSnapshots(context.Background(), time.Millisecond, sink,
+		WithSnapshotRetries(2, time.Millisecond),
+		WithSnapshotError(func(attempt int, err error) {
+			mu.Lock()
+			attempts = append(attempts, attempt)
+			mu.Unlock()
+		}))
+	for deadline := time.Now().Add(10 * time.Second); sink.last() == nil; time.Sleep(time.Millisecond) {
+		if time.Now().After(deadline) {
+			t.Fatal("StartSnapshots stored no snapshot")
+		}
+	}
+	m.Store(newKeyT(1), newValueT(1))
+	if err := stop(); err != nil {
+		t.Fatalf("stop: %v", err)
+	}
+	if err := stop(); err != nil {
+		t.Errorf("stop called again returned %v", err)
+	}
+	n := len(sink.snapshots)
+	time.Sleep(5 * time.Millisecond)
+	if len(sink.snapshots) != n {
+		t.Error("StartSnapshots kept taking snapshots once stopped")
+	}
+
+	mu.Lock()
+	if want := []int{1, 2}; !reflect.DeepEqual(attempts, want) {
+		t.Errorf("WithSnapshotError called with attempts %v; want %v", attempts, want)
+	}
+	mu.Unlock()
+	var restored Map
+	if err := restored.LoadFrom(bytes.NewReader(sink.last())); err != nil {
+		t.Fatalf("LoadFrom: %v", err)
+	}
+	if got, want := restored.Snapshot(), m.Snapshot(); !reflect.DeepEqual(got, want) {
+		t.Errorf("the last snapshot holds %v; want %v", got, want)
+	}
+}
+
+func TestSnapshotFile(t *testing.T) {
+	var m Map
+	for i := 0; i < 10; i++ {
+		m.Store(newKeyT(i), newValueT(i))
+	}
+	name := filepath.Join(t.TempDir(), "map")
+	ctx, cancel := context.WithCancel(context.Background())
+	stop := m.StartSnapshots(ctx, time.Hour, SnapshotFile(name, 0o600))
+	cancel()
+	if err := stop(); err != nil {
+		t.Fatalf("stop: %v", err)
+	}
+	var restored Map
+	if err := restored.LoadFile(name); err != nil {
+		t.Fatalf("LoadFile: %v", err)
+	}
+	if got, want := restored.Snapshot(), m.Snapshot(); !reflect.DeepEqual(got, want) {
+		t.Errorf("LoadFile restored %v; want %v", got, want)
+	}
+	if err := m.StartSnapshots(ctx, time.Hour, SnapshotFile(filepath.Join(name, "map"), 0o600))(); err == nil {
+		t.Error("stop succeeded saving into a file as directory")
+	}
+}
@@ -0,0 +1,52 @@
+package syncmap
+
+import "sync/atomic"
+
+// Stats describes the internal state of a Map, to tell why its loads take the
+// slow path.
+type Stats struct {
+	// Entries is the number of entries in the map, as Len returns.
+	Entries int
+
+	// ReadLen is the number of entries of the read map, which loads look up
+	// without locking, including those of deleted keys.
+	ReadLen int
+
+	// DirtyLen is the number of entries of the dirty map, which holds the
+	// keys stored since the read map was last replaced along with those of
+	// the read map, or 0 if there's none.
+	DirtyLen int
+
+	// Amended reports whether the dirty map holds keys missing from the read
+	// map, which loads of missing keys then lock the map to look for.
+	Amended bool
+
+	// Misses is the number of loads that locked the map since the read map
+	// was last replaced, which promote the dirty map once there are as many
+	// as it has entries, times the factor set by WithPromotionFactor.
+	Misses int
+
+	// Promotions is the number of times the dirty map was promoted to the
+	// read map, each copied by the next store of a new key.
+	Promotions int
+}
+
+// Stats returns the internal state of the map. It acquires the map's lock,
+// so Stats is consistent with respect to writes of new keys.
+func (m *Map) Stats() Stats {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	read := m.loadReadOnly()
+	n := atomic.LoadInt64(m.counter(read))
+	if n < 0 {
+		n = 0
+	}
+	return Stats{
+		Entries:    int(n),
+		ReadLen:    len(read.m),
+		DirtyLen:   len(m.dirty),
+		Amended:    read.amended,
+		Misses:     m.misses,
+		Promotions: m.promotions,
+	}
+}
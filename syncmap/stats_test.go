@@ -0,0 +1,23 @@
+package syncmap
+
+import "testing"
+
+func TestStats(t *testing.T) {
+	const mapSize = 8
+	var m Map
+	for i := 0; i < mapSize; i++ {
+		m.Store(newKeyT(i), newValueT(i))
+	}
+	m.Load(newKeyT(mapSize))
+	want := Stats{Entries: mapSize, DirtyLen: mapSize, Amended: true, Misses: 1}
+	if got := m.Stats(); got != want {
+		t.Fatalf("Stats() = %+v; want %+v", got, want)
+	}
+
+	m.Range(func(KeyT, ValueT) bool { return true })
+	m.Delete(newKeyT(0))
+	want = Stats{Entries: mapSize - 1, ReadLen: mapSize, Promotions: 1}
+	if got := m.Stats(); got != want {
+		t.Fatalf("Stats() after Range and Delete = %+v; want %+v", got, want)
+	}
+}
@@ -0,0 +1,33 @@
+package striped
+
+// This file holds the methods comparing values with ==, which are only
+// generated if ValueT is comparable.
+
+// CompareAndSwap swaps the old and new values for key
+// if the value stored in the map is equal to old.
+func (m *Map) CompareAndSwap(key KeyT, old, new ValueT) (swapped bool) {
+	h, s := m.lookup(key)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	e := m.find(key, h)
+	if e == nil || e.value != old {
+		return false
+	}
+	e.value = new
+	return true
+}
+
+// CompareAndDelete deletes the entry for key if its value is equal to old.
+//
+// If there is no current value for key in the map, CompareAndDelete
+// returns false.
+func (m *Map) CompareAndDelete(key KeyT, old ValueT) (deleted bool) {
+	h, s := m.lookup(key)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if e := m.find(key, h); e == nil || e.value != old {
+		return false
+	}
+	m.deleteLocked(s, key, h)
+	return true
+}
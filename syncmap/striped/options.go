@@ -0,0 +1,37 @@
+package striped
+
+// Option configures a Map created by New.
+type Option func(*Map)
+
+// WithStripes guards the map with n locks, rounded up to a power of two,
+// instead of a number scaled with GOMAXPROCS. More stripes mean less
+// contention between writers, at the cost of memory and of slower Len, Clear,
+// and growth of the table. n less than 1 selects the default.
+func WithStripes(n int) Option {
+	return func(m *Map) {
+		m.n = n
+	}
+}
+
+// WithEntryPooling makes the map keep up to 64 of the entries deleted from
+// each stripe, and reuse them for the keys stored next, rather than leave
+// them to the garbage collector and allocate new ones: maps that store and
+// delete millions of short-lived keys then allocate little. The entries kept
+// take memory while the map has no keys to reuse them for.
+func WithEntryPooling() Option {
+	return func(m *Map) {
+		m.pooling = true
+	}
+}
+
+// New returns an empty Map configured by opts.
+//
+// The zero Map is also empty and ready for use; New is only needed to pass
+// options.
+func New(opts ...Option) *Map {
+	m := new(Map)
+	for _, opt := range opts {
+		opt(m)
+	}
+	return m
+}
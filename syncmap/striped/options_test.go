@@ -0,0 +1,65 @@
+package striped
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestWithStripes(t *testing.T) {
+	for _, tt := range []struct{ n, want int }{
+		{1, 1},
+		{3, 4},
+		{64, 64},
+		{100, 128},
+	} {
+		m := New(WithStripes(tt.n))
+		for i := 0; i < 1000; i++ {
+			m.Store(newKeyT(i), newValueT(i))
+		}
+		if got := len(m.getStripes()); got != tt.want {
+			t.Errorf("WithStripes(%d) made %d stripes; want %d", tt.n, got, tt.want)
+		}
+		// The table grew with the entries, in multiples of the stripes.
+		if n := len(m.buckets); n < 1000/maxLoad/2 || n%tt.want != 0 {
+			t.Errorf("WithStripes(%d): table of %d buckets for 1000 entries", tt.n, n)
+		}
+		if got := m.Len(); got != 1000 {
+			t.Errorf("WithStripes(%d): Len() = %d; want 1000", tt.n, got)
+		}
+		for i := 0; i < 1000; i++ {
+			if got, ok := m.Load(newKeyT(i)); !ok || !reflect.DeepEqual(got, newValueT(i)) {
+				t.Fatalf("WithStripes(%d): Load(%v) = %v, %v; want %v, true", tt.n, newKeyT(i), got, ok, newValueT(i))
+			}
+		}
+		m.Clear()
+		if got := m.Len(); got != 0 || len(m.buckets) != tt.want {
+			t.Errorf("WithStripes(%d): after Clear, Len() = %d with %d buckets; want 0 with %d", tt.n, got, len(m.buckets), tt.want)
+		}
+	}
+
+	var m Map
+	if got := len(m.getStripes()); got < defaultStripes() || got >= 2*defaultStripes() {
+		t.Errorf("zero Map has %d stripes; want the power of two at least %d", got, defaultStripes())
+	}
+}
+
+func TestWithEntryPooling(t *testing.T) {
+	m := New(WithEntryPooling())
+	for i := 0; i < 100; i++ {
+		m.Store(newKeyT(i), newValueT(i))
+	}
+	k, v := newKeyT(100), newValueT(100)
+	allocs := testing.AllocsPerRun(100, func() {
+		m.Store(k, v)
+		m.Delete(k)
+	})
+	if allocs != 0 {
+		t.Errorf("Store and Delete of a new key allocated %v times; want 0", allocs)
+	}
+	m.Store(k, v)
+	for i := 0; i <= 100; i++ {
+		if got, ok := m.Load(newKeyT(i)); !ok || !reflect.DeepEqual(got, newValueT(i)) {
+			t.Fatalf("Load(%v) = %v, %v; want %v, true", newKeyT(i), got, ok, newValueT(i))
+		}
+	}
+}
@@ -0,0 +1,29 @@
+package striped
+
+// Stats describes the internal state of a Map, to tell whether its keys are
+// spread evenly over its stripes.
+type Stats struct {
+	// Entries is the number of entries in the map, as Len returns.
+	Entries int
+
+	// Stripes holds the number of entries of each stripe, in the order keys are
+	// hashed to them.
+	Stripes []int
+}
+
+// Stats returns the internal state of the map.
+//
+// The stripes are counted one at a time, so Stats is only exact in the
+// absence of concurrent writes.
+func (m *Map) Stats() Stats {
+	stripes := m.getStripes()
+	st := Stats{Stripes: make([]int, len(stripes))}
+	for i := range stripes {
+		s := &stripes[i]
+		s.mu.RLock()
+		st.Stripes[i] = s.n
+		s.mu.RUnlock()
+		st.Entries += st.Stripes[i]
+	}
+	return st
+}
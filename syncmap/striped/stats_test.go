@@ -0,0 +1,25 @@
+package striped
+
+import "testing"
+
+func TestStats(t *testing.T) {
+	const mapSize = 1000
+	m := New(WithStripes(4))
+	for i := 0; i < mapSize; i++ {
+		m.Store(newKeyT(i), newValueT(i))
+	}
+	st := m.Stats()
+	if st.Entries != mapSize || len(st.Stripes) != 4 {
+		t.Fatalf("Stats() = %+v; want %d entries in 4 stripes", st, mapSize)
+	}
+	sum := 0
+	for i, n := range st.Stripes {
+		if n == 0 {
+			t.Errorf("stripe %d is empty", i)
+		}
+		sum += n
+	}
+	if sum != mapSize {
+		t.Errorf("stripes hold %d entries; want %d", sum, mapSize)
+	}
+}
@@ -0,0 +1,328 @@
+// Package striped is the template of a map held in a single hash table whose
+// buckets are guarded by a fixed set of locks, or stripes, generated with
+// go-gen-syncmap -impl=striped.
+//
+// It has the core API of the syncmap template. As with the sharded template,
+// writes to keys of different stripes don't contend, but the keys share one
+// table, which grows as a whole: a map costs a bucket array and a few locks
+// rather than a map per shard, which suits memory-constrained services.
+package striped
+
+import (
+	"math/bits"
+	"runtime"
+	"sync"
+
+	"github.com/cristaloleg/go-gen-syncmap/syncmap/internal/shared"
+)
+
+// maxLoad is the average number of entries per bucket of a stripe above
+// which the table grows.
+const maxLoad = 4
+
+// maxFree is the number of deleted entries a stripe of a map created with
+// WithEntryPooling keeps for reuse.
+const maxFree = 64
+
+// Map is like a Go map[KeyT]ValueT held in a hash table whose buckets are
+// guarded by locks chosen by a hash of the key, so it is safe for concurrent
+// use by multiple goroutines.
+//
+// The zero Map is empty and ready for use, with defaultStripes stripes. A
+// Map must not be copied after first use.
+type Map struct {
+	// n is the number of stripes set by WithStripes, or 0 for the default.
+	n int
+
+	// pooling is set by WithEntryPooling.
+	pooling bool
+
+	once    sync.Once
+	seed    shared.HashSeed // picked on first use
+	stripes []stripe        // allocated on first use, a power of two of them
+	mask    uint64          // len(stripes) - 1
+
+	// buckets is the hash table, a multiple of len(stripes) long, so that
+	// the stripe of a bucket is that of the keys in it: bucket i is guarded
+	// by stripe i&mask. buckets itself is only replaced with every stripe
+	// locked.
+	buckets []*entry
+}
+
+// stripe is a lock guarding the buckets of a Map whose indexes have the
+// same low bits, along with the number of entries in them, and the deleted
+// entries kept for reuse by a map created with WithEntryPooling.
+type stripe struct {
+	_     shared.CacheLinePad // from the previous stripe
+	mu    sync.RWMutex
+	n     int
+	free  *entry // linked by next
+	nfree int
+}
+
+// entry is an entry of a bucket, which is a linked list of them.
+type entry struct {
+	key   KeyT
+	value ValueT
+	hash  uint64
+	next  *entry
+}
+
+// defaultStripes returns the number of stripes of a Map created without
+// WithStripes: a few per processor, so that writers rarely contend.
+func defaultStripes() int {
+	return 4 * runtime.GOMAXPROCS(0)
+}
+
+// getStripes returns the stripes of m, allocating them and the table on
+// first use.
+func (m *Map) getStripes() []stripe {
+	m.once.Do(func() {
+		n := m.n
+		if n <= 0 {
+			n = defaultStripes()
+		}
+		// Round up to a power of two, so that a mask picks the stripe.
+		n = 1 << bits.Len(uint(n-1))
+		m.seed = shared.NewHashSeed()
+		m.stripes = make([]stripe, n)
+		m.mask = uint64(n - 1)
+		m.buckets = make([]*entry, n)
+	})
+	return m.stripes
+}
+
+// lookup returns the hash of key and its stripe.
+func (m *Map) lookup(key KeyT) (uint64, *stripe) {
+	stripes := m.getStripes()
+	h := shared.HashKey(m.seed, key)
+	return h, &stripes[h&m.mask]
+}
+
+// bucket returns the bucket of the hash h. The stripe of h must be locked.
+func (m *Map) bucket(h uint64) **entry {
+	return &m.buckets[h&uint64(len(m.buckets)-1)]
+}
+
+// find returns the entry of key, whose hash is h, or nil if there is none.
+// The stripe of h must be locked.
+func (m *Map) find(key KeyT, h uint64) *entry {
+	for e := *m.bucket(h); e != nil; e = e.next {
+		if e.hash == h && shared.EqualKey(e.key, key) {
+			return e
+		}
+	}
+	return nil
+}
+
+// Load returns the value stored in the map for a key, or the zero value if
+// no value is present.
+// The ok result indicates whether value was found in the map.
+func (m *Map) Load(key KeyT) (value ValueT, ok bool) {
+	h, s := m.lookup(key)
+	s.mu.RLock()
+	if e := m.find(key, h); e != nil {
+		value, ok = e.value, true
+	}
+	s.mu.RUnlock()
+	return value, ok
+}
+
+// Store sets the value for a key.
+func (m *Map) Store(key KeyT, value ValueT) {
+	h, s := m.lookup(key)
+	s.mu.Lock()
+	if e := m.find(key, h); e != nil {
+		e.value = value
+		s.mu.Unlock()
+		return
+	}
+	n, grow := m.insertLocked(s, key, value, h)
+	s.mu.Unlock()
+	if grow {
+		m.grow(n)
+	}
+}
+
+// LoadOrStore returns the existing value for the key if present.
+// Otherwise, it stores and returns the given value.
+// The loaded result is true if the value was loaded, false if stored.
+func (m *Map) LoadOrStore(key KeyT, value ValueT) (actual ValueT, loaded bool) {
+	h, s := m.lookup(key)
+	s.mu.Lock()
+	if e := m.find(key, h); e != nil {
+		actual = e.value
+		s.mu.Unlock()
+		return actual, true
+	}
+	n, grow := m.insertLocked(s, key, value, h)
+	s.mu.Unlock()
+	if grow {
+		m.grow(n)
+	}
+	return value, false
+}
+
+// Swap swaps the value for a key and returns the previous value if any.
+// The loaded result reports whether the key was present.
+func (m *Map) Swap(key KeyT, value ValueT) (previous ValueT, loaded bool) {
+	h, s := m.lookup(key)
+	s.mu.Lock()
+	if e := m.find(key, h); e != nil {
+		previous, e.value = e.value, value
+		s.mu.Unlock()
+		return previous, true
+	}
+	n, grow := m.insertLocked(s, key, value, h)
+	s.mu.Unlock()
+	if grow {
+		m.grow(n)
+	}
+	return previous, false
+}
+
+// Delete deletes the value for a key.
+func (m *Map) Delete(key KeyT) {
+	h, s := m.lookup(key)
+	s.mu.Lock()
+	m.deleteLocked(s, key, h)
+	s.mu.Unlock()
+}
+
+// Len returns the number of entries in the map.
+//
+// The stripes are counted one at a time, so Len is only exact in the absence
+// of concurrent writes.
+func (m *Map) Len() int {
+	n := 0
+	stripes := m.getStripes()
+	for i := range stripes {
+		s := &stripes[i]
+		s.mu.RLock()
+		n += s.n
+		s.mu.RUnlock()
+	}
+	return n
+}
+
+// Clear deletes all the entries, resulting in an empty Map.
+//
+// Every stripe is locked while the table is replaced, so Clear takes effect
+// at once, and shrinks the table back to its initial size.
+func (m *Map) Clear() {
+	stripes := m.getStripes()
+	m.lockAll()
+	for i := range stripes {
+		stripes[i].n = 0
+	}
+	m.buckets = make([]*entry, len(stripes))
+	m.unlockAll()
+}
+
+// Range calls f sequentially for each key and value present in the map.
+// If f returns false, range stops the iteration.
+//
+// No lock is held while f runs, so f may call any method of m. As with
+// sync.Map, Range does not necessarily correspond to any consistent snapshot
+// of the Map's contents: it visits the keys present in each stripe when the
+// stripe is reached, skipping those deleted since.
+func (m *Map) Range(f func(key KeyT, value ValueT) bool) {
+	var keys []KeyT
+	stripes := m.getStripes()
+	for i := range stripes {
+		s := &stripes[i]
+		s.mu.RLock()
+		keys = keys[:0]
+		for b := i; b < len(m.buckets); b += len(stripes) {
+			for e := m.buckets[b]; e != nil; e = e.next {
+				keys = append(keys, e.key)
+			}
+		}
+		s.mu.RUnlock()
+
+		for _, k := range keys {
+			v, ok := m.Load(k)
+			if !ok {
+				continue
+			}
+			if !f(k, v) {
+				return
+			}
+		}
+	}
+}
+
+// insertLocked adds an entry for key, which must be absent, to the stripe s
+// of its hash h, which must be locked. It returns the length of the table,
+// and whether the stripe now holds enough entries for the table to grow.
+func (m *Map) insertLocked(s *stripe, key KeyT, value ValueT, h uint64) (n int, grow bool) {
+	b := m.bucket(h)
+	e := s.free
+	if e != nil {
+		s.free = e.next
+		s.nfree--
+	} else {
+		e = new(entry)
+	}
+	*e = entry{key: key, value: value, hash: h, next: *b}
+	*b = e
+	s.n++
+	n = len(m.buckets)
+	return n, s.n > maxLoad*(n/len(m.stripes))
+}
+
+// deleteLocked removes the entry of key, if any, from the stripe s of its
+// hash h, which must be locked.
+func (m *Map) deleteLocked(s *stripe, key KeyT, h uint64) {
+	for p := m.bucket(h); *p != nil; p = &(*p).next {
+		if e := *p; e.hash == h && shared.EqualKey(e.key, key) {
+			*p = e.next
+			s.n--
+			if m.pooling && s.nfree < maxFree {
+				// Entries are only reached with their stripe locked, so
+				// this one can be reused at once. It's zeroed not to keep
+				// its key and value alive meanwhile.
+				*e = entry{next: s.free}
+				s.free = e
+				s.nfree++
+			}
+			return
+		}
+	}
+}
+
+// grow doubles the table, unless it no longer has n buckets because another
+// goroutine grew or cleared it first.
+func (m *Map) grow(n int) {
+	m.lockAll()
+	defer m.unlockAll()
+	if len(m.buckets) != n {
+		return
+	}
+	buckets := make([]*entry, 2*n)
+	mask := uint64(len(buckets) - 1)
+	for _, e := range m.buckets {
+		for e != nil {
+			next := e.next
+			b := &buckets[e.hash&mask]
+			e.next = *b
+			*b = e
+			e = next
+		}
+	}
+	m.buckets = buckets
+}
+
+// lockAll locks every stripe of m for writing, in order, so that goroutines
+// locking all of them don't deadlock.
+func (m *Map) lockAll() {
+	for i := range m.stripes {
+		m.stripes[i].mu.Lock()
+	}
+}
+
+func (m *Map) unlockAll() {
+	for i := range m.stripes {
+		m.stripes[i].mu.Unlock()
+	}
+}
@@ -0,0 +1,33 @@
+package swiss
+
+// This file holds the methods comparing values with ==, which are only
+// generated if ValueT is comparable.
+
+// CompareAndSwap swaps the old and new values for key
+// if the value stored in the map is equal to old.
+func (m *Map) CompareAndSwap(key KeyT, old, new ValueT) (swapped bool) {
+	h, s := m.lookup(key)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	sl := s.find(key, h)
+	if sl == nil || sl.value != old {
+		return false
+	}
+	sl.value = new
+	return true
+}
+
+// CompareAndDelete deletes the entry for key if its value is equal to old.
+//
+// If there is no current value for key in the map, CompareAndDelete
+// returns false.
+func (m *Map) CompareAndDelete(key KeyT, old ValueT) (deleted bool) {
+	h, s := m.lookup(key)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if sl := s.find(key, h); sl == nil || sl.value != old {
+		return false
+	}
+	s.remove(key, h)
+	return true
+}
@@ -0,0 +1,107 @@
+package swiss
+
+import (
+	"math/rand"
+	"testing"
+
+	"github.com/cristaloleg/go-gen-syncmap/syncmap/internal/shared"
+)
+
+func TestMatch(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	ctrls := []uint8{ctrlEmpty, ctrlDeleted, 0, 1, 0x7f}
+	for i := 0; i < 10000; i++ {
+		var ctrl uint64
+		for j := 0; j < groupSize; j++ {
+			c := ctrls[r.Intn(len(ctrls))]
+			if r.Intn(2) == 0 {
+				c = uint8(r.Intn(0x80))
+			}
+			ctrl |= uint64(c) << (8 * j)
+		}
+		h2 := uint8(r.Intn(0x80))
+		empty, free, full, hash := matchEmpty(ctrl), matchFree(ctrl), matchFull(ctrl), matchHash(ctrl, h2)
+		for j := 0; j < groupSize; j++ {
+			c, bit := uint8(ctrl>>(8*j)), uint64(0x80)<<(8*j)
+			if got := empty&bit != 0; got != (c == ctrlEmpty) {
+				t.Fatalf("matchEmpty(%#x) byte %d = %v", ctrl, j, got)
+			}
+			if got := free&bit != 0; got != (c == ctrlEmpty || c == ctrlDeleted) {
+				t.Fatalf("matchFree(%#x) byte %d = %v", ctrl, j, got)
+			}
+			if got := full&bit != 0; got != (c < 0x80) {
+				t.Fatalf("matchFull(%#x) byte %d = %v", ctrl, j, got)
+			}
+			// matchHash may have false positives, but never on free slots.
+			if got := hash&bit != 0; !got && c == h2 || got && c >= 0x80 {
+				t.Fatalf("matchHash(%#x, %#x) byte %d = %v", ctrl, h2, j, got)
+			}
+		}
+	}
+}
+
+// checkShards checks that every entry of m is found by the probe of its
+// hash, and that the counts of its shards are right.
+func checkShards(t *testing.T, m *Map) {
+	t.Helper()
+	for si := range m.shards {
+		s := &m.shards[si]
+		n, tombstones := 0, 0
+		for gi := range s.groups {
+			g := &s.groups[gi]
+			for i := 0; i < groupSize; i++ {
+				c := uint8(g.ctrl >> (8 * i))
+				switch {
+				case c == ctrlDeleted:
+					tombstones++
+				case c < 0x80:
+					n++
+					h := shared.HashKey(m.seed, g.slots[i].key)
+					if c != uint8(h>>57) {
+						t.Fatalf("key %v has control byte %#x; want %#x", g.slots[i].key, c, uint8(h>>57))
+					}
+					if s.find(g.slots[i].key, h) != &g.slots[i] {
+						t.Fatalf("key %v isn't found where it is", g.slots[i].key)
+					}
+				}
+			}
+		}
+		if n != s.n || tombstones != s.tombstones {
+			t.Fatalf("shard %d has %d entries and %d tombstones; counted %d and %d", si, n, tombstones, s.n, s.tombstones)
+		}
+	}
+}
+
+func TestSwissTable(t *testing.T) {
+	m := New(WithShards(2))
+	r := rand.New(rand.NewSource(1))
+	for i := 0; i < 20000; i++ {
+		k := newKeyT(r.Intn(1000))
+		if r.Intn(3) == 0 {
+			m.Delete(k)
+		} else {
+			m.Store(k, newValueT(i))
+		}
+		if i%1000 == 0 {
+			checkShards(t, m)
+		}
+	}
+	checkShards(t, m)
+}
+
+func TestWithCapacity(t *testing.T) {
+	m := New(WithShards(4), WithCapacity(1000))
+	size := len(m.getShards()[0].groups)
+	if size*maxLoad < 1000/4 {
+		t.Fatalf("WithCapacity(1000) made shards of %d groups", size)
+	}
+	for i := 0; i < 800; i++ {
+		m.Store(newKeyT(i), newValueT(i))
+	}
+	for i := range m.shards {
+		if got := len(m.shards[i].groups); got != size {
+			t.Errorf("shard %d grew from %d to %d groups within its capacity", i, size, got)
+		}
+	}
+	checkShards(t, m)
+}
@@ -0,0 +1,29 @@
+package swiss
+
+// Stats describes the internal state of a Map, to tell whether its keys are
+// spread evenly over its shards.
+type Stats struct {
+	// Entries is the number of entries in the map, as Len returns.
+	Entries int
+
+	// Shards holds the number of entries of each shard, in the order keys are
+	// hashed to them.
+	Shards []int
+}
+
+// Stats returns the internal state of the map.
+//
+// The shards are counted one at a time, so Stats is only exact in the
+// absence of concurrent writes.
+func (m *Map) Stats() Stats {
+	shards := m.getShards()
+	st := Stats{Shards: make([]int, len(shards))}
+	for i := range shards {
+		s := &shards[i]
+		s.mu.RLock()
+		st.Shards[i] = s.n
+		s.mu.RUnlock()
+		st.Entries += st.Shards[i]
+	}
+	return st
+}
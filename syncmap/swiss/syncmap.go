@@ -0,0 +1,405 @@
+// Package swiss is the template of a map split into shards, each a Swiss
+// table guarded by its own sync.RWMutex, generated with go-gen-syncmap
+// -impl=swiss.
+//
+// It has the core API of the syncmap template. The table of a shard is an
+// array of groups of eight slots, each group with a word of control bytes
+// holding 7 bits of the hash of the key of each slot. A lookup compares the
+// control bytes of a group with those bits all at once, and only compares
+// the keys of the slots that match, so that probing is dense and cheap even
+// at high loads.
+package swiss
+
+import (
+	"math/bits"
+	"runtime"
+	"sync"
+
+	"github.com/cristaloleg/go-gen-syncmap/syncmap/internal/shared"
+)
+
+const (
+	// groupSize is the number of slots of a group, one per byte of its
+	// control word.
+	groupSize = 8
+
+	// maxLoad is the number of used slots per group, holding entries or
+	// tombstones, above which a shard is rehashed.
+	maxLoad = 7
+)
+
+// Control bytes of a slot. Full slots have the 7 bits of the hash of their
+// key as control byte, with the high bit clear.
+const (
+	ctrlEmpty   = 0b1000_0000
+	ctrlDeleted = 0b1111_1110 // tombstone, probes continue past it
+)
+
+// Map is like a Go map[KeyT]ValueT split into shards by a hash of the key,
+// each a Swiss table, so it is safe for concurrent use by multiple
+// goroutines.
+//
+// The zero Map is empty and ready for use, with defaultShards shards. A Map
+// must not be copied after first use.
+type Map struct {
+	// n and capacity are set by WithShards and WithCapacity.
+	n, capacity int
+
+	once   sync.Once
+	seed   shared.HashSeed // picked on first use
+	shards []shard         // allocated on first use, a power of two of them
+	mask   uint64          // len(shards) - 1
+}
+
+// shard is a part of a Map guarded by its own lock.
+type shard struct {
+	_          shared.CacheLinePad // from the previous shard
+	mu         sync.RWMutex
+	seed       shared.HashSeed // that of the Map, which rehashing the keys needs
+	groups     []group         // a power of two of them, or none
+	n          int             // number of entries
+	tombstones int             // number of deleted slots
+}
+
+// group is a group of slots and their control bytes, byte i of ctrl being
+// that of slot i.
+type group struct {
+	ctrl  uint64
+	slots [groupSize]slot
+}
+
+type slot struct {
+	key   KeyT
+	value ValueT
+}
+
+// defaultShards returns the number of shards of a Map created without
+// WithShards: a few per processor, so that writers rarely contend.
+func defaultShards() int {
+	return 4 * runtime.GOMAXPROCS(0)
+}
+
+// getShards returns the shards of m, allocating them on first use.
+func (m *Map) getShards() []shard {
+	m.once.Do(func() {
+		n := m.n
+		if n <= 0 {
+			n = defaultShards()
+		}
+		// Round up to a power of two, so that a mask picks the shard.
+		n = 1 << bits.Len(uint(n-1))
+		m.seed = shared.NewHashSeed()
+		m.shards = make([]shard, n)
+		m.mask = uint64(n - 1)
+		for i := range m.shards {
+			m.shards[i].seed = m.seed
+			if m.capacity > 0 {
+				m.shards[i].rehash(m.capacity / n)
+			}
+		}
+	})
+	return m.shards
+}
+
+// lookup returns the hash of key and its shard. The low bits of the hash
+// pick the shard, the high 7 bits are the control byte of its slot, and the
+// bits in between pick the first group to probe.
+func (m *Map) lookup(key KeyT) (uint64, *shard) {
+	shards := m.getShards()
+	h := shared.HashKey(m.seed, key)
+	return h, &shards[h&m.mask]
+}
+
+// Load returns the value stored in the map for a key, or the zero value if
+// no value is present.
+// The ok result indicates whether value was found in the map.
+func (m *Map) Load(key KeyT) (value ValueT, ok bool) {
+	h, s := m.lookup(key)
+	s.mu.RLock()
+	if sl := s.find(key, h); sl != nil {
+		value, ok = sl.value, true
+	}
+	s.mu.RUnlock()
+	return value, ok
+}
+
+// Store sets the value for a key.
+func (m *Map) Store(key KeyT, value ValueT) {
+	h, s := m.lookup(key)
+	s.mu.Lock()
+	if sl := s.find(key, h); sl != nil {
+		sl.value = value
+	} else {
+		s.insert(key, value, h)
+	}
+	s.mu.Unlock()
+}
+
+// LoadOrStore returns the existing value for the key if present.
+// Otherwise, it stores and returns the given value.
+// The loaded result is true if the value was loaded, false if stored.
+func (m *Map) LoadOrStore(key KeyT, value ValueT) (actual ValueT, loaded bool) {
+	h, s := m.lookup(key)
+	s.mu.Lock()
+	if sl := s.find(key, h); sl != nil {
+		actual, loaded = sl.value, true
+	} else {
+		actual = value
+		s.insert(key, value, h)
+	}
+	s.mu.Unlock()
+	return actual, loaded
+}
+
+// Swap swaps the value for a key and returns the previous value if any.
+// The loaded result reports whether the key was present.
+func (m *Map) Swap(key KeyT, value ValueT) (previous ValueT, loaded bool) {
+	h, s := m.lookup(key)
+	s.mu.Lock()
+	if sl := s.find(key, h); sl != nil {
+		previous, loaded = sl.value, true
+		sl.value = value
+	} else {
+		s.insert(key, value, h)
+	}
+	s.mu.Unlock()
+	return previous, loaded
+}
+
+// Delete deletes the value for a key.
+func (m *Map) Delete(key KeyT) {
+	h, s := m.lookup(key)
+	s.mu.Lock()
+	s.remove(key, h)
+	s.mu.Unlock()
+}
+
+// Len returns the number of entries in the map.
+//
+// The shards are counted one at a time, so Len is only exact in the absence
+// of concurrent writes.
+func (m *Map) Len() int {
+	n := 0
+	shards := m.getShards()
+	for i := range shards {
+		s := &shards[i]
+		s.mu.RLock()
+		n += s.n
+		s.mu.RUnlock()
+	}
+	return n
+}
+
+// Clear deletes all the entries, resulting in an empty Map.
+//
+// The shards are cleared one at a time, so a concurrent Range may observe
+// some shards cleared and others not.
+func (m *Map) Clear() {
+	shards := m.getShards()
+	for i := range shards {
+		s := &shards[i]
+		s.mu.Lock()
+		s.groups, s.n, s.tombstones = nil, 0, 0
+		s.mu.Unlock()
+	}
+}
+
+// Range calls f sequentially for each key and value present in the map.
+// If f returns false, range stops the iteration.
+//
+// No lock is held while f runs, so f may call any method of m. As with
+// sync.Map, Range does not necessarily correspond to any consistent snapshot
+// of the Map's contents: it visits the keys present in each shard when the
+// shard is reached, skipping those deleted since.
+func (m *Map) Range(f func(key KeyT, value ValueT) bool) {
+	var keys []KeyT
+	shards := m.getShards()
+	for i := range shards {
+		s := &shards[i]
+		s.mu.RLock()
+		keys = keys[:0]
+		for j := range s.groups {
+			g := &s.groups[j]
+			for full := matchFull(g.ctrl); full != 0; full &= full - 1 {
+				keys = append(keys, g.slots[first(full)].key)
+			}
+		}
+		s.mu.RUnlock()
+
+		for _, k := range keys {
+			v, ok := m.Load(k)
+			if !ok {
+				continue
+			}
+			if !f(k, v) {
+				return
+			}
+		}
+	}
+}
+
+// The match functions return a word with the high bit of each byte of a
+// control word set if the byte matches, and the others clear.
+
+const (
+	lsb = 0x0101010101010101
+	msb = 0x8080808080808080
+)
+
+// matchHash matches the control bytes equal to h2, and sometimes the byte
+// after a match: the keys of matching slots must be compared anyway.
+func matchHash(ctrl uint64, h2 uint8) uint64 {
+	v := ctrl ^ (lsb * uint64(h2))
+	return (v - lsb) &^ v & msb
+}
+
+// matchEmpty matches the empty slots.
+func matchEmpty(ctrl uint64) uint64 {
+	// Of the bytes with the high bit set, only ctrlEmpty has bit 1 clear.
+	return ctrl &^ (ctrl << 6) & msb
+}
+
+// matchFree matches the empty and deleted slots.
+func matchFree(ctrl uint64) uint64 {
+	return ctrl & msb
+}
+
+// matchFull matches the slots holding entries.
+func matchFull(ctrl uint64) uint64 {
+	return ^ctrl & msb
+}
+
+// first returns the index of the first slot of a match.
+func first(match uint64) int {
+	return bits.TrailingZeros64(match) / 8
+}
+
+// setCtrl sets the control byte of slot i of g to c.
+func (g *group) setCtrl(i int, c uint8) {
+	g.ctrl = g.ctrl&^(0xff<<(8*i)) | uint64(c)<<(8*i)
+}
+
+// probe returns the groups a key of hash h is looked for in, in order,
+// which visit every group of the shard.
+type probe struct {
+	g, step, mask uint64
+}
+
+func (s *shard) probe(h uint64) probe {
+	mask := uint64(len(s.groups) - 1)
+	return probe{g: h >> 16 & mask, mask: mask}
+}
+
+func (p *probe) next() {
+	// Triangular numbers visit every group of a power of two of them.
+	p.step++
+	p.g = (p.g + p.step) & p.mask
+}
+
+// find returns the slot of key, whose hash is h, or nil if it's absent.
+func (s *shard) find(key KeyT, h uint64) *slot {
+	if len(s.groups) == 0 {
+		return nil
+	}
+	h2 := uint8(h >> 57)
+	for p := s.probe(h); ; p.next() {
+		g := &s.groups[p.g]
+		for match := matchHash(g.ctrl, h2); match != 0; match &= match - 1 {
+			if sl := &g.slots[first(match)]; shared.EqualKey(sl.key, key) {
+				return sl
+			}
+		}
+		// A probe stops at the first group with an empty slot, where key
+		// would have been inserted.
+		if matchEmpty(g.ctrl) != 0 {
+			return nil
+		}
+	}
+}
+
+// insert adds an entry for key, which must be absent, rehashing the table if
+// too few of its slots are free.
+func (s *shard) insert(key KeyT, value ValueT, h uint64) {
+	if s.n+s.tombstones >= maxLoad*len(s.groups) {
+		s.rehash(s.n + 1)
+	}
+	s.place(key, value, h)
+	s.n++
+}
+
+// place puts an entry in the first free slot of the probe of h.
+func (s *shard) place(key KeyT, value ValueT, h uint64) {
+	for p := s.probe(h); ; p.next() {
+		g := &s.groups[p.g]
+		if free := matchFree(g.ctrl); free != 0 {
+			i := first(free)
+			if matchEmpty(g.ctrl)&(0x80<<(8*i)) == 0 {
+				s.tombstones--
+			}
+			g.setCtrl(i, uint8(h>>57))
+			g.slots[i] = slot{key, value}
+			return
+		}
+	}
+}
+
+// remove deletes the entry of key, whose hash is h, if any. Its slot becomes
+// empty if its group has an empty slot, which stops probes anyway, and a
+// tombstone otherwise.
+func (s *shard) remove(key KeyT, h uint64) {
+	if len(s.groups) == 0 {
+		return
+	}
+	h2 := uint8(h >> 57)
+	for p := s.probe(h); ; p.next() {
+		g := &s.groups[p.g]
+		for match := matchHash(g.ctrl, h2); match != 0; match &= match - 1 {
+			i := first(match)
+			if !shared.EqualKey(g.slots[i].key, key) {
+				continue
+			}
+			if matchEmpty(g.ctrl) != 0 {
+				g.setCtrl(i, ctrlEmpty)
+			} else {
+				g.setCtrl(i, ctrlDeleted)
+				s.tombstones++
+			}
+			// Drop the references of the entry, if any.
+			g.slots[i] = slot{}
+			s.n--
+			return
+		}
+		if matchEmpty(g.ctrl) != 0 {
+			return
+		}
+	}
+}
+
+// rehash reallocates the table of s with enough groups for n entries, twice
+// as many as it has if its entries rather than its tombstones fill it, and
+// reinserts its entries, dropping its tombstones.
+func (s *shard) rehash(n int) {
+	size := len(s.groups)
+	switch {
+	case size == 0:
+		size = 1
+	case 2*s.n >= maxLoad*size:
+		size *= 2
+	}
+	for n > maxLoad*size {
+		size *= 2
+	}
+	old := s.groups
+	s.groups = make([]group, size)
+	for i := range s.groups {
+		s.groups[i].ctrl = lsb * ctrlEmpty
+	}
+	s.tombstones = 0
+	for i := range old {
+		g := &old[i]
+		for full := matchFull(g.ctrl); full != 0; full &= full - 1 {
+			sl := &g.slots[first(full)]
+			s.place(sl.key, sl.value, shared.HashKey(s.seed, sl.key))
+		}
+	}
+}
@@ -0,0 +1,13 @@
+//go:build syncmap_customkey
+
+package swiss
+
+import "strconv"
+
+func newKeyT(i int) KeyT {
+	return KeyT(strconv.Itoa(i))
+}
+
+func newValueT(i int) ValueT {
+	return ValueT(i)
+}
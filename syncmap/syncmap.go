@@ -5,9 +5,12 @@
 package syncmap
 
 import (
+	"sort"
 	"sync"
 	"sync/atomic"
 	"unsafe"
+
+	"github.com/cristaloleg/go-gen-syncmap/syncmap/internal/shared"
 )
 
 // Map is like a Go map[KeyT]ValueT but is safe for concurrent use
@@ -26,7 +29,26 @@ import (
 //
 // The zero Map is empty and ready for use. A Map must not be copied after first use.
 type Map struct {
+	// count is the number of live entries in the map until the first call to
+	// Clear, which moves counting to the read map (see readOnly.count). It is
+	// accessed atomically and must stay first in the struct to be 64-bit
+	// aligned on 32-bit platforms.
+	count int64
+
+	// metrics are the counters of maps generated with -metrics. They follow
+	// count to be 64-bit aligned too.
+	metrics counters
+
+	// lru is the state of the eviction of maps generated with -maxentries,
+	// whose clock ticks when keys may have been added.
+	lru eviction
+
+	// The pads keep count, written when keys are added and deleted, and mu,
+	// locked on the slow path, off the cache line of read, which every load
+	// reads.
+	_  shared.CacheLinePad
 	mu sync.Mutex
+	_  shared.CacheLinePad
 
 	// read contains the portion of the map's contents that are safe for
 	// concurrent access (with or without mu held).
@@ -37,7 +59,7 @@ type Map struct {
 	// Entries stored in read may be updated concurrently without mu, but updating
 	// a previously-expunged entry requires that the entry be copied to the dirty
 	// map and unexpunged with mu held.
-	read atomic.Value // readOnly
+	read readOnlyPointer
 
 	// dirty contains the portion of the map's contents that require mu to be
 	// held. To ensure that the dirty map can be promoted to the read map quickly,
@@ -58,20 +80,95 @@ type Map struct {
 	// map, the dirty map will be promoted to the read map (in the unamended
 	// state) and the next store to the map will make a new dirty copy.
 	misses int
+
+	// promotionFactor is the factor set by WithPromotionFactor, by which the
+	// size of the dirty map is multiplied to get the number of misses that
+	// promote it. It is 1 if not positive.
+	promotionFactor float64
+
+	// promotions counts the times the dirty map was promoted, for Stats.
+	promotions int
+
+	// compactFraction is the fraction set by WithAutoCompact, of the entries
+	// of the read map under which deletions compact the map, or 0.
+	compactFraction float64
+
+	// capacity is the size hint set by WithCapacity. It is used when the dirty
+	// map is allocated and is smaller than the hint.
+	capacity int
+
+	// copier is the function set by WithCopy, if any, applied to values
+	// passed in by callers before they are stored.
+	copier func(ValueT) ValueT
+
+	// onEvict is the function set by WithOnEvict, if any, called with the
+	// entries the map removes by itself.
+	onEvict func(KeyT, ValueT, Reason)
+
+	// hooks are the functions set by WithHooks.
+	hooks Hooks
+
+	// loader is the state of the loader set by WithLoader, in maps generated
+	// with -loader.
+	loader loading
+
+	// backend is the store set by WithBackend, in maps generated with
+	// -backend.
+	backend backing
+
+	// telemetry are the instruments set by WithMeter and WithTracer, in maps
+	// generated with -otel.
+	telemetry instruments
+
+	// expiry is the state of the janitor set by WithJanitor.
+	expiry expiry
+}
+
+// loadReadOnly returns the current read map.
+func (m *Map) loadReadOnly() readOnly {
+	if p := m.read.Load(); p != nil {
+		return *p
+	}
+	return readOnly{}
 }
 
 // readOnly is an immutable struct stored atomically in the Map.read field.
 type readOnly struct {
 	m       map[KeyT]*entry
 	amended bool // true if the dirty map contains some key not in m.
+
+	// count is the number of live entries for this generation of the map, or
+	// nil if Map.count should be used. Clear starts a new generation so that
+	// writers still holding entries of the old one can't skew the new count.
+	count *int64
+
+	// frozen is set by Freeze, after which the read map is never replaced.
+	frozen bool
+}
+
+// checkWritable panics if read is the read map of a frozen map.
+func (read readOnly) checkWritable() {
+	if read.frozen {
+		panic("syncmap: write to a frozen map")
+	}
 }
 
 // expunged is an arbitrary pointer that marks entries which have been deleted
-// from the dirty map.
-var expunged = unsafe.Pointer(new(ValueT))
+// from the dirty map. It points to an any, which isn't zero-sized, rather than
+// to a ValueT: pointers to distinct zero-sized variables may be equal, so
+// storing a zero-sized value would expunge its entry.
+var expunged = unsafe.Pointer(new(any))
 
 // An entry is a slot in the map corresponding to a particular key.
 type entry struct {
+	// loaded is when the value was loaded, in maps generated with -loader,
+	// and recency when the entry was last used, in maps generated with
+	// -maxentries. They come first because they take no space otherwise,
+	// which a last field would, and loaded before recency, to be 64-bit
+	// aligned on 32-bit platforms.
+	loaded  loadTime
+	recency recency
+
 	// p points to the ValueT value stored for the entry.
 	//
 	// If p == nil, the entry has been deleted and m.dirty == nil.
@@ -93,22 +190,45 @@ type entry struct {
 	p unsafe.Pointer // *ValueT
 }
 
+// copied returns value, copied by the WithCopy function if there is one.
+func (m *Map) copied(value ValueT) ValueT {
+	if m.copier == nil {
+		return value
+	}
+	return m.copier(value)
+}
+
 func newEntry(i ValueT) *entry {
-	return &entry{p: unsafe.Pointer(&i)}
+	return &entry{p: boxValue(i)}
 }
 
-// Load returns the value stored in the map for a key, or nil if no
-// value is present.
+// Load returns the value stored in the map for a key, or the zero ValueT if
+// no value is present: nil for pointer, slice, and map values, and a struct
+// of zero fields for struct values.
 // The ok result indicates whether value was found in the map.
+//
+// In maps generated with -loader and given WithLoader, a Load missing the key
+// loads its value as GetE does, with context.Background(), and reports
+// whether that succeeded.
 func (m *Map) Load(key KeyT) (value ValueT, ok bool) {
-	read, _ := m.read.Load().(readOnly)
+	value, ok = m.lookup(key)
+	m.onLoad(key, value, ok)
+	if !ok {
+		value, ok = m.loadMissing(key)
+	}
+	return value, ok
+}
+
+// lookup is Load without hooks or loader.
+func (m *Map) lookup(key KeyT) (value ValueT, ok bool) {
+	read := m.loadReadOnly()
 	e, ok := read.m[key]
 	if !ok && read.amended {
 		m.mu.Lock()
 		// Avoid reporting a spurious miss if m.dirty got promoted while we were
 		// blocked on m.mu. (If further loads of the same key will not miss, it's
 		// not worth copying the dirty map for this key.)
-		read, _ = m.read.Load().(readOnly)
+		read = m.loadReadOnly()
 		e, ok = read.m[key]
 		if !ok && read.amended {
 			e, ok = m.dirty[key]
@@ -119,70 +239,44 @@ func (m *Map) Load(key KeyT) (value ValueT, ok bool) {
 		}
 		m.mu.Unlock()
 	}
-	if !ok {
-		var defaultValue ValueT
-		return defaultValue, false
+	if ok {
+		m.expire(key, e, read)
+		m.touch(key, e)
+		m.refreshIfStale(key, e)
+		value, ok = e.load()
 	}
-	return e.load()
+	return value, ok
+}
+
+// Contains reports whether a value is present in the map for key. Unlike
+// Load, it never calls the loader of maps generated with -loader.
+func (m *Map) Contains(key KeyT) bool {
+	value, ok := m.lookup(key)
+	m.onLoad(key, value, ok)
+	return ok
+}
+
+// LoadOrDefault returns the value stored in the map for a key, or def if no
+// value is present.
+func (m *Map) LoadOrDefault(key KeyT, def ValueT) ValueT {
+	if value, ok := m.Load(key); ok {
+		return value
+	}
+	return def
 }
 
 func (e *entry) load() (value ValueT, ok bool) {
 	p := atomic.LoadPointer(&e.p)
-	if p == nil || p == expunged {
+	if p == nil || p == expunged || expired(p) {
 		var defaultValue ValueT
 		return defaultValue, false
 	}
-	return *(*ValueT)(p), true
+	return unboxValue(p), true
 }
 
 // Store sets the value for a key.
 func (m *Map) Store(key KeyT, value ValueT) {
-	read, _ := m.read.Load().(readOnly)
-	if e, ok := read.m[key]; ok && e.tryStore(&value) {
-		return
-	}
-
-	m.mu.Lock()
-	read, _ = m.read.Load().(readOnly)
-	if e, ok := read.m[key]; ok {
-		if e.unexpungeLocked() {
-			// The entry was previously expunged, which implies that there is a
-			// non-nil dirty map and this entry is not in it.
-			m.dirty[key] = e
-		}
-		e.storeLocked(&value)
-	} else if e, ok := m.dirty[key]; ok {
-		e.storeLocked(&value)
-	} else {
-		if !read.amended {
-			// We're adding the first new key to the dirty map.
-			// Make sure it is allocated and mark the read-only map as incomplete.
-			m.dirtyLocked()
-			m.read.Store(readOnly{m: read.m, amended: true})
-		}
-		m.dirty[key] = newEntry(value)
-	}
-	m.mu.Unlock()
-}
-
-// tryStore stores a value if the entry has not been expunged.
-//
-// If the entry is expunged, tryStore returns false and leaves the entry
-// unchanged.
-func (e *entry) tryStore(i *ValueT) bool {
-	p := atomic.LoadPointer(&e.p)
-	if p == expunged {
-		return false
-	}
-	for {
-		if atomic.CompareAndSwapPointer(&e.p, p, unsafe.Pointer(i)) {
-			return true
-		}
-		p = atomic.LoadPointer(&e.p)
-		if p == expunged {
-			return false
-		}
-	}
+	_, _ = m.Swap(key, value)
 }
 
 // unexpungeLocked ensures that the entry is not marked as expunged.
@@ -193,48 +287,78 @@ func (e *entry) unexpungeLocked() (wasExpunged bool) {
 	return atomic.CompareAndSwapPointer(&e.p, expunged, nil)
 }
 
-// storeLocked unconditionally stores a value to the entry.
-//
-// The entry must be known not to be expunged.
-func (e *entry) storeLocked(i *ValueT) {
-	atomic.StorePointer(&e.p, unsafe.Pointer(i))
-}
-
 // LoadOrStore returns the existing value for the key if present.
 // Otherwise, it stores and returns the given value.
 // The loaded result is true if the value was loaded, false if stored.
 func (m *Map) LoadOrStore(key KeyT, value ValueT) (actual ValueT, loaded bool) {
+	if actual, loaded = m.loadOrStore(key, m.copied(value)); loaded {
+		m.onLoad(key, actual, true)
+	} else {
+		m.onStore(key, actual)
+	}
+	return actual, loaded
+}
+
+// loadOrStore is LoadOrStore with the value already copied.
+func (m *Map) loadOrStore(key KeyT, value ValueT) (actual ValueT, loaded bool) {
 	// Avoid locking if it's a clean hit.
-	read, _ := m.read.Load().(readOnly)
+	read := m.loadReadOnly()
+	read.checkWritable()
 	if e, ok := read.m[key]; ok {
+		m.expire(key, e, read)
 		actual, loaded, ok := e.tryLoadOrStore(value)
 		if ok {
+			m.touch(key, e)
+			if !loaded {
+				m.charge(e)
+				atomic.AddInt64(m.counter(read), 1)
+				m.admit(key)
+			}
 			return actual, loaded
 		}
 	}
 
 	m.mu.Lock()
-	read, _ = m.read.Load().(readOnly)
+	read = m.loadReadOnly()
 	if e, ok := read.m[key]; ok {
 		if e.unexpungeLocked() {
 			m.dirty[key] = e
 		}
+		m.expire(key, e, read)
 		actual, loaded, _ = e.tryLoadOrStore(value)
+		m.touch(key, e)
+		if !loaded {
+			m.charge(e)
+		}
 	} else if e, ok := m.dirty[key]; ok {
+		m.expire(key, e, read)
 		actual, loaded, _ = e.tryLoadOrStore(value)
+		m.touch(key, e)
+		if !loaded {
+			m.charge(e)
+		}
 		m.missLocked()
 	} else {
 		if !read.amended {
 			// We're adding the first new key to the dirty map.
 			// Make sure it is allocated and mark the read-only map as incomplete.
 			m.dirtyLocked()
-			m.read.Store(readOnly{m: read.m, amended: true})
+			m.read.Store(&readOnly{m: read.m, amended: true, count: read.count})
 		}
-		m.dirty[key] = newEntry(value)
+		e := newEntry(value)
+		m.touch(key, e)
+		m.charge(e)
+		m.dirty[key] = e
 		actual, loaded = value, false
 	}
+	if !loaded {
+		atomic.AddInt64(m.counter(read), 1)
+	}
 	m.mu.Unlock()
 
+	if !loaded {
+		m.admit(key)
+	}
 	return actual, loaded
 }
 
@@ -250,15 +374,15 @@ func (e *entry) tryLoadOrStore(i ValueT) (actual ValueT, loaded, ok bool) {
 		return defaultValue, false, false
 	}
 	if p != nil {
-		return *(*ValueT)(p), true, true
+		return unboxValue(p), true, true
 	}
 
-	// Copy the value after the first load to make this method more amenable
+	// Box the value after the first load to make this method more amenable
 	// to escape analysis: if we hit the "load" path or the entry is expunged, we
 	// shouldn't bother heap-allocating.
-	ic := i
+	ic := boxValue(i)
 	for {
-		if atomic.CompareAndSwapPointer(&e.p, nil, unsafe.Pointer(&ic)) {
+		if atomic.CompareAndSwapPointer(&e.p, nil, ic) {
 			return i, false, true
 		}
 		p = atomic.LoadPointer(&e.p)
@@ -266,41 +390,865 @@ func (e *entry) tryLoadOrStore(i ValueT) (actual ValueT, loaded, ok bool) {
 			return defaultValue, false, false
 		}
 		if p != nil {
-			return *(*ValueT)(p), true, true
+			return unboxValue(p), true, true
+		}
+	}
+}
+
+// Swap swaps the value for a key and returns the previous value if any.
+// The loaded result reports whether the key was present.
+func (m *Map) Swap(key KeyT, value ValueT) (previous ValueT, loaded bool) {
+	value = m.copied(value)
+	previous, loaded = m.swap(key, boxValue(value))
+	m.onStore(key, value)
+	return previous, loaded
+}
+
+// swap is Swap with the value boxed as nv.
+func (m *Map) swap(key KeyT, nv unsafe.Pointer) (previous ValueT, loaded bool) {
+	read := m.loadReadOnly()
+	read.checkWritable()
+	if e, ok := read.m[key]; ok {
+		m.expire(key, e, read)
+		if v, ok := e.trySwap(nv); ok {
+			m.touch(key, e)
+			m.charge(e)
+			if v == nil {
+				atomic.AddInt64(m.counter(read), 1)
+				m.admit(key)
+				return previous, false
+			}
+			m.evictIfFull()
+			return unboxValue(v), true
+		}
+	}
+
+	m.mu.Lock()
+	read = m.loadReadOnly()
+	if e, ok := read.m[key]; ok {
+		if e.unexpungeLocked() {
+			// The entry was previously expunged, which implies that there is a
+			// non-nil dirty map and this entry is not in it.
+			m.dirty[key] = e
+		}
+		m.expire(key, e, read)
+		if v := e.swapLocked(nv); v != nil {
+			loaded = true
+			previous = unboxValue(v)
+		}
+		m.touch(key, e)
+		m.charge(e)
+	} else if e, ok := m.dirty[key]; ok {
+		m.expire(key, e, read)
+		if v := e.swapLocked(nv); v != nil {
+			loaded = true
+			previous = unboxValue(v)
+		}
+		m.touch(key, e)
+		m.charge(e)
+	} else {
+		if !read.amended {
+			// We're adding the first new key to the dirty map.
+			// Make sure it is allocated and mark the read-only map as incomplete.
+			m.dirtyLocked()
+			m.read.Store(&readOnly{m: read.m, amended: true, count: read.count})
+		}
+		e := &entry{p: nv}
+		m.touch(key, e)
+		m.charge(e)
+		m.dirty[key] = e
+	}
+	if !loaded {
+		atomic.AddInt64(m.counter(read), 1)
+	}
+	m.mu.Unlock()
+
+	if !loaded {
+		m.admit(key)
+	} else {
+		m.evictIfFull()
+	}
+	return previous, loaded
+}
+
+// trySwap swaps a value if the entry has not been expunged.
+//
+// If the entry is expunged, trySwap returns false and leaves the entry
+// unchanged.
+func (e *entry) trySwap(i unsafe.Pointer) (unsafe.Pointer, bool) {
+	for {
+		p := atomic.LoadPointer(&e.p)
+		if p == expunged {
+			return nil, false
+		}
+		if atomic.CompareAndSwapPointer(&e.p, p, i) {
+			return p, true
+		}
+	}
+}
+
+// swapLocked unconditionally swaps a value into the entry.
+//
+// The entry must be known not to be expunged.
+func (e *entry) swapLocked(i unsafe.Pointer) unsafe.Pointer {
+	return atomic.SwapPointer(&e.p, i)
+}
+
+// Replace sets the value for a key only if the key is already present, and
+// returns the previous value. The replaced result reports whether the key was
+// present. Unlike Swap, Replace never inserts a missing key.
+func (m *Map) Replace(key KeyT, value ValueT) (previous ValueT, replaced bool) {
+	value = m.copied(value)
+	read := m.loadReadOnly()
+	read.checkWritable()
+	e, ok := read.m[key]
+	if !ok && read.amended {
+		m.mu.Lock()
+		read = m.loadReadOnly()
+		e, ok = read.m[key]
+		if !ok && read.amended {
+			e, ok = m.dirty[key]
+			// Regardless of whether the entry was present, record a miss: this key
+			// will take the slow path until the dirty map is promoted to the read
+			// map.
+			m.missLocked()
+		}
+		m.mu.Unlock()
+	}
+	if !ok {
+		return previous, false
+	}
+	m.expire(key, e, read)
+	nv := boxValue(value)
+	for {
+		p := atomic.LoadPointer(&e.p)
+		if p == nil || p == expunged || expired(p) {
+			return previous, false
+		}
+		if atomic.CompareAndSwapPointer(&e.p, p, nv) {
+			m.touch(key, e)
+			m.charge(e)
+			m.evictIfFull()
+			m.onStore(key, value)
+			return unboxValue(p), true
+		}
+	}
+}
+
+// Update atomically replaces the value for a key with the result of f.
+//
+// f is called with the current value for key, and loaded reports whether the
+// key was present. If f returns keep == true, its value is stored; otherwise
+// the key is deleted. Update returns the value left in the map for key and
+// whether the key is present after the update.
+//
+// f may be called more than once if the entry is updated concurrently, so it
+// should be free of side effects. f must not call methods on m.
+func (m *Map) Update(key KeyT, f func(old ValueT, loaded bool) (value ValueT, keep bool)) (value ValueT, ok bool) {
+	if m.copier != nil {
+		update := f
+		f = func(old ValueT, loaded bool) (ValueT, bool) {
+			value, keep := update(old, loaded)
+			if keep {
+				value = m.copier(value)
+			}
+			return value, keep
+		}
+	}
+	if m.hooks.OnStore == nil && m.hooks.OnDelete == nil && !m.metrics.enabled() {
+		return m.update(key, f)
+	}
+
+	// The last call of f is the one whose result took effect.
+	var loaded bool
+	apply := f
+	f = func(old ValueT, ok bool) (ValueT, bool) {
+		loaded = ok
+		return apply(old, ok)
+	}
+	if value, ok = m.update(key, f); ok {
+		m.onStore(key, value)
+	} else if loaded {
+		m.onDelete(key)
+	}
+	return value, ok
+}
+
+// update is Update with f already copying the values it keeps.
+func (m *Map) update(key KeyT, f func(old ValueT, loaded bool) (value ValueT, keep bool)) (value ValueT, ok bool) {
+	read := m.loadReadOnly()
+	read.checkWritable()
+	if e, ok := read.m[key]; ok {
+		m.expire(key, e, read)
+		if v, ok, updated := e.tryUpdate(f, m.counter(read)); updated {
+			m.touch(key, e)
+			m.charge(e)
+			m.admit(key)
+			return v, ok
+		}
+	}
+
+	m.mu.Lock()
+	read = m.loadReadOnly()
+	if e, found := read.m[key]; found {
+		if e.unexpungeLocked() {
+			// The entry was previously expunged, which implies that there is a
+			// non-nil dirty map and this entry is not in it.
+			m.dirty[key] = e
+		}
+		m.expire(key, e, read)
+		value, ok, _ = e.tryUpdate(f, m.counter(read))
+		m.touch(key, e)
+		m.charge(e)
+	} else if e, found := m.dirty[key]; found {
+		m.expire(key, e, read)
+		value, ok, _ = e.tryUpdate(f, m.counter(read))
+		m.touch(key, e)
+		m.charge(e)
+		m.missLocked()
+	} else {
+		var defaultValue ValueT
+		if value, ok = f(defaultValue, false); ok {
+			if !read.amended {
+				// We're adding the first new key to the dirty map.
+				// Make sure it is allocated and mark the read-only map as incomplete.
+				m.dirtyLocked()
+				m.read.Store(&readOnly{m: read.m, amended: true, count: read.count})
+			}
+			e := newEntry(value)
+			m.touch(key, e)
+			m.charge(e)
+			m.dirty[key] = e
+			atomic.AddInt64(m.counter(read), 1)
 		}
 	}
+	m.mu.Unlock()
+	m.admit(key)
+	return value, ok
+}
+
+// Upsert atomically stores value for a key if it is not present, or stores
+// merge(existing, value) if it is. It returns the value left in the map, and
+// the loaded result reports whether an existing value was merged.
+//
+// As with Update, merge may be called more than once if the entry is updated
+// concurrently, and merge must not call methods on m.
+func (m *Map) Upsert(key KeyT, value ValueT, merge func(existing, incoming ValueT) ValueT) (actual ValueT, loaded bool) {
+	actual, _ = m.Update(key, func(old ValueT, ok bool) (ValueT, bool) {
+		loaded = ok
+		if ok {
+			return merge(old, value), true
+		}
+		return value, true
+	})
+	return actual, loaded
+}
+
+// tryUpdate applies f to the entry if it has not been expunged, adjusting
+// count when the entry gains or loses its value.
+//
+// If the entry is expunged, tryUpdate returns with updated==false and leaves
+// the entry unchanged.
+func (e *entry) tryUpdate(f func(ValueT, bool) (ValueT, bool), count *int64) (value ValueT, ok, updated bool) {
+	for {
+		p := atomic.LoadPointer(&e.p)
+		if p == expunged {
+			return value, false, false
+		}
+
+		var old ValueT
+		loaded := p != nil
+		if loaded {
+			old = unboxValue(p)
+		}
+		v, keep := f(old, loaded)
+		if !keep && !loaded {
+			// Nothing to delete.
+			return value, false, true
+		}
+
+		var np unsafe.Pointer
+		if keep {
+			np = boxValue(v)
+		}
+		if atomic.CompareAndSwapPointer(&e.p, p, np) {
+			switch {
+			case keep && !loaded:
+				atomic.AddInt64(count, 1)
+			case !keep && loaded:
+				atomic.AddInt64(count, -1)
+				return value, false, true
+			}
+			return v, true, true
+		}
+	}
+}
+
+// StoreMany sets the values for all keys in entries, acquiring the map's lock
+// at most once.
+func (m *Map) StoreMany(entries map[KeyT]ValueT) {
+	m.loadReadOnly().checkWritable()
+	if len(entries) == 0 {
+		return
+	}
+
+	// stored holds the values stored, for onStoreMany.
+	var stored []Pair
+	if m.collectsStores() {
+		stored = make([]Pair, 0, len(entries))
+	}
+
+	m.mu.Lock()
+	read := m.loadReadOnly()
+	count := m.counter(read)
+	for k, v := range entries {
+		v := m.copied(v)
+		e := m.entryLocked(k)
+		if e.swapLocked(boxValue(v)) == nil {
+			atomic.AddInt64(count, 1)
+		}
+		m.touch(k, e)
+		m.charge(e)
+		if stored != nil {
+			stored = append(stored, Pair{k, v})
+		}
+	}
+	m.mu.Unlock()
+	m.evictIfFull()
+	m.onStoreMany(len(entries), stored)
+}
+
+// Pair is a key and its value, as passed to LoadBulk.
+type Pair struct {
+	Key   KeyT
+	Value ValueT
+}
+
+// LoadBulk stores the values of pairs, in order, so the last value of a key
+// passed more than once wins. Rather than adding the new keys to the dirty
+// map, which loads then miss until it's promoted, LoadBulk builds a read map
+// holding the map's entries and the new ones, and replaces the read map with
+// it, so that loading millions of entries into a map at startup copies it
+// once and promotes nothing.
+//
+// The new entries are allocated in a single block, which stays reachable as
+// long as any of them is: a map whose bulk-loaded keys are mostly deleted
+// later keeps their memory.
+func (m *Map) LoadBulk(pairs []Pair) {
+	m.loadReadOnly().checkWritable()
+	if len(pairs) == 0 {
+		return
+	}
+	block := make([]entry, len(pairs))
+	for i, p := range pairs {
+		block[i].p = boxValue(m.copied(p.Value))
+	}
+
+	m.mu.Lock()
+	read := m.loadReadOnly()
+	entries := m.liveLocked(read, int(atomic.LoadInt64(m.counter(read)))+len(pairs))
+	added := 0
+	for i, p := range pairs {
+		if e, ok := entries[p.Key]; ok {
+			// Entries already present may be held by writers, so their
+			// values are swapped rather than the entries replaced.
+			if e.swapLocked(block[i].p) == nil {
+				added++
+			}
+			m.touch(p.Key, e)
+			m.charge(e)
+			continue
+		}
+		m.touch(p.Key, &block[i])
+		m.charge(&block[i])
+		entries[p.Key] = &block[i]
+		added++
+	}
+	atomic.AddInt64(m.counter(read), int64(added))
+	m.read.Store(&readOnly{m: entries, count: read.count})
+	m.dirty = nil
+	m.misses = 0
+	m.mu.Unlock()
+	m.evictIfFull()
+	m.metrics.store(len(pairs))
+	if m.hooks.OnStore != nil {
+		for i, p := range pairs {
+			m.hooks.OnStore(p.Key, unboxValue(block[i].p))
+		}
+	}
+}
+
+// LoadMany returns the values stored in the map for keys. For each i,
+// values[i] and ok[i] are the results Load(keys[i]) would return.
+//
+// Keys found in the read map are loaded without locking; the remaining keys
+// are looked up in the dirty map with a single acquisition of the lock.
+func (m *Map) LoadMany(keys []KeyT) (values []ValueT, ok []bool) {
+	values = make([]ValueT, len(keys))
+	ok = make([]bool, len(keys))
+
+	var missed []int
+	read := m.loadReadOnly()
+	for i, k := range keys {
+		if e, found := read.m[k]; found {
+			values[i], ok[i] = e.load()
+		} else if read.amended {
+			missed = append(missed, i)
+		}
+	}
+	if len(missed) == 0 {
+		m.onLoadMany(keys, values, ok)
+		return values, ok
+	}
+
+	m.mu.Lock()
+	read = m.loadReadOnly()
+	for _, i := range missed {
+		e, found := read.m[keys[i]]
+		if !found && read.amended {
+			e, found = m.dirty[keys[i]]
+			m.missLocked()
+			// missLocked may have promoted the dirty map.
+			read = m.loadReadOnly()
+		}
+		if found {
+			values[i], ok[i] = e.load()
+		}
+	}
+	m.mu.Unlock()
+	m.onLoadMany(keys, values, ok)
+	return values, ok
+}
+
+// DeleteMany deletes the values for keys, acquiring the map's lock at most
+// once.
+func (m *Map) DeleteMany(keys []KeyT) {
+	if m.backend.enabled() {
+		// The keys are deleted from the backend one by one regardless of
+		// whether the map holds them.
+		for _, k := range keys {
+			m.Delete(k)
+		}
+		return
+	}
+
+	var missed []KeyT
+	read := m.loadReadOnly()
+	read.checkWritable()
+	for _, k := range keys {
+		if e, ok := read.m[k]; ok {
+			if e.delete() {
+				atomic.AddInt64(m.counter(read), -1)
+				m.charge(e)
+				m.onDelete(k)
+			}
+		} else if read.amended {
+			missed = append(missed, k)
+		}
+	}
+	if len(missed) == 0 {
+		m.compactIfSparse()
+		return
+	}
+
+	// deleted reuses missed to hold the keys deleted, for the OnDelete hook.
+	deleted := missed[:0]
+	m.mu.Lock()
+	read = m.loadReadOnly()
+	for _, k := range missed {
+		e, ok := read.m[k]
+		if !ok && read.amended {
+			if e, ok := m.dirty[k]; ok {
+				delete(m.dirty, k)
+				if e.expungeLocked() {
+					atomic.AddInt64(m.counter(read), -1)
+					m.charge(e)
+					deleted = append(deleted, k)
+				}
+			}
+			m.missLocked()
+			// missLocked may have promoted the dirty map.
+			read = m.loadReadOnly()
+			continue
+		}
+		if ok && e.delete() {
+			atomic.AddInt64(m.counter(read), -1)
+			m.charge(e)
+			deleted = append(deleted, k)
+		}
+	}
+	m.mu.Unlock()
+	m.compactIfSparse()
+	for _, k := range deleted {
+		m.onDelete(k)
+	}
+}
+
+// Merge stores every entry of other into m, overwriting the values of keys
+// present in both maps.
+//
+// The entries of other are read as by Snapshot and then stored with a single
+// acquisition of m's lock.
+func (m *Map) Merge(other *Map) {
+	m.MergeFunc(other, func(_ KeyT, _, b ValueT) ValueT {
+		return b
+	})
+}
+
+// MergeFunc stores every entry of other into m. For keys present in both
+// maps, f is called with the value a from m and the value b from other, and
+// its result is stored.
+//
+// As with Update, f may be called more than once for a key if the entry is
+// updated concurrently, and f must not call methods on m.
+func (m *Map) MergeFunc(other *Map, f func(key KeyT, a, b ValueT) ValueT) {
+	m.loadReadOnly().checkWritable()
+	src := other.Snapshot()
+	if len(src) == 0 {
+		return
+	}
+
+	// stored holds the values stored, for onStoreMany.
+	var stored []Pair
+	if m.collectsStores() {
+		stored = make([]Pair, 0, len(src))
+	}
+
+	m.mu.Lock()
+	read := m.loadReadOnly()
+	count := m.counter(read)
+	for k, v := range src {
+		k, v := k, v
+		e := m.entryLocked(k)
+		m.expire(k, e, read)
+		v, _, _ = e.tryUpdate(func(old ValueT, loaded bool) (ValueT, bool) {
+			if loaded {
+				return m.copied(f(k, old, v)), true
+			}
+			return m.copied(v), true
+		}, count)
+		m.touch(k, e)
+		m.charge(e)
+		if stored != nil {
+			stored = append(stored, Pair{k, v})
+		}
+	}
+	m.mu.Unlock()
+	m.evictIfFull()
+	m.onStoreMany(len(src), stored)
+}
+
+// entryLocked returns the entry for key, adding an empty entry to the dirty
+// map if the key is not present. The returned entry is not expunged.
+func (m *Map) entryLocked(key KeyT) *entry {
+	read := m.loadReadOnly()
+	if e, ok := read.m[key]; ok {
+		if e.unexpungeLocked() {
+			// The entry was previously expunged, which implies that there is a
+			// non-nil dirty map and this entry is not in it.
+			m.dirty[key] = e
+		}
+		return e
+	}
+	if e, ok := m.dirty[key]; ok {
+		return e
+	}
+	if !read.amended {
+		// We're adding the first new key to the dirty map.
+		// Make sure it is allocated and mark the read-only map as incomplete.
+		m.dirtyLocked()
+		m.read.Store(&readOnly{m: read.m, amended: true, count: read.count})
+	}
+	e := &entry{}
+	m.dirty[key] = e
+	return e
 }
 
 // Delete deletes the value for a key.
 func (m *Map) Delete(key KeyT) {
-	read, _ := m.read.Load().(readOnly)
+	if m.delete(key) {
+		m.onDelete(key)
+	} else {
+		// The backend may hold the key regardless.
+		m.backend.delete(key)
+	}
+}
+
+// delete is Delete without hooks or backend. It reports whether the map held
+// a value for key.
+func (m *Map) delete(key KeyT) bool {
+	read := m.loadReadOnly()
+	read.checkWritable()
 	e, ok := read.m[key]
+	deleted := false
 	if !ok && read.amended {
 		m.mu.Lock()
-		read, _ = m.read.Load().(readOnly)
+		read = m.loadReadOnly()
 		e, ok = read.m[key]
 		if !ok && read.amended {
-			delete(m.dirty, key)
+			if e, ok := m.dirty[key]; ok {
+				delete(m.dirty, key)
+				if e.expungeLocked() {
+					atomic.AddInt64(m.counter(read), -1)
+					m.charge(e)
+					deleted = true
+				}
+			}
+			// Regardless of whether the entry was present, record a miss: this key
+			// will take the slow path until the dirty map is promoted to the read
+			// map.
+			m.missLocked()
+			ok = false
 		}
 		m.mu.Unlock()
 	}
-	if ok {
-		e.delete()
+	if ok && e.delete() {
+		atomic.AddInt64(m.counter(read), -1)
+		m.charge(e)
+		deleted = true
 	}
+	m.compactIfSparse()
+	return deleted
+}
+
+// expungeLocked marks an entry that has been removed from the dirty map, and
+// is not in the read map, as expunged. Entry handles still holding it will
+// then look the key up again instead of updating an unreachable entry.
+func (e *entry) expungeLocked() (hadValue bool) {
+	p := atomic.SwapPointer(&e.p, expunged)
+	return p != nil && p != expunged
 }
 
 func (e *entry) delete() (hadValue bool) {
+	return e.take() != nil
+}
+
+// take deletes the value of e, and returns the pointer it held, or nil if it
+// had none.
+func (e *entry) take() unsafe.Pointer {
 	for {
 		p := atomic.LoadPointer(&e.p)
 		if p == nil || p == expunged {
-			return false
+			return nil
 		}
 		if atomic.CompareAndSwapPointer(&e.p, p, nil) {
-			return true
+			return p
 		}
 	}
 }
 
+// Pop deletes an arbitrary entry from the map and returns it. The ok result
+// reports whether an entry was found.
+//
+// Pop takes the entry from the read map when it holds any, and only promotes
+// the dirty map otherwise.
+func (m *Map) Pop() (key KeyT, value ValueT, ok bool) {
+	read := m.loadReadOnly()
+	read.checkWritable()
+	if key, value, ok = m.popFrom(read); !ok && read.amended {
+		key, value, ok = m.popFrom(m.promote())
+	}
+	if ok {
+		m.onDelete(key)
+	}
+	return key, value, ok
+}
+
+// popFrom deletes the first live entry found in read.m and returns it.
+func (m *Map) popFrom(read readOnly) (key KeyT, value ValueT, ok bool) {
+	for k, e := range read.m {
+		for {
+			p := atomic.LoadPointer(&e.p)
+			if p == nil || p == expunged || expired(p) {
+				break
+			}
+			if atomic.CompareAndSwapPointer(&e.p, p, nil) {
+				atomic.AddInt64(m.counter(read), -1)
+				m.charge(e)
+				return k, unboxValue(p), true
+			}
+		}
+	}
+	return key, value, false
+}
+
+// DeleteFunc deletes every entry for which del returns true.
+//
+// Like Range, DeleteFunc promotes the dirty map and then walks the read map,
+// so deletions mark entries in place instead of repeatedly invalidating the
+// read map. An entry is only deleted if its value has not changed since it
+// was passed to del.
+func (m *Map) DeleteFunc(del func(key KeyT, value ValueT) bool) {
+	read := m.promote()
+	read.checkWritable()
+	for k, e := range read.m {
+		p := atomic.LoadPointer(&e.p)
+		if p == nil || p == expunged || expired(p) || !del(k, unboxValue(p)) {
+			continue
+		}
+		if atomic.CompareAndSwapPointer(&e.p, p, nil) {
+			atomic.AddInt64(m.counter(read), -1)
+			m.charge(e)
+			m.onDelete(k)
+		}
+	}
+	m.compactIfSparse()
+}
+
+// Len returns the number of entries in the map.
+//
+// Len acquires the map's lock, so it is ordered with respect to the writes
+// adding keys that aren't in the read map, which count them with the lock
+// held. Writes to keys in the read map, including those storing into a
+// deleted entry, complete without the lock, and may be concurrently in
+// flight.
+func (m *Map) Len() int {
+	m.mu.Lock()
+	n := m.ApproxLen()
+	m.mu.Unlock()
+	return n
+}
+
+// ApproxLen returns the number of entries in the map without locking.
+//
+// The result may lag behind concurrent writers and is intended for callers,
+// such as metrics, that tolerate some slack.
+func (m *Map) ApproxLen() int {
+	read := m.loadReadOnly()
+	n := atomic.LoadInt64(m.counter(read))
+	if n < 0 {
+		// A Delete may briefly be counted ahead of the Store it observed.
+		return 0
+	}
+	return int(n)
+}
+
+// Clear deletes all the entries, resulting in an empty Map.
+//
+// Clear runs in constant time: both the read and dirty maps are dropped
+// rather than deleted from key by key.
+func (m *Map) Clear() {
+	read := m.loadReadOnly()
+	read.checkWritable()
+	if len(read.m) == 0 && !read.amended {
+		// Avoid allocating a new readOnly when the map is already clear.
+		return
+	}
+
+	m.mu.Lock()
+	read = m.loadReadOnly()
+	old := m.entriesLocked(read)
+	if len(read.m) > 0 || read.amended {
+		m.read.Store(&readOnly{count: new(int64)})
+		m.recharge(nil)
+	}
+	m.dirty = nil
+	// Don't immediately promote the newly-cleared dirty map on the next operation.
+	m.misses = 0
+	m.mu.Unlock()
+	m.cleared(old)
+}
+
+// Compact rebuilds the read map to hold only the entries present in the map,
+// dropping those of deleted keys, and drops the dirty map, so that the tables
+// sized for entries since deleted can be reclaimed. Go maps don't shrink as
+// keys are deleted: a map that held many more entries than it does now keeps
+// the memory they took until it is compacted.
+//
+// Compact copies every entry under the map's lock, so it takes as long as
+// promoting the dirty map; loads don't wait for it, while writers of new keys
+// do.
+func (m *Map) Compact() {
+	m.mu.Lock()
+	read := m.loadReadOnly()
+	if !read.frozen {
+		// A frozen map has been compacted by Freeze, and can't be written.
+		live := m.liveLocked(read, int(atomic.LoadInt64(m.counter(read))))
+		m.read.Store(&readOnly{m: live, count: read.count})
+		m.dirty = nil
+		m.misses = 0
+	}
+	m.mu.Unlock()
+}
+
+// Freeze makes the map read-only: it compacts the map, as Compact does, into
+// a read map that is never replaced, and the methods writing to the map
+// panic from then on. Loads of a frozen map never lock it, nor count misses,
+// and only read shared memory, as loads of a Go map do: a map built at
+// startup and only read afterwards can be frozen to pay no synchronization
+// but the atomic loads of its read map and entries. Clone returns a copy of
+// a frozen map that isn't frozen.
+//
+// Writes concurrent with Freeze may be lost: the map must be written to by
+// the goroutine calling Freeze only, or by goroutines it waits for.
+func (m *Map) Freeze() {
+	m.mu.Lock()
+	read := m.loadReadOnly()
+	if !read.frozen {
+		live := m.liveLocked(read, int(atomic.LoadInt64(m.counter(read))))
+		m.read.Store(&readOnly{m: live, count: read.count, frozen: true})
+		m.dirty = nil
+		m.misses = 0
+	}
+	m.mu.Unlock()
+}
+
+// Frozen reports whether Freeze was called on the map.
+func (m *Map) Frozen() bool {
+	return m.loadReadOnly().frozen
+}
+
+// entriesLocked returns the map of the map's entries whose read map is read:
+// the dirty map, which holds every entry that isn't expunged, if it has keys
+// read doesn't, and read's otherwise.
+func (m *Map) entriesLocked(read readOnly) map[KeyT]*entry {
+	if read.amended {
+		return m.dirty
+	}
+	return read.m
+}
+
+// liveLocked returns a new map holding the entries of the map that aren't
+// deleted, with room for n entries, and expunges the deleted ones, so that
+// it can replace the read map.
+func (m *Map) liveLocked(read readOnly, n int) map[KeyT]*entry {
+	src := m.entriesLocked(read)
+	if n < 0 {
+		// A Delete may briefly be counted ahead of the Store it observed.
+		n = 0
+	}
+	live := make(map[KeyT]*entry, n)
+	for k, e := range src {
+		// Expunged entries can't be stored to without the lock, so writers
+		// still holding them will find the key missing and add it again.
+		m.expire(k, e, read)
+		if !e.tryExpungeLocked() {
+			live[k] = e
+		}
+	}
+	return live
+}
+
+// minCompactLen is the length of the smallest read map that is compacted
+// automatically, below which compacting saves too little to be worth it.
+const minCompactLen = 64
+
+// compactIfSparse compacts the map if it was created with WithAutoCompact and
+// deletions have left fewer live entries than the fraction set of the entries
+// of its read map.
+func (m *Map) compactIfSparse() {
+	if m.compactFraction <= 0 {
+		return
+	}
+	read := m.loadReadOnly()
+	if len(read.m) < minCompactLen {
+		return
+	}
+	if float64(atomic.LoadInt64(m.counter(read))) < m.compactFraction*float64(len(read.m)) {
+		m.Compact()
+	}
+}
+
 // Range calls f sequentially for each key and value present in the map.
 // If f returns false, range stops the iteration.
 //
@@ -312,46 +1260,262 @@ func (e *entry) delete() (hadValue bool) {
 // Range may be O(N) with the number of elements in the map even if f returns
 // false after a constant number of calls.
 func (m *Map) Range(f func(key KeyT, value ValueT) bool) {
+	read := m.promote()
+	for k, e := range read.m {
+		v, ok := e.load()
+		if !ok {
+			continue
+		}
+		if !f(k, v) {
+			break
+		}
+	}
+}
+
+// RangeSnapshot calls f sequentially for each key and value in a Snapshot of
+// the map taken before the first call to f. If f returns false, RangeSnapshot
+// stops the iteration.
+//
+// Unlike Range, stores and deletes made while f runs, including those made by
+// f itself, are never observed by the iteration. In exchange, RangeSnapshot
+// always costs O(N) time and memory for the copy, even if f returns false
+// after a constant number of calls.
+func (m *Map) RangeSnapshot(f func(key KeyT, value ValueT) bool) {
+	for k, v := range m.Snapshot() {
+		if !f(k, v) {
+			break
+		}
+	}
+}
+
+// RangeSorted calls f sequentially for each key and value present in the
+// map, in the order of keys defined by less. If f returns false, RangeSorted
+// stops the iteration.
+//
+// RangeSorted iterates over a Snapshot of the map, so it costs O(N log N)
+// and O(N) memory even if f returns false early.
+func (m *Map) RangeSorted(less func(a, b KeyT) bool, f func(key KeyT, value ValueT) bool) {
+	snapshot := m.Snapshot()
+	keys := make([]KeyT, 0, len(snapshot))
+	for k := range snapshot {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		return less(keys[i], keys[j])
+	})
+
+	for _, k := range keys {
+		if !f(k, snapshot[k]) {
+			break
+		}
+	}
+}
+
+// RangeKeys calls f sequentially for each key present in the map.
+// If f returns false, RangeKeys stops the iteration.
+//
+// RangeKeys has the same consistency guarantees as Range, but doesn't load
+// the values.
+func (m *Map) RangeKeys(f func(key KeyT) bool) {
+	read := m.promote()
+	for k, e := range read.m {
+		if p := atomic.LoadPointer(&e.p); p == nil || p == expunged || expired(p) {
+			continue
+		}
+		if !f(k) {
+			break
+		}
+	}
+}
+
+// RangeValues calls f sequentially for each value present in the map.
+// If f returns false, RangeValues stops the iteration.
+//
+// RangeValues has the same consistency guarantees as Range.
+func (m *Map) RangeValues(f func(value ValueT) bool) {
+	read := m.promote()
+	for _, e := range read.m {
+		v, ok := e.load()
+		if !ok {
+			continue
+		}
+		if !f(v) {
+			break
+		}
+	}
+}
+
+// Keys returns the keys present in the map.
+//
+// Like Range, Keys promotes the dirty map first, so the result covers every
+// key stored before the call; keys stored or deleted concurrently may or may
+// not be included.
+func (m *Map) Keys() []KeyT {
+	read := m.promote()
+	keys := make([]KeyT, 0, len(read.m))
+	for k, e := range read.m {
+		if _, ok := e.load(); ok {
+			keys = append(keys, k)
+		}
+	}
+	return keys
+}
+
+// Values returns the values present in the map.
+//
+// Values has the same consistency guarantees as Keys.
+func (m *Map) Values() []ValueT {
+	read := m.promote()
+	values := make([]ValueT, 0, len(read.m))
+	for _, e := range read.m {
+		if v, ok := e.load(); ok {
+			values = append(values, v)
+		}
+	}
+	return values
+}
+
+// Snapshot returns a point-in-time copy of the map's contents as a plain Go
+// map. The returned map is owned by the caller and is not affected by later
+// writes to m.
+//
+// Snapshot has the same consistency guarantees as Keys.
+func (m *Map) Snapshot() map[KeyT]ValueT {
+	read := m.promote()
+	snapshot := make(map[KeyT]ValueT, len(read.m))
+	for k, e := range read.m {
+		if v, ok := e.load(); ok {
+			snapshot[k] = v
+		}
+	}
+	return snapshot
+}
+
+// Clone returns a new Map holding the entries currently present in m.
+//
+// The clone's read map is built directly from a promoted copy of m, so no
+// dirty map is created and the first loads from the clone don't miss.
+// Clone has the same consistency guarantees as Keys. If m was created with
+// WithCopy, the clone holds copies of its values and copies values too, and
+// it promotes its dirty map and compacts as m does. In maps generated with
+// -ttl, the values of the clone expire when those of m do.
+func (m *Map) Clone() *Map {
+	read := m.promote()
+	entries := make(map[KeyT]*entry, len(read.m))
+	for k, e := range read.m {
+		p := atomic.LoadPointer(&e.p)
+		if p == nil || p == expunged || expired(p) {
+			continue
+		}
+		entries[k] = &entry{p: reboxValue(p, m.copied(unboxValue(p)))}
+	}
+
+	clone := &Map{
+		count:           int64(len(entries)),
+		lru:             m.lru.copy(),
+		promotionFactor: m.promotionFactor,
+		compactFraction: m.compactFraction,
+		copier:          m.copier,
+		onEvict:         m.onEvict,
+		hooks:           m.hooks,
+		loader:          m.loader.copy(),
+		telemetry:       m.telemetry.copy(),
+		backend:         m.backend.copy(),
+	}
+	clone.read.Store(&readOnly{m: entries})
+	clone.recharge(entries)
+	return clone
+}
+
+// EqualFunc is like Equal, but compares values using eq.
+func (m *Map) EqualFunc(other *Map, eq func(a, b ValueT) bool) bool {
+	if m == other {
+		return true
+	}
+	a, b := m.Snapshot(), other.Snapshot()
+	if len(a) != len(b) {
+		return false
+	}
+	for k, va := range a {
+		vb, ok := b[k]
+		if !ok || !eq(va, vb) {
+			return false
+		}
+	}
+	return true
+}
+
+// reset replaces the contents of the map with src, building the read map
+// directly instead of storing the entries one by one. Like Clear, it starts a
+// new counting generation. The values of src never expire.
+func (m *Map) reset(src map[KeyT]ValueT) {
+	m.loadReadOnly().checkWritable()
+	entries := make(map[KeyT]*entry, len(src))
+	for k, v := range src {
+		entries[k] = newEntry(m.copied(v))
+	}
+	count := int64(len(entries))
+
+	m.mu.Lock()
+	old := m.entriesLocked(m.loadReadOnly())
+	m.read.Store(&readOnly{m: entries, count: &count})
+	m.recharge(entries)
+	m.dirty = nil
+	m.misses = 0
+	m.mu.Unlock()
+	m.cleared(old)
+	m.evictIfFull()
+}
+
+// promote returns a read map that holds all of the keys present in the map,
+// promoting the dirty map if needed.
+func (m *Map) promote() readOnly {
 	// We need to be able to iterate over all of the keys that were already
 	// present at the start of the call to Range.
 	// If read.amended is false, then read.m satisfies that property without
 	// requiring us to hold m.mu for a long time.
-	read, _ := m.read.Load().(readOnly)
+	read := m.loadReadOnly()
 	if read.amended {
 		// m.dirty contains keys not in read.m. Fortunately, Range is already O(N)
 		// (assuming the caller does not break out early), so a call to Range
 		// amortizes an entire copy of the map: we can promote the dirty copy
 		// immediately!
 		m.mu.Lock()
-		read, _ = m.read.Load().(readOnly)
+		read = m.loadReadOnly()
 		if read.amended {
-			read = readOnly{m: m.dirty}
-			m.read.Store(read)
+			read = readOnly{m: m.dirty, count: read.count}
+			m.read.Store(&read)
 			m.dirty = nil
 			m.misses = 0
+			m.promotions++
 		}
 		m.mu.Unlock()
 	}
-
-	for k, e := range read.m {
-		v, ok := e.load()
-		if !ok {
-			continue
-		}
-		if !f(k, v) {
-			break
-		}
-	}
+	return read
 }
 
 func (m *Map) missLocked() {
 	m.misses++
-	if m.misses < len(m.dirty) {
+	threshold := len(m.dirty)
+	if m.promotionFactor > 0 {
+		threshold = int(m.promotionFactor * float64(threshold))
+	}
+	if m.misses < threshold {
 		return
 	}
-	m.read.Store(readOnly{m: m.dirty})
+	read := m.loadReadOnly()
+	m.read.Store(&readOnly{m: m.dirty, count: read.count})
 	m.dirty = nil
 	m.misses = 0
+	m.promotions++
+}
+
+// counter returns the live entry counter for the generation of read.
+func (m *Map) counter(read readOnly) *int64 {
+	if read.count == nil {
+		return &m.count
+	}
+	return read.count
 }
 
 func (m *Map) dirtyLocked() {
@@ -359,8 +1523,12 @@ func (m *Map) dirtyLocked() {
 		return
 	}
 
-	read, _ := m.read.Load().(readOnly)
-	m.dirty = make(map[KeyT]*entry, len(read.m))
+	read := m.loadReadOnly()
+	size := len(read.m)
+	if size < m.capacity {
+		size = m.capacity
+	}
+	m.dirty = make(map[KeyT]*entry, size)
 	for k, e := range read.m {
 		if !e.tryExpungeLocked() {
 			m.dirty[k] = e
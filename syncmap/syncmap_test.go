@@ -2,12 +2,20 @@
 // Use of this source code is governed by a BSD-style
 // license that can be found in the LICENSE file.
 
+//go:build !syncmap_ptrvalue
+
 package syncmap_test
 
 import (
+	"bytes"
+	"encoding/gob"
+	"encoding/json"
+	"expvar"
+	"fmt"
 	"math/rand"
 	"reflect"
 	"runtime"
+	"strings"
 	"sync"
 	"testing"
 	"testing/quick"
@@ -18,6 +26,14 @@ import (
 type KeyT = syncmap.KeyT
 type ValueT = syncmap.ValueT
 
+func newKeyT(i int) KeyT {
+	return KeyT(i)
+}
+
+func newValueT(i int) ValueT {
+	return ValueT(i)
+}
+
 func randomKeyT(r *rand.Rand) KeyT {
 	// PLEASE FEEL WITH A MEANINGFUL CODE
 	var defaultKey KeyT
@@ -33,19 +49,33 @@ func randomValueT(r *rand.Rand) ValueT {
 type mapOp string
 
 const (
-	opLoad        = mapOp("Load")
-	opStore       = mapOp("Store")
-	opLoadOrStore = mapOp("LoadOrStore")
-	opDelete      = mapOp("Delete")
+	opLoad             = mapOp("Load")
+	opStore            = mapOp("Store")
+	opLoadOrStore      = mapOp("LoadOrStore")
+	opDelete           = mapOp("Delete")
+	opSwap             = mapOp("Swap")
+	opCompareAndSwap   = mapOp("CompareAndSwap")
+	opCompareAndDelete = mapOp("CompareAndDelete")
+	opClear            = mapOp("Clear")
 )
 
-var mapOps = [...]mapOp{opLoad, opStore, opLoadOrStore, opDelete}
+var mapOps = [...]mapOp{
+	opLoad,
+	opStore,
+	opLoadOrStore,
+	opDelete,
+	opSwap,
+	opCompareAndSwap,
+	opCompareAndDelete,
+	opClear,
+}
 
 // mapCall is a quick.Generator for calls on mapInterface.
 type mapCall struct {
 	op mapOp
 	k  KeyT
 	v  ValueT
+	o  ValueT
 }
 
 func (c mapCall) apply(m mapInterface) (ValueT, bool) {
@@ -61,6 +91,21 @@ func (c mapCall) apply(m mapInterface) (ValueT, bool) {
 	case opDelete:
 		m.Delete(c.k)
 		return defaultValue, false
+	case opSwap:
+		return m.Swap(c.k, c.v)
+	case opCompareAndSwap:
+		if m.CompareAndSwap(c.k, c.o, c.v) {
+			return c.v, true
+		}
+		return defaultValue, false
+	case opCompareAndDelete:
+		if m.CompareAndDelete(c.k, c.o) {
+			return c.o, true
+		}
+		return defaultValue, false
+	case opClear:
+		m.Clear()
+		return defaultValue, false
 	default:
 		panic("invalid mapOp")
 	}
@@ -85,8 +130,13 @@ func (mapCall) Generate(r *rand.Rand, size int) reflect.Value {
 		k:  randomKeyT(r),
 	}
 	switch c.op {
-	case opStore, opLoadOrStore:
+	case opStore, opLoadOrStore, opSwap:
+		c.v = randomValueT(r)
+	case opCompareAndSwap:
+		c.o = randomValueT(r)
 		c.v = randomValueT(r)
+	case opCompareAndDelete:
+		c.o = randomValueT(r)
 	}
 	return reflect.ValueOf(c)
 }
@@ -190,3 +240,964 @@ func TestConcurrentRange(t *testing.T) {
 		}
 	}
 }
+
+func TestCompareAndSwap_NonExistingKey(t *testing.T) {
+	m := new(syncmap.Map)
+	var zero ValueT
+	if m.CompareAndSwap(newKeyT(1), zero, newValueT(42)) {
+		// See https://go.dev/issue/51972#issuecomment-1126408637.
+		t.Fatalf("CompareAndSwap on a non-existing key succeeded")
+	}
+	if m.CompareAndDelete(newKeyT(1), zero) {
+		t.Fatalf("CompareAndDelete on a non-existing key succeeded")
+	}
+}
+
+func TestSwap(t *testing.T) {
+	m := new(syncmap.Map)
+
+	// Dirty path: the key is not yet in the read map.
+	if _, loaded := m.Swap(newKeyT(1), ValueT(1)); loaded {
+		t.Fatalf("Swap on a new key reported loaded")
+	}
+	if prev, loaded := m.Swap(newKeyT(1), ValueT(2)); !loaded || prev != ValueT(1) {
+		t.Fatalf("Swap on dirty key = %v, %v; want %v, true", prev, loaded, ValueT(1))
+	}
+
+	// Read path: Range promotes the dirty map.
+	m.Range(func(KeyT, ValueT) bool { return true })
+	if prev, loaded := m.Swap(newKeyT(1), ValueT(3)); !loaded || prev != ValueT(2) {
+		t.Fatalf("Swap on read key = %v, %v; want %v, true", prev, loaded, ValueT(2))
+	}
+
+	// Deleted entry in the read map.
+	m.Delete(newKeyT(1))
+	if _, loaded := m.Swap(newKeyT(1), ValueT(4)); loaded {
+		t.Fatalf("Swap on deleted key reported loaded")
+	}
+	if v, ok := m.Load(newKeyT(1)); !ok || v != ValueT(4) {
+		t.Fatalf("Load after Swap = %v, %v; want %v, true", v, ok, ValueT(4))
+	}
+}
+
+func TestLen(t *testing.T) {
+	const mapSize = 1 << 6
+
+	m := new(syncmap.Map)
+	check := func(want int) {
+		t.Helper()
+		if n := m.Len(); n != want {
+			t.Fatalf("Len() = %v; want %v", n, want)
+		}
+		if n := m.ApproxLen(); n != want {
+			t.Fatalf("ApproxLen() = %v; want %v", n, want)
+		}
+	}
+
+	check(0)
+	for n := 0; n < mapSize; n++ {
+		m.Store(newKeyT(n), ValueT(n))
+		m.Store(newKeyT(n), ValueT(n))
+	}
+	check(mapSize)
+
+	// Promote the dirty map and exercise the read-map paths.
+	m.Range(func(KeyT, ValueT) bool { return true })
+	for n := 0; n < mapSize; n += 2 {
+		m.Delete(newKeyT(n))
+		m.Delete(newKeyT(n))
+	}
+	check(mapSize / 2)
+
+	for n := 0; n < mapSize; n++ {
+		m.LoadOrStore(newKeyT(n), ValueT(n))
+	}
+	check(mapSize)
+
+	for n := 0; n < mapSize; n++ {
+		m.CompareAndDelete(newKeyT(n), ValueT(n))
+	}
+	check(0)
+}
+
+func TestClear(t *testing.T) {
+	const mapSize = 1 << 6
+
+	m := new(syncmap.Map)
+	m.Clear()
+	for n := 0; n < mapSize; n++ {
+		m.Store(newKeyT(n), ValueT(n))
+	}
+	// Promote half of the entries to the read map and leave the rest dirty.
+	m.Range(func(KeyT, ValueT) bool { return true })
+	m.Delete(newKeyT(0))
+	for n := mapSize; n < 2*mapSize; n++ {
+		m.Store(newKeyT(n), ValueT(n))
+	}
+
+	m.Clear()
+	if n := m.Len(); n != 0 {
+		t.Fatalf("Len() after Clear = %v; want 0", n)
+	}
+	m.Range(func(k KeyT, v ValueT) bool {
+		t.Fatalf("Range after Clear visited %v: %v", k, v)
+		return false
+	})
+
+	for n := 0; n < 2*mapSize; n++ {
+		if v, ok := m.Load(newKeyT(n)); ok {
+			t.Fatalf("Load(%v) after Clear = %v, true", newKeyT(n), v)
+		}
+	}
+	m.Store(newKeyT(1), ValueT(1))
+	if v, ok := m.Load(newKeyT(1)); !ok || v != ValueT(1) {
+		t.Fatalf("Load after Clear and Store = %v, %v; want %v, true", v, ok, ValueT(1))
+	}
+	if n := m.Len(); n != 1 {
+		t.Fatalf("Len() after Clear and Store = %v; want 1", n)
+	}
+}
+
+func TestCompact(t *testing.T) {
+	const mapSize = 1 << 6
+
+	m := new(syncmap.Map)
+	m.Compact()
+	for n := 0; n < mapSize; n++ {
+		m.Store(newKeyT(n), ValueT(n))
+	}
+	// Delete entries from both the read map and the dirty map.
+	m.Range(func(KeyT, ValueT) bool { return true })
+	for n := mapSize; n < 2*mapSize; n++ {
+		m.Store(newKeyT(n), ValueT(n))
+	}
+	for n := 0; n < 2*mapSize; n += 2 {
+		m.Delete(newKeyT(n))
+	}
+
+	m.Compact()
+	if n := m.Len(); n != mapSize {
+		t.Fatalf("Len() after Compact = %v; want %v", n, mapSize)
+	}
+	for n := 0; n < 2*mapSize; n++ {
+		v, ok := m.Load(newKeyT(n))
+		if want := n%2 == 1; ok != want || (ok && v != ValueT(n)) {
+			t.Fatalf("Load(%v) after Compact = %v, %v; want %v, %v", newKeyT(n), v, ok, ValueT(n), want)
+		}
+	}
+	// Deleted keys can be stored again.
+	m.Store(newKeyT(0), ValueT(0))
+	if v, ok := m.Load(newKeyT(0)); !ok || v != ValueT(0) {
+		t.Fatalf("Load after Compact and Store = %v, %v; want %v, true", v, ok, ValueT(0))
+	}
+	if n := m.Len(); n != mapSize+1 {
+		t.Fatalf("Len() after Compact and Store = %v; want %v", n, mapSize+1)
+	}
+}
+
+func TestLoadBulk(t *testing.T) {
+	const mapSize = 1 << 10
+
+	m := new(syncmap.Map)
+	m.Store(newKeyT(0), ValueT(-1))
+	m.Store(newKeyT(mapSize), ValueT(mapSize))
+	m.Delete(newKeyT(mapSize))
+	pairs := make([]syncmap.Pair, 0, mapSize+1)
+	for n := 0; n < mapSize; n++ {
+		pairs = append(pairs, syncmap.Pair{Key: newKeyT(n), Value: ValueT(n)})
+	}
+	pairs = append(pairs, syncmap.Pair{Key: newKeyT(1), Value: ValueT(1)})
+
+	m.LoadBulk(pairs)
+	if n := m.Len(); n != mapSize {
+		t.Fatalf("Len() after LoadBulk = %v; want %v", n, mapSize)
+	}
+	for n := 0; n <= mapSize; n++ {
+		v, ok := m.Load(newKeyT(n))
+		if want := n < mapSize; ok != want || (ok && v != ValueT(n)) {
+			t.Fatalf("Load(%v) after LoadBulk = %v, %v; want %v, %v", newKeyT(n), v, ok, ValueT(n), want)
+		}
+	}
+	if st := m.Stats(); st.ReadLen != mapSize || st.DirtyLen != 0 || st.Misses != 0 {
+		t.Fatalf("Stats() after LoadBulk = %+v; want %v entries in the read map only", st, mapSize)
+	}
+}
+
+func TestFreeze(t *testing.T) {
+	const mapSize = 1 << 6
+
+	m := new(syncmap.Map)
+	for n := 0; n < mapSize; n++ {
+		m.Store(newKeyT(n), ValueT(n))
+	}
+	m.Delete(newKeyT(0))
+	e := m.Acquire(newKeyT(1))
+
+	m.Freeze()
+	if !m.Frozen() {
+		t.Fatal("Frozen() after Freeze = false")
+	}
+	for n := 0; n < mapSize; n++ {
+		v, ok := m.Load(newKeyT(n))
+		if want := n > 0; ok != want || (ok && v != ValueT(n)) {
+			t.Fatalf("Load(%v) after Freeze = %v, %v; want %v, %v", newKeyT(n), v, ok, ValueT(n), want)
+		}
+	}
+	if st := m.Stats(); st.ReadLen != mapSize-1 || st.DirtyLen != 0 || st.Amended {
+		t.Fatalf("Stats() after Freeze = %+v; want %v entries in the read map only", st, mapSize-1)
+	}
+
+	k := newKeyT(1)
+	for name, write := range map[string]func(){
+		"Store":            func() { m.Store(k, 0) },
+		"LoadOrStore":      func() { m.LoadOrStore(newKeyT(mapSize), 0) },
+		"Swap":             func() { m.Swap(k, 0) },
+		"Replace":          func() { m.Replace(k, 0) },
+		"Update":           func() { m.Update(k, func(v ValueT, ok bool) (ValueT, bool) { return v, ok }) },
+		"StoreMany":        func() { m.StoreMany(map[KeyT]ValueT{k: 0}) },
+		"LoadBulk":         func() { m.LoadBulk([]syncmap.Pair{{Key: k}}) },
+		"Merge":            func() { m.Merge(new(syncmap.Map)) },
+		"Delete":           func() { m.Delete(k) },
+		"DeleteMany":       func() { m.DeleteMany([]KeyT{k}) },
+		"DeleteFunc":       func() { m.DeleteFunc(func(KeyT, ValueT) bool { return false }) },
+		"Pop":              func() { m.Pop() },
+		"Clear":            func() { m.Clear() },
+		"CompareAndSwap":   func() { m.CompareAndSwap(k, 1, 0) },
+		"CompareAndDelete": func() { m.CompareAndDelete(k, 1) },
+		"UnmarshalJSON":    func() { m.UnmarshalJSON([]byte("{}")) },
+		"Entry.Store":      func() { e.Store(0) },
+	} {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("%s on a frozen map didn't panic", name)
+				}
+			}()
+			write()
+		}()
+	}
+	if n := m.Len(); n != mapSize-1 {
+		t.Fatalf("Len() after failed writes = %v; want %v", n, mapSize-1)
+	}
+
+	clone := m.Clone()
+	clone.Store(k, 0)
+	if v, _ := clone.Load(k); clone.Frozen() || v != 0 {
+		t.Fatalf("Clone of a frozen map loaded %v after Store, frozen = %v", v, clone.Frozen())
+	}
+}
+
+func TestKeysValues(t *testing.T) {
+	const mapSize = 1 << 6
+
+	m := new(syncmap.Map)
+	want := make(map[KeyT]ValueT)
+	for n := 0; n < mapSize; n++ {
+		m.Store(newKeyT(n), ValueT(n))
+		want[newKeyT(n)] = ValueT(n)
+		if n%3 == 0 {
+			m.Delete(newKeyT(n))
+			delete(want, newKeyT(n))
+		}
+	}
+
+	keys, values := m.Keys(), m.Values()
+	if len(keys) != len(want) || len(values) != len(want) {
+		t.Fatalf("Keys/Values returned %v/%v elements; want %v", len(keys), len(values), len(want))
+	}
+	seen := make(map[ValueT]bool)
+	for _, k := range keys {
+		if _, ok := want[k]; !ok {
+			t.Fatalf("Keys returned unexpected key %v", k)
+		}
+		seen[want[k]] = true
+	}
+	for _, v := range values {
+		if !seen[v] {
+			t.Fatalf("Values returned unexpected value %v", v)
+		}
+	}
+}
+
+func TestSnapshot(t *testing.T) {
+	m := new(syncmap.Map)
+	m.Store(newKeyT(1), ValueT(1))
+	m.Store(newKeyT(2), ValueT(2))
+	m.Delete(newKeyT(2))
+
+	got := m.Snapshot()
+	want := map[KeyT]ValueT{newKeyT(1): ValueT(1)}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("Snapshot() = %v; want %v", got, want)
+	}
+
+	m.Store(newKeyT(3), ValueT(3))
+	if _, ok := got[newKeyT(3)]; ok {
+		t.Fatalf("Snapshot was modified by a later Store")
+	}
+}
+
+func TestClone(t *testing.T) {
+	const mapSize = 1 << 6
+
+	m := new(syncmap.Map)
+	for n := 0; n < mapSize; n++ {
+		m.Store(newKeyT(n), ValueT(n))
+	}
+	m.Delete(newKeyT(0))
+
+	c := m.Clone()
+	if !reflect.DeepEqual(c.Snapshot(), m.Snapshot()) {
+		t.Fatalf("Clone() = %v; want %v", c.Snapshot(), m.Snapshot())
+	}
+	if n := c.Len(); n != mapSize-1 {
+		t.Fatalf("Clone().Len() = %v; want %v", n, mapSize-1)
+	}
+
+	// Writes to either map must not be visible in the other.
+	c.Store(newKeyT(1), ValueT(-1))
+	m.Store(newKeyT(0), ValueT(0))
+	if v, _ := m.Load(newKeyT(1)); v != ValueT(1) {
+		t.Fatalf("Store to clone changed the original: got %v; want %v", v, ValueT(1))
+	}
+	if _, ok := c.Load(newKeyT(0)); ok {
+		t.Fatalf("Store to original is visible in the clone")
+	}
+}
+
+func TestUpdate(t *testing.T) {
+	incr := func(old ValueT, loaded bool) (ValueT, bool) {
+		return old + 1, true
+	}
+	remove := func(ValueT, bool) (ValueT, bool) {
+		var zero ValueT
+		return zero, false
+	}
+
+	m := new(syncmap.Map)
+	if _, ok := m.Update(newKeyT(1), remove); ok {
+		t.Fatalf("Update deleting a missing key reported it present")
+	}
+	if v, ok := m.Update(newKeyT(1), incr); !ok || v != ValueT(1) {
+		t.Fatalf("Update on a missing key = %v, %v; want %v, true", v, ok, ValueT(1))
+	}
+	m.Range(func(KeyT, ValueT) bool { return true })
+	if v, ok := m.Update(newKeyT(1), incr); !ok || v != ValueT(2) {
+		t.Fatalf("Update on a read key = %v, %v; want %v, true", v, ok, ValueT(2))
+	}
+	if _, ok := m.Update(newKeyT(1), remove); ok {
+		t.Fatalf("Update deleting a key reported it present")
+	}
+	if _, ok := m.Load(newKeyT(1)); ok {
+		t.Fatalf("key is present after Update deleted it")
+	}
+	if n := m.Len(); n != 0 {
+		t.Fatalf("Len() = %v; want 0", n)
+	}
+}
+
+func TestConcurrentUpdate(t *testing.T) {
+	const incrs = 1 << 10
+
+	m := new(syncmap.Map)
+	var wg sync.WaitGroup
+	procs := runtime.GOMAXPROCS(0)
+	for g := 0; g < procs; g++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < incrs; i++ {
+				m.Update(newKeyT(1), func(old ValueT, _ bool) (ValueT, bool) {
+					return old + 1, true
+				})
+			}
+		}()
+	}
+	wg.Wait()
+
+	if v, _ := m.Load(newKeyT(1)); v != ValueT(procs*incrs) {
+		t.Fatalf("after concurrent Updates got %v; want %v", v, procs*incrs)
+	}
+}
+
+func TestJSON(t *testing.T) {
+	m := new(syncmap.Map)
+	m.Store(newKeyT(1), ValueT(1))
+	m.Store(newKeyT(2), ValueT(2))
+
+	data, err := json.Marshal(m)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got := new(syncmap.Map)
+	got.Store(newKeyT(3), ValueT(3))
+	if err := json.Unmarshal(data, got); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got.Snapshot(), m.Snapshot()) {
+		t.Fatalf("round trip through %s = %v; want %v", data, got.Snapshot(), m.Snapshot())
+	}
+	if n := got.Len(); n != 2 {
+		t.Fatalf("Len() after UnmarshalJSON = %v; want 2", n)
+	}
+}
+
+func TestGob(t *testing.T) {
+	m := new(syncmap.Map)
+	m.Store(newKeyT(1), ValueT(1))
+	m.Store(newKeyT(2), ValueT(2))
+
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(m); err != nil {
+		t.Fatal(err)
+	}
+
+	got := new(syncmap.Map)
+	if err := gob.NewDecoder(&buf).Decode(got); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got.Snapshot(), m.Snapshot()) {
+		t.Fatalf("gob round trip = %v; want %v", got.Snapshot(), m.Snapshot())
+	}
+}
+
+func TestBinary(t *testing.T) {
+	m := new(syncmap.Map)
+	for n := 0; n < 1<<4; n++ {
+		m.Store(newKeyT(n), ValueT(n))
+	}
+
+	data, err := m.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := new(syncmap.Map)
+	if err := got.UnmarshalBinary(data); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got.Snapshot(), m.Snapshot()) {
+		t.Fatalf("binary round trip = %v; want %v", got.Snapshot(), m.Snapshot())
+	}
+
+	if err := got.UnmarshalBinary(data[:len(data)-1]); err == nil {
+		t.Fatalf("UnmarshalBinary of truncated data succeeded")
+	}
+	if err := got.UnmarshalBinary(append(data, 0)); err == nil {
+		t.Fatalf("UnmarshalBinary with trailing data succeeded")
+	}
+}
+
+func TestMerge(t *testing.T) {
+	a, b := new(syncmap.Map), new(syncmap.Map)
+	a.Store(newKeyT(1), ValueT(1))
+	a.Store(newKeyT(2), ValueT(2))
+	a.Range(func(KeyT, ValueT) bool { return true })
+	b.Store(newKeyT(2), ValueT(20))
+	b.Store(newKeyT(3), ValueT(30))
+
+	sum := a.Clone()
+	sum.MergeFunc(b, func(_ KeyT, x, y ValueT) ValueT { return x + y })
+	want := map[KeyT]ValueT{newKeyT(1): 1, newKeyT(2): 22, newKeyT(3): 30}
+	if got := sum.Snapshot(); !reflect.DeepEqual(got, want) {
+		t.Fatalf("MergeFunc = %v; want %v", got, want)
+	}
+
+	a.Merge(b)
+	want = map[KeyT]ValueT{newKeyT(1): 1, newKeyT(2): 20, newKeyT(3): 30}
+	if got := a.Snapshot(); !reflect.DeepEqual(got, want) {
+		t.Fatalf("Merge = %v; want %v", got, want)
+	}
+	if n := a.Len(); n != len(want) {
+		t.Fatalf("Len() after Merge = %v; want %v", n, len(want))
+	}
+
+	a.Merge(a)
+	if got := a.Snapshot(); !reflect.DeepEqual(got, want) {
+		t.Fatalf("self-Merge = %v; want %v", got, want)
+	}
+}
+
+func TestBatch(t *testing.T) {
+	const mapSize = 1 << 6
+
+	m := new(syncmap.Map)
+	m.Store(newKeyT(0), ValueT(-1))
+	m.Range(func(KeyT, ValueT) bool { return true })
+
+	entries := make(map[KeyT]ValueT)
+	keys := make([]KeyT, 0, mapSize)
+	for n := 0; n < mapSize; n++ {
+		entries[newKeyT(n)] = ValueT(n)
+		keys = append(keys, newKeyT(n))
+	}
+	m.StoreMany(entries)
+	if n := m.Len(); n != mapSize {
+		t.Fatalf("Len() after StoreMany = %v; want %v", n, mapSize)
+	}
+
+	values, ok := m.LoadMany(append(keys, newKeyT(mapSize)))
+	for i, k := range keys {
+		if !ok[i] || values[i] != entries[k] {
+			t.Fatalf("LoadMany()[%v] = %v, %v; want %v, true", i, values[i], ok[i], entries[k])
+		}
+	}
+	if ok[mapSize] {
+		t.Fatalf("LoadMany reported a missing key as present")
+	}
+
+	m.DeleteMany(keys[:mapSize/2])
+	if n := m.Len(); n != mapSize/2 {
+		t.Fatalf("Len() after DeleteMany = %v; want %v", n, mapSize/2)
+	}
+	_, ok = m.LoadMany(keys)
+	for i := range keys {
+		if ok[i] != (i >= mapSize/2) {
+			t.Fatalf("LoadMany()[%v] after DeleteMany reported ok=%v", i, ok[i])
+		}
+	}
+}
+
+func TestDeleteFunc(t *testing.T) {
+	const mapSize = 1 << 6
+
+	m := new(syncmap.Map)
+	for n := 0; n < mapSize; n++ {
+		m.Store(newKeyT(n), ValueT(n))
+	}
+	m.DeleteFunc(func(_ KeyT, v ValueT) bool {
+		return v%2 == 0
+	})
+
+	if n := m.Len(); n != mapSize/2 {
+		t.Fatalf("Len() after DeleteFunc = %v; want %v", n, mapSize/2)
+	}
+	m.Range(func(k KeyT, v ValueT) bool {
+		if v%2 == 0 {
+			t.Fatalf("DeleteFunc left %v: %v in the map", k, v)
+		}
+		return true
+	})
+}
+
+func TestNew(t *testing.T) {
+	const mapSize = 1 << 10
+
+	m := syncmap.New(syncmap.WithCapacity(mapSize))
+	for n := 0; n < mapSize; n++ {
+		m.Store(newKeyT(n), ValueT(n))
+	}
+	if n := m.Len(); n != mapSize {
+		t.Fatalf("Len() = %v; want %v", n, mapSize)
+	}
+}
+
+func TestWithCopy(t *testing.T) {
+	// The copy is marked by an offset, so that uncopied values stand out.
+	const mark = 1000
+	m := syncmap.New(syncmap.WithCopy(func(v ValueT) ValueT { return v + mark }))
+	store := map[string]func(k KeyT, v ValueT){
+		"Store":       func(k KeyT, v ValueT) { m.Store(k, v) },
+		"LoadOrStore": func(k KeyT, v ValueT) { m.LoadOrStore(k, v) },
+		"Swap":        func(k KeyT, v ValueT) { m.Swap(k, v) },
+		"StoreMany":   func(k KeyT, v ValueT) { m.StoreMany(map[KeyT]ValueT{k: v}) },
+		"Update": func(k KeyT, v ValueT) {
+			m.Update(k, func(ValueT, bool) (ValueT, bool) { return v, true })
+		},
+		"Replace": func(k KeyT, v ValueT) {
+			m.Store(k, 0)
+			m.Replace(k, v)
+		},
+		"CompareAndSwap": func(k KeyT, v ValueT) {
+			m.Store(k, 0)
+			m.CompareAndSwap(k, mark, v)
+		},
+		"Entry.Store": func(k KeyT, v ValueT) { m.Acquire(k).Store(v) },
+	}
+	for name, f := range store {
+		k := newKeyT(1)
+		m.Clear()
+		f(k, 1)
+		if got, _ := m.Load(k); got != 1+mark {
+			t.Errorf("%s stored %v; want a copy of 1", name, got)
+		}
+	}
+
+	clone := m.Clone()
+	if got, _ := clone.Load(newKeyT(1)); got != 1+2*mark {
+		t.Errorf("Clone holds %v; want a copy of %v", got, 1+mark)
+	}
+}
+
+func TestWithOnEvict(t *testing.T) {
+	evicted := make(map[KeyT]ValueT)
+	m := syncmap.New(syncmap.WithOnEvict(func(k KeyT, v ValueT, reason syncmap.Reason) {
+		if reason != syncmap.ReasonCleared {
+			t.Errorf("WithOnEvict called for %v with reason %v; want %v", k, reason, syncmap.ReasonCleared)
+		}
+		if _, ok := evicted[k]; ok {
+			t.Errorf("WithOnEvict called twice for %v", k)
+		}
+		evicted[k] = v
+	}))
+	want := make(map[KeyT]ValueT)
+	for n := 0; n < 8; n++ {
+		m.Store(newKeyT(n), ValueT(n))
+		want[newKeyT(n)] = ValueT(n)
+	}
+	// Leave some keys to the dirty map.
+	m.Range(func(KeyT, ValueT) bool { return true })
+	for n := 8; n < 16; n++ {
+		m.Store(newKeyT(n), ValueT(n))
+		want[newKeyT(n)] = ValueT(n)
+	}
+	// Deleted and replaced values aren't evicted.
+	m.Delete(newKeyT(0))
+	delete(want, newKeyT(0))
+	m.Store(newKeyT(1), ValueT(100))
+	want[newKeyT(1)] = ValueT(100)
+
+	m.Clear()
+	if !reflect.DeepEqual(evicted, want) {
+		t.Errorf("Clear evicted %v; want %v", evicted, want)
+	}
+	m.Store(newKeyT(1), ValueT(1))
+	if v, ok := m.Load(newKeyT(1)); !ok || v != ValueT(1) {
+		t.Errorf("Load after Clear and Store = %v, %v; want %v, true", v, ok, ValueT(1))
+	}
+}
+
+func TestWithHooks(t *testing.T) {
+	var (
+		m      *syncmap.Map
+		events []string
+	)
+	record := func(args ...any) { events = append(events, fmt.Sprintln(args...)) }
+	m = syncmap.New(syncmap.WithHooks(syncmap.Hooks{
+		OnStore: func(k KeyT, v ValueT) {
+			// Hooks are called without the map's lock held.
+			if got, _ := m.Load(k); got != v {
+				t.Errorf("OnStore(%v, %v) found %v in the map", k, v, got)
+			}
+			record("store", k, v)
+		},
+		OnDelete:   func(k KeyT) { record("delete", k) },
+		OnLoadHit:  func(k KeyT, v ValueT) { record("hit", k, v) },
+		OnLoadMiss: func(k KeyT) { record("miss", k) },
+	}))
+	// ev returns the event recorded by a hook called with the i-th key, and
+	// the value v if any.
+	ev := func(hook string, i int, v ...any) string {
+		return fmt.Sprintln(append([]any{hook, newKeyT(i)}, v...)...)
+	}
+	ops := []struct {
+		op   func()
+		want []string
+	}{
+		{func() { m.Store(newKeyT(1), 1) }, []string{ev("hit", 1, 1), ev("store", 1, 1)}},
+		{func() { m.Load(newKeyT(2)) }, []string{ev("miss", 2)}},
+		{func() { m.LoadOrStore(newKeyT(1), 2) }, []string{ev("hit", 1, 1)}},
+		{func() { m.LoadOrStore(newKeyT(2), 2) }, []string{ev("hit", 2, 2), ev("store", 2, 2)}},
+		{func() { m.Update(newKeyT(2), func(v ValueT, _ bool) (ValueT, bool) { return v + 1, true }) }, []string{ev("hit", 2, 3), ev("store", 2, 3)}},
+		{func() { m.Update(newKeyT(2), func(ValueT, bool) (ValueT, bool) { return 0, false }) }, []string{ev("delete", 2)}},
+		{func() { m.Update(newKeyT(2), func(ValueT, bool) (ValueT, bool) { return 0, false }) }, nil},
+		{func() { m.Replace(newKeyT(3), 3) }, nil},
+		{func() { m.Delete(newKeyT(3)) }, nil},
+		{func() { m.LoadMany([]KeyT{newKeyT(1), newKeyT(3)}) }, []string{ev("hit", 1, 1), ev("miss", 3)}},
+		{func() { m.StoreMany(map[KeyT]ValueT{newKeyT(3): 3}) }, []string{ev("hit", 3, 3), ev("store", 3, 3)}},
+		{func() { m.DeleteMany([]KeyT{newKeyT(3), newKeyT(4)}) }, []string{ev("delete", 3)}},
+		{func() { m.Delete(newKeyT(1)) }, []string{ev("delete", 1)}},
+	}
+	for i, op := range ops {
+		events = nil
+		op.op()
+		if !reflect.DeepEqual(events, op.want) {
+			t.Errorf("operation %d called hooks %q; want %q", i, events, op.want)
+		}
+	}
+}
+
+func TestNewFromMap(t *testing.T) {
+	src := map[KeyT]ValueT{newKeyT(1): ValueT(1), newKeyT(2): ValueT(2)}
+	m := syncmap.NewFromMap(src)
+	if got := m.Snapshot(); !reflect.DeepEqual(got, src) {
+		t.Fatalf("NewFromMap(%v) holds %v", src, got)
+	}
+	if n := m.Len(); n != len(src) {
+		t.Fatalf("Len() = %v; want %v", n, len(src))
+	}
+
+	m.Store(newKeyT(3), ValueT(3))
+	if _, ok := src[newKeyT(3)]; ok {
+		t.Fatalf("Store modified the source map")
+	}
+}
+
+func TestContains(t *testing.T) {
+	m := new(syncmap.Map)
+	m.Store(newKeyT(1), ValueT(1))
+
+	if !m.Contains(newKeyT(1)) || m.Contains(newKeyT(2)) {
+		t.Fatalf("Contains = %v, %v; want true, false", m.Contains(newKeyT(1)), m.Contains(newKeyT(2)))
+	}
+	if v := m.LoadOrDefault(newKeyT(1), ValueT(-1)); v != ValueT(1) {
+		t.Fatalf("LoadOrDefault of present key = %v; want %v", v, ValueT(1))
+	}
+	if v := m.LoadOrDefault(newKeyT(2), ValueT(-1)); v != ValueT(-1) {
+		t.Fatalf("LoadOrDefault of missing key = %v; want %v", v, ValueT(-1))
+	}
+}
+
+func TestUpsert(t *testing.T) {
+	sum := func(a, b ValueT) ValueT { return a + b }
+
+	m := new(syncmap.Map)
+	if v, loaded := m.Upsert(newKeyT(1), ValueT(1), sum); loaded || v != ValueT(1) {
+		t.Fatalf("Upsert of a new key = %v, %v; want %v, false", v, loaded, ValueT(1))
+	}
+	if v, loaded := m.Upsert(newKeyT(1), ValueT(2), sum); !loaded || v != ValueT(3) {
+		t.Fatalf("Upsert of an existing key = %v, %v; want %v, true", v, loaded, ValueT(3))
+	}
+}
+
+func TestReplace(t *testing.T) {
+	m := new(syncmap.Map)
+	if _, replaced := m.Replace(newKeyT(1), ValueT(1)); replaced {
+		t.Fatalf("Replace of a missing key reported replaced")
+	}
+	if m.Contains(newKeyT(1)) {
+		t.Fatalf("Replace inserted a missing key")
+	}
+
+	m.Store(newKeyT(1), ValueT(1))
+	if prev, replaced := m.Replace(newKeyT(1), ValueT(2)); !replaced || prev != ValueT(1) {
+		t.Fatalf("Replace of a dirty key = %v, %v; want %v, true", prev, replaced, ValueT(1))
+	}
+	m.Range(func(KeyT, ValueT) bool { return true })
+	if prev, replaced := m.Replace(newKeyT(1), ValueT(3)); !replaced || prev != ValueT(2) {
+		t.Fatalf("Replace of a read key = %v, %v; want %v, true", prev, replaced, ValueT(2))
+	}
+	m.Delete(newKeyT(1))
+	if _, replaced := m.Replace(newKeyT(1), ValueT(4)); replaced {
+		t.Fatalf("Replace of a deleted key reported replaced")
+	}
+}
+
+func TestPop(t *testing.T) {
+	const mapSize = 1 << 6
+
+	m := new(syncmap.Map)
+	want := make(map[KeyT]ValueT)
+	for n := 0; n < mapSize; n++ {
+		m.Store(newKeyT(n), ValueT(n))
+		want[newKeyT(n)] = ValueT(n)
+		if n == mapSize/2 {
+			// Leave half of the entries in the dirty map.
+			m.Range(func(KeyT, ValueT) bool { return true })
+		}
+	}
+
+	for n := mapSize; n > 0; n-- {
+		k, v, ok := m.Pop()
+		if !ok {
+			t.Fatalf("Pop reported an empty map with %v entries left", n)
+		}
+		if w, found := want[k]; !found || w != v {
+			t.Fatalf("Pop returned unexpected entry %v: %v", k, v)
+		}
+		delete(want, k)
+	}
+	if k, v, ok := m.Pop(); ok {
+		t.Fatalf("Pop on an empty map returned %v: %v", k, v)
+	}
+	if n := m.Len(); n != 0 {
+		t.Fatalf("Len() after popping every entry = %v; want 0", n)
+	}
+}
+
+func TestRangeKeysValues(t *testing.T) {
+	const mapSize = 1 << 4
+
+	m := new(syncmap.Map)
+	for n := 0; n < mapSize; n++ {
+		m.Store(newKeyT(n), ValueT(n))
+	}
+	m.Delete(newKeyT(0))
+
+	keys := 0
+	m.RangeKeys(func(k KeyT) bool {
+		if k == newKeyT(0) {
+			t.Fatalf("RangeKeys visited deleted key %v", k)
+		}
+		keys++
+		return true
+	})
+	values := 0
+	m.RangeValues(func(ValueT) bool {
+		values++
+		return true
+	})
+	if keys != mapSize-1 || values != mapSize-1 {
+		t.Fatalf("RangeKeys/RangeValues visited %v/%v elements; want %v", keys, values, mapSize-1)
+	}
+
+	calls := 0
+	m.RangeKeys(func(KeyT) bool {
+		calls++
+		return false
+	})
+	if calls != 1 {
+		t.Fatalf("RangeKeys called f %v times after it returned false", calls)
+	}
+}
+
+func TestRangeSorted(t *testing.T) {
+	const mapSize = 1 << 6
+
+	m := new(syncmap.Map)
+	for n := 0; n < mapSize; n++ {
+		m.Store(newKeyT(n), ValueT(n))
+	}
+
+	var keys []KeyT
+	m.RangeSorted(func(a, b KeyT) bool { return a < b }, func(k KeyT, v ValueT) bool {
+		keys = append(keys, k)
+		return true
+	})
+	if len(keys) != mapSize {
+		t.Fatalf("RangeSorted visited %v elements; want %v", len(keys), mapSize)
+	}
+	for i := 1; i < len(keys); i++ {
+		if keys[i-1] >= keys[i] {
+			t.Fatalf("RangeSorted visited %v before %v", keys[i-1], keys[i])
+		}
+	}
+}
+
+func TestEqual(t *testing.T) {
+	a, b := new(syncmap.Map), new(syncmap.Map)
+	if !a.Equal(b) {
+		t.Fatalf("empty maps are not Equal")
+	}
+
+	a.Store(newKeyT(1), ValueT(1))
+	b.Store(newKeyT(1), ValueT(1))
+	b.Store(newKeyT(2), ValueT(2))
+	if a.Equal(b) || b.Equal(a) {
+		t.Fatalf("maps of different sizes are Equal")
+	}
+
+	b.Delete(newKeyT(2))
+	if !a.Equal(b) {
+		t.Fatalf("maps with the same entries are not Equal")
+	}
+
+	b.Store(newKeyT(1), ValueT(-1))
+	if a.Equal(b) {
+		t.Fatalf("maps with different values are Equal")
+	}
+	abs := func(x, y ValueT) bool { return x == y || x == -y }
+	if !a.EqualFunc(b, abs) {
+		t.Fatalf("EqualFunc ignored eq")
+	}
+}
+
+func TestString(t *testing.T) {
+	m := new(syncmap.Map)
+	m.Store(newKeyT(2), ValueT(20))
+	m.Store(newKeyT(1), ValueT(10))
+
+	want := fmt.Sprintf("Map[len=2]{%v:%v %v:%v}", newKeyT(1), ValueT(10), newKeyT(2), ValueT(20))
+	if got := fmt.Sprint(m); got != want {
+		t.Fatalf("String() = %q; want %q", got, want)
+	}
+	if got := fmt.Sprintf("%#v", m); !strings.HasPrefix(got, "&syncmap.Map{") {
+		t.Fatalf("GoString() = %q", got)
+	}
+
+	for n := 0; n < 1<<6; n++ {
+		m.Store(newKeyT(n), ValueT(n))
+	}
+	if got := m.String(); !strings.HasSuffix(got, " …}") {
+		t.Fatalf("String() of a large map is not truncated: %q", got)
+	}
+}
+
+func TestPublish(t *testing.T) {
+	m := new(syncmap.Map)
+	m.Store(newKeyT(1), ValueT(1))
+	m.Publish("syncmap_test.TestPublish")
+
+	v := expvar.Get("syncmap_test.TestPublish")
+	if v == nil {
+		t.Fatalf("Publish did not register the map")
+	}
+	want, err := json.Marshal(m)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := v.String(); got != string(want) {
+		t.Fatalf("published String() = %s; want %s", got, want)
+	}
+}
+
+func TestRangeSnapshot(t *testing.T) {
+	const mapSize = 1 << 6
+
+	m := new(syncmap.Map)
+	for n := 0; n < mapSize; n++ {
+		m.Store(newKeyT(n), ValueT(n))
+	}
+
+	seen := 0
+	m.RangeSnapshot(func(k KeyT, v ValueT) bool {
+		// Writes made during the iteration must not be observed by it.
+		m.Delete(k)
+		m.Store(newKeyT(mapSize+seen), v)
+		seen++
+		return true
+	})
+	if seen != mapSize {
+		t.Fatalf("RangeSnapshot visited %v elements; want %v", seen, mapSize)
+	}
+}
+
+func TestAcquire(t *testing.T) {
+	m := new(syncmap.Map)
+	h := m.Acquire(newKeyT(1))
+	if h.Key() != newKeyT(1) {
+		t.Fatalf("Key() = %v; want %v", h.Key(), newKeyT(1))
+	}
+	if _, ok := h.Load(); ok {
+		t.Fatalf("Load through a handle to a missing key reported ok")
+	}
+
+	h.Store(ValueT(1))
+	if v, ok := m.Load(newKeyT(1)); !ok || v != ValueT(1) {
+		t.Fatalf("Load after handle Store = %v, %v; want %v, true", v, ok, ValueT(1))
+	}
+	if !h.CompareAndSwap(ValueT(1), ValueT(2)) || h.CompareAndSwap(ValueT(1), ValueT(3)) {
+		t.Fatalf("handle CompareAndSwap did not compare the current value")
+	}
+
+	// Drop the entry from the dirty map, then promote a new one for the key:
+	// the handle must follow the key rather than its old entry.
+	m.Delete(newKeyT(1))
+	m.Store(newKeyT(1), ValueT(4))
+	m.Range(func(KeyT, ValueT) bool { return true })
+	if v, ok := h.Load(); !ok || v != ValueT(4) {
+		t.Fatalf("handle Load after Delete and Store = %v, %v; want %v, true", v, ok, ValueT(4))
+	}
+
+	m.Clear()
+	if v, ok := h.Load(); ok {
+		t.Fatalf("handle Load after Clear = %v, true", v)
+	}
+	h.Store(ValueT(5))
+	if v, ok := m.Load(newKeyT(1)); !ok || v != ValueT(5) {
+		t.Fatalf("Load after Clear and handle Store = %v, %v; want %v, true", v, ok, ValueT(5))
+	}
+	if n := m.Len(); n != 1 {
+		t.Fatalf("Len() = %v; want 1", n)
+	}
+}
@@ -0,0 +1,95 @@
+//go:build syncmap_ttl
+
+package syncmap
+
+import (
+	"sync"
+	"time"
+)
+
+// This file holds the methods of maps generated with -ttl, whose values may
+// expire.
+
+// StoreWithTTL sets the value for a key, which expires after d: from then
+// on, the map behaves as if the key had been deleted. A d that isn't
+// positive stores a value that never expires, as Store does.
+//
+// Expired values are deleted lazily, by the next operation on their key, or
+// by DeleteExpired, Compact, or Freeze. Until then, they take memory and are
+// counted by Len.
+func (m *Map) StoreWithTTL(key KeyT, value ValueT, d time.Duration) {
+	value = m.copied(value)
+	_, _ = m.swap(key, boxValueTTL(value, d))
+	m.onStore(key, value)
+}
+
+// DeleteExpired deletes the values that have expired. It walks the read map
+// without locking, and then the dirty map, if any, with the map's lock held,
+// so it doesn't promote the dirty map, and writers of new keys only wait for
+// the second walk.
+func (m *Map) DeleteExpired() {
+	read := m.loadReadOnly()
+	for k, e := range read.m {
+		m.expire(k, e, read)
+	}
+	if !read.amended {
+		return
+	}
+	m.mu.Lock()
+	read = m.loadReadOnly()
+	for k, e := range m.dirty {
+		m.expire(k, e, read)
+	}
+	m.mu.Unlock()
+}
+
+// expiry is the state of the janitor of a map.
+type expiry struct {
+	interval time.Duration // set by WithJanitor, or 0
+	stop     chan struct{}
+	once     sync.Once
+}
+
+// WithJanitor makes the map run a goroutine calling DeleteExpired every
+// interval, so that the values of keys never accessed again don't take memory
+// forever. The map must then be closed by Close, which stops the goroutine;
+// until then, the goroutine keeps the map reachable. An interval that isn't
+// positive starts no goroutine.
+func WithJanitor(interval time.Duration) Option {
+	return func(m *Map) {
+		m.expiry.interval = interval
+	}
+}
+
+// startJanitor starts the goroutine set by WithJanitor, if any.
+func (m *Map) startJanitor() {
+	if m.expiry.interval <= 0 {
+		return
+	}
+	m.expiry.stop = make(chan struct{})
+	go m.janitor(m.expiry.interval, m.expiry.stop)
+}
+
+// janitor deletes the expired values of m every interval until stop is
+// closed.
+func (m *Map) janitor(interval time.Duration, stop <-chan struct{}) {
+	t := time.NewTicker(interval)
+	defer t.Stop()
+	for {
+		select {
+		case <-t.C:
+			m.DeleteExpired()
+		case <-stop:
+			return
+		}
+	}
+}
+
+// stopJanitor stops the goroutine started by WithJanitor, if any, for Close.
+func (m *Map) stopJanitor() {
+	m.expiry.once.Do(func() {
+		if m.expiry.stop != nil {
+			close(m.expiry.stop)
+		}
+	})
+}
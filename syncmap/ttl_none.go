@@ -0,0 +1,24 @@
+//go:build !syncmap_ttl
+
+package syncmap
+
+import "unsafe"
+
+// expiry is the state of the janitor of maps generated with -ttl.
+type expiry struct{}
+
+// expired reports whether the value held by an entry as p has expired,
+// which values only do in maps generated with -ttl.
+func expired(p unsafe.Pointer) bool {
+	return false
+}
+
+// expire deletes the value of e, the entry of key in read, if it has
+// expired.
+func (m *Map) expire(key KeyT, e *entry, read readOnly) {}
+
+// startJanitor starts the janitor of maps generated with -ttl.
+func (m *Map) startJanitor() {}
+
+// stopJanitor stops the janitor of maps generated with -ttl.
+func (m *Map) stopJanitor() {}
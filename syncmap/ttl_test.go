@@ -0,0 +1,120 @@
+//go:build syncmap_ttl
+
+package syncmap
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestStoreWithTTL(t *testing.T) {
+	const ttl = time.Millisecond
+	var m Map
+	for i := 0; i < 4; i++ {
+		m.StoreWithTTL(newKeyT(i), newValueT(i), ttl)
+	}
+	m.StoreWithTTL(newKeyT(4), newValueT(4), 0)
+	if _, ok := m.Load(newKeyT(0)); !ok {
+		t.Fatal("Load before the TTL found no value")
+	}
+	time.Sleep(2 * ttl)
+
+	if v, ok := m.Load(newKeyT(0)); ok {
+		t.Errorf("Load of an expired key = %v, true", v)
+	}
+	if _, loaded := m.LoadOrStore(newKeyT(1), newValueT(5)); loaded {
+		t.Error("LoadOrStore of an expired key loaded it")
+	}
+	if _, loaded := m.Swap(newKeyT(2), newValueT(6)); loaded {
+		t.Error("Swap of an expired key loaded it")
+	}
+	m.Range(func(k KeyT, v ValueT) bool {
+		if k == newKeyT(3) {
+			t.Errorf("Range visited the expired key %v", k)
+		}
+		return true
+	})
+	if v, ok := m.Load(newKeyT(4)); !ok || !reflect.DeepEqual(v, newValueT(4)) {
+		t.Errorf("Load of a key stored without TTL = %v, %v; want %v, true", v, ok, newValueT(4))
+	}
+
+	// The expired key 3 is only deleted by DeleteExpired.
+	if n := m.Len(); n != 4 {
+		t.Errorf("Len() before DeleteExpired = %d; want 4", n)
+	}
+	m.DeleteExpired()
+	if n := m.Len(); n != 3 {
+		t.Errorf("Len() after DeleteExpired = %d; want 3", n)
+	}
+}
+
+func TestCloneTTL(t *testing.T) {
+	const ttl = 50 * time.Millisecond
+	var m Map
+	m.StoreWithTTL(newKeyT(0), newValueT(0), ttl)
+	m.StoreWithTTL(newKeyT(1), newValueT(1), time.Millisecond)
+	m.Store(newKeyT(2), newValueT(2))
+	time.Sleep(2 * time.Millisecond)
+
+	// The clone leaves out the value that expired already.
+	c := m.Clone()
+	if n := c.Len(); n != 2 {
+		t.Errorf("Len() of the clone = %d; want 2", n)
+	}
+	if _, ok := c.Load(newKeyT(0)); !ok {
+		t.Fatal("Load from the clone before the TTL found no value")
+	}
+	time.Sleep(2 * ttl)
+
+	if v, ok := c.Load(newKeyT(0)); ok {
+		t.Errorf("Load of a key expired in the clone = %v, true", v)
+	}
+	if v, ok := c.Load(newKeyT(2)); !ok || !reflect.DeepEqual(v, newValueT(2)) {
+		t.Errorf("Load from the clone of a key stored without TTL = %v, %v; want %v, true", v, ok, newValueT(2))
+	}
+}
+
+func TestWithOnEvictExpired(t *testing.T) {
+	evicted := make(map[KeyT]Reason)
+	m := New(WithOnEvict(func(k KeyT, v ValueT, reason Reason) {
+		evicted[k] = reason
+	}))
+	m.StoreWithTTL(newKeyT(0), newValueT(0), time.Millisecond)
+	m.StoreWithTTL(newKeyT(1), newValueT(1), time.Millisecond)
+	m.Store(newKeyT(2), newValueT(2))
+	time.Sleep(2 * time.Millisecond)
+
+	m.Load(newKeyT(0))
+	if want := map[KeyT]Reason{newKeyT(0): ReasonExpired}; !reflect.DeepEqual(evicted, want) {
+		t.Errorf("Load of an expired key evicted %v; want %v", evicted, want)
+	}
+	// Clear reports the values that expired before it as such.
+	m.Clear()
+	want := map[KeyT]Reason{newKeyT(0): ReasonExpired, newKeyT(1): ReasonExpired, newKeyT(2): ReasonCleared}
+	if !reflect.DeepEqual(evicted, want) {
+		t.Errorf("Clear evicted %v; want %v", evicted, want)
+	}
+}
+
+func TestWithJanitor(t *testing.T) {
+	m := New(WithJanitor(time.Millisecond))
+	defer m.Close()
+	for i := 0; i < 4; i++ {
+		m.StoreWithTTL(newKeyT(i), newValueT(i), time.Millisecond)
+	}
+	// Leave some keys to the dirty map.
+	m.Range(func(KeyT, ValueT) bool { return true })
+	for i := 4; i < 8; i++ {
+		m.StoreWithTTL(newKeyT(i), newValueT(i), time.Millisecond)
+	}
+
+	// The expired keys are never accessed, so only the janitor deletes them.
+	for deadline := time.Now().Add(time.Second); m.Len() > 0; time.Sleep(time.Millisecond) {
+		if time.Now().After(deadline) {
+			t.Fatalf("Len() = %d a second after the values expired; want 0", m.Len())
+		}
+	}
+	m.Close()
+	m.Close()
+}
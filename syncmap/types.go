@@ -1,7 +1,11 @@
+//go:build !syncmap_ptrvalue
+
 package syncmap
 
 // KeyT is a type for map's keys.
 type KeyT int64
 
 // ValueT is a type for map's values.
+//
+// ValueT must be comparable for CompareAndSwap and CompareAndDelete.
 type ValueT int64
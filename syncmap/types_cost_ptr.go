@@ -0,0 +1,16 @@
+//go:build syncmap_cost && syncmap_ptrvalue
+
+package syncmap
+
+// costValueT is the cost of a value, which the generator replaces with the
+// function given by -cost.
+func costValueT(value ValueT) int64 {
+	if value == nil {
+		return 0
+	}
+	return *value
+}
+
+// maxCostT is the total cost of the values maps hold by default, which the
+// generator replaces with the one given by -maxcost.
+const maxCostT = 1 << 40
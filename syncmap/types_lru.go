@@ -0,0 +1,7 @@
+//go:build syncmap_lru
+
+package syncmap
+
+// maxEntriesT is the number of entries maps hold by default, which the
+// generator replaces with the one given by -maxentries.
+const maxEntriesT = 1 << 20
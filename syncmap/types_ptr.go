@@ -0,0 +1,10 @@
+//go:build syncmap_ptrvalue
+
+package syncmap
+
+// KeyT is a type for map's keys.
+type KeyT int64
+
+// ValueT is a type for map's values, a pointer type, whose values entries
+// hold as they are.
+type ValueT *int64
@@ -0,0 +1,28 @@
+//go:build syncmap_ptrvalue
+
+package syncmap
+
+import "sync"
+
+var (
+	valuesMu sync.Mutex
+	values   = make(map[int]ValueT)
+)
+
+func newKeyT(i int) KeyT {
+	return KeyT(i)
+}
+
+// newValueT returns the same pointer for the same i, since the tests
+// compare the values they store with those they load.
+func newValueT(i int) ValueT {
+	valuesMu.Lock()
+	defer valuesMu.Unlock()
+	v, ok := values[i]
+	if !ok {
+		n := int64(i)
+		v = &n
+		values[i] = v
+	}
+	return v
+}
@@ -0,0 +1,23 @@
+//go:build !syncmap_ptrvalue && !syncmap_ttl
+
+package syncmap
+
+import "unsafe"
+
+// boxValue returns the pointer an entry holds for the value v: a pointer to
+// a copy of v on the heap, which storing any value but a pointer needs.
+func boxValue(v ValueT) unsafe.Pointer {
+	return unsafe.Pointer(&v)
+}
+
+// unboxValue returns the value held by an entry as p, which is neither nil
+// nor expunged.
+func unboxValue(p unsafe.Pointer) ValueT {
+	return *(*ValueT)(p)
+}
+
+// reboxValue returns the pointer an entry holds for the value v in place of
+// the one it held as p, which is neither nil nor expunged.
+func reboxValue(p unsafe.Pointer, v ValueT) unsafe.Pointer {
+	return boxValue(v)
+}
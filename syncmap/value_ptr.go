@@ -0,0 +1,34 @@
+//go:build syncmap_ptrvalue && !syncmap_ttl
+
+package syncmap
+
+import "unsafe"
+
+// nilValue is the pointer an entry holds for a nil value, since a nil
+// pointer marks a deleted entry.
+var nilValue = unsafe.Pointer(new(any))
+
+// boxValue returns the pointer an entry holds for the value v: v itself, so
+// that storing a value doesn't allocate, and loading it doesn't follow
+// another pointer.
+func boxValue(v ValueT) unsafe.Pointer {
+	if v == nil {
+		return nilValue
+	}
+	return unsafe.Pointer(v)
+}
+
+// unboxValue returns the value held by an entry as p, which is neither nil
+// nor expunged.
+func unboxValue(p unsafe.Pointer) ValueT {
+	if p == nilValue {
+		return nil
+	}
+	return (ValueT)(p)
+}
+
+// reboxValue returns the pointer an entry holds for the value v in place of
+// the one it held as p, which is neither nil nor expunged.
+func reboxValue(p unsafe.Pointer, v ValueT) unsafe.Pointer {
+	return boxValue(v)
+}
@@ -0,0 +1,43 @@
+package syncmap
+
+import (
+	"testing"
+	"unsafe"
+)
+
+var boxed unsafe.Pointer
+
+// TestAllocs checks that reads don't allocate, and that writes to present
+// keys allocate no more than boxing their value does: nothing for pointer
+// values, which entries hold as they are.
+func TestAllocs(t *testing.T) {
+	var m Map
+	for i := 0; i < 8; i++ {
+		m.Store(newKeyT(i), newValueT(i))
+	}
+	// Promote the dirty map, so that reads take the fast path.
+	m.Range(func(KeyT, ValueT) bool { return true })
+	k, missing, v := newKeyT(1), newKeyT(8), newValueT(1)
+	box := testing.AllocsPerRun(100, func() {
+		boxed = boxValue(v)
+	})
+
+	for _, tt := range []struct {
+		name string
+		max  float64
+		f    func()
+	}{
+		{"Load", 0, func() { m.Load(k) }},
+		{"Load of a missing key", 0, func() { m.Load(missing) }},
+		{"LoadOrStore of a present key", 0, func() { m.LoadOrStore(k, v) }},
+		{"Store", box, func() { m.Store(k, v) }},
+		{"Swap", box, func() { m.Swap(k, v) }},
+		{"Replace", box, func() { m.Replace(k, v) }},
+		{"Delete of a missing key", 0, func() { m.Delete(missing) }},
+		{"Len", 0, func() { m.Len() }},
+	} {
+		if n := testing.AllocsPerRun(100, tt.f); n > tt.max {
+			t.Errorf("%s allocates %v times; want at most %v", tt.name, n, tt.max)
+		}
+	}
+}
@@ -0,0 +1,65 @@
+//go:build syncmap_ttl
+
+package syncmap
+
+import (
+	"sync/atomic"
+	"time"
+	"unsafe"
+)
+
+// ttlValue is what entries hold pointers to: a value, and when it expires.
+type ttlValue struct {
+	v ValueT
+
+	// deadline is the time, as returned by now, from which the value is
+	// expired, or 0 if it never expires.
+	deadline int64
+}
+
+// boxValue returns the pointer an entry holds for the value v, which never
+// expires.
+func boxValue(v ValueT) unsafe.Pointer {
+	return unsafe.Pointer(&ttlValue{v: v})
+}
+
+// boxValueTTL returns the pointer an entry holds for the value v, which
+// expires after d, or never if d isn't positive.
+func boxValueTTL(v ValueT, d time.Duration) unsafe.Pointer {
+	b := &ttlValue{v: v}
+	if d > 0 {
+		b.deadline = now() + int64(d)
+	}
+	return unsafe.Pointer(b)
+}
+
+// reboxValue returns the pointer an entry holds for the value v in place of
+// the one it held as p, which is neither nil nor expunged: v expires when
+// the value held as p does.
+func reboxValue(p unsafe.Pointer, v ValueT) unsafe.Pointer {
+	return unsafe.Pointer(&ttlValue{v: v, deadline: (*ttlValue)(p).deadline})
+}
+
+// unboxValue returns the value held by an entry as p, which is neither nil
+// nor expunged.
+func unboxValue(p unsafe.Pointer) ValueT {
+	return (*ttlValue)(p).v
+}
+
+// expired reports whether the value held by an entry as p, which is neither
+// nil nor expunged, has expired.
+func expired(p unsafe.Pointer) bool {
+	d := (*ttlValue)(p).deadline
+	return d != 0 && now() >= d
+}
+
+// expire deletes the value of e, the entry of key in read, if it has
+// expired, so that the operation about to access it finds it deleted.
+func (m *Map) expire(key KeyT, e *entry, read readOnly) {
+	p := atomic.LoadPointer(&e.p)
+	if p != nil && p != expunged && expired(p) && atomic.CompareAndSwapPointer(&e.p, p, nil) {
+		atomic.AddInt64(m.counter(read), -1)
+		m.charge(e)
+		m.evicted(key, p, ReasonExpired)
+	}
+}
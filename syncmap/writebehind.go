@@ -0,0 +1,250 @@
+//go:build syncmap_backend && syncmap_loader
+
+package syncmap
+
+import (
+	"context"
+	"sync"
+)
+
+// This file holds the write-behind mode of the backends of maps generated
+// with -backend, which queue the writes to the backend for a goroutine to
+// apply in batches.
+
+// Write is a write of a key to a backend, as applied by WithWriteBehind.
+type Write struct {
+	Key   KeyT
+	Value ValueT
+
+	// Deleted reports that the key was deleted, rather than Value stored.
+	Deleted bool
+}
+
+// BatchWriter is implemented by the backends that apply batches of writes
+// at once, such as in a transaction or a pipeline, which WithWriteBehind
+// then passes its batches to rather than to Put and Delete one by one.
+type BatchWriter interface {
+	// WriteBatch applies writes, which are of distinct keys.
+	WriteBatch(ctx context.Context, writes []Write) error
+}
+
+// WithWriteBehind makes the map write to the backend set by WithBackend
+// asynchronously: the writes to the map queue the writes to the backend, and
+// return without waiting for them. A goroutine applies the queued writes in
+// batches of up to batch writes, of which only the last of each key is
+// applied, by the WriteBatch method of the backend if it implements
+// BatchWriter, and by Put and Delete otherwise, passing their errors to the
+// function set by WithOnWriteError, if any, which must not write to the map.
+//
+// The queue holds up to n writes: once full, writes to the map block until it
+// drains, so that a slow backend slows writers down rather than the queue
+// growing without bound. StoreE and DeleteE queue their writes too, and wait
+// for them to be applied, or for their context to end, leaving the map
+// unchanged while their write may still be applied later. Flush waits for
+// the writes queued until then to be applied, and Close, which must be
+// called for the goroutine to stop, applies all of them. Loads missing keys
+// whose writes are queued flush the queue before loading them from the
+// backend, so that they never load values overwritten or deleted since.
+//
+// An n that isn't positive writes through synchronously, and a batch that
+// isn't positive applies up to n writes at once.
+func WithWriteBehind(n, batch int) Option {
+	return func(m *Map) {
+		m.backend.queueLen = n
+		m.backend.batchLen = batch
+	}
+}
+
+// Flush waits for the writes queued by WithWriteBehind until then to be
+// applied to the backend.
+func (m *Map) Flush() {
+	m.backend.flush()
+}
+
+// writeBehind is the queue of the writes to a backend.
+type writeBehind struct {
+	queue chan queuedWrite
+	batch int
+	done  chan struct{} // closed once the queue is drained
+
+	// sendMu is held for reading to queue writes, and for writing to close
+	// the queue.
+	sendMu sync.RWMutex
+	closed bool
+
+	mu      sync.Mutex
+	pending map[KeyT]int // the number of writes queued for each key
+}
+
+// queuedWrite is a write queued, or a mark of the writes Flush waits for.
+type queuedWrite struct {
+	w       Write
+	flushed chan struct{} // if not nil, closed once the writes before are applied
+	result  chan error    // if not nil, receives the result of w, for StoreE and DeleteE
+}
+
+// get loads key from the backend, once the writes of key queued, if any,
+// are applied.
+func (b *backing) get(ctx context.Context, key KeyT) (ValueT, error) {
+	if wb := b.behind; wb != nil && wb.isPending(key) {
+		b.flush()
+	}
+	return b.b.Get(ctx, key)
+}
+
+// start starts the goroutine applying the writes to the backend, if the map
+// writes behind.
+func (b *backing) start() {
+	if b.b == nil || b.queueLen <= 0 {
+		return
+	}
+	batch := b.batchLen
+	if batch <= 0 {
+		batch = b.queueLen
+	}
+	wb := &writeBehind{
+		queue:   make(chan queuedWrite, b.queueLen),
+		batch:   batch,
+		done:    make(chan struct{}),
+		pending: make(map[KeyT]int),
+	}
+	b.behind = wb
+	go b.writeBehind(wb)
+}
+
+// close applies the queued writes to the backend, and stops the goroutine
+// applying them.
+func (b *backing) close() {
+	wb := b.behind
+	if wb == nil {
+		return
+	}
+	wb.sendMu.Lock()
+	if !wb.closed {
+		wb.closed = true
+		close(wb.queue)
+	}
+	wb.sendMu.Unlock()
+	<-wb.done
+}
+
+// flush waits for the writes queued until now to be applied to the backend.
+func (b *backing) flush() {
+	if b.behind == nil {
+		return
+	}
+	flushed := make(chan struct{})
+	if b.behind.send(queuedWrite{flushed: flushed}) {
+		<-flushed
+	}
+}
+
+// send queues q, blocking while the queue is full, unless it's closed, which
+// send reports by returning false.
+func (wb *writeBehind) send(q queuedWrite) bool {
+	wb.sendMu.RLock()
+	defer wb.sendMu.RUnlock()
+	if wb.closed {
+		return false
+	}
+	if q.flushed == nil {
+		wb.mu.Lock()
+		wb.pending[q.w.Key]++
+		wb.mu.Unlock()
+	}
+	wb.queue <- q
+	return true
+}
+
+// isPending reports whether writes of key are queued.
+func (wb *writeBehind) isPending(key KeyT) bool {
+	wb.mu.Lock()
+	defer wb.mu.Unlock()
+	return wb.pending[key] > 0
+}
+
+// writeBehind applies the writes queued to wb in batches, until its queue is
+// closed and drained.
+func (b *backing) writeBehind(wb *writeBehind) {
+	defer close(wb.done)
+	batch := make([]queuedWrite, 0, wb.batch)
+	for q := range wb.queue {
+		batch = append(batch[:0], q)
+	fill:
+		for len(batch) < wb.batch {
+			select {
+			case q, ok := <-wb.queue:
+				if !ok {
+					break fill
+				}
+				batch = append(batch, q)
+			default:
+				break fill
+			}
+		}
+		b.apply(wb, batch)
+	}
+}
+
+// apply applies the last write of each key of batch to the backend, and
+// reports their results.
+func (b *backing) apply(wb *writeBehind, batch []queuedWrite) {
+	last := make(map[KeyT]int, len(batch))
+	var writes []Write
+	for _, q := range batch {
+		if q.flushed != nil {
+			continue
+		}
+		if i, ok := last[q.w.Key]; ok {
+			writes[i] = q.w
+			continue
+		}
+		last[q.w.Key] = len(writes)
+		writes = append(writes, q.w)
+	}
+
+	errs := make(map[KeyT]error)
+	ctx := context.Background()
+	if bw, ok := b.b.(BatchWriter); ok && len(writes) > 0 {
+		if err := bw.WriteBatch(ctx, writes); err != nil {
+			for _, w := range writes {
+				errs[w.Key] = err
+			}
+		}
+	} else {
+		for _, w := range writes {
+			if err := b.write(ctx, w); err != nil {
+				errs[w.Key] = err
+			}
+		}
+	}
+
+	wb.mu.Lock()
+	for _, q := range batch {
+		if q.flushed == nil {
+			if wb.pending[q.w.Key]--; wb.pending[q.w.Key] == 0 {
+				delete(wb.pending, q.w.Key)
+			}
+		}
+	}
+	wb.mu.Unlock()
+
+	var reported map[KeyT]bool
+	for _, q := range batch {
+		switch {
+		case q.flushed != nil:
+			close(q.flushed)
+		case q.result != nil:
+			q.result <- errs[q.w.Key]
+		default:
+			// Report the error of each key once.
+			if err := errs[q.w.Key]; err != nil && !reported[q.w.Key] {
+				if reported == nil {
+					reported = make(map[KeyT]bool)
+				}
+				reported[q.w.Key] = true
+				b.failed(q.w.Key, err)
+			}
+		}
+	}
+}
@@ -0,0 +1,37 @@
+// Package syncmaptest provides the interface of the maps go-gen-syncmap
+// generates and reference implementations of it, so that applications can
+// write their own tests and benchmarks against a generated map and swap
+// implementations behind the interface.
+//
+// A generated map implements Map for its key and value types:
+//
+//	var _ syncmaptest.Map[UserID, *User] = (*UserCache)(nil)
+//
+// or Core if it is generated without the methods comparing values.
+package syncmaptest
+
+// Core is the API every implementation of the generator shares.
+type Core[K comparable, V any] interface {
+	Load(key K) (value V, ok bool)
+	Store(key K, value V)
+	LoadOrStore(key K, value V) (actual V, loaded bool)
+	Delete(key K)
+	Swap(key K, value V) (previous V, loaded bool)
+	Len() int
+	Clear()
+	Range(f func(key K, value V) (shouldContinue bool))
+}
+
+// Map is Core and the methods comparing values with ==, which generated maps
+// have unless they are generated with -nocompare.
+type Map[K comparable, V any] interface {
+	Core[K, V]
+	CompareAndSwap(key K, old, new V) (swapped bool)
+	CompareAndDelete(key K, old V) (deleted bool)
+}
+
+// equal reports whether a and b are equal, panicking if their type isn't
+// comparable, like the maps generated for such values do.
+func equal[V any](a, b V) bool {
+	return any(a) == any(b)
+}
@@ -0,0 +1,78 @@
+package syncmaptest_test
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/cristaloleg/go-gen-syncmap/generic"
+	"github.com/cristaloleg/go-gen-syncmap/syncmap"
+	"github.com/cristaloleg/go-gen-syncmap/syncmap/cow"
+	"github.com/cristaloleg/go-gen-syncmap/syncmap/ctrie"
+	"github.com/cristaloleg/go-gen-syncmap/syncmap/robinhood"
+	"github.com/cristaloleg/go-gen-syncmap/syncmap/rwmutex"
+	"github.com/cristaloleg/go-gen-syncmap/syncmap/sharded"
+	"github.com/cristaloleg/go-gen-syncmap/syncmap/striped"
+	"github.com/cristaloleg/go-gen-syncmap/syncmap/swiss"
+	"github.com/cristaloleg/go-gen-syncmap/syncmaptest"
+)
+
+// The template packages, the generic package, and the references implement
+// Map.
+var (
+	_ syncmaptest.Map[syncmap.KeyT, syncmap.ValueT]     = (*syncmap.Map)(nil)
+	_ syncmaptest.Map[rwmutex.KeyT, rwmutex.ValueT]     = (*rwmutex.Map)(nil)
+	_ syncmaptest.Map[sharded.KeyT, sharded.ValueT]     = (*sharded.Map)(nil)
+	_ syncmaptest.Map[striped.KeyT, striped.ValueT]     = (*striped.Map)(nil)
+	_ syncmaptest.Map[cow.KeyT, cow.ValueT]             = (*cow.Map)(nil)
+	_ syncmaptest.Map[ctrie.KeyT, ctrie.ValueT]         = (*ctrie.Map)(nil)
+	_ syncmaptest.Map[robinhood.KeyT, robinhood.ValueT] = (*robinhood.Map)(nil)
+	_ syncmaptest.Map[swiss.KeyT, swiss.ValueT]         = (*swiss.Map)(nil)
+	_ syncmaptest.Map[string, []byte]                   = (*generic.Map[string, []byte])(nil)
+	_ syncmaptest.Map[string, []byte]                   = (*syncmaptest.RWMutexMap[string, []byte])(nil)
+	_ syncmaptest.Map[string, []byte]                   = (*syncmaptest.DeepCopyMap[string, []byte])(nil)
+)
+
+func TestReferences(t *testing.T) {
+	for _, m := range []syncmaptest.Map[string, int]{
+		new(syncmaptest.RWMutexMap[string, int]),
+		new(syncmaptest.DeepCopyMap[string, int]),
+	} {
+		m.Store("a", 1)
+		if v, loaded := m.LoadOrStore("a", 2); !loaded || v != 1 {
+			t.Errorf("%T: LoadOrStore(a, 2) = %v, %v; want 1, true", m, v, loaded)
+		}
+		if !m.CompareAndSwap("a", 1, 3) || m.CompareAndSwap("a", 1, 4) {
+			t.Errorf("%T: CompareAndSwap doesn't compare the current value", m)
+		}
+		if prev, loaded := m.Swap("b", 5); loaded {
+			t.Errorf("%T: Swap(b, 5) = %v, true; want a miss", m, prev)
+		}
+		if !m.CompareAndDelete("b", 5) {
+			t.Errorf("%T: CompareAndDelete(b, 5) = false", m)
+		}
+		got := make(map[string]int)
+		m.Range(func(k string, v int) bool {
+			got[k] = v
+			return true
+		})
+		if want := map[string]int{"a": 3}; !reflect.DeepEqual(got, want) || m.Len() != len(want) {
+			t.Errorf("%T: holds %v (Len %d); want %v", m, got, m.Len(), want)
+		}
+		m.Delete("a")
+		m.Clear()
+		if n := m.Len(); n != 0 {
+			t.Errorf("%T: Len() = %d after Clear", m, n)
+		}
+	}
+}
+
+func TestCompareIncomparable(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Error("CompareAndSwap of slices didn't panic")
+		}
+	}()
+	var m syncmaptest.RWMutexMap[string, []byte]
+	m.Store("a", nil)
+	m.CompareAndSwap("a", nil, []byte("b"))
+}
@@ -0,0 +1,11 @@
+// Package templates embeds the template packages of go-gen-syncmap, so that
+// the generator needn't locate their source when it runs.
+package templates
+
+import "embed"
+
+// FS holds the syncmap template package and its subpackages, in the
+// directory syncmap.
+//
+//go:embed syncmap
+var FS embed.FS